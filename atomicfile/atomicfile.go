@@ -0,0 +1,98 @@
+// Package atomicfile replaces files atomically and durably: after
+// a crash the file has either its old or its new contents.
+//
+// The data is written to a temporary file in the same directory,
+// which is then renamed to the target name. A crash may leave the
+// temporary file behind; IsTemp recognizes such files.
+package atomicfile
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const tmpInfix = ".tmp"
+
+// File is a temporary file replacing the target file on Commit.
+type File struct {
+	*os.File
+	fname string
+}
+
+// Create creates a temporary file which replaces fname on Commit.
+func Create(fname string) (*File, error) {
+	f, err := ioutil.TempFile(filepath.Dir(fname), filepath.Base(fname)+tmpInfix)
+	if err != nil {
+		return nil, fmt.Errorf("ioutil.TempFile: %v", err)
+	}
+	return &File{File: f, fname: fname}, nil
+}
+
+// Commit syncs and closes the temporary file and renames it to
+// the target name. The file is removed if Commit fails.
+func (f *File) Commit() error {
+	if err := f.Sync(); err != nil {
+		f.Abort()
+		return fmt.Errorf("Sync(%q): %v", f.Name(), err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("Close(%q): %v", f.Name(), err)
+	}
+	if err := os.Rename(f.Name(), f.fname); err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("os.Rename(%q, %q): %v", f.Name(), f.fname, err)
+	}
+	dir := filepath.Dir(f.fname)
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("os.Open(%q): %v", dir, err)
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("Sync(%q): %v", dir, err)
+	}
+	return nil
+}
+
+// Abort closes and removes the temporary file.
+// The target file is not changed.
+func (f *File) Abort() error {
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// WriteFile replaces the file with data.
+func WriteFile(fname string, data []byte) error {
+	f, err := Create(fname)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Abort()
+		return fmt.Errorf("Write(%q): %v", f.Name(), err)
+	}
+	return f.Commit()
+}
+
+// IsTemp reports whether the base name of a file is a name of
+// a temporary file of this package, e.g. left by a crash.
+func IsTemp(name string) bool {
+	i := strings.LastIndex(name, tmpInfix)
+	if i == -1 {
+		return false
+	}
+	suffix := name[i+len(tmpInfix):]
+	if suffix == "" {
+		return false
+	}
+	for _, c := range suffix {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
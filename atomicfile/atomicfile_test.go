@@ -0,0 +1,62 @@
+package atomicfile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "atomicfile")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	fname := filepath.Join(dir, "db")
+	for _, data := range []string{"first", "second"} {
+		if err := WriteFile(fname, []byte(data)); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+		got, err := ioutil.ReadFile(fname)
+		if err != nil {
+			t.Fatalf("ioutil.ReadFile: %v", err)
+		}
+		if string(got) != data {
+			t.Errorf("file contains %q, want %q", got, data)
+		}
+	}
+	// An aborted write leaves the old contents and no temporary file.
+	f, err := Create(fname)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if !IsTemp(filepath.Base(f.Name())) {
+		t.Errorf("IsTemp(%q) = false", f.Name())
+	}
+	if _, err := f.Write([]byte("third")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := f.Abort(); err != nil {
+		t.Fatalf("Abort: %v", err)
+	}
+	got, err := ioutil.ReadFile(fname)
+	if err != nil {
+		t.Fatalf("ioutil.ReadFile: %v", err)
+	}
+	if string(got) != "second" {
+		t.Errorf("file contains %q after Abort, want %q", got, "second")
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ioutil.ReadDir: %v", err)
+	}
+	if len(files) != 1 {
+		t.Errorf("%d files in the directory, want 1", len(files))
+	}
+	for _, name := range []string{"db", "db.tmp", "db.tmpx1", "db.contract"} {
+		if IsTemp(name) {
+			t.Errorf("IsTemp(%q) = true", name)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package client
+
+import (
+	"crypto/rand"
+	"fmt"
+	"log"
+	"math/big"
+	"time"
+
+	"golang.org/x/net/context"
+
+	fpb "github.com/starius/invisiblefs/freestore/proto"
+	"github.com/starius/invisiblefs/freestore/verifier"
+	"github.com/starius/invisiblefs/merkle"
+)
+
+// Reporter receives results of audits. manager.Manager implements it.
+type Reporter interface {
+	ReportAudit(contractID string, err error)
+}
+
+// maxChallengeSectors is the number of distinct sectors in
+// a challenge accepted by hosts (see ChallengeRequest).
+const maxChallengeSectors = 16
+
+func randInt(n int64) (int64, error) {
+	i, err := rand.Int(rand.Reader, big.NewInt(n))
+	if err != nil {
+		return 0, fmt.Errorf("rand.Int: %v", err)
+	}
+	return i.Int64(), nil
+}
+
+// Challenge asks the host to prove that it stores n random segments
+// of the contract. The proofs are checked against the latest state
+// signed by the host. Contracts without sectors always pass.
+func (c *Client) Challenge(ctx context.Context, contractID string, n int) error {
+	ct, err := c.get(contractID)
+	if err != nil {
+		return err
+	}
+	// The contract must not change until the proofs are checked.
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	st := ct.latest.State
+	if len(st.SectorIds) == 0 {
+		return nil
+	}
+	segments := merkle.Segments(int(st.SectorSize))
+	req := &fpb.ChallengeRequest{Id: ct.id}
+	// The host proves segments of a limited number of sectors.
+	var sectors []int64
+	for i := 0; i < n; i++ {
+		var sector int64
+		if len(sectors) < maxChallengeSectors {
+			sector, err = randInt(int64(len(st.SectorIds)))
+			if err != nil {
+				return err
+			}
+			sectors = append(sectors, sector)
+		} else {
+			j, err := randInt(int64(len(sectors)))
+			if err != nil {
+				return err
+			}
+			sector = sectors[j]
+		}
+		segment, err := randInt(int64(segments))
+		if err != nil {
+			return err
+		}
+		req.Segments = append(req.Segments, &fpb.SegmentRef{
+			Sector:  sector,
+			Segment: int32(segment),
+		})
+	}
+	ctx, cancel := context.WithTimeout(ctx, rpcTimeout)
+	defer cancel()
+	client, err := c.rpc(ctx, ct.host)
+	if err != nil {
+		return err
+	}
+	res, err := client.Challenge(ctx, req)
+	if err != nil {
+		return fmt.Errorf("Challenge: %v", err)
+	}
+	if err := verifier.Challenge(req, res, st); err != nil {
+		return fmt.Errorf("verifier.Challenge: %v", err)
+	}
+	return nil
+}
+
+// Auditor challenges all contracts of the client and reports
+// the results.
+type Auditor struct {
+	client   *Client
+	reporter Reporter
+	segments int
+
+	stopChan chan struct{}
+	finChan  chan struct{}
+}
+
+// NewAuditor creates an auditor asking for segments random segments
+// of each contract.
+func NewAuditor(c *Client, reporter Reporter, segments int) *Auditor {
+	return &Auditor{
+		client:   c,
+		reporter: reporter,
+		segments: segments,
+	}
+}
+
+// Audit challenges all contracts once. It returns the last failure.
+func (a *Auditor) Audit(ctx context.Context) error {
+	contracts, err := a.client.Contracts(ctx)
+	if err != nil {
+		return err
+	}
+	var lastErr error
+	for _, contractID := range contracts {
+		err := a.client.Challenge(ctx, contractID, a.segments)
+		a.reporter.ReportAudit(contractID, err)
+		if err != nil {
+			lastErr = fmt.Errorf("Challenge(%s): %v", contractID, err)
+			log.Printf("Audit failed: %v.", lastErr)
+		}
+	}
+	return lastErr
+}
+
+// Start calls Audit every interval in background.
+func (a *Auditor) Start(interval time.Duration) error {
+	a.stopChan = make(chan struct{})
+	a.finChan = make(chan struct{})
+	go func() {
+		defer close(a.finChan)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-a.stopChan:
+				return
+			case <-ticker.C:
+				a.Audit(context.Background())
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop stops the background task started by Start.
+func (a *Auditor) Stop() error {
+	close(a.stopChan)
+	<-a.finChan
+	return nil
+}
@@ -0,0 +1,511 @@
+// Package client stores sectors on freestore hosts.
+//
+// Client implements manager.SiaClient. Contract IDs are hex encoded IDs
+// of freestore contracts, sector roots are hex encoded Merkle roots of
+// sectors. Sectors are appended to contracts and removed by moving the
+// last sector to their place, so a sector root is mapped to the index
+// of the sector through the latest contract state.
+package client
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/starius/invisiblefs/atomicfile"
+	"github.com/starius/invisiblefs/freestore/clientdb"
+	"github.com/starius/invisiblefs/freestore/discovery"
+	fpb "github.com/starius/invisiblefs/freestore/proto"
+	"github.com/starius/invisiblefs/freestore/sign"
+	"github.com/starius/invisiblefs/freestore/state"
+	"github.com/starius/invisiblefs/freestore/verifier"
+	"github.com/starius/invisiblefs/merkle"
+	"github.com/starius/invisiblefs/pubkey"
+)
+
+const rpcTimeout = time.Minute
+
+type contract struct {
+	id     []byte
+	host   *fpb.Peer
+	latest *fpb.SignedState
+	mu     sync.Mutex // Changes of the contract are sequential.
+}
+
+type Client struct {
+	file       string
+	priv, cert []byte
+
+	db        *clientdb.Db
+	contracts map[string]*contract
+	conns     map[string]*grpc.ClientConn // Key is pubkey of the host.
+	mu        sync.Mutex
+
+	stopChan chan struct{}
+	finChan  chan struct{}
+
+	now func() time.Time
+}
+
+// Open opens the client storing its database in file.
+// priv and cert are the key and the certificate of the client.
+func Open(file string, priv, cert []byte) (*Client, error) {
+	c := &Client{
+		file:      file,
+		priv:      priv,
+		cert:      cert,
+		db:        &clientdb.Db{Contracts: make(map[string]*clientdb.Contract)},
+		contracts: make(map[string]*contract),
+		conns:     make(map[string]*grpc.ClientConn),
+		now:       time.Now,
+	}
+	dump, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return c, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("ioutil.ReadFile(%q): %v", file, err)
+	}
+	if err := proto.Unmarshal(dump, c.db); err != nil {
+		return nil, fmt.Errorf("proto.Unmarshal(%q): %v", file, err)
+	}
+	if c.db.Contracts == nil {
+		c.db.Contracts = make(map[string]*clientdb.Contract)
+	}
+	for contractID, db := range c.db.Contracts {
+		latest := &fpb.SignedState{}
+		if err := proto.Unmarshal(db.Latest, latest); err != nil {
+			return nil, fmt.Errorf("proto.Unmarshal(latest of %s): %v", contractID, err)
+		}
+		if latest.State == nil {
+			return nil, fmt.Errorf("no state of contract %s", contractID)
+		}
+		c.contracts[contractID] = &contract{
+			id: latest.State.Id,
+			host: &fpb.Peer{
+				Pubkey:  db.HostPubkey,
+				Address: db.HostAddress,
+			},
+			latest: latest,
+		}
+	}
+	return c, nil
+}
+
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, conn := range c.conns {
+		if err := conn.Close(); err != nil {
+			return err
+		}
+		delete(c.conns, key)
+	}
+	return nil
+}
+
+// save writes the database atomically. Run under c.mu.Lock().
+func (c *Client) save() error {
+	dump, err := proto.Marshal(c.db)
+	if err != nil {
+		return fmt.Errorf("proto.Marshal: %v", err)
+	}
+	// It keeps the latest revisions signed by hosts, so it must
+	// reach the disk.
+	if err := atomicfile.WriteFile(c.file, dump); err != nil {
+		return fmt.Errorf("atomicfile.WriteFile(%q): %v", c.file, err)
+	}
+	return nil
+}
+
+// setLatest replaces the latest state of the contract and saves it.
+// Run under ct.mu.Lock().
+func (c *Client) setLatest(ct *contract, latest *fpb.SignedState) error {
+	dump, err := proto.Marshal(latest)
+	if err != nil {
+		return fmt.Errorf("proto.Marshal: %v", err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	contractID := hex.EncodeToString(ct.id)
+	db, has := c.db.Contracts[contractID]
+	if !has {
+		db = &clientdb.Contract{
+			HostPubkey:  ct.host.Pubkey,
+			HostAddress: ct.host.Address,
+		}
+		c.db.Contracts[contractID] = db
+		c.contracts[contractID] = ct
+	}
+	db.Latest = dump
+	ct.latest = latest
+	return c.save()
+}
+
+func (c *Client) conn(ctx context.Context, host *fpb.Peer) (*grpc.ClientConn, error) {
+	c.mu.Lock()
+	conn, has := c.conns[string(host.Pubkey)]
+	c.mu.Unlock()
+	if has {
+		return conn, nil
+	}
+	conn, err := discovery.Dial(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if other, has := c.conns[string(host.Pubkey)]; has {
+		conn.Close()
+		return other, nil
+	}
+	c.conns[string(host.Pubkey)] = conn
+	return conn, nil
+}
+
+func (c *Client) rpc(ctx context.Context, host *fpb.Peer) (fpb.FreestoreClient, error) {
+	conn, err := c.conn(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	return fpb.NewFreestoreClient(conn), nil
+}
+
+func (c *Client) get(contractID string) (*contract, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ct, has := c.contracts[contractID]
+	if !has {
+		return nil, fmt.Errorf("no such contract: %s", contractID)
+	}
+	return ct, nil
+}
+
+// expired returns true if the contract has expired. Run under ct.mu.Lock().
+func (c *Client) expired(ct *contract) bool {
+	expires, err := ptypes.Timestamp(ct.latest.State.Expires)
+	return err != nil || !c.now().Before(expires)
+}
+
+// MakeContract makes a contract with the host and returns its ID.
+func (c *Client) MakeContract(ctx context.Context, host *fpb.Peer, sectorSize, days int32) (string, error) {
+	client, err := c.rpc(ctx, host)
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(ctx, rpcTimeout)
+	defer cancel()
+	res, err := client.MakeContract(ctx, &fpb.MakeContractRequest{
+		SectorSize:   sectorSize,
+		ClientPubkey: c.cert,
+		DaysNum:      days,
+	})
+	if err != nil {
+		return "", fmt.Errorf("MakeContract: %v", err)
+	}
+	if res.State == nil {
+		return "", fmt.Errorf("no state of the new contract")
+	}
+	if err := verifier.CheckState(host.Pubkey, c.cert, res.State); err != nil {
+		return "", fmt.Errorf("verifier.CheckState: %v", err)
+	}
+	st := res.State.State
+	if !bytes.Equal(st.Id, res.Id) || st.Revision != 0 || st.SectorSize != sectorSize || len(st.SectorIds) != 0 {
+		return "", fmt.Errorf("bad state of the new contract: %v", st)
+	}
+	ct := &contract{
+		id:   res.Id,
+		host: host,
+	}
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	if err := c.setLatest(ct, res.State); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(res.Id), nil
+}
+
+// Contracts returns the IDs of contracts which have not expired.
+func (c *Client) Contracts(ctx context.Context) ([]string, error) {
+	c.mu.Lock()
+	var all []*contract
+	for _, ct := range c.contracts {
+		all = append(all, ct)
+	}
+	c.mu.Unlock()
+	var contracts []string
+	for _, ct := range all {
+		ct.mu.Lock()
+		if !c.expired(ct) {
+			contracts = append(contracts, hex.EncodeToString(ct.id))
+		}
+		ct.mu.Unlock()
+	}
+	sort.Strings(contracts)
+	return contracts, nil
+}
+
+// Hosts returns the hosts having contracts which have not expired.
+func (c *Client) Hosts() ([]*fpb.Peer, error) {
+	contracts, err := c.Contracts(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	var hosts []*fpb.Peer
+	for _, contractID := range contracts {
+		ct, err := c.get(contractID)
+		if err != nil {
+			return nil, err
+		}
+		hosts = append(hosts, ct.host)
+	}
+	return hosts, nil
+}
+
+func (c *Client) Read(ctx context.Context, contractID, sectorRoot string, sectorID int64) ([]byte, error) {
+	return c.ReadAt(ctx, contractID, sectorRoot, sectorID, 0, -1)
+}
+
+// ReadAt reads length bytes of the sector starting from offset.
+// The range is checked against the sector root. Negative length
+// means the whole sector.
+func (c *Client) ReadAt(ctx context.Context, contractID, sectorRoot string, sectorID int64, offset, length int) ([]byte, error) {
+	root, err := hex.DecodeString(sectorRoot)
+	if err != nil {
+		return nil, fmt.Errorf("bad sector root %q: %v", sectorRoot, err)
+	}
+	ct, err := c.get(contractID)
+	if err != nil {
+		return nil, err
+	}
+	// The sector is looked up and read under the lock, so Delete
+	// can not move it in between.
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	st := ct.latest.State
+	sector := int64(-1)
+	for i, id := range st.SectorIds {
+		if bytes.Equal(id, root) {
+			sector = int64(i)
+			break
+		}
+	}
+	if sector == -1 {
+		return nil, fmt.Errorf("no sector %s in contract %s", sectorRoot, contractID)
+	}
+	ctx, cancel := context.WithTimeout(ctx, rpcTimeout)
+	defer cancel()
+	client, err := c.rpc(ctx, ct.host)
+	if err != nil {
+		return nil, err
+	}
+	if length < 0 {
+		length = int(st.SectorSize)
+	}
+	req := &fpb.ReadSectorRequest{
+		Id:          ct.id,
+		Sector:      sector,
+		Offset:      int32(offset),
+		Size:        int32(length),
+		ProofNeeded: true,
+	}
+	res, err := client.ReadSector(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("ReadSector: %v", err)
+	}
+	if err := verifier.ReadSector(req, res, st.SectorSize, root); err != nil {
+		return nil, fmt.Errorf("verifier.ReadSector: %v", err)
+	}
+	return res.Data, nil
+}
+
+func (c *Client) Write(ctx context.Context, contractID string, data []byte, sectorID int64) (string, error) {
+	ct, err := c.get(contractID)
+	if err != nil {
+		return "", err
+	}
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	st := ct.latest.State
+	if len(data) == 0 || len(data) > int(st.SectorSize) {
+		return "", fmt.Errorf("len(data) is %d, sector size is %d", len(data), st.SectorSize)
+	}
+	// The host appends the sector filled with zeros.
+	sector := make([]byte, st.SectorSize)
+	copy(sector, data)
+	root := merkle.Root(sector)
+	i := int64(len(st.SectorIds))
+	newState, err := state.Write(st, i, root)
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(ctx, rpcTimeout)
+	defer cancel()
+	err = c.update(ctx, ct, newState, func(client fpb.FreestoreClient, signature []byte) ([]byte, error) {
+		res, err := client.WriteSector(ctx, &fpb.WriteSectorRequest{
+			Id:        ct.id,
+			Sector:    i,
+			Length:    int32(len(data)),
+			Data:      data,
+			NewState:  newState,
+			Signature: signature,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("WriteSector: %v", err)
+		}
+		return res.HostSignature, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(root), nil
+}
+
+// Delete removes the sector from the contract: the last sector is moved
+// to its place and the contract is shrunk. Implements manager.Deleter.
+func (c *Client) Delete(ctx context.Context, contractID, sectorRoot string) error {
+	root, err := hex.DecodeString(sectorRoot)
+	if err != nil {
+		return fmt.Errorf("bad sector root %q: %v", sectorRoot, err)
+	}
+	ct, err := c.get(contractID)
+	if err != nil {
+		return err
+	}
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	st := ct.latest.State
+	sector := int64(-1)
+	for i, id := range st.SectorIds {
+		if bytes.Equal(id, root) {
+			sector = int64(i)
+			break
+		}
+	}
+	if sector == -1 {
+		// Already deleted.
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, rpcTimeout)
+	defer cancel()
+	last := int64(len(st.SectorIds)) - 1
+	if sector != last {
+		ordering := make([]int64, len(st.SectorIds))
+		for i := range ordering {
+			ordering[i] = int64(i)
+		}
+		ordering[sector], ordering[last] = last, sector
+		newState, err := state.Reorder(st, ordering)
+		if err != nil {
+			return err
+		}
+		err = c.update(ctx, ct, newState, func(client fpb.FreestoreClient, signature []byte) ([]byte, error) {
+			res, err := client.Reorder(ctx, &fpb.ReorderRequest{
+				Id:        ct.id,
+				Ordering:  ordering,
+				NewState:  newState,
+				Signature: signature,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("Reorder: %v", err)
+			}
+			return res.HostSignature, nil
+		})
+		if err != nil {
+			return err
+		}
+		st = ct.latest.State
+	}
+	newState, err := state.Shrink(st, last)
+	if err != nil {
+		return err
+	}
+	return c.update(ctx, ct, newState, func(client fpb.FreestoreClient, signature []byte) ([]byte, error) {
+		res, err := client.Shrink(ctx, &fpb.ShrinkRequest{
+			Id:         ct.id,
+			NumSectors: last,
+			NewState:   newState,
+			Signature:  signature,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("Shrink: %v", err)
+		}
+		return res.HostSignature, nil
+	})
+}
+
+// update signs newState, sends it to the host using send and saves it
+// with the signature of the host returned by send. If the host has
+// another state, the client synchronizes with it. Run under ct.mu.Lock().
+func (c *Client) update(ctx context.Context, ct *contract, newState *fpb.ContractState, send func(client fpb.FreestoreClient, signature []byte) ([]byte, error)) error {
+	signature, err := pubkey.Sign(c.priv, sign.State(newState))
+	if err != nil {
+		return fmt.Errorf("pubkey.Sign: %v", err)
+	}
+	client, err := c.rpc(ctx, ct.host)
+	if err != nil {
+		return err
+	}
+	hostSignature, sendErr := send(client, signature)
+	if sendErr != nil {
+		if status.Code(sendErr) == codes.FailedPrecondition {
+			if err := c.sync(ctx, ct, client); err != nil {
+				log.Printf("Failed to synchronize contract %x: %v.", ct.id, err)
+			}
+		}
+		return sendErr
+	}
+	signed := &fpb.SignedState{
+		State:           newState,
+		HostSignature:   hostSignature,
+		ClientSignature: signature,
+	}
+	if err := verifier.CheckState(ct.host.Pubkey, c.cert, signed); err != nil {
+		return fmt.Errorf("verifier.CheckState: %v", err)
+	}
+	return c.setLatest(ct, signed)
+}
+
+// sync adopts the state of the host if it is newer than the latest
+// known state and is signed by the client and the host. This happens
+// if a response of the host was lost. Run under ct.mu.Lock().
+func (c *Client) sync(ctx context.Context, ct *contract, client fpb.FreestoreClient) error {
+	res, err := client.ContractMetadata(ctx, &fpb.ContractMetadataRequest{
+		Id:    ct.id,
+		Nonce: sign.Digest(ct.latest),
+	})
+	if err != nil {
+		return fmt.Errorf("ContractMetadata: %v", err)
+	}
+	evidence, err := verifier.CheckMetadata(ct.host.Pubkey, c.cert, ct.latest, res)
+	if evidence != nil {
+		log.Printf("Host %s rolled back contract %x: %v.", ct.host.Address, ct.id, evidence)
+	}
+	if err != nil {
+		return err
+	}
+	if res.State.Revision <= ct.latest.State.Revision {
+		return nil
+	}
+	signed := &fpb.SignedState{
+		State:           res.State,
+		HostSignature:   res.HostSignature,
+		ClientSignature: res.ClientSignature,
+	}
+	if err := verifier.CheckState(ct.host.Pubkey, c.cert, signed); err != nil {
+		return fmt.Errorf("verifier.CheckState: %v", err)
+	}
+	return c.setLatest(ct, signed)
+}
@@ -0,0 +1,445 @@
+package client
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+
+	fpb "github.com/starius/invisiblefs/freestore/proto"
+	"github.com/starius/invisiblefs/freestore/server"
+	"github.com/starius/invisiblefs/freestore/verifier"
+	"github.com/starius/invisiblefs/pubkey"
+	"github.com/starius/invisiblefs/siaform/manager"
+)
+
+const testSectorSize = 4096
+
+var (
+	_ manager.SiaClient = (*Client)(nil)
+	_ manager.Deleter   = (*Client)(nil)
+)
+
+type testHost struct {
+	peer       *fpb.Peer
+	server     *server.Server
+	grpcServer *grpc.Server
+	wg         sync.WaitGroup
+}
+
+func startHost(t *testing.T, dir string) *testHost {
+	priv, err := pubkey.GeneratePriv(rand.Reader)
+	if err != nil {
+		t.Fatalf("pubkey.GeneratePriv: %v", err)
+	}
+	cert, err := pubkey.Cert(priv, rand.Reader)
+	if err != nil {
+		t.Fatalf("pubkey.Cert: %v", err)
+	}
+	creds, err := pubkey.ServerCreds(priv, cert)
+	if err != nil {
+		t.Fatalf("pubkey.ServerCreds: %v", err)
+	}
+	h := &testHost{
+		grpcServer: grpc.NewServer(grpc.Creds(creds)),
+	}
+	h.server, err = server.NewServer(dir, priv, server.Limits{})
+	if err != nil {
+		t.Fatalf("server.NewServer: %v", err)
+	}
+	fpb.RegisterFreestoreServer(h.grpcServer, h.server)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen: %v", err)
+	}
+	h.peer = &fpb.Peer{
+		Pubkey:  cert,
+		Address: listener.Addr().String(),
+	}
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+		h.grpcServer.Serve(listener)
+	}()
+	return h
+}
+
+func (h *testHost) stop() {
+	h.grpcServer.Stop()
+	h.wg.Wait()
+	h.server.Close()
+}
+
+func TestClient(t *testing.T) {
+	dir, err := ioutil.TempDir("", "freestore-client")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	hostDir := filepath.Join(dir, "host")
+	clientDir := filepath.Join(dir, "client")
+	if err := os.Mkdir(clientDir, 0700); err != nil {
+		t.Fatalf("os.Mkdir: %v", err)
+	}
+	h := startHost(t, hostDir)
+	defer h.stop()
+	c, err := OpenDir(clientDir)
+	if err != nil {
+		t.Fatalf("OpenDir: %v", err)
+	}
+	ctx := context.Background()
+	seeds := []*fpb.Peer{h.peer}
+	if err := c.EnsureContracts(ctx, seeds, 1, testSectorSize, 10); err != nil {
+		t.Fatalf("EnsureContracts: %v", err)
+	}
+	if err := c.EnsureContracts(ctx, seeds, 2, testSectorSize, 10); err == nil {
+		t.Errorf("EnsureContracts made two contracts with one host")
+	}
+	contracts, err := c.Contracts(ctx)
+	if err != nil || len(contracts) != 1 {
+		t.Fatalf("Contracts returned %v, %v", contracts, err)
+	}
+	contract := contracts[0]
+	data1 := bytes.Repeat([]byte{1}, testSectorSize)
+	root1, err := c.Write(ctx, contract, data1, 1)
+	if err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	data2 := []byte("short sector")
+	root2, err := c.Write(ctx, contract, data2, 2)
+	if err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if data, err := c.Read(ctx, contract, root1, 1); err != nil || !bytes.Equal(data, data1) {
+		t.Errorf("Read(sector 1) returned wrong data, %v", err)
+	}
+	want2 := make([]byte, testSectorSize)
+	copy(want2, data2)
+	if data, err := c.Read(ctx, contract, root2, 2); err != nil || !bytes.Equal(data, want2) {
+		t.Errorf("Read(sector 2) returned wrong data, %v", err)
+	}
+	if _, err := c.Read(ctx, contract, "00", 3); err == nil {
+		t.Errorf("Read of unknown sector succeeded")
+	}
+	if data, err := c.ReadAt(ctx, contract, root2, 2, 6, 6); err != nil || string(data) != "sector" {
+		t.Errorf("ReadAt(sector 2) returned %q, %v", data, err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	// The client continues from the saved state.
+	c, err = OpenDir(clientDir)
+	if err != nil {
+		t.Fatalf("OpenDir: %v", err)
+	}
+	defer c.Close()
+	if err := c.EnsureContracts(ctx, nil, 1, testSectorSize, 10); err != nil {
+		t.Fatalf("EnsureContracts: %v", err)
+	}
+	data3 := bytes.Repeat([]byte{3}, testSectorSize)
+	root3, err := c.Write(ctx, contract, data3, 3)
+	if err != nil {
+		t.Fatalf("Write after reopening: %v", err)
+	}
+	for _, s := range []struct {
+		root string
+		data []byte
+	}{
+		{root1, data1},
+		{root3, data3},
+	} {
+		if data, err := c.Read(ctx, contract, s.root, 0); err != nil || !bytes.Equal(data, s.data) {
+			t.Errorf("Read(%s) after reopening returned wrong data, %v", s.root, err)
+		}
+	}
+}
+
+func TestDelete(t *testing.T) {
+	dir, err := ioutil.TempDir("", "freestore-client")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	h := startHost(t, filepath.Join(dir, "host"))
+	defer h.stop()
+	c, err := OpenDir(dir)
+	if err != nil {
+		t.Fatalf("OpenDir: %v", err)
+	}
+	defer c.Close()
+	ctx := context.Background()
+	if err := c.EnsureContracts(ctx, []*fpb.Peer{h.peer}, 1, testSectorSize, 10); err != nil {
+		t.Fatalf("EnsureContracts: %v", err)
+	}
+	contracts, err := c.Contracts(ctx)
+	if err != nil || len(contracts) != 1 {
+		t.Fatalf("Contracts returned %v, %v", contracts, err)
+	}
+	contract := contracts[0]
+	var roots []string
+	for b := byte(1); b <= 3; b++ {
+		root, err := c.Write(ctx, contract, bytes.Repeat([]byte{b}, testSectorSize), int64(b))
+		if err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+		roots = append(roots, root)
+	}
+	// Sector 3 is moved to the place of sector 1.
+	if err := c.Delete(ctx, contract, roots[0]); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := c.Delete(ctx, contract, roots[0]); err != nil {
+		t.Errorf("second Delete: %v", err)
+	}
+	if _, err := c.Read(ctx, contract, roots[0], 1); err == nil {
+		t.Errorf("Read of deleted sector succeeded")
+	}
+	for i, b := range []byte{2, 3} {
+		data, err := c.Read(ctx, contract, roots[i+1], int64(b))
+		if err != nil || !bytes.Equal(data, bytes.Repeat([]byte{b}, testSectorSize)) {
+			t.Errorf("Read(sector %d) after Delete returned wrong data, %v", b, err)
+		}
+	}
+	ct, _ := c.get(contract)
+	if n := len(ct.latest.State.SectorIds); n != 2 {
+		t.Errorf("contract has %d sectors after Delete, want 2", n)
+	}
+}
+
+func TestReadDuringDelete(t *testing.T) {
+	dir, err := ioutil.TempDir("", "freestore-client")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	h := startHost(t, filepath.Join(dir, "host"))
+	defer h.stop()
+	c, err := OpenDir(dir)
+	if err != nil {
+		t.Fatalf("OpenDir: %v", err)
+	}
+	defer c.Close()
+	ctx := context.Background()
+	if err := c.EnsureContracts(ctx, []*fpb.Peer{h.peer}, 1, testSectorSize, 10); err != nil {
+		t.Fatalf("EnsureContracts: %v", err)
+	}
+	contracts, err := c.Contracts(ctx)
+	if err != nil || len(contracts) != 1 {
+		t.Fatalf("Contracts returned %v, %v", contracts, err)
+	}
+	contract := contracts[0]
+	const n = 10
+	var roots []string
+	for b := byte(1); b <= n; b++ {
+		root, err := c.Write(ctx, contract, bytes.Repeat([]byte{b}, testSectorSize), int64(b))
+		if err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+		roots = append(roots, root)
+	}
+	// Each Delete moves the sector being read.
+	stop := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		want := bytes.Repeat([]byte{n}, testSectorSize)
+		for {
+			select {
+			case <-stop:
+				done <- nil
+				return
+			default:
+			}
+			data, err := c.Read(ctx, contract, roots[n-1], n)
+			if err != nil || !bytes.Equal(data, want) {
+				done <- fmt.Errorf("Read returned wrong data, %v", err)
+				return
+			}
+		}
+	}()
+	for _, root := range roots[:n-1] {
+		if err := c.Delete(ctx, contract, root); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+	}
+	close(stop)
+	if err := <-done; err != nil {
+		t.Errorf("%v", err)
+	}
+}
+
+func TestSync(t *testing.T) {
+	dir, err := ioutil.TempDir("", "freestore-client")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	h := startHost(t, filepath.Join(dir, "host"))
+	defer h.stop()
+	c, err := OpenDir(dir)
+	if err != nil {
+		t.Fatalf("OpenDir: %v", err)
+	}
+	defer c.Close()
+	ctx := context.Background()
+	if err := c.EnsureContracts(ctx, []*fpb.Peer{h.peer}, 1, testSectorSize, 10); err != nil {
+		t.Fatalf("EnsureContracts: %v", err)
+	}
+	contracts, err := c.Contracts(ctx)
+	if err != nil || len(contracts) != 1 {
+		t.Fatalf("Contracts returned %v, %v", contracts, err)
+	}
+	contract := contracts[0]
+	ct, _ := c.get(contract)
+	old := ct.latest
+	if _, err := c.Write(ctx, contract, []byte("first"), 1); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	// The response of the host is lost.
+	synced := ct.latest
+	ct.latest = old
+	if _, err := c.Write(ctx, contract, []byte("second"), 2); err == nil {
+		t.Fatalf("Write based on the old state succeeded")
+	}
+	if ct.latest.State.Revision != synced.State.Revision {
+		t.Fatalf("revision %d after sync, want %d", ct.latest.State.Revision, synced.State.Revision)
+	}
+	if err := verifier.CheckState(h.peer.Pubkey, c.cert, ct.latest); err != nil {
+		t.Errorf("the state adopted from the host is not fully signed: %v", err)
+	}
+	if _, err := c.Write(ctx, contract, []byte("second"), 2); err != nil {
+		t.Errorf("Write after sync: %v", err)
+	}
+}
+
+func TestRenew(t *testing.T) {
+	dir, err := ioutil.TempDir("", "freestore-client")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	h := startHost(t, filepath.Join(dir, "host"))
+	defer h.stop()
+	c, err := OpenDir(dir)
+	if err != nil {
+		t.Fatalf("OpenDir: %v", err)
+	}
+	defer c.Close()
+	ctx := context.Background()
+	if err := c.EnsureContracts(ctx, []*fpb.Peer{h.peer}, 1, testSectorSize, 10); err != nil {
+		t.Fatalf("EnsureContracts: %v", err)
+	}
+	contracts, err := c.Contracts(ctx)
+	if err != nil || len(contracts) != 1 {
+		t.Fatalf("Contracts returned %v, %v", contracts, err)
+	}
+	contract := contracts[0]
+	expires := func() time.Time {
+		ct, err := c.get(contract)
+		if err != nil {
+			t.Fatalf("get: %v", err)
+		}
+		ct.mu.Lock()
+		defer ct.mu.Unlock()
+		expires, err := ptypes.Timestamp(ct.latest.State.Expires)
+		if err != nil {
+			t.Fatalf("ptypes.Timestamp: %v", err)
+		}
+		return expires
+	}
+	const day = 24 * time.Hour
+	before := expires()
+	if err := c.Renew(ctx, 3*day, 10); err != nil {
+		t.Fatalf("Renew: %v", err)
+	}
+	if !expires().Equal(before) {
+		t.Errorf("Renew extended a contract with 10 days left")
+	}
+	now := time.Now()
+	c.now = func() time.Time {
+		return now.Add(8 * day)
+	}
+	if err := c.Renew(ctx, 3*day, 10); err != nil {
+		t.Fatalf("Renew: %v", err)
+	}
+	if got := expires().Sub(before); got != 10*day {
+		t.Errorf("Renew extended the contract by %s, want 10 days", got)
+	}
+	// The host agrees.
+	client, err := c.rpc(ctx, h.peer)
+	if err != nil {
+		t.Fatalf("rpc: %v", err)
+	}
+	ct, _ := c.get(contract)
+	res, err := client.ContractMetadata(ctx, &fpb.ContractMetadataRequest{Id: ct.id})
+	if err != nil {
+		t.Fatalf("ContractMetadata: %v", err)
+	}
+	if res.DaysLeft != 20 {
+		t.Errorf("host reports %d days left, want 20", res.DaysLeft)
+	}
+}
+
+type testReporter map[string][]error
+
+func (r testReporter) ReportAudit(contractID string, err error) {
+	r[contractID] = append(r[contractID], err)
+}
+
+func TestAudit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "freestore-client")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	hostDir := filepath.Join(dir, "host")
+	h := startHost(t, hostDir)
+	defer h.stop()
+	c, err := OpenDir(dir)
+	if err != nil {
+		t.Fatalf("OpenDir: %v", err)
+	}
+	defer c.Close()
+	ctx := context.Background()
+	if err := c.EnsureContracts(ctx, []*fpb.Peer{h.peer}, 1, testSectorSize, 10); err != nil {
+		t.Fatalf("EnsureContracts: %v", err)
+	}
+	contracts, err := c.Contracts(ctx)
+	if err != nil || len(contracts) != 1 {
+		t.Fatalf("Contracts returned %v, %v", contracts, err)
+	}
+	contract := contracts[0]
+	reporter := make(testReporter)
+	a := NewAuditor(c, reporter, 16)
+	// Empty contracts pass.
+	if err := a.Audit(ctx); err != nil {
+		t.Errorf("Audit of empty contract: %v", err)
+	}
+	if _, err := c.Write(ctx, contract, bytes.Repeat([]byte{1}, testSectorSize), 1); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := a.Audit(ctx); err != nil {
+		t.Errorf("Audit: %v", err)
+	}
+	// The host loses the data.
+	dataFile := filepath.Join(hostDir, contract+".data")
+	if err := ioutil.WriteFile(dataFile, make([]byte, testSectorSize), 0600); err != nil {
+		t.Fatalf("ioutil.WriteFile: %v", err)
+	}
+	if err := a.Audit(ctx); err == nil {
+		t.Errorf("Audit passed after the host lost the data")
+	}
+	results := reporter[contract]
+	if len(results) != 3 || results[0] != nil || results[1] != nil || results[2] == nil {
+		t.Errorf("reported %v, want nil, nil, error", results)
+	}
+}
@@ -0,0 +1,97 @@
+package client
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"golang.org/x/net/context"
+
+	fpb "github.com/starius/invisiblefs/freestore/proto"
+	"github.com/starius/invisiblefs/freestore/state"
+)
+
+// Extend extends the contract by days.
+func (c *Client) Extend(ctx context.Context, contractID string, days int32) error {
+	ct, err := c.get(contractID)
+	if err != nil {
+		return err
+	}
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	newState, err := state.Extend(ct.latest.State, days)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, rpcTimeout)
+	defer cancel()
+	return c.update(ctx, ct, newState, func(client fpb.FreestoreClient, signature []byte) ([]byte, error) {
+		res, err := client.ExtendContract(ctx, &fpb.ExtendContractRequest{
+			Id:        ct.id,
+			DaysNum:   days,
+			NewState:  newState,
+			Signature: signature,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("ExtendContract: %v", err)
+		}
+		return res.HostSignature, nil
+	})
+}
+
+// Renew extends by days the contracts expiring in less than before.
+func (c *Client) Renew(ctx context.Context, before time.Duration, days int32) error {
+	contracts, err := c.Contracts(ctx)
+	if err != nil {
+		return err
+	}
+	var lastErr error
+	for _, contractID := range contracts {
+		ct, err := c.get(contractID)
+		if err != nil {
+			return err
+		}
+		ct.mu.Lock()
+		expires, err := ptypes.Timestamp(ct.latest.State.Expires)
+		ct.mu.Unlock()
+		if err != nil {
+			return fmt.Errorf("bad expiration time of %s: %v", contractID, err)
+		}
+		if expires.Sub(c.now()) >= before {
+			continue
+		}
+		if err := c.Extend(ctx, contractID, days); err != nil {
+			lastErr = fmt.Errorf("Extend(%s): %v", contractID, err)
+			log.Printf("Failed to renew contract: %v.", lastErr)
+		}
+	}
+	return lastErr
+}
+
+// StartRenewing calls Renew every interval in background.
+func (c *Client) StartRenewing(interval, before time.Duration, days int32) error {
+	c.stopChan = make(chan struct{})
+	c.finChan = make(chan struct{})
+	go func() {
+		defer close(c.finChan)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-c.stopChan:
+				return
+			case <-ticker.C:
+				c.Renew(context.Background(), before, days)
+			}
+		}
+	}()
+	return nil
+}
+
+// StopRenewing stops the background task started by StartRenewing.
+func (c *Client) StopRenewing() error {
+	close(c.stopChan)
+	<-c.finChan
+	return nil
+}
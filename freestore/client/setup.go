@@ -0,0 +1,116 @@
+package client
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/net/context"
+
+	"github.com/starius/invisiblefs/freestore/discovery"
+	fpb "github.com/starius/invisiblefs/freestore/proto"
+	"github.com/starius/invisiblefs/pubkey"
+)
+
+const (
+	dbFile   = "freestore.db"
+	keyFile  = "freestore.key"
+	certFile = "freestore.crt"
+)
+
+func loadOrGenerate(file string, generate func() ([]byte, error)) ([]byte, error) {
+	data, err := ioutil.ReadFile(file)
+	if err == nil {
+		return data, nil
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("ioutil.ReadFile(%q): %v", file, err)
+	}
+	data, err = generate()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate %q: %v", file, err)
+	}
+	if err := ioutil.WriteFile(file, data, 0600); err != nil {
+		return nil, fmt.Errorf("ioutil.WriteFile(%q): %v", file, err)
+	}
+	return data, nil
+}
+
+// OpenDir opens the client storing its key, certificate and database
+// in dir. The key and the certificate are generated if missing.
+func OpenDir(dir string) (*Client, error) {
+	priv, err := loadOrGenerate(filepath.Join(dir, keyFile), func() ([]byte, error) {
+		return pubkey.GeneratePriv(rand.Reader)
+	})
+	if err != nil {
+		return nil, err
+	}
+	cert, err := loadOrGenerate(filepath.Join(dir, certFile), func() ([]byte, error) {
+		return pubkey.Cert(priv, rand.Reader)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return Open(filepath.Join(dir, dbFile), priv, cert)
+}
+
+// ParsePeers parses comma separated list of address=certfile.
+func ParsePeers(list string) ([]*fpb.Peer, error) {
+	var peers []*fpb.Peer
+	for _, item := range strings.Split(list, ",") {
+		if item == "" {
+			continue
+		}
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("bad peer %q, want address=certfile", item)
+		}
+		cert, err := ioutil.ReadFile(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("ioutil.ReadFile(%q): %v", parts[1], err)
+		}
+		peers = append(peers, &fpb.Peer{
+			Pubkey:  cert,
+			Address: parts[0],
+		})
+	}
+	return peers, nil
+}
+
+// EnsureContracts makes contracts with hosts found from seeds until
+// there are n active contracts with different hosts.
+func (c *Client) EnsureContracts(ctx context.Context, seeds []*fpb.Peer, n int, sectorSize, days int32) error {
+	hosts, err := c.Hosts()
+	if err != nil {
+		return err
+	}
+	have := make(map[string]bool)
+	for _, host := range hosts {
+		have[string(host.Pubkey)] = true
+	}
+	if len(have) >= n {
+		return nil
+	}
+	peers, err := discovery.Bootstrap(ctx, seeds, n+len(have))
+	if err != nil {
+		return fmt.Errorf("discovery.Bootstrap: %v", err)
+	}
+	for _, peer := range peers {
+		if len(have) >= n {
+			break
+		}
+		if have[string(peer.Pubkey)] {
+			continue
+		}
+		if _, err := c.MakeContract(ctx, peer, sectorSize, days); err != nil {
+			return fmt.Errorf("MakeContract with %s: %v", peer.Address, err)
+		}
+		have[string(peer.Pubkey)] = true
+	}
+	if len(have) < n {
+		return fmt.Errorf("found %d hosts, want %d", len(have), n)
+	}
+	return nil
+}
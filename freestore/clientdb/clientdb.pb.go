@@ -0,0 +1,106 @@
+// Code generated by protoc-gen-go.
+// source: clientdb.proto
+// DO NOT EDIT!
+
+/*
+Package clientdb is a generated protocol buffer package.
+
+It is generated from these files:
+	clientdb.proto
+
+It has these top-level messages:
+	Db
+	Contract
+*/
+package clientdb
+
+import proto "github.com/golang/protobuf/proto"
+import fmt "fmt"
+import math "math"
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
+
+type Db struct {
+	// Key is hex encoded ID of the contract.
+	Contracts map[string]*Contract `protobuf:"bytes,1,rep,name=contracts" json:"contracts,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+}
+
+func (m *Db) Reset()                    { *m = Db{} }
+func (m *Db) String() string            { return proto.CompactTextString(m) }
+func (*Db) ProtoMessage()               {}
+func (*Db) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0} }
+
+func (m *Db) GetContracts() map[string]*Contract {
+	if m != nil {
+		return m.Contracts
+	}
+	return nil
+}
+
+type Contract struct {
+	// Certificate of the host (see package pubkey).
+	HostPubkey  []byte `protobuf:"bytes,1,opt,name=host_pubkey,json=hostPubkey,proto3" json:"host_pubkey,omitempty"`
+	HostAddress string `protobuf:"bytes,2,opt,name=host_address,json=hostAddress" json:"host_address,omitempty"`
+	// Serialized freestore.SignedState: the latest state of the contract
+	// signed by both sides.
+	Latest []byte `protobuf:"bytes,3,opt,name=latest,proto3" json:"latest,omitempty"`
+}
+
+func (m *Contract) Reset()                    { *m = Contract{} }
+func (m *Contract) String() string            { return proto.CompactTextString(m) }
+func (*Contract) ProtoMessage()               {}
+func (*Contract) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{1} }
+
+func (m *Contract) GetHostPubkey() []byte {
+	if m != nil {
+		return m.HostPubkey
+	}
+	return nil
+}
+
+func (m *Contract) GetHostAddress() string {
+	if m != nil {
+		return m.HostAddress
+	}
+	return ""
+}
+
+func (m *Contract) GetLatest() []byte {
+	if m != nil {
+		return m.Latest
+	}
+	return nil
+}
+
+func init() {
+	proto.RegisterType((*Db)(nil), "clientdb.Db")
+	proto.RegisterType((*Contract)(nil), "clientdb.Contract")
+}
+
+func init() { proto.RegisterFile("clientdb.proto", fileDescriptor0) }
+
+var fileDescriptor0 = []byte{
+	// 206 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe2, 0xe2, 0x4b, 0xce, 0xc9, 0x4c,
+	0xcd, 0x2b, 0x49, 0x49, 0xd2, 0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x17, 0xe2, 0x80, 0xf1, 0x95, 0x26,
+	0x32, 0x72, 0x31, 0xb9, 0x24, 0x09, 0x59, 0x72, 0x71, 0x26, 0xe7, 0xe7, 0x95, 0x14, 0x25, 0x26,
+	0x97, 0x14, 0x4b, 0x30, 0x2a, 0x30, 0x6b, 0x70, 0x1b, 0x49, 0xeb, 0xc1, 0x35, 0xb9, 0x24, 0xe9,
+	0x39, 0xc3, 0x64, 0x5d, 0xf3, 0x4a, 0x8a, 0x2a, 0x83, 0x10, 0xaa, 0xa5, 0x02, 0xb8, 0xf8, 0x50,
+	0x25, 0x85, 0x04, 0xb8, 0x98, 0xb3, 0x53, 0x2b, 0x25, 0x18, 0x15, 0x18, 0x35, 0x38, 0x83, 0x40,
+	0x4c, 0x21, 0x0d, 0x2e, 0xd6, 0xb2, 0xc4, 0x9c, 0xd2, 0x54, 0x09, 0x26, 0x05, 0x46, 0x0d, 0x6e,
+	0x23, 0x21, 0x84, 0xd1, 0x30, 0xad, 0x41, 0x10, 0x05, 0x56, 0x4c, 0x16, 0x8c, 0x4a, 0x69, 0x5c,
+	0x1c, 0x30, 0x61, 0x21, 0x79, 0x2e, 0xee, 0x8c, 0xfc, 0xe2, 0x92, 0xf8, 0x82, 0xd2, 0x24, 0x98,
+	0x99, 0x3c, 0x41, 0x5c, 0x20, 0xa1, 0x00, 0xb0, 0x88, 0x90, 0x22, 0x17, 0x0f, 0x58, 0x41, 0x62,
+	0x4a, 0x4a, 0x51, 0x6a, 0x71, 0x31, 0xd8, 0x06, 0xce, 0x20, 0xb0, 0x26, 0x47, 0x88, 0x90, 0x90,
+	0x18, 0x17, 0x5b, 0x4e, 0x62, 0x49, 0x6a, 0x71, 0x89, 0x04, 0x33, 0x58, 0x3b, 0x94, 0x97, 0xc4,
+	0x06, 0x0e, 0x0c, 0x63, 0xc0, 0x00, 0xf5, 0x01, 0x41, 0xcc, 0x1e, 0x01, 0x00, 0x00,
+}
@@ -0,0 +1,3 @@
+package clientdb
+
+//go:generate protoc --proto_path=. --go_out=. clientdb.proto
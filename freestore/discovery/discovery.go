@@ -0,0 +1,94 @@
+// Package discovery finds freestore hosts and checks that they control
+// their public keys.
+package discovery
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+
+	fpb "github.com/starius/invisiblefs/freestore/proto"
+	"github.com/starius/invisiblefs/pubkey"
+)
+
+const DialTimeout = 10 * time.Second
+
+// Dial connects to the peer. The connection is established only if
+// the peer has the private key matching its certificate.
+func Dial(ctx context.Context, peer *fpb.Peer) (*grpc.ClientConn, error) {
+	creds, err := pubkey.ClientCreds(peer.Pubkey)
+	if err != nil {
+		return nil, fmt.Errorf("pubkey.ClientCreds: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, DialTimeout)
+	defer cancel()
+	conn, err := grpc.DialContext(
+		ctx,
+		peer.Address,
+		grpc.WithBlock(),
+		grpc.FailOnNonTempDialError(true),
+		grpc.WithTransportCredentials(creds),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("grpc.Dial(%q): %v", peer.Address, err)
+	}
+	return conn, nil
+}
+
+// Check connects to the peer and asks it for known peers. gossip is
+// passed to the peer. Check returns the peers known to the peer.
+func Check(ctx context.Context, peer *fpb.Peer, gossip []*fpb.Peer) ([]*fpb.Peer, error) {
+	conn, err := Dial(ctx, peer)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(ctx, DialTimeout)
+	defer cancel()
+	res, err := fpb.NewFreestoreClient(conn).KnownPeers(ctx, &fpb.KnownPeersRequest{
+		Peers: gossip,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("KnownPeers: %v", err)
+	}
+	return res.Peers, nil
+}
+
+// Bootstrap walks the network starting from seeds and returns up to
+// want checked peers. It fails only if no peers were found.
+func Bootstrap(ctx context.Context, seeds []*fpb.Peer, want int) ([]*fpb.Peer, error) {
+	queue := append([]*fpb.Peer{}, seeds...)
+	seen := make(map[string]bool)
+	foundKeys := make(map[string]bool)
+	var found []*fpb.Peer
+	var lastErr error
+	for len(queue) > 0 && len(found) < want {
+		peer := queue[0]
+		queue = queue[1:]
+		key := string(peer.Pubkey) + "\x00" + peer.Address
+		if len(peer.Pubkey) == 0 || peer.Address == "" || seen[key] || foundKeys[string(peer.Pubkey)] {
+			continue
+		}
+		seen[key] = true
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		peers, err := Check(ctx, peer, nil)
+		if err != nil {
+			lastErr = fmt.Errorf("peer %s: %v", peer.Address, err)
+			continue
+		}
+		found = append(found, peer)
+		foundKeys[string(peer.Pubkey)] = true
+		queue = append(queue, peers...)
+	}
+	if len(found) == 0 {
+		if lastErr == nil {
+			lastErr = fmt.Errorf("no peers")
+		}
+		return nil, lastErr
+	}
+	return found, nil
+}
@@ -0,0 +1,3 @@
+package hostdb
+
+//go:generate protoc --proto_path=. --go_out=. hostdb.proto
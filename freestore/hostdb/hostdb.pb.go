@@ -0,0 +1,191 @@
+// Code generated by protoc-gen-go.
+// source: hostdb.proto
+// DO NOT EDIT!
+
+/*
+Package hostdb is a generated protocol buffer package.
+
+It is generated from these files:
+	hostdb.proto
+
+It has these top-level messages:
+	Contract
+	Peer
+	Peers
+*/
+package hostdb
+
+import proto "github.com/golang/protobuf/proto"
+import fmt "fmt"
+import math "math"
+import google_protobuf "github.com/golang/protobuf/ptypes/timestamp"
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
+
+type Contract struct {
+	Id []byte `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	// Certificate of the client (see package pubkey).
+	ClientPubkey []byte                     `protobuf:"bytes,2,opt,name=client_pubkey,json=clientPubkey,proto3" json:"client_pubkey,omitempty"`
+	SectorSize   int32                      `protobuf:"varint,3,opt,name=sector_size,json=sectorSize" json:"sector_size,omitempty"`
+	Expires      *google_protobuf.Timestamp `protobuf:"bytes,4,opt,name=expires" json:"expires,omitempty"`
+	SectorIds    [][]byte                   `protobuf:"bytes,5,rep,name=sector_ids,json=sectorIds,proto3" json:"sector_ids,omitempty"`
+	// Revision of the state and the client signature of it (see package sign).
+	Revision        int64  `protobuf:"varint,6,opt,name=revision" json:"revision,omitempty"`
+	ClientSignature []byte `protobuf:"bytes,7,opt,name=client_signature,json=clientSignature,proto3" json:"client_signature,omitempty"`
+	// Sector i is stored in slot slots[i] of the data file.
+	// Slots not listed here are free.
+	Slots []int64 `protobuf:"varint,8,rep,packed,name=slots" json:"slots,omitempty"`
+}
+
+func (m *Contract) Reset()                    { *m = Contract{} }
+func (m *Contract) String() string            { return proto.CompactTextString(m) }
+func (*Contract) ProtoMessage()               {}
+func (*Contract) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0} }
+
+func (m *Contract) GetId() []byte {
+	if m != nil {
+		return m.Id
+	}
+	return nil
+}
+
+func (m *Contract) GetClientPubkey() []byte {
+	if m != nil {
+		return m.ClientPubkey
+	}
+	return nil
+}
+
+func (m *Contract) GetSectorSize() int32 {
+	if m != nil {
+		return m.SectorSize
+	}
+	return 0
+}
+
+func (m *Contract) GetExpires() *google_protobuf.Timestamp {
+	if m != nil {
+		return m.Expires
+	}
+	return nil
+}
+
+func (m *Contract) GetSectorIds() [][]byte {
+	if m != nil {
+		return m.SectorIds
+	}
+	return nil
+}
+
+func (m *Contract) GetRevision() int64 {
+	if m != nil {
+		return m.Revision
+	}
+	return 0
+}
+
+func (m *Contract) GetClientSignature() []byte {
+	if m != nil {
+		return m.ClientSignature
+	}
+	return nil
+}
+
+func (m *Contract) GetSlots() []int64 {
+	if m != nil {
+		return m.Slots
+	}
+	return nil
+}
+
+type Peer struct {
+	// Certificate of the peer (see package pubkey).
+	Pubkey  []byte `protobuf:"bytes,1,opt,name=pubkey,proto3" json:"pubkey,omitempty"`
+	Address string `protobuf:"bytes,2,opt,name=address" json:"address,omitempty"`
+	// Time of the last successful check of the peer.
+	LastSeen *google_protobuf.Timestamp `protobuf:"bytes,3,opt,name=last_seen,json=lastSeen" json:"last_seen,omitempty"`
+}
+
+func (m *Peer) Reset()                    { *m = Peer{} }
+func (m *Peer) String() string            { return proto.CompactTextString(m) }
+func (*Peer) ProtoMessage()               {}
+func (*Peer) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{1} }
+
+func (m *Peer) GetPubkey() []byte {
+	if m != nil {
+		return m.Pubkey
+	}
+	return nil
+}
+
+func (m *Peer) GetAddress() string {
+	if m != nil {
+		return m.Address
+	}
+	return ""
+}
+
+func (m *Peer) GetLastSeen() *google_protobuf.Timestamp {
+	if m != nil {
+		return m.LastSeen
+	}
+	return nil
+}
+
+type Peers struct {
+	Peers []*Peer `protobuf:"bytes,1,rep,name=peers" json:"peers,omitempty"`
+}
+
+func (m *Peers) Reset()                    { *m = Peers{} }
+func (m *Peers) String() string            { return proto.CompactTextString(m) }
+func (*Peers) ProtoMessage()               {}
+func (*Peers) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{2} }
+
+func (m *Peers) GetPeers() []*Peer {
+	if m != nil {
+		return m.Peers
+	}
+	return nil
+}
+
+func init() {
+	proto.RegisterType((*Contract)(nil), "hostdb.Contract")
+	proto.RegisterType((*Peer)(nil), "hostdb.Peer")
+	proto.RegisterType((*Peers)(nil), "hostdb.Peers")
+}
+
+func init() { proto.RegisterFile("hostdb.proto", fileDescriptor0) }
+
+var fileDescriptor0 = []byte{
+	// 328 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x84, 0x91, 0x41, 0x4f, 0xbb, 0x40,
+	0x10, 0xc5, 0x03, 0x14, 0x4a, 0xa7, 0xfc, 0xff, 0x9a, 0x8d, 0x31, 0x9b, 0x26, 0xa6, 0x04, 0x2f,
+	0x18, 0x13, 0x9a, 0x54, 0x13, 0x3f, 0x80, 0x27, 0x6f, 0xcd, 0xd6, 0x3b, 0x81, 0x32, 0xd6, 0x8d,
+	0x94, 0xc5, 0x9d, 0xad, 0xd1, 0x7e, 0x0c, 0x3f, 0xb1, 0x81, 0x05, 0xaf, 0xde, 0x78, 0xbf, 0xf7,
+	0x32, 0xbc, 0x99, 0x85, 0xe8, 0x55, 0x91, 0xa9, 0xca, 0xac, 0xd5, 0xca, 0x28, 0x16, 0x58, 0xb5,
+	0x58, 0xee, 0x95, 0xda, 0xd7, 0xb8, 0xea, 0x69, 0x79, 0x7c, 0x59, 0x19, 0x79, 0x40, 0x32, 0xc5,
+	0xa1, 0xb5, 0xc1, 0xe4, 0xdb, 0x85, 0xf0, 0x51, 0x35, 0x46, 0x17, 0x3b, 0xc3, 0xfe, 0x83, 0x2b,
+	0x2b, 0xee, 0xc4, 0x4e, 0x1a, 0x09, 0x57, 0x56, 0xec, 0x1a, 0xfe, 0xed, 0x6a, 0x89, 0x8d, 0xc9,
+	0xdb, 0x63, 0xf9, 0x86, 0x5f, 0xdc, 0xed, 0xad, 0xc8, 0xc2, 0x4d, 0xcf, 0xd8, 0x12, 0xe6, 0x84,
+	0x3b, 0xa3, 0x74, 0x4e, 0xf2, 0x84, 0xdc, 0x8b, 0x9d, 0xd4, 0x17, 0x60, 0xd1, 0x56, 0x9e, 0x90,
+	0xdd, 0xc3, 0x14, 0x3f, 0x5b, 0xa9, 0x91, 0xf8, 0x24, 0x76, 0xd2, 0xf9, 0x7a, 0x91, 0xd9, 0x56,
+	0xd9, 0xd8, 0x2a, 0x7b, 0x1e, 0x5b, 0x89, 0x31, 0xca, 0xae, 0x60, 0x98, 0x91, 0xcb, 0x8a, 0xb8,
+	0x1f, 0x7b, 0x69, 0x24, 0x66, 0x96, 0x3c, 0x55, 0xc4, 0x16, 0x10, 0x6a, 0xfc, 0x90, 0x24, 0x55,
+	0xc3, 0x83, 0xd8, 0x49, 0x3d, 0xf1, 0xab, 0xd9, 0x0d, 0x9c, 0x0f, 0xb5, 0x49, 0xee, 0x9b, 0xc2,
+	0x1c, 0x35, 0xf2, 0x69, 0xdf, 0xfc, 0xcc, 0xf2, 0xed, 0x88, 0xd9, 0x05, 0xf8, 0x54, 0x2b, 0x43,
+	0x3c, 0x8c, 0xbd, 0xd4, 0x13, 0x56, 0x24, 0xef, 0x30, 0xd9, 0x20, 0x6a, 0x76, 0x09, 0xc1, 0xb0,
+	0xb8, 0xbd, 0xc9, 0xa0, 0x18, 0x87, 0x69, 0x51, 0x55, 0x1a, 0x89, 0xfa, 0x8b, 0xcc, 0xc4, 0x28,
+	0xd9, 0x03, 0xcc, 0xea, 0x82, 0x4c, 0x4e, 0x88, 0x0d, 0xf7, 0xfe, 0xdc, 0x36, 0xec, 0xc2, 0x5b,
+	0xc4, 0x26, 0xb9, 0x05, 0xbf, 0xfb, 0x25, 0xb1, 0x04, 0xfc, 0xb6, 0xfb, 0xe0, 0x4e, 0xec, 0xa5,
+	0xf3, 0x75, 0x94, 0x0d, 0xef, 0xda, 0xb9, 0xc2, 0x5a, 0x65, 0xd0, 0x8f, 0xba, 0xfb, 0x19, 0x00,
+	0xfd, 0xc2, 0xd3, 0x7d, 0xf4, 0x01, 0x00, 0x00,
+}
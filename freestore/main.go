@@ -1,28 +1,77 @@
 package main
 
 import (
+	"crypto/rand"
 	"flag"
+	"io/ioutil"
 	"log"
 	"net"
+	"os"
+	"time"
 
 	"google.golang.org/grpc"
 
 	fpb "github.com/starius/invisiblefs/freestore/proto"
 	"github.com/starius/invisiblefs/freestore/server"
+	"github.com/starius/invisiblefs/pubkey"
 )
 
 var (
 	serverListenAddress = flag.String("server-listen-address", "", "Address to run GRPC server on")
+	dataDir             = flag.String("data-dir", "freestore-data", "Directory to store contracts")
+	keyFile             = flag.String("key-file", "freestore.key", "File with private key of the host (generated if missing)")
+	certFile            = flag.String("cert-file", "freestore.crt", "File with certificate of the host (generated if missing)")
+	checkPeersInterval  = flag.Duration("check-peers-interval", time.Hour, "How often to check known peers")
+	limitsFile          = flag.String("limits-file", "", "JSON file with limits (see server.Limits)")
+	expireInterval      = flag.Duration("expire-interval", 10*time.Minute, "How often to remove expired contracts")
 )
 
+func loadOrGenerate(file string, generate func() ([]byte, error)) []byte {
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		data, err := generate()
+		if err != nil {
+			log.Fatalf("Failed to generate %q: %v.", file, err)
+		}
+		if err := ioutil.WriteFile(file, data, 0600); err != nil {
+			log.Fatalf("ioutil.WriteFile(%q, ...): %v.", file, err)
+		}
+		return data
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		log.Fatalf("ioutil.ReadFile(%q): %v.", file, err)
+	}
+	return data
+}
+
 func main() {
 	flag.Parse()
-	grpcServer := grpc.NewServer()
-	server, err := server.NewServer()
+	priv := loadOrGenerate(*keyFile, func() ([]byte, error) {
+		return pubkey.GeneratePriv(rand.Reader)
+	})
+	cert := loadOrGenerate(*certFile, func() ([]byte, error) {
+		return pubkey.Cert(priv, rand.Reader)
+	})
+	creds, err := pubkey.ServerCreds(priv, cert)
+	if err != nil {
+		log.Fatalf("pubkey.ServerCreds: %v.", err)
+	}
+	grpcServer := grpc.NewServer(grpc.Creds(creds))
+	var limits server.Limits
+	if *limitsFile != "" {
+		limits, err = server.LoadLimits(*limitsFile)
+		if err != nil {
+			log.Fatalf("server.LoadLimits: %v.", err)
+		}
+	}
+	server, err := server.NewServer(*dataDir, priv, limits)
 	if err != nil {
 		log.Fatalf("Failed to create server: %v.", err)
 	}
 	fpb.RegisterFreestoreServer(grpcServer, server)
+	if err := server.Start(*expireInterval, *checkPeersInterval); err != nil {
+		log.Fatalf("server.Start: %v.", err)
+	}
 	conn, err := net.Listen("tcp", *serverListenAddress)
 	if err != nil {
 		log.Fatalf("net.Listen: %v.", err)
@@ -13,6 +13,9 @@ It has these top-level messages:
 	KnownPeersRequest
 	KnownPeersResponse
 	MakeContractRequest
+	ContractState
+	SignedState
+	Evidence
 	MakeContractResponse
 	ExtendContractRequest
 	ExtendContractResponse
@@ -20,6 +23,11 @@ It has these top-level messages:
 	ContractMetadataResponse
 	ReadSectorRequest
 	ReadSectorResponse
+	RangeProof
+	SegmentRef
+	ChallengeRequest
+	SegmentProof
+	ChallengeResponse
 	WriteSectorRequest
 	WriteSectorResponse
 	ShrinkRequest
@@ -32,6 +40,7 @@ package freestore
 import proto "github.com/golang/protobuf/proto"
 import fmt "fmt"
 import math "math"
+import google_protobuf "github.com/golang/protobuf/ptypes/timestamp"
 
 import (
 	context "golang.org/x/net/context"
@@ -50,6 +59,7 @@ var _ = math.Inf
 const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
 
 type Peer struct {
+	// Certificate of the host (see package pubkey).
 	Pubkey  []byte `protobuf:"bytes,1,opt,name=pubkey,proto3" json:"pubkey,omitempty"`
 	Address string `protobuf:"bytes,2,opt,name=address" json:"address,omitempty"`
 }
@@ -106,7 +116,9 @@ func (m *KnownPeersResponse) GetPeers() []*Peer {
 }
 
 type MakeContractRequest struct {
-	SectorSize   int32  `protobuf:"varint,1,opt,name=sector_size,json=sectorSize" json:"sector_size,omitempty"`
+	SectorSize int32 `protobuf:"varint,1,opt,name=sector_size,json=sectorSize" json:"sector_size,omitempty"`
+	// Certificate of the client (see package pubkey).
+	// It is used to check signatures of requests changing the contract.
 	ClientPubkey []byte `protobuf:"bytes,2,opt,name=client_pubkey,json=clientPubkey,proto3" json:"client_pubkey,omitempty"`
 	DaysNum      int32  `protobuf:"varint,3,opt,name=days_num,json=daysNum" json:"days_num,omitempty"`
 }
@@ -137,14 +149,138 @@ func (m *MakeContractRequest) GetDaysNum() int32 {
 	return 0
 }
 
+// State of a contract agreed by the client and the host.
+// Each change of the contract increments the revision and must be
+// signed by both sides (see package sign).
+type ContractState struct {
+	Id       []byte `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Revision int64  `protobuf:"varint,2,opt,name=revision" json:"revision,omitempty"`
+	// Merkle roots of the sectors.
+	SectorIds  [][]byte                   `protobuf:"bytes,3,rep,name=sector_ids,json=sectorIds,proto3" json:"sector_ids,omitempty"`
+	SectorSize int32                      `protobuf:"varint,4,opt,name=sector_size,json=sectorSize" json:"sector_size,omitempty"`
+	Expires    *google_protobuf.Timestamp `protobuf:"bytes,5,opt,name=expires" json:"expires,omitempty"`
+}
+
+func (m *ContractState) Reset()                    { *m = ContractState{} }
+func (m *ContractState) String() string            { return proto.CompactTextString(m) }
+func (*ContractState) ProtoMessage()               {}
+func (*ContractState) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{4} }
+
+func (m *ContractState) GetId() []byte {
+	if m != nil {
+		return m.Id
+	}
+	return nil
+}
+
+func (m *ContractState) GetRevision() int64 {
+	if m != nil {
+		return m.Revision
+	}
+	return 0
+}
+
+func (m *ContractState) GetSectorIds() [][]byte {
+	if m != nil {
+		return m.SectorIds
+	}
+	return nil
+}
+
+func (m *ContractState) GetSectorSize() int32 {
+	if m != nil {
+		return m.SectorSize
+	}
+	return 0
+}
+
+func (m *ContractState) GetExpires() *google_protobuf.Timestamp {
+	if m != nil {
+		return m.Expires
+	}
+	return nil
+}
+
+type SignedState struct {
+	State         *ContractState `protobuf:"bytes,1,opt,name=state" json:"state,omitempty"`
+	HostSignature []byte         `protobuf:"bytes,2,opt,name=host_signature,json=hostSignature,proto3" json:"host_signature,omitempty"`
+	// Empty for revision 0 (new contract).
+	ClientSignature []byte `protobuf:"bytes,3,opt,name=client_signature,json=clientSignature,proto3" json:"client_signature,omitempty"`
+}
+
+func (m *SignedState) Reset()                    { *m = SignedState{} }
+func (m *SignedState) String() string            { return proto.CompactTextString(m) }
+func (*SignedState) ProtoMessage()               {}
+func (*SignedState) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{5} }
+
+func (m *SignedState) GetState() *ContractState {
+	if m != nil {
+		return m.State
+	}
+	return nil
+}
+
+func (m *SignedState) GetHostSignature() []byte {
+	if m != nil {
+		return m.HostSignature
+	}
+	return nil
+}
+
+func (m *SignedState) GetClientSignature() []byte {
+	if m != nil {
+		return m.ClientSignature
+	}
+	return nil
+}
+
+// Proof that the host rolled a contract back or forked it: the host
+// signed the latest state and then reported an older or different state
+// of the same revision in response to the nonce derived from the latest
+// state.
+type Evidence struct {
+	Latest   *SignedState   `protobuf:"bytes,1,opt,name=latest" json:"latest,omitempty"`
+	Reported *ContractState `protobuf:"bytes,2,opt,name=reported" json:"reported,omitempty"`
+	// Host signature of the reported state with nonce = digest of latest.
+	Signature []byte `protobuf:"bytes,3,opt,name=signature,proto3" json:"signature,omitempty"`
+}
+
+func (m *Evidence) Reset()                    { *m = Evidence{} }
+func (m *Evidence) String() string            { return proto.CompactTextString(m) }
+func (*Evidence) ProtoMessage()               {}
+func (*Evidence) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{6} }
+
+func (m *Evidence) GetLatest() *SignedState {
+	if m != nil {
+		return m.Latest
+	}
+	return nil
+}
+
+func (m *Evidence) GetReported() *ContractState {
+	if m != nil {
+		return m.Reported
+	}
+	return nil
+}
+
+func (m *Evidence) GetSignature() []byte {
+	if m != nil {
+		return m.Signature
+	}
+	return nil
+}
+
 type MakeContractResponse struct {
 	Id []byte `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	// Initial state of the contract (revision 0) signed by the host.
+	State *SignedState `protobuf:"bytes,2,opt,name=state" json:"state,omitempty"`
 }
 
 func (m *MakeContractResponse) Reset()                    { *m = MakeContractResponse{} }
 func (m *MakeContractResponse) String() string            { return proto.CompactTextString(m) }
 func (*MakeContractResponse) ProtoMessage()               {}
-func (*MakeContractResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{4} }
+func (*MakeContractResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{7} }
 
 func (m *MakeContractResponse) GetId() []byte {
 	if m != nil {
@@ -153,15 +289,25 @@ func (m *MakeContractResponse) GetId() []byte {
 	return nil
 }
 
+func (m *MakeContractResponse) GetState() *SignedState {
+	if m != nil {
+		return m.State
+	}
+	return nil
+}
+
 type ExtendContractRequest struct {
-	Id      []byte `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
-	DaysNum int32  `protobuf:"varint,2,opt,name=days_num,json=daysNum" json:"days_num,omitempty"`
+	Id       []byte         `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	DaysNum  int32          `protobuf:"varint,2,opt,name=days_num,json=daysNum" json:"days_num,omitempty"`
+	NewState *ContractState `protobuf:"bytes,3,opt,name=new_state,json=newState" json:"new_state,omitempty"`
+	// Client signature of new_state.
+	Signature []byte `protobuf:"bytes,4,opt,name=signature,proto3" json:"signature,omitempty"`
 }
 
 func (m *ExtendContractRequest) Reset()                    { *m = ExtendContractRequest{} }
 func (m *ExtendContractRequest) String() string            { return proto.CompactTextString(m) }
 func (*ExtendContractRequest) ProtoMessage()               {}
-func (*ExtendContractRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{5} }
+func (*ExtendContractRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{8} }
 
 func (m *ExtendContractRequest) GetId() []byte {
 	if m != nil {
@@ -177,22 +323,49 @@ func (m *ExtendContractRequest) GetDaysNum() int32 {
 	return 0
 }
 
+func (m *ExtendContractRequest) GetNewState() *ContractState {
+	if m != nil {
+		return m.NewState
+	}
+	return nil
+}
+
+func (m *ExtendContractRequest) GetSignature() []byte {
+	if m != nil {
+		return m.Signature
+	}
+	return nil
+}
+
 type ExtendContractResponse struct {
+	// Host signature of the new state.
+	HostSignature []byte `protobuf:"bytes,1,opt,name=host_signature,json=hostSignature,proto3" json:"host_signature,omitempty"`
 }
 
 func (m *ExtendContractResponse) Reset()                    { *m = ExtendContractResponse{} }
 func (m *ExtendContractResponse) String() string            { return proto.CompactTextString(m) }
 func (*ExtendContractResponse) ProtoMessage()               {}
-func (*ExtendContractResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{6} }
+func (*ExtendContractResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{9} }
+
+func (m *ExtendContractResponse) GetHostSignature() []byte {
+	if m != nil {
+		return m.HostSignature
+	}
+	return nil
+}
 
 type ContractMetadataRequest struct {
 	Id []byte `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	// Signed by the host together with the state.
+	// Set it to the digest of the latest known SignedState to make
+	// rollbacks provable (see package sign).
+	Nonce []byte `protobuf:"bytes,2,opt,name=nonce,proto3" json:"nonce,omitempty"`
 }
 
 func (m *ContractMetadataRequest) Reset()                    { *m = ContractMetadataRequest{} }
 func (m *ContractMetadataRequest) String() string            { return proto.CompactTextString(m) }
 func (*ContractMetadataRequest) ProtoMessage()               {}
-func (*ContractMetadataRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{7} }
+func (*ContractMetadataRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{10} }
 
 func (m *ContractMetadataRequest) GetId() []byte {
 	if m != nil {
@@ -201,17 +374,30 @@ func (m *ContractMetadataRequest) GetId() []byte {
 	return nil
 }
 
+func (m *ContractMetadataRequest) GetNonce() []byte {
+	if m != nil {
+		return m.Nonce
+	}
+	return nil
+}
+
 type ContractMetadataResponse struct {
 	SectorIds  [][]byte `protobuf:"bytes,1,rep,name=sector_ids,json=sectorIds,proto3" json:"sector_ids,omitempty"`
 	DaysLeft   int32    `protobuf:"varint,2,opt,name=days_left,json=daysLeft" json:"days_left,omitempty"`
 	SectorSize int32    `protobuf:"varint,3,opt,name=sector_size,json=sectorSize" json:"sector_size,omitempty"`
-	Signature  []byte   `protobuf:"bytes,4,opt,name=signature,proto3" json:"signature,omitempty"`
+	// Host signature of state and nonce.
+	Signature []byte         `protobuf:"bytes,4,opt,name=signature,proto3" json:"signature,omitempty"`
+	State     *ContractState `protobuf:"bytes,5,opt,name=state" json:"state,omitempty"`
+	// Client signature of state.
+	ClientSignature []byte `protobuf:"bytes,6,opt,name=client_signature,json=clientSignature,proto3" json:"client_signature,omitempty"`
+	// Host signature of state (see package sign).
+	HostSignature []byte `protobuf:"bytes,7,opt,name=host_signature,json=hostSignature,proto3" json:"host_signature,omitempty"`
 }
 
 func (m *ContractMetadataResponse) Reset()                    { *m = ContractMetadataResponse{} }
 func (m *ContractMetadataResponse) String() string            { return proto.CompactTextString(m) }
 func (*ContractMetadataResponse) ProtoMessage()               {}
-func (*ContractMetadataResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{8} }
+func (*ContractMetadataResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{11} }
 
 func (m *ContractMetadataResponse) GetSectorIds() [][]byte {
 	if m != nil {
@@ -241,6 +427,27 @@ func (m *ContractMetadataResponse) GetSignature() []byte {
 	return nil
 }
 
+func (m *ContractMetadataResponse) GetState() *ContractState {
+	if m != nil {
+		return m.State
+	}
+	return nil
+}
+
+func (m *ContractMetadataResponse) GetClientSignature() []byte {
+	if m != nil {
+		return m.ClientSignature
+	}
+	return nil
+}
+
+func (m *ContractMetadataResponse) GetHostSignature() []byte {
+	if m != nil {
+		return m.HostSignature
+	}
+	return nil
+}
+
 type ReadSectorRequest struct {
 	Id          []byte `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
 	Sector      int64  `protobuf:"varint,2,opt,name=sector" json:"sector,omitempty"`
@@ -252,7 +459,7 @@ type ReadSectorRequest struct {
 func (m *ReadSectorRequest) Reset()                    { *m = ReadSectorRequest{} }
 func (m *ReadSectorRequest) String() string            { return proto.CompactTextString(m) }
 func (*ReadSectorRequest) ProtoMessage()               {}
-func (*ReadSectorRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{9} }
+func (*ReadSectorRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{12} }
 
 func (m *ReadSectorRequest) GetId() []byte {
 	if m != nil {
@@ -290,14 +497,15 @@ func (m *ReadSectorRequest) GetProofNeeded() bool {
 }
 
 type ReadSectorResponse struct {
-	Data  []byte `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"`
+	Data []byte `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"`
+	// Serialized RangeProof if proof_needed.
 	Proof []byte `protobuf:"bytes,2,opt,name=proof,proto3" json:"proof,omitempty"`
 }
 
 func (m *ReadSectorResponse) Reset()                    { *m = ReadSectorResponse{} }
 func (m *ReadSectorResponse) String() string            { return proto.CompactTextString(m) }
 func (*ReadSectorResponse) ProtoMessage()               {}
-func (*ReadSectorResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{10} }
+func (*ReadSectorResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{13} }
 
 func (m *ReadSectorResponse) GetData() []byte {
 	if m != nil {
@@ -313,19 +521,148 @@ func (m *ReadSectorResponse) GetProof() []byte {
 	return nil
 }
 
+// Proof that data belongs to a sector with the given Merkle root
+// (see package merkle).
+type RangeProof struct {
+	// Parts of the first and the last segments outside the range.
+	Prefix []byte   `protobuf:"bytes,1,opt,name=prefix,proto3" json:"prefix,omitempty"`
+	Suffix []byte   `protobuf:"bytes,2,opt,name=suffix,proto3" json:"suffix,omitempty"`
+	Hashes [][]byte `protobuf:"bytes,3,rep,name=hashes,proto3" json:"hashes,omitempty"`
+}
+
+func (m *RangeProof) Reset()                    { *m = RangeProof{} }
+func (m *RangeProof) String() string            { return proto.CompactTextString(m) }
+func (*RangeProof) ProtoMessage()               {}
+func (*RangeProof) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{14} }
+
+func (m *RangeProof) GetPrefix() []byte {
+	if m != nil {
+		return m.Prefix
+	}
+	return nil
+}
+
+func (m *RangeProof) GetSuffix() []byte {
+	if m != nil {
+		return m.Suffix
+	}
+	return nil
+}
+
+func (m *RangeProof) GetHashes() [][]byte {
+	if m != nil {
+		return m.Hashes
+	}
+	return nil
+}
+
+// Segment of a sector asked in a proof-of-storage challenge.
+type SegmentRef struct {
+	Sector int64 `protobuf:"varint,1,opt,name=sector" json:"sector,omitempty"`
+	// Index of the segment (see package merkle) in the sector.
+	Segment int32 `protobuf:"varint,2,opt,name=segment" json:"segment,omitempty"`
+}
+
+func (m *SegmentRef) Reset()                    { *m = SegmentRef{} }
+func (m *SegmentRef) String() string            { return proto.CompactTextString(m) }
+func (*SegmentRef) ProtoMessage()               {}
+func (*SegmentRef) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{15} }
+
+func (m *SegmentRef) GetSector() int64 {
+	if m != nil {
+		return m.Sector
+	}
+	return 0
+}
+
+func (m *SegmentRef) GetSegment() int32 {
+	if m != nil {
+		return m.Segment
+	}
+	return 0
+}
+
+// The host proves at most 1024 segments of at most 16 distinct sectors.
+type ChallengeRequest struct {
+	Id       []byte        `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Segments []*SegmentRef `protobuf:"bytes,2,rep,name=segments" json:"segments,omitempty"`
+}
+
+func (m *ChallengeRequest) Reset()                    { *m = ChallengeRequest{} }
+func (m *ChallengeRequest) String() string            { return proto.CompactTextString(m) }
+func (*ChallengeRequest) ProtoMessage()               {}
+func (*ChallengeRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{16} }
+
+func (m *ChallengeRequest) GetId() []byte {
+	if m != nil {
+		return m.Id
+	}
+	return nil
+}
+
+func (m *ChallengeRequest) GetSegments() []*SegmentRef {
+	if m != nil {
+		return m.Segments
+	}
+	return nil
+}
+
+type SegmentProof struct {
+	Data   []byte   `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"`
+	Hashes [][]byte `protobuf:"bytes,2,rep,name=hashes,proto3" json:"hashes,omitempty"`
+}
+
+func (m *SegmentProof) Reset()                    { *m = SegmentProof{} }
+func (m *SegmentProof) String() string            { return proto.CompactTextString(m) }
+func (*SegmentProof) ProtoMessage()               {}
+func (*SegmentProof) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{17} }
+
+func (m *SegmentProof) GetData() []byte {
+	if m != nil {
+		return m.Data
+	}
+	return nil
+}
+
+func (m *SegmentProof) GetHashes() [][]byte {
+	if m != nil {
+		return m.Hashes
+	}
+	return nil
+}
+
+type ChallengeResponse struct {
+	// Proofs of the requested segments, in the same order.
+	Proofs []*SegmentProof `protobuf:"bytes,1,rep,name=proofs" json:"proofs,omitempty"`
+}
+
+func (m *ChallengeResponse) Reset()                    { *m = ChallengeResponse{} }
+func (m *ChallengeResponse) String() string            { return proto.CompactTextString(m) }
+func (*ChallengeResponse) ProtoMessage()               {}
+func (*ChallengeResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{18} }
+
+func (m *ChallengeResponse) GetProofs() []*SegmentProof {
+	if m != nil {
+		return m.Proofs
+	}
+	return nil
+}
+
 type WriteSectorRequest struct {
-	Id        []byte `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
-	Sector    int64  `protobuf:"varint,2,opt,name=sector" json:"sector,omitempty"`
-	Offset    int32  `protobuf:"varint,3,opt,name=offset" json:"offset,omitempty"`
-	Length    int32  `protobuf:"varint,4,opt,name=length" json:"length,omitempty"`
-	Data      []byte `protobuf:"bytes,5,opt,name=data,proto3" json:"data,omitempty"`
-	Signature []byte `protobuf:"bytes,6,opt,name=signature,proto3" json:"signature,omitempty"`
+	Id     []byte `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Sector int64  `protobuf:"varint,2,opt,name=sector" json:"sector,omitempty"`
+	Offset int32  `protobuf:"varint,3,opt,name=offset" json:"offset,omitempty"`
+	Length int32  `protobuf:"varint,4,opt,name=length" json:"length,omitempty"`
+	Data   []byte `protobuf:"bytes,5,opt,name=data,proto3" json:"data,omitempty"`
+	// Client signature of new_state.
+	Signature []byte         `protobuf:"bytes,6,opt,name=signature,proto3" json:"signature,omitempty"`
+	NewState  *ContractState `protobuf:"bytes,7,opt,name=new_state,json=newState" json:"new_state,omitempty"`
 }
 
 func (m *WriteSectorRequest) Reset()                    { *m = WriteSectorRequest{} }
 func (m *WriteSectorRequest) String() string            { return proto.CompactTextString(m) }
 func (*WriteSectorRequest) ProtoMessage()               {}
-func (*WriteSectorRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{11} }
+func (*WriteSectorRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{19} }
 
 func (m *WriteSectorRequest) GetId() []byte {
 	if m != nil {
@@ -369,24 +706,42 @@ func (m *WriteSectorRequest) GetSignature() []byte {
 	return nil
 }
 
+func (m *WriteSectorRequest) GetNewState() *ContractState {
+	if m != nil {
+		return m.NewState
+	}
+	return nil
+}
+
 type WriteSectorResponse struct {
+	// Host signature of the new state.
+	HostSignature []byte `protobuf:"bytes,1,opt,name=host_signature,json=hostSignature,proto3" json:"host_signature,omitempty"`
 }
 
 func (m *WriteSectorResponse) Reset()                    { *m = WriteSectorResponse{} }
 func (m *WriteSectorResponse) String() string            { return proto.CompactTextString(m) }
 func (*WriteSectorResponse) ProtoMessage()               {}
-func (*WriteSectorResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{12} }
+func (*WriteSectorResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{20} }
+
+func (m *WriteSectorResponse) GetHostSignature() []byte {
+	if m != nil {
+		return m.HostSignature
+	}
+	return nil
+}
 
 type ShrinkRequest struct {
 	Id         []byte `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
 	NumSectors int64  `protobuf:"varint,2,opt,name=num_sectors,json=numSectors" json:"num_sectors,omitempty"`
-	Signature  []byte `protobuf:"bytes,3,opt,name=signature,proto3" json:"signature,omitempty"`
+	// Client signature of new_state.
+	Signature []byte         `protobuf:"bytes,3,opt,name=signature,proto3" json:"signature,omitempty"`
+	NewState  *ContractState `protobuf:"bytes,4,opt,name=new_state,json=newState" json:"new_state,omitempty"`
 }
 
 func (m *ShrinkRequest) Reset()                    { *m = ShrinkRequest{} }
 func (m *ShrinkRequest) String() string            { return proto.CompactTextString(m) }
 func (*ShrinkRequest) ProtoMessage()               {}
-func (*ShrinkRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{13} }
+func (*ShrinkRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{21} }
 
 func (m *ShrinkRequest) GetId() []byte {
 	if m != nil {
@@ -409,24 +764,42 @@ func (m *ShrinkRequest) GetSignature() []byte {
 	return nil
 }
 
+func (m *ShrinkRequest) GetNewState() *ContractState {
+	if m != nil {
+		return m.NewState
+	}
+	return nil
+}
+
 type ShrinkResponse struct {
+	// Host signature of the new state.
+	HostSignature []byte `protobuf:"bytes,1,opt,name=host_signature,json=hostSignature,proto3" json:"host_signature,omitempty"`
 }
 
 func (m *ShrinkResponse) Reset()                    { *m = ShrinkResponse{} }
 func (m *ShrinkResponse) String() string            { return proto.CompactTextString(m) }
 func (*ShrinkResponse) ProtoMessage()               {}
-func (*ShrinkResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{14} }
+func (*ShrinkResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{22} }
+
+func (m *ShrinkResponse) GetHostSignature() []byte {
+	if m != nil {
+		return m.HostSignature
+	}
+	return nil
+}
 
 type ReorderRequest struct {
-	Id        []byte  `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
-	Ordering  []int64 `protobuf:"varint,2,rep,packed,name=ordering" json:"ordering,omitempty"`
-	Signature []byte  `protobuf:"bytes,3,opt,name=signature,proto3" json:"signature,omitempty"`
+	Id       []byte  `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Ordering []int64 `protobuf:"varint,2,rep,packed,name=ordering" json:"ordering,omitempty"`
+	// Client signature of new_state.
+	Signature []byte         `protobuf:"bytes,3,opt,name=signature,proto3" json:"signature,omitempty"`
+	NewState  *ContractState `protobuf:"bytes,4,opt,name=new_state,json=newState" json:"new_state,omitempty"`
 }
 
 func (m *ReorderRequest) Reset()                    { *m = ReorderRequest{} }
 func (m *ReorderRequest) String() string            { return proto.CompactTextString(m) }
 func (*ReorderRequest) ProtoMessage()               {}
-func (*ReorderRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{15} }
+func (*ReorderRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{23} }
 
 func (m *ReorderRequest) GetId() []byte {
 	if m != nil {
@@ -449,19 +822,38 @@ func (m *ReorderRequest) GetSignature() []byte {
 	return nil
 }
 
+func (m *ReorderRequest) GetNewState() *ContractState {
+	if m != nil {
+		return m.NewState
+	}
+	return nil
+}
+
 type ReorderResponse struct {
+	// Host signature of the new state.
+	HostSignature []byte `protobuf:"bytes,1,opt,name=host_signature,json=hostSignature,proto3" json:"host_signature,omitempty"`
 }
 
 func (m *ReorderResponse) Reset()                    { *m = ReorderResponse{} }
 func (m *ReorderResponse) String() string            { return proto.CompactTextString(m) }
 func (*ReorderResponse) ProtoMessage()               {}
-func (*ReorderResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{16} }
+func (*ReorderResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{24} }
+
+func (m *ReorderResponse) GetHostSignature() []byte {
+	if m != nil {
+		return m.HostSignature
+	}
+	return nil
+}
 
 func init() {
 	proto.RegisterType((*Peer)(nil), "freestore.Peer")
 	proto.RegisterType((*KnownPeersRequest)(nil), "freestore.KnownPeersRequest")
 	proto.RegisterType((*KnownPeersResponse)(nil), "freestore.KnownPeersResponse")
 	proto.RegisterType((*MakeContractRequest)(nil), "freestore.MakeContractRequest")
+	proto.RegisterType((*ContractState)(nil), "freestore.ContractState")
+	proto.RegisterType((*SignedState)(nil), "freestore.SignedState")
+	proto.RegisterType((*Evidence)(nil), "freestore.Evidence")
 	proto.RegisterType((*MakeContractResponse)(nil), "freestore.MakeContractResponse")
 	proto.RegisterType((*ExtendContractRequest)(nil), "freestore.ExtendContractRequest")
 	proto.RegisterType((*ExtendContractResponse)(nil), "freestore.ExtendContractResponse")
@@ -469,6 +861,11 @@ func init() {
 	proto.RegisterType((*ContractMetadataResponse)(nil), "freestore.ContractMetadataResponse")
 	proto.RegisterType((*ReadSectorRequest)(nil), "freestore.ReadSectorRequest")
 	proto.RegisterType((*ReadSectorResponse)(nil), "freestore.ReadSectorResponse")
+	proto.RegisterType((*RangeProof)(nil), "freestore.RangeProof")
+	proto.RegisterType((*SegmentRef)(nil), "freestore.SegmentRef")
+	proto.RegisterType((*ChallengeRequest)(nil), "freestore.ChallengeRequest")
+	proto.RegisterType((*SegmentProof)(nil), "freestore.SegmentProof")
+	proto.RegisterType((*ChallengeResponse)(nil), "freestore.ChallengeResponse")
 	proto.RegisterType((*WriteSectorRequest)(nil), "freestore.WriteSectorRequest")
 	proto.RegisterType((*WriteSectorResponse)(nil), "freestore.WriteSectorResponse")
 	proto.RegisterType((*ShrinkRequest)(nil), "freestore.ShrinkRequest")
@@ -493,6 +890,8 @@ type FreestoreClient interface {
 	ExtendContract(ctx context.Context, in *ExtendContractRequest, opts ...grpc.CallOption) (*ExtendContractResponse, error)
 	ContractMetadata(ctx context.Context, in *ContractMetadataRequest, opts ...grpc.CallOption) (*ContractMetadataResponse, error)
 	ReadSector(ctx context.Context, in *ReadSectorRequest, opts ...grpc.CallOption) (*ReadSectorResponse, error)
+	Challenge(ctx context.Context, in *ChallengeRequest, opts ...grpc.CallOption) (*ChallengeResponse, error)
+	WriteSector(ctx context.Context, in *WriteSectorRequest, opts ...grpc.CallOption) (*WriteSectorResponse, error)
 	Shrink(ctx context.Context, in *ShrinkRequest, opts ...grpc.CallOption) (*ShrinkResponse, error)
 	Reorder(ctx context.Context, in *ReorderRequest, opts ...grpc.CallOption) (*ReorderResponse, error)
 }
@@ -550,6 +949,24 @@ func (c *freestoreClient) ReadSector(ctx context.Context, in *ReadSectorRequest,
 	return out, nil
 }
 
+func (c *freestoreClient) Challenge(ctx context.Context, in *ChallengeRequest, opts ...grpc.CallOption) (*ChallengeResponse, error) {
+	out := new(ChallengeResponse)
+	err := grpc.Invoke(ctx, "/freestore.Freestore/Challenge", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *freestoreClient) WriteSector(ctx context.Context, in *WriteSectorRequest, opts ...grpc.CallOption) (*WriteSectorResponse, error) {
+	out := new(WriteSectorResponse)
+	err := grpc.Invoke(ctx, "/freestore.Freestore/WriteSector", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *freestoreClient) Shrink(ctx context.Context, in *ShrinkRequest, opts ...grpc.CallOption) (*ShrinkResponse, error) {
 	out := new(ShrinkResponse)
 	err := grpc.Invoke(ctx, "/freestore.Freestore/Shrink", in, out, c.cc, opts...)
@@ -576,6 +993,8 @@ type FreestoreServer interface {
 	ExtendContract(context.Context, *ExtendContractRequest) (*ExtendContractResponse, error)
 	ContractMetadata(context.Context, *ContractMetadataRequest) (*ContractMetadataResponse, error)
 	ReadSector(context.Context, *ReadSectorRequest) (*ReadSectorResponse, error)
+	Challenge(context.Context, *ChallengeRequest) (*ChallengeResponse, error)
+	WriteSector(context.Context, *WriteSectorRequest) (*WriteSectorResponse, error)
 	Shrink(context.Context, *ShrinkRequest) (*ShrinkResponse, error)
 	Reorder(context.Context, *ReorderRequest) (*ReorderResponse, error)
 }
@@ -674,6 +1093,42 @@ func _Freestore_ReadSector_Handler(srv interface{}, ctx context.Context, dec fun
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Freestore_Challenge_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ChallengeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FreestoreServer).Challenge(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/freestore.Freestore/Challenge",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FreestoreServer).Challenge(ctx, req.(*ChallengeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Freestore_WriteSector_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(WriteSectorRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FreestoreServer).WriteSector(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/freestore.Freestore/WriteSector",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FreestoreServer).WriteSector(ctx, req.(*WriteSectorRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _Freestore_Shrink_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(ShrinkRequest)
 	if err := dec(in); err != nil {
@@ -734,6 +1189,14 @@ var _Freestore_serviceDesc = grpc.ServiceDesc{
 			MethodName: "ReadSector",
 			Handler:    _Freestore_ReadSector_Handler,
 		},
+		{
+			MethodName: "Challenge",
+			Handler:    _Freestore_Challenge_Handler,
+		},
+		{
+			MethodName: "WriteSector",
+			Handler:    _Freestore_WriteSector_Handler,
+		},
 		{
 			MethodName: "Shrink",
 			Handler:    _Freestore_Shrink_Handler,
@@ -750,48 +1213,74 @@ var _Freestore_serviceDesc = grpc.ServiceDesc{
 func init() { proto.RegisterFile("freestore.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 676 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xac, 0x55, 0x4f, 0x6f, 0xd3, 0x4e,
-	0x10, 0x95, 0xe3, 0x24, 0x6d, 0x26, 0x69, 0xda, 0x6e, 0xdb, 0xfc, 0x5c, 0xff, 0x5a, 0x9a, 0xba,
-	0x02, 0x85, 0x4b, 0x0f, 0xe5, 0x82, 0x40, 0x20, 0x04, 0x02, 0xa9, 0x82, 0x96, 0xca, 0x15, 0x42,
-	0x02, 0x89, 0xc8, 0xed, 0x4e, 0x5a, 0xab, 0xc9, 0x3a, 0x78, 0xd7, 0x40, 0xfb, 0x11, 0xb8, 0x73,
-	0xe5, 0xca, 0xd7, 0x44, 0xd9, 0x9d, 0x24, 0xb6, 0x13, 0x17, 0x0e, 0xdc, 0x3c, 0x7f, 0xdf, 0x9b,
-	0x97, 0xd9, 0x09, 0x2c, 0xf7, 0x62, 0x44, 0xa9, 0xa2, 0x18, 0xf7, 0x87, 0x71, 0xa4, 0x22, 0x56,
-	0x9b, 0x38, 0xbc, 0x87, 0x50, 0x3e, 0x41, 0x8c, 0x59, 0x0b, 0xaa, 0xc3, 0xe4, 0xec, 0x0a, 0xaf,
-	0x1d, 0xab, 0x6d, 0x75, 0x1a, 0x3e, 0x59, 0xcc, 0x81, 0x85, 0x80, 0xf3, 0x18, 0xa5, 0x74, 0x4a,
-	0x6d, 0xab, 0x53, 0xf3, 0xc7, 0xa6, 0xf7, 0x08, 0x56, 0x5f, 0x8b, 0xe8, 0xab, 0x18, 0x95, 0x4b,
-	0x1f, 0x3f, 0x27, 0x28, 0x15, 0xbb, 0x0b, 0x95, 0xe1, 0xc8, 0x76, 0xac, 0xb6, 0xdd, 0xa9, 0x1f,
-	0x2c, 0xef, 0x4f, 0xa1, 0x47, 0x79, 0xbe, 0x89, 0x7a, 0x8f, 0x81, 0xa5, 0x6b, 0xe5, 0x30, 0x12,
-	0x12, 0xff, 0xb6, 0xf8, 0x0b, 0xac, 0x1d, 0x05, 0x57, 0xf8, 0x22, 0x12, 0x2a, 0x0e, 0xce, 0xd5,
-	0x18, 0x7a, 0x07, 0xea, 0x12, 0xcf, 0x55, 0x14, 0x77, 0x65, 0x78, 0x83, 0x7a, 0x8c, 0x8a, 0x0f,
-	0xc6, 0x75, 0x1a, 0xde, 0x20, 0xdb, 0x83, 0xa5, 0xf3, 0x7e, 0x88, 0x42, 0x75, 0x69, 0xd2, 0x92,
-	0x9e, 0xb4, 0x61, 0x9c, 0x27, 0x66, 0xde, 0x4d, 0x58, 0xe4, 0xc1, 0xb5, 0xec, 0x8a, 0x64, 0xe0,
-	0xd8, 0xba, 0xc5, 0xc2, 0xc8, 0x3e, 0x4e, 0x06, 0xde, 0x3d, 0x58, 0xcf, 0xe2, 0x12, 0xed, 0x26,
-	0x94, 0x42, 0x4e, 0xb2, 0x95, 0x42, 0xee, 0x3d, 0x87, 0x8d, 0x97, 0xdf, 0x14, 0x0a, 0x9e, 0x67,
-	0x98, 0x4b, 0xcc, 0x60, 0x95, 0xb2, 0x58, 0x0e, 0xb4, 0xf2, 0x3d, 0x0c, 0x9a, 0x77, 0x1f, 0xfe,
-	0x1b, 0xfb, 0x8e, 0x50, 0x05, 0x3c, 0x50, 0x41, 0x41, 0x7f, 0xef, 0x87, 0x05, 0xce, 0x6c, 0x2e,
-	0xb1, 0xde, 0x06, 0xd2, 0xa6, 0x1b, 0x72, 0xa3, 0x78, 0xc3, 0xaf, 0x19, 0xcf, 0x21, 0x97, 0xec,
-	0x7f, 0xa8, 0x69, 0x6e, 0x7d, 0xec, 0x29, 0x22, 0xa7, 0xc9, 0xbe, 0xc1, 0xde, 0x8c, 0xd4, 0xf6,
-	0x8c, 0xd4, 0x5b, 0x50, 0x93, 0xe1, 0x85, 0x08, 0x54, 0x12, 0xa3, 0x53, 0xd6, 0x84, 0xa6, 0x0e,
-	0xef, 0xbb, 0x05, 0xab, 0x3e, 0x06, 0xfc, 0x54, 0x17, 0x14, 0xa9, 0xd3, 0x82, 0xaa, 0xe9, 0xa8,
-	0xe1, 0x6d, 0x9f, 0xac, 0x91, 0x3f, 0xea, 0xf5, 0x24, 0x2a, 0xc2, 0x25, 0x8b, 0x31, 0x28, 0x6b,
-	0x36, 0x65, 0xed, 0xd5, 0xdf, 0x6c, 0x17, 0x1a, 0xc3, 0x38, 0x8a, 0x7a, 0x5d, 0x81, 0xc8, 0x91,
-	0x3b, 0x95, 0xb6, 0xd5, 0x59, 0xf4, 0xeb, 0xda, 0x77, 0xac, 0x5d, 0xde, 0x53, 0x60, 0x69, 0x2e,
-	0xa4, 0x0e, 0x83, 0xf2, 0x48, 0x2d, 0xa2, 0xa3, 0xbf, 0xd9, 0x3a, 0x54, 0x74, 0x21, 0xed, 0x8d,
-	0x31, 0xbc, 0x9f, 0x16, 0xb0, 0xf7, 0x71, 0xa8, 0xf0, 0xdf, 0x4e, 0xd3, 0x82, 0x6a, 0x1f, 0xc5,
-	0x85, 0xba, 0xa4, 0x79, 0xc8, 0x9a, 0x10, 0xab, 0xa4, 0x88, 0x65, 0xd4, 0xae, 0xe6, 0xd5, 0xde,
-	0x80, 0xb5, 0x0c, 0x3f, 0xda, 0xa3, 0x4f, 0xb0, 0x74, 0x7a, 0x19, 0x87, 0xe2, 0xaa, 0x88, 0xf1,
-	0x0e, 0xd4, 0x45, 0x32, 0xe8, 0x1a, 0x9e, 0x92, 0x68, 0x83, 0x48, 0x06, 0xa6, 0x91, 0xcc, 0xc2,
-	0xda, 0x79, 0xd8, 0x15, 0x68, 0x8e, 0xfb, 0x13, 0xe2, 0x07, 0x68, 0xfa, 0x18, 0xc5, 0x1c, 0x0b,
-	0x45, 0x72, 0x61, 0x51, 0xc7, 0x43, 0x71, 0xe1, 0x94, 0xda, 0x76, 0xc7, 0xf6, 0x27, 0xf6, 0x1f,
-	0xd0, 0x56, 0x61, 0x79, 0xd2, 0xdb, 0xc0, 0x1d, 0xfc, 0x2a, 0x43, 0xed, 0xd5, 0xf8, 0x80, 0xb0,
-	0x43, 0x80, 0xe9, 0xc5, 0x61, 0x5b, 0xa9, 0xd3, 0x32, 0x73, 0xc4, 0xdc, 0xed, 0x82, 0x28, 0xed,
-	0xc6, 0x5b, 0x68, 0xa4, 0xef, 0x00, 0xbb, 0x93, 0x4a, 0x9f, 0x73, 0x98, 0xdc, 0x9d, 0xc2, 0x38,
-	0x35, 0x7c, 0x07, 0xcd, 0xec, 0x63, 0x67, 0xed, 0x54, 0xc9, 0xdc, 0x5b, 0xe2, 0xee, 0xde, 0x92,
-	0x41, 0x6d, 0x3f, 0xc2, 0x4a, 0xfe, 0xf5, 0x33, 0x2f, 0x55, 0x56, 0x70, 0x46, 0xdc, 0xbd, 0x5b,
-	0x73, 0xa8, 0xf9, 0x21, 0xc0, 0xf4, 0xd9, 0x64, 0xf4, 0x9c, 0x79, 0xd9, 0x19, 0x3d, 0xe7, 0xbc,
-	0xb5, 0x27, 0x50, 0x35, 0x9b, 0xc2, 0x9c, 0x54, 0x62, 0x66, 0x39, 0xdd, 0xcd, 0x39, 0x11, 0x2a,
-	0x7f, 0x06, 0x0b, 0xf4, 0xd3, 0xb3, 0xcd, 0x0c, 0x50, 0x7a, 0xd5, 0x5c, 0x77, 0x5e, 0xc8, 0x74,
-	0x38, 0xab, 0xea, 0x7f, 0xc5, 0x07, 0xbf, 0x03, 0x00, 0x00, 0xff, 0xff, 0xcc, 0x51, 0x9a, 0xe8,
-	0x28, 0x07, 0x00, 0x00,
+	// 1095 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0x03, 0xb5, 0x56, 0xdb, 0x6e, 0xdb, 0x46,
+	0x10, 0x05, 0x75, 0xd7, 0x48, 0x96, 0xe3, 0x4d, 0xe2, 0xc8, 0x8c, 0x13, 0x27, 0x0c, 0x0a, 0xa4,
+	0x40, 0x21, 0xa3, 0x6e, 0x8b, 0x06, 0xbd, 0x03, 0x69, 0x02, 0x04, 0x4d, 0x52, 0x83, 0x4a, 0xd0,
+	0x87, 0x3e, 0x08, 0xb4, 0x39, 0x94, 0x08, 0x4b, 0xa4, 0xca, 0xa5, 0x1c, 0xa7, 0x9f, 0xd0, 0x87,
+	0x16, 0x7d, 0x28, 0xf2, 0x1d, 0xfd, 0x80, 0x7e, 0x46, 0xff, 0xa7, 0xc3, 0xdd, 0x25, 0xb5, 0xa4,
+	0x28, 0xd5, 0x06, 0xda, 0x37, 0xce, 0xec, 0xec, 0xec, 0x99, 0x33, 0x37, 0xc2, 0xb6, 0x17, 0x21,
+	0xf2, 0x38, 0x8c, 0x70, 0x30, 0x8f, 0xc2, 0x38, 0x64, 0xed, 0x4c, 0x61, 0x1e, 0x8c, 0xc3, 0x70,
+	0x3c, 0xc5, 0x43, 0x71, 0x70, 0xb2, 0xf0, 0x0e, 0x63, 0x7f, 0x46, 0x47, 0xce, 0x6c, 0x2e, 0x6d,
+	0xad, 0x47, 0x50, 0x3b, 0x46, 0x8c, 0xd8, 0x2e, 0x34, 0xe6, 0x8b, 0x93, 0x33, 0x7c, 0xdb, 0x37,
+	0xee, 0x19, 0x0f, 0xbb, 0xb6, 0x92, 0x58, 0x1f, 0x9a, 0x8e, 0xeb, 0x46, 0xc8, 0x79, 0xbf, 0x42,
+	0x07, 0x6d, 0x3b, 0x15, 0xad, 0xcf, 0x60, 0xe7, 0xbb, 0x20, 0x7c, 0x13, 0x24, 0xd7, 0xb9, 0x8d,
+	0x3f, 0x2d, 0xc8, 0x2f, 0x7b, 0x0f, 0xea, 0xf3, 0x44, 0x26, 0x2f, 0xd5, 0x87, 0x9d, 0xa3, 0xed,
+	0xc1, 0x12, 0x5b, 0x62, 0x67, 0xcb, 0x53, 0xeb, 0x73, 0x60, 0xfa, 0x5d, 0x3e, 0x0f, 0x03, 0x8e,
+	0x97, 0xbd, 0x7c, 0x0e, 0xd7, 0x5f, 0x38, 0x67, 0xf8, 0x38, 0x0c, 0xe2, 0xc8, 0x39, 0x8d, 0xd3,
+	0xa7, 0x0f, 0xa0, 0xc3, 0xf1, 0x94, 0xac, 0x47, 0xdc, 0xff, 0x19, 0x45, 0x18, 0x75, 0x1b, 0xa4,
+	0x6a, 0x48, 0x1a, 0xf6, 0x00, 0xb6, 0x4e, 0xa7, 0x3e, 0x06, 0xf1, 0x48, 0x45, 0x5a, 0x11, 0x91,
+	0x76, 0xa5, 0xf2, 0x58, 0xc6, 0xbb, 0x07, 0x2d, 0xd7, 0x79, 0xcb, 0x47, 0xc1, 0x62, 0xd6, 0xaf,
+	0x0a, 0x17, 0xcd, 0x44, 0x7e, 0xb9, 0x98, 0x59, 0x7f, 0x1a, 0xb0, 0x95, 0x3e, 0x3a, 0x8c, 0x9d,
+	0x18, 0x59, 0x0f, 0x2a, 0xbe, 0xab, 0x08, 0xa3, 0x2f, 0x66, 0x42, 0x2b, 0xc2, 0x73, 0x9f, 0xfb,
+	0x61, 0x20, 0x9c, 0x57, 0xed, 0x4c, 0x66, 0x77, 0x40, 0x61, 0x19, 0xf9, 0x2e, 0x27, 0xd7, 0x55,
+	0xba, 0xd3, 0x96, 0x9a, 0x67, 0x2e, 0x2f, 0xa2, 0xaf, 0xad, 0xa0, 0xff, 0x18, 0x9a, 0x78, 0x31,
+	0xf7, 0x89, 0xfa, 0x7e, 0x9d, 0x0e, 0x3b, 0x47, 0xe6, 0x40, 0xe6, 0x76, 0x90, 0xe6, 0x76, 0xf0,
+	0x2a, 0xcd, 0xad, 0x9d, 0x9a, 0x5a, 0xbf, 0x19, 0xd0, 0x19, 0xfa, 0xe3, 0x00, 0x5d, 0x89, 0x78,
+	0x00, 0x75, 0x9e, 0x7c, 0x08, 0xd0, 0x9d, 0xa3, 0xbe, 0x46, 0x71, 0x2e, 0x34, 0x5b, 0x9a, 0x51,
+	0x4a, 0x7a, 0x93, 0x90, 0xc7, 0x04, 0x6a, 0x1c, 0x38, 0xf1, 0x22, 0x42, 0x45, 0xda, 0x56, 0xa2,
+	0x1d, 0xa6, 0x4a, 0xf6, 0x3e, 0x5c, 0x53, 0xd4, 0x2e, 0x0d, 0xab, 0xc2, 0x70, 0x5b, 0xea, 0x33,
+	0x53, 0xeb, 0x57, 0x03, 0x5a, 0x4f, 0xce, 0x7d, 0x17, 0x83, 0xd3, 0x04, 0x4e, 0x63, 0x4a, 0xcf,
+	0xf0, 0x58, 0xe1, 0xd9, 0xd5, 0xf0, 0x68, 0xb0, 0x6d, 0x65, 0x45, 0x24, 0x10, 0xa1, 0xf3, 0x30,
+	0x8a, 0xd1, 0x15, 0x40, 0x36, 0x45, 0x90, 0x59, 0xb2, 0x7d, 0x68, 0x17, 0x61, 0x2d, 0x15, 0xd6,
+	0x2b, 0xb8, 0x91, 0x2f, 0x27, 0x55, 0x8d, 0xc5, 0xe4, 0x7e, 0x90, 0x52, 0x57, 0xd9, 0x08, 0x55,
+	0x1a, 0x59, 0xef, 0x0c, 0xb8, 0xf9, 0xe4, 0x22, 0xc6, 0xc0, 0x2d, 0xd6, 0x69, 0xd1, 0xaf, 0x5e,
+	0x71, 0x95, 0x5c, 0xc5, 0xb1, 0x4f, 0xa0, 0x1d, 0xe0, 0x9b, 0x91, 0x7c, 0xb6, 0xfa, 0x6f, 0xf1,
+	0x92, 0xa9, 0x4c, 0x72, 0x2e, 0xde, 0x5a, 0x31, 0xde, 0xaf, 0x61, 0xb7, 0x08, 0x2c, 0xeb, 0xbf,
+	0x62, 0xb2, 0x8d, 0x92, 0x64, 0x93, 0x83, 0x5b, 0xe9, 0xd5, 0x17, 0x18, 0x3b, 0xae, 0x13, 0x3b,
+	0xeb, 0x62, 0xbb, 0x01, 0xf5, 0x20, 0xa4, 0x44, 0xab, 0xaa, 0x91, 0x82, 0xf5, 0xae, 0x02, 0xfd,
+	0x55, 0x0f, 0x0a, 0x44, 0xbe, 0x4f, 0x8c, 0x62, 0x9f, 0xdc, 0x86, 0xb6, 0x60, 0x6b, 0x8a, 0x5e,
+	0xac, 0xe8, 0x12, 0xf4, 0x3d, 0x27, 0xb9, 0xd8, 0x44, 0xd5, 0x95, 0x26, 0xda, 0xc8, 0xcc, 0xb2,
+	0x39, 0xea, 0x97, 0x6b, 0x8e, 0xb2, 0xaa, 0x6f, 0x94, 0x56, 0x7d, 0x09, 0xb5, 0xcd, 0x32, 0x6a,
+	0x7f, 0x31, 0x60, 0xc7, 0x46, 0xc7, 0x1d, 0x0a, 0xc8, 0xeb, 0x58, 0xa5, 0x59, 0x2d, 0x63, 0x52,
+	0x43, 0x46, 0x49, 0x89, 0x3e, 0xf4, 0x3c, 0x8e, 0xb1, 0x8a, 0x5c, 0x49, 0x8c, 0x41, 0x4d, 0x1b,
+	0x2a, 0xe2, 0x9b, 0xdd, 0x87, 0x2e, 0xcd, 0x8d, 0xd0, 0x1b, 0x05, 0x88, 0x2e, 0x75, 0x53, 0x12,
+	0x72, 0xcb, 0xee, 0x08, 0xdd, 0x4b, 0xa1, 0xb2, 0xbe, 0x02, 0xa6, 0x63, 0x51, 0xf9, 0x21, 0x67,
+	0x49, 0xbe, 0x14, 0x1c, 0xf1, 0x9d, 0xa4, 0x59, 0x5c, 0x4c, 0xd3, 0x2c, 0x04, 0x6a, 0x2c, 0xb0,
+	0x9d, 0x60, 0x8c, 0xc7, 0x89, 0x24, 0x16, 0x4c, 0x84, 0x9e, 0x7f, 0x91, 0x2d, 0x18, 0x21, 0x89,
+	0x60, 0x16, 0x5e, 0xa2, 0x97, 0x97, 0x95, 0x94, 0xe8, 0x27, 0x0e, 0x9f, 0x60, 0x3a, 0x2b, 0x95,
+	0x44, 0xa8, 0x60, 0x88, 0xe3, 0x19, 0xb1, 0x6b, 0xa3, 0xa7, 0x51, 0x61, 0xe4, 0xa8, 0xa0, 0xb5,
+	0xc5, 0xa5, 0x55, 0xda, 0x53, 0x4a, 0xb4, 0x5e, 0xc3, 0xb5, 0xc7, 0x13, 0x67, 0x3a, 0x45, 0x42,
+	0xb6, 0x8e, 0xe0, 0x0f, 0xa1, 0xa5, 0xcc, 0x93, 0xad, 0x97, 0xec, 0xa2, 0x9b, 0x7a, 0xb7, 0x67,
+	0xcf, 0xdb, 0x99, 0x19, 0x6d, 0xc3, 0xae, 0xd2, 0xcb, 0x70, 0xcb, 0x68, 0x5a, 0x86, 0x54, 0xc9,
+	0x85, 0xf4, 0x2d, 0xec, 0x68, 0x90, 0x14, 0xcf, 0x87, 0x09, 0x5f, 0xe4, 0x29, 0xdd, 0x86, 0xb7,
+	0x56, 0x11, 0x88, 0x97, 0x6c, 0x65, 0x66, 0xfd, 0x6d, 0x00, 0xfb, 0x21, 0xf2, 0x63, 0xfc, 0x6f,
+	0x8b, 0x87, 0xf4, 0x09, 0xb0, 0x78, 0xa2, 0xca, 0x47, 0x49, 0x59, 0x80, 0x75, 0x2d, 0xc0, 0x5c,
+	0x7b, 0x35, 0x8a, 0xed, 0x95, 0x9b, 0x66, 0xcd, 0xcb, 0x4e, 0x33, 0xeb, 0x0b, 0xb8, 0x9e, 0x0b,
+	0xeb, 0x6a, 0xc3, 0xea, 0x0f, 0x5a, 0xda, 0xc3, 0x49, 0xe4, 0x07, 0x67, 0xeb, 0x08, 0xa1, 0xa1,
+	0x41, 0xa3, 0x77, 0x24, 0x69, 0xe0, 0x8a, 0x15, 0x20, 0x95, 0x7c, 0x90, 0x6f, 0x5e, 0x1f, 0xf9,
+	0xa8, 0x6a, 0x97, 0x8e, 0xea, 0x53, 0xe8, 0xa5, 0xb0, 0xae, 0x16, 0xd0, 0xef, 0x06, 0xf4, 0x6c,
+	0x0c, 0x23, 0x17, 0xd7, 0xa6, 0x98, 0x7e, 0x43, 0xc4, 0xb9, 0x1f, 0x8c, 0x45, 0xa5, 0xd1, 0x6f,
+	0x48, 0x2a, 0xff, 0x3f, 0xc1, 0x3c, 0x82, 0xed, 0x0c, 0xd2, 0x95, 0xa2, 0x39, 0xfa, 0xab, 0x0e,
+	0xed, 0xa7, 0xa9, 0x7f, 0xf6, 0x0c, 0x60, 0xf9, 0x5b, 0xc8, 0xf6, 0xb5, 0x97, 0x57, 0xfe, 0x34,
+	0xcd, 0x3b, 0x6b, 0x4e, 0xd5, 0xfb, 0xdf, 0x43, 0x57, 0xdf, 0xea, 0xec, 0xae, 0x66, 0x5e, 0xf2,
+	0xf7, 0x68, 0x1e, 0xac, 0x3d, 0x57, 0x0e, 0x5f, 0x43, 0x2f, 0xbf, 0x36, 0xd9, 0x3d, 0xed, 0x4a,
+	0xe9, 0xaa, 0x37, 0xef, 0x6f, 0xb0, 0x50, 0x6e, 0x7f, 0xa4, 0x71, 0x54, 0x58, 0x85, 0xcc, 0x2a,
+	0xa1, 0xbc, 0xb0, 0x69, 0xcd, 0x07, 0x1b, 0x6d, 0x94, 0x73, 0xe2, 0x73, 0x39, 0xc1, 0x73, 0x7c,
+	0xae, 0x2c, 0x99, 0x1c, 0x9f, 0x25, 0x63, 0xff, 0x29, 0xb4, 0xb3, 0x19, 0xc5, 0x6e, 0xeb, 0x8f,
+	0x17, 0x86, 0xa9, 0xb9, 0x5f, 0x7e, 0xa8, 0xfc, 0x3c, 0x87, 0x8e, 0xd6, 0xcd, 0x4c, 0x7f, 0x75,
+	0x75, 0x78, 0x99, 0x77, 0xd7, 0x1d, 0x2b, 0x6f, 0x5f, 0x42, 0x43, 0x76, 0x11, 0xd3, 0xcb, 0x34,
+	0xd7, 0xef, 0xe6, 0x5e, 0xc9, 0x89, 0xba, 0xfe, 0x0d, 0x34, 0x55, 0xdd, 0xb2, 0xbd, 0x5c, 0xf8,
+	0x7a, 0x7b, 0x99, 0x66, 0xd9, 0x91, 0xf4, 0x70, 0xd2, 0x10, 0x3f, 0xdf, 0x1f, 0xfd, 0x03, 0xc9,
+	0x8b, 0x5f, 0xd7, 0x84, 0x0d, 0x00, 0x00,
 }
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// RemoveExpired removes expired contracts and their sectors.
+// It returns the number of removed contracts.
+func (s *Server) RemoveExpired() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	removed := 0
+	var firstErr error
+	for id, c := range s.contracts {
+		c.mu.Lock()
+		if days, err := s.daysLeft(c); err != nil {
+			// Keep the data: the contract may be repaired by hand.
+			log.Printf("Contract %x: %v.", id, err)
+			c.mu.Unlock()
+			continue
+		} else if days > 0 {
+			c.mu.Unlock()
+			continue
+		}
+		if !c.removed {
+			// Requests waiting for c.mu must check this flag.
+			// The contract can not be used anymore, so its quota
+			// is released even if its files can not be removed.
+			c.removed = true
+			if err := c.close(); err != nil {
+				log.Printf("Contract %x: failed to close the data file: %v.", id, err)
+			}
+			s.quota.release(c.numSectors() * int64(c.db.SectorSize))
+			s.quota.removeContract(c.db.ClientPubkey)
+		}
+		err := c.remove()
+		c.mu.Unlock()
+		if err != nil {
+			// The contract stays in the map, the removal of
+			// its files is retried next time.
+			if firstErr == nil {
+				firstErr = fmt.Errorf("contract %x: %v", id, err)
+			}
+			continue
+		}
+		delete(s.contracts, id)
+		removed++
+	}
+	return removed, firstErr
+}
+
+// Start starts the background removal of expired contracts and
+// checking of peers.
+func (s *Server) Start(expireInterval, checkPeersInterval time.Duration) error {
+	s.stopChan = make(chan struct{})
+	s.finChan = make(chan struct{})
+	go func() {
+		defer close(s.finChan)
+		expireTicker := time.NewTicker(expireInterval)
+		defer expireTicker.Stop()
+		peersTicker := time.NewTicker(checkPeersInterval)
+		defer peersTicker.Stop()
+		for {
+			select {
+			case <-s.stopChan:
+				return
+			case <-expireTicker.C:
+				n, err := s.RemoveExpired()
+				if err != nil {
+					log.Printf("RemoveExpired: %v.", err)
+				}
+				if n > 0 {
+					log.Printf("Removed %d expired contracts.", n)
+				}
+			case <-peersTicker.C:
+				if err := s.CheckPeers(context.Background()); err != nil {
+					log.Printf("CheckPeers: %v.", err)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop stops the background tasks started by Start.
+func (s *Server) Stop() error {
+	close(s.stopChan)
+	<-s.finChan
+	return nil
+}
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sync"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Limits restrict the contracts accepted by the host.
+// Zero values mean no limit.
+type Limits struct {
+	// Total size of sectors of all contracts, in bytes. It is a
+	// logical limit: data files also have free slots. Preallocation
+	// of free slots is capped by the remaining budget, and an
+	// overwrite holds one more slot until it is committed.
+	DiskBudget int64 `json:"disk_budget"`
+	// Number of active contracts of one client.
+	MaxContractsPerClient int `json:"max_contracts_per_client"`
+	// Allowed sector sizes. Any size up to 64 MiB if empty.
+	SectorSizes []int32 `json:"sector_sizes"`
+	// Maximum number of days left before a contract expires.
+	MaxDays int32 `json:"max_days"`
+}
+
+// LoadLimits reads limits from JSON file.
+func LoadLimits(file string) (Limits, error) {
+	var limits Limits
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return limits, fmt.Errorf("ioutil.ReadFile(%q): %v", file, err)
+	}
+	if err := json.Unmarshal(data, &limits); err != nil {
+		return limits, fmt.Errorf("json.Unmarshal(%q): %v", file, err)
+	}
+	if limits.DiskBudget < 0 || limits.MaxContractsPerClient < 0 || limits.MaxDays < 0 {
+		return limits, fmt.Errorf("negative limit in %q", file)
+	}
+	for _, size := range limits.SectorSizes {
+		if size <= 0 || size > maxSectorSize {
+			return limits, fmt.Errorf("bad sector size %d in %q", size, file)
+		}
+	}
+	return limits, nil
+}
+
+// quota tracks the usage of resources limited by Limits.
+type quota struct {
+	limits Limits
+
+	used    int64          // Total size of sectors.
+	clients map[string]int // Number of contracts of each client.
+	mu      sync.Mutex
+}
+
+func newQuota(limits Limits, contracts map[string]*contract) *quota {
+	q := &quota{
+		limits:  limits,
+		clients: make(map[string]int),
+	}
+	for _, c := range contracts {
+		q.used += c.numSectors() * int64(c.db.SectorSize)
+		q.clients[string(c.db.ClientPubkey)]++
+	}
+	return q
+}
+
+// checkContract checks the parameters of a new contract.
+func (q *quota) checkContract(sectorSize, days int32) error {
+	if sectorSize <= 0 || sectorSize > maxSectorSize {
+		return status.Errorf(codes.InvalidArgument, "bad sector size: %d", sectorSize)
+	}
+	if len(q.limits.SectorSizes) != 0 {
+		allowed := false
+		for _, size := range q.limits.SectorSizes {
+			if size == sectorSize {
+				allowed = true
+			}
+		}
+		if !allowed {
+			return status.Errorf(codes.InvalidArgument, "sector size %d is not allowed, allowed sizes: %v", sectorSize, q.limits.SectorSizes)
+		}
+	}
+	return q.checkDays(days)
+}
+
+// checkDays checks the number of days left before a contract expires.
+func (q *quota) checkDays(days int32) error {
+	if q.limits.MaxDays != 0 && days > q.limits.MaxDays {
+		return status.Errorf(codes.InvalidArgument, "contract for %d days, at most %d days are allowed", days, q.limits.MaxDays)
+	}
+	return nil
+}
+
+// addContract reserves a contract of the client.
+func (q *quota) addContract(clientPubkey []byte) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.limits.DiskBudget != 0 && q.used >= q.limits.DiskBudget {
+		return status.Errorf(codes.ResourceExhausted, "no disk space")
+	}
+	n := q.clients[string(clientPubkey)]
+	if q.limits.MaxContractsPerClient != 0 && n >= q.limits.MaxContractsPerClient {
+		return status.Errorf(codes.ResourceExhausted, "the client has %d contracts, the limit is %d", n, q.limits.MaxContractsPerClient)
+	}
+	q.clients[string(clientPubkey)] = n + 1
+	return nil
+}
+
+func (q *quota) removeContract(clientPubkey []byte) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.clients[string(clientPubkey)]--
+	if q.clients[string(clientPubkey)] <= 0 {
+		delete(q.clients, string(clientPubkey))
+	}
+}
+
+// reserve reserves disk space for new sectors.
+func (q *quota) reserve(bytes int64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.limits.DiskBudget != 0 && q.used+bytes > q.limits.DiskBudget {
+		return status.Errorf(codes.ResourceExhausted, "no disk space: %d of %d bytes used", q.used, q.limits.DiskBudget)
+	}
+	q.used += bytes
+	return nil
+}
+
+// spare returns the disk space left in the budget
+// or -1 if there is no budget.
+func (q *quota) spare() int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.limits.DiskBudget == 0 {
+		return -1
+	}
+	if left := q.limits.DiskBudget - q.used; left > 0 {
+		return left
+	}
+	return 0
+}
+
+// release returns disk space of removed sectors.
+func (q *quota) release(bytes int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.used -= bytes
+}
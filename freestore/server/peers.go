@@ -0,0 +1,213 @@
+package server
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"golang.org/x/net/context"
+
+	"github.com/starius/invisiblefs/atomicfile"
+	"github.com/starius/invisiblefs/freestore/discovery"
+	"github.com/starius/invisiblefs/freestore/hostdb"
+	fpb "github.com/starius/invisiblefs/freestore/proto"
+)
+
+const (
+	peersFile = "peers"
+	// Peers not seen for this time are removed.
+	peerTTL = 3 * day
+	// Limits protecting the host from gossip flood.
+	maxPeers    = 1000
+	maxChecking = 16
+	// Timeout of a single check.
+	checkTimeout = 30 * time.Second
+)
+
+// checkFunc checks that the peer is alive and controls its pubkey.
+type checkFunc func(ctx context.Context, peer *fpb.Peer) error
+
+func checkPeer(ctx context.Context, peer *fpb.Peer) error {
+	_, err := discovery.Check(ctx, peer, nil)
+	return err
+}
+
+// peerTable stores checked peers. New peers are added only after
+// a successful check.
+type peerTable struct {
+	file  string
+	peers map[string]*hostdb.Peer // Key is pubkey.
+
+	// Keys are pubkey and address of peers being checked.
+	checking map[string]bool
+	wg       sync.WaitGroup
+
+	mu sync.Mutex
+
+	check   checkFunc
+	timeout time.Duration
+	now     func() time.Time
+}
+
+func loadPeers(dir string) (*peerTable, error) {
+	t := &peerTable{
+		file:     filepath.Join(dir, peersFile),
+		peers:    make(map[string]*hostdb.Peer),
+		checking: make(map[string]bool),
+		check:    checkPeer,
+		timeout:  checkTimeout,
+		now:      time.Now,
+	}
+	dump, err := ioutil.ReadFile(t.file)
+	if os.IsNotExist(err) {
+		return t, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("ioutil.ReadFile(%q): %v", t.file, err)
+	}
+	db := &hostdb.Peers{}
+	if err := proto.Unmarshal(dump, db); err != nil {
+		return nil, fmt.Errorf("proto.Unmarshal(%q): %v", t.file, err)
+	}
+	for _, peer := range db.Peers {
+		t.peers[string(peer.Pubkey)] = peer
+	}
+	return t, nil
+}
+
+// save writes the peers atomically. Run under t.mu.Lock().
+func (t *peerTable) save() error {
+	db := &hostdb.Peers{}
+	for _, peer := range t.peers {
+		db.Peers = append(db.Peers, peer)
+	}
+	dump, err := proto.Marshal(db)
+	if err != nil {
+		return fmt.Errorf("proto.Marshal: %v", err)
+	}
+	return atomicfile.WriteFile(t.file, dump)
+}
+
+// list returns the known peers.
+func (t *peerTable) list() []*fpb.Peer {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var peers []*fpb.Peer
+	for _, peer := range t.peers {
+		peers = append(peers, &fpb.Peer{
+			Pubkey:  peer.Pubkey,
+			Address: peer.Address,
+		})
+	}
+	return peers
+}
+
+// seen records a successful check of the peer. Run under t.mu.Lock().
+func (t *peerTable) seen(peer *fpb.Peer) error {
+	lastSeen, err := ptypes.TimestampProto(t.now())
+	if err != nil {
+		return fmt.Errorf("ptypes.TimestampProto: %v", err)
+	}
+	t.peers[string(peer.Pubkey)] = &hostdb.Peer{
+		Pubkey:   peer.Pubkey,
+		Address:  peer.Address,
+		LastSeen: lastSeen,
+	}
+	return nil
+}
+
+// gossip checks peers received from another peer in background and
+// adds the ones passing the check.
+func (t *peerTable) gossip(peers []*fpb.Peer) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, peer := range peers {
+		if len(peer.Pubkey) == 0 || peer.Address == "" {
+			continue
+		}
+		known, has := t.peers[string(peer.Pubkey)]
+		if has && known.Address == peer.Address {
+			continue
+		}
+		if !has && len(t.peers) >= maxPeers {
+			continue
+		}
+		key := string(peer.Pubkey) + "\x00" + peer.Address
+		if t.checking[key] || len(t.checking) >= maxChecking {
+			continue
+		}
+		t.checking[key] = true
+		peer := &fpb.Peer{
+			Pubkey:  peer.Pubkey,
+			Address: peer.Address,
+		}
+		t.wg.Add(1)
+		go func() {
+			defer t.wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), t.timeout)
+			err := t.check(ctx, peer)
+			cancel()
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			delete(t.checking, key)
+			if err != nil {
+				return
+			}
+			if err := t.seen(peer); err != nil {
+				log.Printf("Failed to add peer: %v.", err)
+				return
+			}
+			if err := t.save(); err != nil {
+				log.Printf("Failed to save peers: %v.", err)
+			}
+		}()
+	}
+}
+
+// refresh checks all known peers and removes the ones not seen
+// for peerTTL.
+func (t *peerTable) refresh(ctx context.Context) error {
+	peers := t.list()
+	errs := make([]error, len(peers))
+	var wg sync.WaitGroup
+	for i, peer := range peers {
+		wg.Add(1)
+		go func(i int, peer *fpb.Peer) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, t.timeout)
+			defer cancel()
+			errs[i] = t.check(ctx, peer)
+		}(i, peer)
+	}
+	wg.Wait()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i, peer := range peers {
+		known, has := t.peers[string(peer.Pubkey)]
+		if !has || known.Address != peer.Address {
+			// Changed during the check.
+			continue
+		}
+		if errs[i] == nil {
+			if err := t.seen(peer); err != nil {
+				return err
+			}
+			continue
+		}
+		lastSeen, err := ptypes.Timestamp(known.LastSeen)
+		if err != nil || t.now().Sub(lastSeen) > peerTTL {
+			delete(t.peers, string(peer.Pubkey))
+		}
+	}
+	return t.save()
+}
+
+// wait waits for background checks to finish.
+func (t *peerTable) wait() {
+	t.wg.Wait()
+}
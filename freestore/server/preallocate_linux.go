@@ -0,0 +1,16 @@
+package server
+
+import (
+	"os"
+	"syscall"
+)
+
+// preallocate allocates disk space for the range of the file
+// and extends the file if needed.
+func preallocate(f *os.File, offset, size int64) error {
+	err := syscall.Fallocate(int(f.Fd()), 0, offset, size)
+	if err == syscall.EOPNOTSUPP {
+		return f.Truncate(offset + size)
+	}
+	return err
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package server
+
+import (
+	"os"
+)
+
+// preallocate extends the file to cover the range.
+func preallocate(f *os.File, offset, size int64) error {
+	return f.Truncate(offset + size)
+}
@@ -1,52 +1,514 @@
 package server
 
 import (
+	"crypto/rand"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 
+	"github.com/starius/invisiblefs/freestore/hostdb"
 	fpb "github.com/starius/invisiblefs/freestore/proto"
+	"github.com/starius/invisiblefs/freestore/sign"
+	"github.com/starius/invisiblefs/freestore/state"
+	"github.com/starius/invisiblefs/merkle"
+	"github.com/starius/invisiblefs/pubkey"
 )
 
-type Pubkey struct {
-	// TODO
-}
+const (
+	day           = 24 * time.Hour
+	maxSectorSize = 64 * 1024 * 1024
+	idSize        = 32
+
+	// Maximum number of segments and distinct sectors in one challenge.
+	maxChallengeSegments = 1024
+	maxChallengeSectors  = 16
+)
 
 type Server struct {
-	peers map[string]Pubkey
+	dir  string
+	priv []byte
+
+	contracts map[string]*contract
+	mu        sync.Mutex
+
+	peers *peerTable
+	quota *quota
+
+	stopChan chan struct{}
+	finChan  chan struct{}
+
+	now func() time.Time
 }
 
-func NewServer() (*Server, error) {
+// NewServer creates the server storing contracts in dir.
+// priv is the private key of the host used to sign metadata.
+// New contracts and writes must fit in limits.
+func NewServer(dir string, priv []byte, limits Limits) (*Server, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("os.MkdirAll(%q): %v", dir, err)
+	}
+	contracts, err := loadContracts(dir)
+	if err != nil {
+		return nil, err
+	}
+	peers, err := loadPeers(dir)
+	if err != nil {
+		return nil, err
+	}
 	server := &Server{
-		peers: make(map[string]Pubkey),
+		dir:       dir,
+		priv:      priv,
+		contracts: contracts,
+		peers:     peers,
+		quota:     newQuota(limits, contracts),
+		now:       time.Now,
+	}
+	peers.now = func() time.Time {
+		return server.now()
 	}
 	return server, nil
 }
 
+func (s *Server) Close() error {
+	s.peers.wait()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.contracts {
+		c.mu.Lock()
+		var err error
+		if !c.removed {
+			err = c.close()
+		}
+		c.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getContract returns the contract locked. The caller must unlock it.
+func (s *Server) getContract(id []byte) (*contract, error) {
+	s.mu.Lock()
+	c, has := s.contracts[string(id)]
+	s.mu.Unlock()
+	if !has {
+		return nil, status.Errorf(codes.NotFound, "no such contract")
+	}
+	c.mu.Lock()
+	if c.removed {
+		c.mu.Unlock()
+		return nil, status.Errorf(codes.NotFound, "no such contract")
+	}
+	if days, err := s.daysLeft(c); err != nil {
+		c.mu.Unlock()
+		log.Printf("s.daysLeft: %v.", err)
+		return nil, status.Errorf(codes.Internal, "bad expiration time of the contract")
+	} else if days == 0 {
+		c.mu.Unlock()
+		return nil, status.Errorf(codes.FailedPrecondition, "the contract has expired")
+	}
+	return c, nil
+}
+
+// daysLeft returns the number of started days before the contract expires.
+// Run under c.mu.Lock().
+func (s *Server) daysLeft(c *contract) (int32, error) {
+	expires, err := ptypes.Timestamp(c.db.Expires)
+	if err != nil {
+		return 0, fmt.Errorf("ptypes.Timestamp: %v", err)
+	}
+	left := expires.Sub(s.now())
+	if left <= 0 {
+		return 0, nil
+	}
+	return int32((left + day - 1) / day), nil
+}
+
+// CheckPeers checks all known peers and forgets the ones
+// which have been dead for a long time.
+func (s *Server) CheckPeers(ctx context.Context) error {
+	return s.peers.refresh(ctx)
+}
+
 func (s *Server) KnownPeers(ctx context.Context, req *fpb.KnownPeersRequest) (*fpb.KnownPeersResponse, error) {
-	return nil, status.Errorf(codes.Unimplemented, "todo")
+	res := &fpb.KnownPeersResponse{
+		Peers: s.peers.list(),
+	}
+	// Peers from the request are added after they pass the check.
+	s.peers.gossip(req.Peers)
+	return res, nil
+}
+
+// signState returns the host signature of the state.
+func (s *Server) signState(state *fpb.ContractState) ([]byte, error) {
+	signature, err := pubkey.Sign(s.priv, sign.State(state))
+	if err != nil {
+		log.Printf("pubkey.Sign: %v.", err)
+		return nil, status.Errorf(codes.Internal, "failed to sign state")
+	}
+	return signature, nil
+}
+
+// checkUpdate checks that the state proposed by the client is equal to
+// the state computed by the host and is signed by the client.
+// Run under c.mu.Lock().
+func checkUpdate(c *contract, want, proposed *fpb.ContractState, clientSignature []byte) error {
+	if !proto.Equal(want, proposed) {
+		return status.Errorf(codes.FailedPrecondition, "new state does not match the state of revision %d", want.Revision)
+	}
+	if err := pubkey.Verify(c.db.ClientPubkey, sign.State(proposed), clientSignature); err != nil {
+		return status.Errorf(codes.PermissionDenied, "bad signature: %v", err)
+	}
+	return nil
+}
+
+// commit applies the new state checked by checkUpdate using apply and
+// returns the host signature of it. Run under c.mu.Lock().
+func (s *Server) commit(st *fpb.ContractState, apply func() error) ([]byte, error) {
+	hostSignature, err := s.signState(st)
+	if err != nil {
+		return nil, err
+	}
+	if err := apply(); err != nil {
+		log.Printf("Failed to save contract: %v.", err)
+		return nil, status.Errorf(codes.Internal, "failed to save contract")
+	}
+	return hostSignature, nil
 }
 
 func (s *Server) MakeContract(ctx context.Context, req *fpb.MakeContractRequest) (*fpb.MakeContractResponse, error) {
-	return nil, status.Errorf(codes.Unimplemented, "todo")
+	if req.DaysNum <= 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "bad number of days: %d", req.DaysNum)
+	}
+	if err := s.quota.checkContract(req.SectorSize, req.DaysNum); err != nil {
+		return nil, err
+	}
+	if _, err := x509.ParseCertificate(req.ClientPubkey); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "bad client pubkey: %v", err)
+	}
+	if err := s.quota.addContract(req.ClientPubkey); err != nil {
+		return nil, err
+	}
+	st, err := s.createContract(req)
+	if err != nil {
+		s.quota.removeContract(req.ClientPubkey)
+		return nil, err
+	}
+	hostSignature, err := s.signState(st)
+	if err != nil {
+		return nil, err
+	}
+	return &fpb.MakeContractResponse{
+		Id: st.Id,
+		State: &fpb.SignedState{
+			State:         st,
+			HostSignature: hostSignature,
+		},
+	}, nil
+}
+
+// createContract creates the contract and returns its initial state.
+func (s *Server) createContract(req *fpb.MakeContractRequest) (*fpb.ContractState, error) {
+	id := make([]byte, idSize)
+	if _, err := rand.Read(id); err != nil {
+		return nil, status.Errorf(codes.Internal, "rand.Read: %v", err)
+	}
+	expires, err := ptypes.TimestampProto(s.now().Add(time.Duration(req.DaysNum) * day))
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "bad number of days: %v", err)
+	}
+	db := &hostdb.Contract{
+		Id:           id,
+		ClientPubkey: req.ClientPubkey,
+		SectorSize:   req.SectorSize,
+		Expires:      expires,
+	}
+	c, err := createContract(s.dir, db)
+	if err != nil {
+		log.Printf("createContract: %v.", err)
+		return nil, status.Errorf(codes.Internal, "failed to create contract")
+	}
+	st := c.state()
+	s.mu.Lock()
+	s.contracts[string(id)] = c
+	s.mu.Unlock()
+	return st, nil
 }
 
 func (s *Server) ExtendContract(ctx context.Context, req *fpb.ExtendContractRequest) (*fpb.ExtendContractResponse, error) {
-	return nil, status.Errorf(codes.Unimplemented, "todo")
+	if req.DaysNum <= 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "bad number of days: %d", req.DaysNum)
+	}
+	c, err := s.getContract(req.Id)
+	if err != nil {
+		return nil, err
+	}
+	defer c.mu.Unlock()
+	// getContract has checked the expiration time.
+	days, _ := s.daysLeft(c)
+	if err := s.quota.checkDays(days + req.DaysNum); err != nil {
+		return nil, err
+	}
+	want, err := state.Extend(c.state(), req.DaysNum)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	if err := checkUpdate(c, want, req.NewState, req.Signature); err != nil {
+		return nil, err
+	}
+	hostSignature, err := s.commit(want, func() error {
+		return c.commit(want, req.Signature, c.db.Slots)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &fpb.ExtendContractResponse{HostSignature: hostSignature}, nil
 }
 
 func (s *Server) ContractMetadata(ctx context.Context, req *fpb.ContractMetadataRequest) (*fpb.ContractMetadataResponse, error) {
-	return nil, status.Errorf(codes.Unimplemented, "todo")
+	c, err := s.getContract(req.Id)
+	if err != nil {
+		return nil, err
+	}
+	defer c.mu.Unlock()
+	st := c.state()
+	// getContract has checked the expiration time.
+	days, _ := s.daysLeft(c)
+	res := &fpb.ContractMetadataResponse{
+		SectorIds:       c.db.SectorIds,
+		DaysLeft:        days,
+		SectorSize:      c.db.SectorSize,
+		State:           st,
+		ClientSignature: c.db.ClientSignature,
+	}
+	res.Signature, err = pubkey.Sign(s.priv, sign.Metadata(st, req.Nonce))
+	if err != nil {
+		log.Printf("pubkey.Sign: %v.", err)
+		return nil, status.Errorf(codes.Internal, "failed to sign metadata")
+	}
+	res.HostSignature, err = pubkey.Sign(s.priv, sign.State(st))
+	if err != nil {
+		log.Printf("pubkey.Sign: %v.", err)
+		return nil, status.Errorf(codes.Internal, "failed to sign state")
+	}
+	return res, nil
 }
 
 func (s *Server) ReadSector(ctx context.Context, req *fpb.ReadSectorRequest) (*fpb.ReadSectorResponse, error) {
-	return nil, status.Errorf(codes.Unimplemented, "todo")
+	c, err := s.getContract(req.Id)
+	if err != nil {
+		return nil, err
+	}
+	defer c.mu.Unlock()
+	if req.Sector < 0 || req.Sector >= c.numSectors() {
+		return nil, status.Errorf(codes.OutOfRange, "no sector %d", req.Sector)
+	}
+	if req.Offset < 0 || req.Size <= 0 || int64(req.Offset)+int64(req.Size) > int64(c.db.SectorSize) {
+		return nil, status.Errorf(codes.OutOfRange, "bad range [%d, %d)", req.Offset, req.Offset+req.Size)
+	}
+	data, err := c.readSector(req.Sector, int(req.Offset), int(req.Size))
+	if err != nil {
+		log.Printf("c.readSector: %v.", err)
+		return nil, status.Errorf(codes.Internal, "failed to read sector")
+	}
+	res := &fpb.ReadSectorResponse{Data: data}
+	if req.ProofNeeded {
+		proof, err := c.rangeProof(req.Sector, int(req.Offset), int(req.Size))
+		if err != nil {
+			log.Printf("c.rangeProof: %v.", err)
+			return nil, status.Errorf(codes.Internal, "failed to build proof")
+		}
+		res.Proof, err = proto.Marshal(proof)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "proto.Marshal: %v", err)
+		}
+	}
+	return res, nil
+}
+
+func (s *Server) Challenge(ctx context.Context, req *fpb.ChallengeRequest) (*fpb.ChallengeResponse, error) {
+	c, err := s.getContract(req.Id)
+	if err != nil {
+		return nil, err
+	}
+	if len(req.Segments) > maxChallengeSegments {
+		c.mu.Unlock()
+		return nil, status.Errorf(codes.InvalidArgument, "too many segments: %d > %d", len(req.Segments), maxChallengeSegments)
+	}
+	segments := merkle.Segments(int(c.db.SectorSize))
+	// Indices of requested segments of each sector.
+	bySector := make(map[int64][]int)
+	var sectors []int64
+	for i, ref := range req.Segments {
+		if ref.Sector < 0 || ref.Sector >= c.numSectors() {
+			c.mu.Unlock()
+			return nil, status.Errorf(codes.OutOfRange, "no sector %d", ref.Sector)
+		}
+		if ref.Segment < 0 || int(ref.Segment) >= segments {
+			c.mu.Unlock()
+			return nil, status.Errorf(codes.OutOfRange, "no segment %d", ref.Segment)
+		}
+		if _, has := bySector[ref.Sector]; !has {
+			sectors = append(sectors, ref.Sector)
+		}
+		bySector[ref.Sector] = append(bySector[ref.Sector], i)
+	}
+	if len(sectors) > maxChallengeSectors {
+		c.mu.Unlock()
+		return nil, status.Errorf(codes.InvalidArgument, "too many sectors: %d > %d", len(sectors), maxChallengeSectors)
+	}
+	revision := c.db.Revision
+	c.mu.Unlock()
+	// Sectors are read one by one and hashed without the lock.
+	res := &fpb.ChallengeResponse{
+		Proofs: make([]*fpb.SegmentProof, len(req.Segments)),
+	}
+	for _, sector := range sectors {
+		whole, err := s.readChallenged(c, sector, revision)
+		if err != nil {
+			return nil, err
+		}
+		tree := merkle.NewTree(whole)
+		for _, i := range bySector[sector] {
+			start := int(req.Segments[i].Segment)
+			hashes, err := tree.RangeProof(start, start+1)
+			if err != nil {
+				log.Printf("tree.RangeProof: %v.", err)
+				return nil, status.Errorf(codes.Internal, "failed to build proof")
+			}
+			end := (start + 1) * merkle.SegmentSize
+			if end > len(whole) {
+				end = len(whole)
+			}
+			res.Proofs[i] = &fpb.SegmentProof{
+				Data:   whole[start*merkle.SegmentSize : end],
+				Hashes: hashes,
+			}
+		}
+	}
+	return res, nil
+}
+
+// readChallenged reads the whole sector for Challenge if the contract
+// still has the given revision.
+func (s *Server) readChallenged(c *contract, sector, revision int64) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.removed {
+		return nil, status.Errorf(codes.NotFound, "no such contract")
+	}
+	if c.db.Revision != revision {
+		return nil, status.Errorf(codes.Aborted, "the contract was changed during the challenge")
+	}
+	whole, err := c.readSector(sector, 0, int(c.db.SectorSize))
+	if err != nil {
+		log.Printf("c.readSector: %v.", err)
+		return nil, status.Errorf(codes.Internal, "failed to read sector")
+	}
+	return whole, nil
+}
+
+func (s *Server) WriteSector(ctx context.Context, req *fpb.WriteSectorRequest) (*fpb.WriteSectorResponse, error) {
+	c, err := s.getContract(req.Id)
+	if err != nil {
+		return nil, err
+	}
+	defer c.mu.Unlock()
+	if int(req.Length) != len(req.Data) {
+		return nil, status.Errorf(codes.InvalidArgument, "length is %d, len(data) is %d", req.Length, len(req.Data))
+	}
+	// Writing to the sector following the last one appends a sector.
+	if req.Sector < 0 || req.Sector > c.numSectors() {
+		return nil, status.Errorf(codes.OutOfRange, "can not write sector %d to contract of %d sectors", req.Sector, c.numSectors())
+	}
+	if req.Offset < 0 || req.Length <= 0 || int64(req.Offset)+int64(req.Length) > int64(c.db.SectorSize) {
+		return nil, status.Errorf(codes.OutOfRange, "bad range [%d, %d) for sector size %d", req.Offset, int64(req.Offset)+int64(req.Length), c.db.SectorSize)
+	}
+	// Compute the root of the sector after the write.
+	whole, err := c.readSector(req.Sector, 0, int(c.db.SectorSize))
+	if err != nil {
+		log.Printf("c.readSector: %v.", err)
+		return nil, status.Errorf(codes.Internal, "failed to read sector")
+	}
+	copy(whole[req.Offset:], req.Data)
+	want, err := state.Write(c.state(), req.Sector, sectorID(whole))
+	if err != nil {
+		return nil, status.Errorf(codes.OutOfRange, "%v", err)
+	}
+	if err := checkUpdate(c, want, req.NewState, req.Signature); err != nil {
+		return nil, err
+	}
+	var reserved int64
+	if req.Sector == c.numSectors() {
+		reserved = int64(c.db.SectorSize)
+		if err := s.quota.reserve(reserved); err != nil {
+			return nil, err
+		}
+	}
+	// Free slots are preallocated only within the disk budget.
+	spare := s.quota.spare()
+	hostSignature, err := s.commit(want, func() error {
+		return c.writeSector(req.Sector, whole, want, req.Signature, spare)
+	})
+	if err != nil {
+		s.quota.release(reserved)
+		return nil, err
+	}
+	return &fpb.WriteSectorResponse{HostSignature: hostSignature}, nil
 }
 
 func (s *Server) Shrink(ctx context.Context, req *fpb.ShrinkRequest) (*fpb.ShrinkResponse, error) {
-	return nil, status.Errorf(codes.Unimplemented, "todo")
+	c, err := s.getContract(req.Id)
+	if err != nil {
+		return nil, err
+	}
+	defer c.mu.Unlock()
+	want, err := state.Shrink(c.state(), req.NumSectors)
+	if err != nil {
+		return nil, status.Errorf(codes.OutOfRange, "%v", err)
+	}
+	if err := checkUpdate(c, want, req.NewState, req.Signature); err != nil {
+		return nil, err
+	}
+	removed := c.numSectors() - req.NumSectors
+	hostSignature, err := s.commit(want, func() error {
+		return c.shrink(req.NumSectors, want, req.Signature)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.quota.release(removed * int64(c.db.SectorSize))
+	return &fpb.ShrinkResponse{HostSignature: hostSignature}, nil
 }
 
 func (s *Server) Reorder(ctx context.Context, req *fpb.ReorderRequest) (*fpb.ReorderResponse, error) {
-	return nil, status.Errorf(codes.Unimplemented, "todo")
+	c, err := s.getContract(req.Id)
+	if err != nil {
+		return nil, err
+	}
+	defer c.mu.Unlock()
+	want, err := state.Reorder(c.state(), req.Ordering)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	if err := checkUpdate(c, want, req.NewState, req.Signature); err != nil {
+		return nil, err
+	}
+	hostSignature, err := s.commit(want, func() error {
+		return c.reorder(req.Ordering, want, req.Signature)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &fpb.ReorderResponse{HostSignature: hostSignature}, nil
 }
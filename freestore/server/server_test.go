@@ -0,0 +1,989 @@
+package server
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/starius/invisiblefs/freestore/discovery"
+	fpb "github.com/starius/invisiblefs/freestore/proto"
+	"github.com/starius/invisiblefs/freestore/sign"
+	"github.com/starius/invisiblefs/freestore/state"
+	"github.com/starius/invisiblefs/freestore/verifier"
+	"github.com/starius/invisiblefs/merkle"
+	"github.com/starius/invisiblefs/pubkey"
+)
+
+const testSectorSize = 4096
+
+type testKey struct {
+	priv, cert []byte
+}
+
+var (
+	testKeys     []testKey
+	testKeysOnce sync.Once
+)
+
+// keys returns two key pairs: the host's and the client's.
+// Key generation is slow, so keys are shared by all tests.
+func keys(t *testing.T) (host, client testKey) {
+	testKeysOnce.Do(func() {
+		for i := 0; i < 2; i++ {
+			priv, err := pubkey.GeneratePriv(rand.Reader)
+			if err != nil {
+				panic(err)
+			}
+			cert, err := pubkey.Cert(priv, rand.Reader)
+			if err != nil {
+				panic(err)
+			}
+			testKeys = append(testKeys, testKey{priv, cert})
+		}
+	})
+	return testKeys[0], testKeys[1]
+}
+
+type testEnv struct {
+	dir        string
+	server     *Server
+	grpcServer *grpc.Server
+	conn       *grpc.ClientConn
+	client     fpb.FreestoreClient
+	wg         sync.WaitGroup
+}
+
+func newTestEnv(t *testing.T, dir string) *testEnv {
+	return newTestEnvWithLimits(t, dir, Limits{})
+}
+
+func newTestEnvWithLimits(t *testing.T, dir string, limits Limits) *testEnv {
+	host, _ := keys(t)
+	server, err := NewServer(dir, host.priv, limits)
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	e := &testEnv{
+		dir:        dir,
+		server:     server,
+		grpcServer: grpc.NewServer(),
+	}
+	fpb.RegisterFreestoreServer(e.grpcServer, server)
+	listener := bufconn.Listen(1024 * 1024)
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+		e.grpcServer.Serve(listener)
+	}()
+	dialer := func(string, time.Duration) (net.Conn, error) {
+		return listener.Dial()
+	}
+	e.conn, err = grpc.Dial("bufnet", grpc.WithDialer(dialer), grpc.WithInsecure())
+	if err != nil {
+		t.Fatalf("grpc.Dial: %v", err)
+	}
+	e.client = fpb.NewFreestoreClient(e.conn)
+	return e
+}
+
+func (e *testEnv) stop(t *testing.T) {
+	if err := e.conn.Close(); err != nil {
+		t.Fatalf("conn.Close: %v", err)
+	}
+	e.grpcServer.Stop()
+	e.wg.Wait()
+	if err := e.server.Close(); err != nil {
+		t.Fatalf("server.Close: %v", err)
+	}
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "freestore")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	return dir
+}
+
+func makeContract(t *testing.T, e *testEnv) []byte {
+	host, client := keys(t)
+	res, err := e.client.MakeContract(context.Background(), &fpb.MakeContractRequest{
+		SectorSize:   testSectorSize,
+		ClientPubkey: client.cert,
+		DaysNum:      10,
+	})
+	if err != nil {
+		t.Fatalf("MakeContract: %v", err)
+	}
+	if err := verifier.CheckState(host.cert, client.cert, res.State); err != nil {
+		t.Fatalf("verifier.CheckState: %v", err)
+	}
+	if res.State.State.Revision != 0 || !bytes.Equal(res.State.State.Id, res.Id) {
+		t.Fatalf("bad initial state: %v", res.State)
+	}
+	return res.Id
+}
+
+// signState returns the signature of the state by signer.
+func signState(t *testing.T, st *fpb.ContractState, signer []byte) []byte {
+	signature, err := pubkey.Sign(signer, sign.State(st))
+	if err != nil {
+		t.Fatalf("pubkey.Sign: %v", err)
+	}
+	return signature
+}
+
+// checkHostSignature checks the signature returned by the host
+// after a change of the state.
+func checkHostSignature(t *testing.T, st *fpb.ContractState, signature []byte) {
+	host, _ := keys(t)
+	if err := pubkey.Verify(host.cert, sign.State(st), signature); err != nil {
+		t.Errorf("bad host signature of revision %d: %v", st.Revision, err)
+	}
+}
+
+func writeSector(t *testing.T, e *testEnv, id []byte, i int64, offset int32, data []byte, signer []byte) error {
+	m := metadata(t, e, id)
+	whole := make([]byte, testSectorSize)
+	if i >= 0 && i < int64(len(m.SectorIds)) {
+		copy(whole, readSector(t, e, id, i, 0, testSectorSize))
+	}
+	if offset >= 0 && int(offset)+len(data) <= testSectorSize {
+		copy(whole[offset:], data)
+	}
+	newState, err := state.Write(m.State, i, merkle.Root(whole))
+	if err != nil {
+		// Let the host reject the request.
+		newState = m.State
+	}
+	req := &fpb.WriteSectorRequest{
+		Id:        id,
+		Sector:    i,
+		Offset:    offset,
+		Length:    int32(len(data)),
+		Data:      data,
+		NewState:  newState,
+		Signature: signState(t, newState, signer),
+	}
+	res, err := e.client.WriteSector(context.Background(), req)
+	if err != nil {
+		return err
+	}
+	checkHostSignature(t, newState, res.HostSignature)
+	return nil
+}
+
+// fill appends sectors to the contract.
+func fill(t *testing.T, e *testEnv, id []byte, sectors ...[]byte) {
+	_, client := keys(t)
+	m := metadata(t, e, id)
+	for i, data := range sectors {
+		n := int64(len(m.SectorIds) + i)
+		if err := writeSector(t, e, id, n, 0, data, client.priv); err != nil {
+			t.Fatalf("WriteSector(%d): %v", n, err)
+		}
+	}
+}
+
+func sector(b byte) []byte {
+	return bytes.Repeat([]byte{b}, testSectorSize)
+}
+
+func readSector(t *testing.T, e *testEnv, id []byte, i int64, offset, size int32) []byte {
+	res, err := e.client.ReadSector(context.Background(), &fpb.ReadSectorRequest{
+		Id:     id,
+		Sector: i,
+		Offset: offset,
+		Size:   size,
+	})
+	if err != nil {
+		t.Fatalf("ReadSector(%d): %v", i, err)
+	}
+	return res.Data
+}
+
+func metadataWithNonce(t *testing.T, e *testEnv, id, nonce []byte) *fpb.ContractMetadataResponse {
+	res, err := e.client.ContractMetadata(context.Background(), &fpb.ContractMetadataRequest{
+		Id:    id,
+		Nonce: nonce,
+	})
+	if err != nil {
+		t.Fatalf("ContractMetadata: %v", err)
+	}
+	host, _ := keys(t)
+	if err := pubkey.Verify(host.cert, sign.Metadata(res.State, nonce), res.Signature); err != nil {
+		t.Fatalf("bad metadata signature: %v", err)
+	}
+	return res
+}
+
+func metadata(t *testing.T, e *testEnv, id []byte) *fpb.ContractMetadataResponse {
+	return metadataWithNonce(t, e, id, nil)
+}
+
+func TestMakeContractAndRead(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	e := newTestEnv(t, dir)
+	defer e.stop(t)
+	id := makeContract(t, e)
+	m := metadata(t, e, id)
+	if m.DaysLeft != 10 || m.SectorSize != testSectorSize || len(m.SectorIds) != 0 {
+		t.Errorf("bad metadata of new contract: %v", m)
+	}
+	fill(t, e, id, sector(1), sector(2))
+	if data := readSector(t, e, id, 1, 100, 10); !bytes.Equal(data, sector(2)[:10]) {
+		t.Errorf("ReadSector returned %v", data)
+	}
+	if data := readSector(t, e, id, 0, 0, testSectorSize); !bytes.Equal(data, sector(1)) {
+		t.Errorf("ReadSector returned wrong data")
+	}
+	m = metadata(t, e, id)
+	if len(m.SectorIds) != 2 || !bytes.Equal(m.SectorIds[1], sectorID(sector(2))) {
+		t.Errorf("bad sector_ids: %v", m.SectorIds)
+	}
+	for _, req := range []*fpb.ReadSectorRequest{
+		{Id: id, Sector: 2, Size: 1},
+		{Id: id, Sector: -1, Size: 1},
+		{Id: id, Sector: 0, Offset: testSectorSize - 1, Size: 2},
+		{Id: id, Sector: 0, Size: 0},
+	} {
+		_, err := e.client.ReadSector(context.Background(), req)
+		if status.Code(err) != codes.OutOfRange {
+			t.Errorf("ReadSector(%v) returned %v, want OutOfRange", req, err)
+		}
+	}
+	_, err := e.client.ReadSector(context.Background(), &fpb.ReadSectorRequest{
+		Id:   []byte("unknown"),
+		Size: 1,
+	})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("ReadSector of unknown contract returned %v", err)
+	}
+}
+
+func TestMakeContractBadRequest(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	e := newTestEnv(t, dir)
+	defer e.stop(t)
+	_, client := keys(t)
+	for _, req := range []*fpb.MakeContractRequest{
+		{SectorSize: 0, ClientPubkey: client.cert, DaysNum: 1},
+		{SectorSize: testSectorSize, ClientPubkey: client.cert, DaysNum: 0},
+		{SectorSize: testSectorSize, ClientPubkey: []byte("bad"), DaysNum: 1},
+	} {
+		_, err := e.client.MakeContract(context.Background(), req)
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("MakeContract(%v) returned %v, want InvalidArgument", req, err)
+		}
+	}
+}
+
+func TestWriteSector(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	e := newTestEnv(t, dir)
+	defer e.stop(t)
+	host, client := keys(t)
+	id := makeContract(t, e)
+	if err := writeSector(t, e, id, 0, 100, []byte("hello"), client.priv); err != nil {
+		t.Fatalf("WriteSector: %v", err)
+	}
+	if err := writeSector(t, e, id, 0, 102, []byte("LLO world"), client.priv); err != nil {
+		t.Fatalf("WriteSector: %v", err)
+	}
+	want := make([]byte, testSectorSize)
+	copy(want[100:], "heLLO world")
+	if data := readSector(t, e, id, 0, 0, testSectorSize); !bytes.Equal(data, want) {
+		t.Errorf("ReadSector returned wrong data after partial writes")
+	}
+	m := metadata(t, e, id)
+	if len(m.SectorIds) != 1 || !bytes.Equal(m.SectorIds[0], sectorID(want)) {
+		t.Errorf("bad sector_ids after partial writes: %v", m.SectorIds)
+	}
+	if err := writeSector(t, e, id, 0, 0, []byte("x"), host.priv); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("WriteSector signed by another key returned %v", err)
+	}
+	for _, tc := range []struct {
+		sector int64
+		offset int32
+		data   []byte
+	}{
+		{sector: 2, offset: 0, data: []byte("gap")},
+		{sector: -1, offset: 0, data: []byte("negative")},
+		{sector: 0, offset: testSectorSize - 1, data: []byte("past end")},
+		{sector: 1, offset: -1, data: []byte("negative offset")},
+		{sector: 1, offset: 0, data: nil},
+	} {
+		err := writeSector(t, e, id, tc.sector, tc.offset, tc.data, client.priv)
+		if status.Code(err) != codes.OutOfRange {
+			t.Errorf("WriteSector(%d, %d, %q) returned %v, want OutOfRange", tc.sector, tc.offset, tc.data, err)
+		}
+	}
+	req := &fpb.WriteSectorRequest{
+		Id:     id,
+		Length: 10,
+		Data:   []byte("short"),
+	}
+	if _, err := e.client.WriteSector(context.Background(), req); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("WriteSector with wrong length returned %v", err)
+	}
+	if m := metadata(t, e, id); len(m.SectorIds) != 1 {
+		t.Errorf("failed writes changed the contract: %v", m.SectorIds)
+	}
+}
+
+func TestReadSectorProof(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	e := newTestEnv(t, dir)
+	defer e.stop(t)
+	id := makeContract(t, e)
+	data := make([]byte, testSectorSize)
+	rand.Read(data)
+	fill(t, e, id, sector(1), data)
+	m := metadata(t, e, id)
+	for _, r := range []struct{ offset, size int32 }{
+		{0, testSectorSize},
+		{0, 1},
+		{100, 10},
+		{63, 2},
+		{64, 64},
+		{testSectorSize - 1, 1},
+	} {
+		req := &fpb.ReadSectorRequest{
+			Id:          id,
+			Sector:      1,
+			Offset:      r.offset,
+			Size:        r.size,
+			ProofNeeded: true,
+		}
+		res, err := e.client.ReadSector(context.Background(), req)
+		if err != nil {
+			t.Fatalf("ReadSector(%v): %v", req, err)
+		}
+		if !bytes.Equal(res.Data, data[r.offset:r.offset+r.size]) {
+			t.Errorf("ReadSector(%v) returned wrong data", req)
+		}
+		if err := verifier.ReadSector(req, res, m.SectorSize, m.SectorIds[1]); err != nil {
+			t.Errorf("verifier.ReadSector(%v): %v", req, err)
+		}
+		if err := verifier.ReadSector(req, res, m.SectorSize, m.SectorIds[0]); err == nil {
+			t.Errorf("verifier.ReadSector(%v) accepted root of another sector", req)
+		}
+	}
+}
+
+func TestChallenge(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	e := newTestEnv(t, dir)
+	defer e.stop(t)
+	id := makeContract(t, e)
+	data := make([]byte, testSectorSize)
+	rand.Read(data)
+	fill(t, e, id, sector(1), data)
+	st := metadata(t, e, id).State
+	last := int32(testSectorSize/merkle.SegmentSize - 1)
+	req := &fpb.ChallengeRequest{
+		Id: id,
+		Segments: []*fpb.SegmentRef{
+			{Sector: 1, Segment: 0},
+			{Sector: 0, Segment: 5},
+			{Sector: 1, Segment: last},
+			{Sector: 1, Segment: 0},
+		},
+	}
+	res, err := e.client.Challenge(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Challenge: %v", err)
+	}
+	if err := verifier.Challenge(req, res, st); err != nil {
+		t.Errorf("verifier.Challenge: %v", err)
+	}
+	if got := res.Proofs[2].Data; !bytes.Equal(got, data[testSectorSize-merkle.SegmentSize:]) {
+		t.Errorf("Challenge returned wrong last segment")
+	}
+	res.Proofs[1].Data[0] ^= 1
+	if err := verifier.Challenge(req, res, st); err == nil {
+		t.Errorf("verifier.Challenge accepted a wrong segment")
+	}
+	res.Proofs = res.Proofs[:3]
+	if err := verifier.Challenge(req, res, st); err == nil {
+		t.Errorf("verifier.Challenge accepted a missing proof")
+	}
+	for _, ref := range []*fpb.SegmentRef{
+		{Sector: 2, Segment: 0},
+		{Sector: -1, Segment: 0},
+		{Sector: 0, Segment: last + 1},
+		{Sector: 0, Segment: -1},
+	} {
+		req := &fpb.ChallengeRequest{Id: id, Segments: []*fpb.SegmentRef{ref}}
+		if _, err := e.client.Challenge(context.Background(), req); status.Code(err) != codes.OutOfRange {
+			t.Errorf("Challenge(%v) returned %v, want OutOfRange", ref, err)
+		}
+	}
+	req = &fpb.ChallengeRequest{Id: id}
+	for i := 0; i <= maxChallengeSegments; i++ {
+		req.Segments = append(req.Segments, &fpb.SegmentRef{})
+	}
+	if _, err := e.client.Challenge(context.Background(), req); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Challenge with too many segments returned %v, want InvalidArgument", err)
+	}
+	var more [][]byte
+	for i := 0; i < maxChallengeSectors; i++ {
+		more = append(more, sector(byte(i)))
+	}
+	fill(t, e, id, more...)
+	req = &fpb.ChallengeRequest{Id: id}
+	for i := 0; i <= maxChallengeSectors; i++ {
+		req.Segments = append(req.Segments, &fpb.SegmentRef{Sector: int64(i)})
+	}
+	if _, err := e.client.Challenge(context.Background(), req); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Challenge of too many sectors returned %v, want InvalidArgument", err)
+	}
+	req.Segments = req.Segments[1:]
+	res, err = e.client.Challenge(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Challenge: %v", err)
+	}
+	if err := verifier.Challenge(req, res, metadata(t, e, id).State); err != nil {
+		t.Errorf("verifier.Challenge: %v", err)
+	}
+}
+
+func TestExpireAndExtend(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	e := newTestEnv(t, dir)
+	defer e.stop(t)
+	_, client := keys(t)
+	id := makeContract(t, e)
+	newState, err := state.Extend(metadata(t, e, id).State, 5)
+	if err != nil {
+		t.Fatalf("state.Extend: %v", err)
+	}
+	req := &fpb.ExtendContractRequest{
+		Id:       id,
+		DaysNum:  5,
+		NewState: newState,
+	}
+	if _, err := e.client.ExtendContract(context.Background(), req); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("unsigned ExtendContract returned %v", err)
+	}
+	req.Signature = signState(t, newState, client.priv)
+	res, err := e.client.ExtendContract(context.Background(), req)
+	if err != nil {
+		t.Fatalf("ExtendContract: %v", err)
+	}
+	checkHostSignature(t, newState, res.HostSignature)
+	if m := metadata(t, e, id); m.DaysLeft != 15 {
+		t.Errorf("DaysLeft = %d, want 15", m.DaysLeft)
+	}
+	now := time.Now()
+	e.server.now = func() time.Time {
+		return now.Add(14*day + time.Hour)
+	}
+	if m := metadata(t, e, id); m.DaysLeft != 1 {
+		t.Errorf("DaysLeft = %d, want 1", m.DaysLeft)
+	}
+	e.server.now = func() time.Time {
+		return now.Add(15*day + time.Hour)
+	}
+	_, err = e.client.ContractMetadata(context.Background(), &fpb.ContractMetadataRequest{
+		Id: id,
+	})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("ContractMetadata of expired contract returned %v", err)
+	}
+}
+
+func TestShrinkAndReorder(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	e := newTestEnv(t, dir)
+	defer e.stop(t)
+	_, client := keys(t)
+	id := makeContract(t, e)
+	fill(t, e, id, sector(1), sector(2), sector(3), sector(4))
+	ordering := []int64{3, 0, 2, 1}
+	newState, err := state.Reorder(metadata(t, e, id).State, ordering)
+	if err != nil {
+		t.Fatalf("state.Reorder: %v", err)
+	}
+	reorder := &fpb.ReorderRequest{
+		Id:       id,
+		Ordering: ordering,
+		NewState: newState,
+	}
+	if _, err := e.client.Reorder(context.Background(), reorder); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("unsigned Reorder returned %v", err)
+	}
+	reorder.Signature = signState(t, newState, client.priv)
+	res, err := e.client.Reorder(context.Background(), reorder)
+	if err != nil {
+		t.Fatalf("Reorder: %v", err)
+	}
+	checkHostSignature(t, newState, res.HostSignature)
+	for i, b := range []byte{4, 1, 3, 2} {
+		if data := readSector(t, e, id, int64(i), 0, testSectorSize); !bytes.Equal(data, sector(b)) {
+			t.Errorf("sector %d has wrong data after Reorder", i)
+		}
+	}
+	// Replaying the request must not change the contract again.
+	if _, err := e.client.Reorder(context.Background(), reorder); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("replayed Reorder returned %v", err)
+	}
+	newState, err = state.Shrink(newState, 2)
+	if err != nil {
+		t.Fatalf("state.Shrink: %v", err)
+	}
+	shrink := &fpb.ShrinkRequest{
+		Id:         id,
+		NumSectors: 2,
+		NewState:   newState,
+		Signature:  signState(t, newState, client.priv),
+	}
+	// The new state must match num_sectors.
+	shrink.NumSectors = 1
+	if _, err := e.client.Shrink(context.Background(), shrink); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("Shrink with wrong state returned %v", err)
+	}
+	shrink.NumSectors = 2
+	shrinkRes, err := e.client.Shrink(context.Background(), shrink)
+	if err != nil {
+		t.Fatalf("Shrink: %v", err)
+	}
+	checkHostSignature(t, newState, shrinkRes.HostSignature)
+	m := metadata(t, e, id)
+	if len(m.SectorIds) != 2 || !bytes.Equal(m.SectorIds[0], sectorID(sector(4))) {
+		t.Errorf("bad sector_ids after Shrink: %v", m.SectorIds)
+	}
+	_, err = e.client.ReadSector(context.Background(), &fpb.ReadSectorRequest{
+		Id:     id,
+		Sector: 2,
+		Size:   1,
+	})
+	if status.Code(err) != codes.OutOfRange {
+		t.Errorf("ReadSector after Shrink returned %v", err)
+	}
+}
+
+func TestRevisions(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	e := newTestEnv(t, dir)
+	host, client := keys(t)
+	id := makeContract(t, e)
+	fill(t, e, id, sector(1))
+	m := metadata(t, e, id)
+	if m.State.Revision != 1 {
+		t.Errorf("revision after first write is %d, want 1", m.State.Revision)
+	}
+	// Write based on a stale state.
+	stale, err := state.Write(m.State, 1, sectorID(sector(2)))
+	if err != nil {
+		t.Fatalf("state.Write: %v", err)
+	}
+	fill(t, e, id, sector(3))
+	_, err = e.client.WriteSector(context.Background(), &fpb.WriteSectorRequest{
+		Id:        id,
+		Sector:    1,
+		Length:    testSectorSize,
+		Data:      sector(2),
+		NewState:  stale,
+		Signature: signState(t, stale, client.priv),
+	})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("WriteSector with stale state returned %v", err)
+	}
+	// Save the contract file of revision 2 to roll back to it later.
+	file := contractPath(dir, id) + contractSuffix
+	old, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatalf("ioutil.ReadFile: %v", err)
+	}
+	m = metadata(t, e, id)
+	newState, err := state.Write(m.State, 1, sectorID(sector(4)))
+	if err != nil {
+		t.Fatalf("state.Write: %v", err)
+	}
+	clientSignature := signState(t, newState, client.priv)
+	res, err := e.client.WriteSector(context.Background(), &fpb.WriteSectorRequest{
+		Id:        id,
+		Sector:    1,
+		Length:    testSectorSize,
+		Data:      sector(4),
+		NewState:  newState,
+		Signature: clientSignature,
+	})
+	if err != nil {
+		t.Fatalf("WriteSector: %v", err)
+	}
+	latest := &fpb.SignedState{
+		State:           newState,
+		HostSignature:   res.HostSignature,
+		ClientSignature: clientSignature,
+	}
+	if err := verifier.CheckState(host.cert, client.cert, latest); err != nil {
+		t.Fatalf("verifier.CheckState: %v", err)
+	}
+	m = metadataWithNonce(t, e, id, sign.Digest(latest))
+	if evidence, err := verifier.CheckMetadata(host.cert, client.cert, latest, m); err != nil || evidence != nil {
+		t.Errorf("verifier.CheckMetadata: %v, %v", evidence, err)
+	}
+	// The host rolls the contract back.
+	e.stop(t)
+	if err := ioutil.WriteFile(file, old, 0600); err != nil {
+		t.Fatalf("ioutil.WriteFile: %v", err)
+	}
+	e = newTestEnv(t, dir)
+	defer e.stop(t)
+	m = metadataWithNonce(t, e, id, sign.Digest(latest))
+	evidence, err := verifier.CheckMetadata(host.cert, client.cert, latest, m)
+	if err == nil || evidence == nil {
+		t.Fatalf("verifier.CheckMetadata accepted rollback: %v, %v", evidence, err)
+	}
+	if err := verifier.CheckEvidence(host.cert, evidence); err != nil {
+		t.Errorf("verifier.CheckEvidence: %v", err)
+	}
+	// Evidence with a nonce unrelated to the latest state is useless.
+	m = metadata(t, e, id)
+	evidence.Signature = m.Signature
+	if err := verifier.CheckEvidence(host.cert, evidence); err == nil {
+		t.Errorf("verifier.CheckEvidence accepted evidence without nonce")
+	}
+}
+
+func TestRemoveExpired(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	e := newTestEnv(t, dir)
+	defer e.stop(t)
+	_, client := keys(t)
+	id := makeContract(t, e)
+	fill(t, e, id, sector(1), sector(2))
+	res, err := e.client.MakeContract(context.Background(), &fpb.MakeContractRequest{
+		SectorSize:   testSectorSize,
+		ClientPubkey: client.cert,
+		DaysNum:      20,
+	})
+	if err != nil {
+		t.Fatalf("MakeContract: %v", err)
+	}
+	long := res.Id
+	fill(t, e, long, sector(3))
+	if n, err := e.server.RemoveExpired(); err != nil || n != 0 {
+		t.Errorf("RemoveExpired returned %d, %v; want nothing removed", n, err)
+	}
+	now := time.Now()
+	e.server.now = func() time.Time {
+		return now.Add(10*day + time.Hour)
+	}
+	if err := e.server.Start(time.Millisecond, time.Hour); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	for {
+		e.server.mu.Lock()
+		n := len(e.server.contracts)
+		e.server.mu.Unlock()
+		if n == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := e.server.Stop(); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	for _, suffix := range []string{contractSuffix, dataSuffix} {
+		if _, err := os.Stat(contractPath(dir, id) + suffix); !os.IsNotExist(err) {
+			t.Errorf("file %s of expired contract was not removed: %v", suffix, err)
+		}
+	}
+	_, err = e.client.ContractMetadata(context.Background(), &fpb.ContractMetadataRequest{
+		Id: id,
+	})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("ContractMetadata of removed contract returned %v", err)
+	}
+	if data := readSector(t, e, long, 0, 0, testSectorSize); !bytes.Equal(data, sector(3)) {
+		t.Errorf("sector of remaining contract has wrong data")
+	}
+}
+
+func TestRemoveExpiredRetries(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	e := newTestEnv(t, dir)
+	defer e.stop(t)
+	id := makeContract(t, e)
+	fill(t, e, id, sector(1), sector(2))
+	// A non-empty directory can not be removed by os.Remove.
+	data := contractPath(dir, id) + dataSuffix
+	if err := os.Remove(data); err != nil {
+		t.Fatalf("os.Remove: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(data, "dir"), 0700); err != nil {
+		t.Fatalf("os.MkdirAll: %v", err)
+	}
+	now := time.Now()
+	e.server.now = func() time.Time {
+		return now.Add(10*day + time.Hour)
+	}
+	if n, err := e.server.RemoveExpired(); err == nil || n != 0 {
+		t.Errorf("RemoveExpired returned %d, %v; want an error", n, err)
+	}
+	if used := e.server.quota.used; used != 0 {
+		t.Errorf("%d bytes are still used by the expired contract", used)
+	}
+	_, err := e.client.ContractMetadata(context.Background(), &fpb.ContractMetadataRequest{
+		Id: id,
+	})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("ContractMetadata of expired contract returned %v", err)
+	}
+	if err := os.RemoveAll(data); err != nil {
+		t.Fatalf("os.RemoveAll: %v", err)
+	}
+	if n, err := e.server.RemoveExpired(); err != nil || n != 1 {
+		t.Errorf("RemoveExpired returned %d, %v; want one contract removed", n, err)
+	}
+	if used := e.server.quota.used; used != 0 {
+		t.Errorf("quota was released twice: %d bytes are used", used)
+	}
+	if len(e.server.contracts) != 0 {
+		t.Errorf("the contract was not removed from the map")
+	}
+}
+
+func shrink(t *testing.T, e *testEnv, id []byte, n int64) error {
+	_, client := keys(t)
+	newState, err := state.Shrink(metadata(t, e, id).State, n)
+	if err != nil {
+		t.Fatalf("state.Shrink: %v", err)
+	}
+	_, err = e.client.Shrink(context.Background(), &fpb.ShrinkRequest{
+		Id:         id,
+		NumSectors: n,
+		NewState:   newState,
+		Signature:  signState(t, newState, client.priv),
+	})
+	return err
+}
+
+func extend(t *testing.T, e *testEnv, id []byte, days int32) error {
+	_, client := keys(t)
+	newState, err := state.Extend(metadata(t, e, id).State, days)
+	if err != nil {
+		t.Fatalf("state.Extend: %v", err)
+	}
+	_, err = e.client.ExtendContract(context.Background(), &fpb.ExtendContractRequest{
+		Id:        id,
+		DaysNum:   days,
+		NewState:  newState,
+		Signature: signState(t, newState, client.priv),
+	})
+	return err
+}
+
+func TestLimits(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	limitsFile := filepath.Join(dir, "limits.json")
+	limitsJSON := `{
+		"disk_budget": 12288,
+		"max_contracts_per_client": 2,
+		"sector_sizes": [4096],
+		"max_days": 15
+	}`
+	if err := ioutil.WriteFile(limitsFile, []byte(limitsJSON), 0600); err != nil {
+		t.Fatalf("ioutil.WriteFile: %v", err)
+	}
+	limits, err := LoadLimits(limitsFile)
+	if err != nil {
+		t.Fatalf("LoadLimits: %v", err)
+	}
+	e := newTestEnvWithLimits(t, filepath.Join(dir, "data"), limits)
+	defer func() {
+		e.stop(t)
+	}()
+	_, client := keys(t)
+	for _, req := range []*fpb.MakeContractRequest{
+		{SectorSize: 2 * testSectorSize, ClientPubkey: client.cert, DaysNum: 10},
+		{SectorSize: testSectorSize, ClientPubkey: client.cert, DaysNum: 16},
+	} {
+		_, err := e.client.MakeContract(context.Background(), req)
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("MakeContract(%v) returned %v, want InvalidArgument", req, err)
+		}
+	}
+	id := makeContract(t, e)
+	makeContract(t, e)
+	_, err = e.client.MakeContract(context.Background(), &fpb.MakeContractRequest{
+		SectorSize:   testSectorSize,
+		ClientPubkey: client.cert,
+		DaysNum:      10,
+	})
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("MakeContract over the limit of contracts returned %v", err)
+	}
+	fill(t, e, id, sector(1), sector(2), sector(3))
+	if err := writeSector(t, e, id, 3, 0, sector(4), client.priv); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("WriteSector over disk budget returned %v", err)
+	}
+	if err := writeSector(t, e, id, 0, 0, sector(4), client.priv); err != nil {
+		t.Errorf("overwriting a sector failed: %v", err)
+	}
+	if err := shrink(t, e, id, 2); err != nil {
+		t.Fatalf("Shrink: %v", err)
+	}
+	if err := writeSector(t, e, id, 2, 0, sector(5), client.priv); err != nil {
+		t.Errorf("WriteSector after Shrink failed: %v", err)
+	}
+	if err := extend(t, e, id, 6); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("ExtendContract over max days returned %v", err)
+	}
+	if err := extend(t, e, id, 5); err != nil {
+		t.Errorf("ExtendContract: %v", err)
+	}
+	// The usage is restored after restart.
+	e.stop(t)
+	e = newTestEnvWithLimits(t, filepath.Join(dir, "data"), limits)
+	if err := writeSector(t, e, id, 3, 0, sector(4), client.priv); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("WriteSector over disk budget after restart returned %v", err)
+	}
+}
+
+func TestReload(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	e := newTestEnv(t, dir)
+	id := makeContract(t, e)
+	fill(t, e, id, sector(1), sector(2))
+	e.stop(t)
+	e = newTestEnv(t, dir)
+	defer e.stop(t)
+	m := metadata(t, e, id)
+	if len(m.SectorIds) != 2 || m.DaysLeft != 10 {
+		t.Errorf("bad metadata after reload: %v", m)
+	}
+	if data := readSector(t, e, id, 1, 0, testSectorSize); !bytes.Equal(data, sector(2)) {
+		t.Errorf("sector 1 has wrong data after reload")
+	}
+}
+
+// startTLSHost runs a host with TLS on a local TCP port.
+func startTLSHost(t *testing.T, dir string, key testKey) (string, func()) {
+	server, err := NewServer(dir, key.priv, Limits{})
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	creds, err := pubkey.ServerCreds(key.priv, key.cert)
+	if err != nil {
+		t.Fatalf("pubkey.ServerCreds: %v", err)
+	}
+	grpcServer := grpc.NewServer(grpc.Creds(creds))
+	fpb.RegisterFreestoreServer(grpcServer, server)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen: %v", err)
+	}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		grpcServer.Serve(listener)
+	}()
+	stop := func() {
+		grpcServer.Stop()
+		wg.Wait()
+		server.Close()
+	}
+	return listener.Addr().String(), stop
+}
+
+func knownPeers(t *testing.T, e *testEnv, peers ...*fpb.Peer) []*fpb.Peer {
+	res, err := e.client.KnownPeers(context.Background(), &fpb.KnownPeersRequest{
+		Peers: peers,
+	})
+	if err != nil {
+		t.Fatalf("KnownPeers: %v", err)
+	}
+	return res.Peers
+}
+
+func TestKnownPeers(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	e := newTestEnv(t, dir)
+	e.server.peers.timeout = time.Second
+	host, client := keys(t)
+	// Use the key of the client as the key of another host.
+	otherDir := tempDir(t)
+	defer os.RemoveAll(otherDir)
+	addr, stopOther := startTLSHost(t, otherDir, client)
+	defer stopOther()
+	other := &fpb.Peer{Pubkey: client.cert, Address: addr}
+	peers := knownPeers(t, e,
+		other,
+		&fpb.Peer{Pubkey: host.cert, Address: addr},
+		&fpb.Peer{Pubkey: []byte("no address")},
+		&fpb.Peer{Pubkey: []byte("bad pubkey"), Address: addr},
+	)
+	if len(peers) != 0 {
+		t.Errorf("KnownPeers returned %v, want nothing", peers)
+	}
+	e.server.peers.wait()
+	peers = knownPeers(t, e)
+	if len(peers) != 1 || !proto.Equal(peers[0], other) {
+		t.Errorf("KnownPeers returned %v, want %v", peers, other)
+	}
+	// The peer is persisted.
+	e.stop(t)
+	e = newTestEnv(t, dir)
+	defer e.stop(t)
+	if peers := knownPeers(t, e); len(peers) != 1 || !proto.Equal(peers[0], other) {
+		t.Errorf("KnownPeers after reload returned %v, want %v", peers, other)
+	}
+	// The client finds the host through the peer.
+	hostPeer := &fpb.Peer{Pubkey: host.cert, Address: "127.0.0.1:1"}
+	found, err := discovery.Bootstrap(context.Background(), []*fpb.Peer{other}, 10)
+	if err != nil || len(found) != 1 || !proto.Equal(found[0], other) {
+		t.Errorf("discovery.Bootstrap returned %v, %v", found, err)
+	}
+	if _, err := discovery.Bootstrap(context.Background(), []*fpb.Peer{hostPeer}, 10); err == nil {
+		t.Errorf("discovery.Bootstrap succeeded without live peers")
+	}
+	// The peer dies.
+	stopOther()
+	if err := e.server.CheckPeers(context.Background()); err != nil {
+		t.Fatalf("CheckPeers: %v", err)
+	}
+	if peers := knownPeers(t, e); len(peers) != 1 {
+		t.Errorf("recently seen peer was removed: %v", peers)
+	}
+	now := time.Now()
+	e.server.now = func() time.Time {
+		return now.Add(peerTTL + time.Hour)
+	}
+	if err := e.server.CheckPeers(context.Background()); err != nil {
+		t.Fatalf("CheckPeers: %v", err)
+	}
+	if peers := knownPeers(t, e); len(peers) != 0 {
+		t.Errorf("dead peer was not removed: %v", peers)
+	}
+}
@@ -0,0 +1,379 @@
+package server
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/starius/invisiblefs/atomicfile"
+	"github.com/starius/invisiblefs/freestore/hostdb"
+	fpb "github.com/starius/invisiblefs/freestore/proto"
+	"github.com/starius/invisiblefs/merkle"
+)
+
+const (
+	contractSuffix = ".contract"
+	dataSuffix     = ".data"
+
+	// The data file doubles in size, but grows by at most
+	// this number of bytes (or one sector) at once.
+	maxGrowBytes = 64 * 1024 * 1024
+)
+
+// contract is a contract stored in two files in the data directory:
+// <id>.contract with the serialized hostdb.Contract (the index) and
+// <id>.data with the slots for sectors.
+//
+// Sectors are never overwritten in place: a write goes to a free slot
+// and becomes visible when the index pointing to the slot is saved.
+// Reorder and Shrink change only the index. So after a crash the data
+// file contains the sectors of the last saved index.
+type contract struct {
+	db   *hostdb.Contract
+	dir  string
+	data *os.File
+	mu   sync.Mutex
+
+	// Number of slots in the data file.
+	nslots int64
+	// Slots not used by the index.
+	free []int64
+
+	// Set when the contract expires. The contract may stay in
+	// Server.contracts until its files are removed.
+	removed bool
+
+	// crash is called at the points where a crash is dangerous.
+	// If it returns an error, the operation is aborted (used by tests).
+	crash func(point string) error
+}
+
+func contractPath(dir string, id []byte) string {
+	return filepath.Join(dir, hex.EncodeToString(id))
+}
+
+func noCrash(string) error {
+	return nil
+}
+
+func createContract(dir string, db *hostdb.Contract) (*contract, error) {
+	base := contractPath(dir, db.Id)
+	data, err := os.OpenFile(base+dataSuffix, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("os.OpenFile: %v", err)
+	}
+	c := &contract{
+		db:    db,
+		dir:   dir,
+		data:  data,
+		crash: noCrash,
+	}
+	if err := c.save(db); err != nil {
+		data.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func openContract(dir string, id []byte) (*contract, error) {
+	base := contractPath(dir, id)
+	dump, err := ioutil.ReadFile(base + contractSuffix)
+	if err != nil {
+		return nil, fmt.Errorf("ioutil.ReadFile: %v", err)
+	}
+	db := &hostdb.Contract{}
+	if err := proto.Unmarshal(dump, db); err != nil {
+		return nil, fmt.Errorf("proto.Unmarshal: %v", err)
+	}
+	if len(db.Slots) != len(db.SectorIds) {
+		return nil, fmt.Errorf("%d slots for %d sectors", len(db.Slots), len(db.SectorIds))
+	}
+	data, err := os.OpenFile(base+dataSuffix, os.O_RDWR, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("os.OpenFile: %v", err)
+	}
+	stat, err := data.Stat()
+	if err != nil {
+		data.Close()
+		return nil, fmt.Errorf("Stat: %v", err)
+	}
+	c := &contract{
+		db:     db,
+		dir:    dir,
+		data:   data,
+		nslots: stat.Size() / int64(db.SectorSize),
+		crash:  noCrash,
+	}
+	for _, slot := range db.Slots {
+		if slot < 0 || slot >= c.nslots {
+			data.Close()
+			return nil, fmt.Errorf("slot %d is out of the data file of %d slots", slot, c.nslots)
+		}
+	}
+	c.findFree()
+	return c, nil
+}
+
+// findFree fills c.free with slots not used by c.db.
+func (c *contract) findFree() {
+	used := make([]bool, c.nslots)
+	for _, slot := range c.db.Slots {
+		used[slot] = true
+	}
+	c.free = c.free[:0]
+	// Keep the first slots at the end of the list, they are used first.
+	for slot := c.nslots - 1; slot >= 0; slot-- {
+		if !used[slot] {
+			c.free = append(c.free, slot)
+		}
+	}
+}
+
+// loadContracts opens all contracts found in dir.
+func loadContracts(dir string) (map[string]*contract, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("ioutil.ReadDir(%q): %v", dir, err)
+	}
+	contracts := make(map[string]*contract)
+	for _, file := range files {
+		name := file.Name()
+		if atomicfile.IsTemp(name) {
+			// Left by a crash in contract.save.
+			if err := os.Remove(filepath.Join(dir, name)); err != nil {
+				return nil, fmt.Errorf("os.Remove(%q): %v", name, err)
+			}
+			continue
+		}
+		if !strings.HasSuffix(name, contractSuffix) {
+			continue
+		}
+		id, err := hex.DecodeString(strings.TrimSuffix(name, contractSuffix))
+		if err != nil {
+			return nil, fmt.Errorf("bad contract file name %q: %v", name, err)
+		}
+		c, err := openContract(dir, id)
+		if err != nil {
+			return nil, fmt.Errorf("openContract(%q): %v", name, err)
+		}
+		contracts[string(id)] = c
+	}
+	return contracts, nil
+}
+
+// save writes db durably. Run under c.mu.Lock().
+func (c *contract) save(db *hostdb.Contract) error {
+	dump, err := proto.Marshal(db)
+	if err != nil {
+		return fmt.Errorf("proto.Marshal: %v", err)
+	}
+	f, err := atomicfile.Create(contractPath(c.dir, db.Id) + contractSuffix)
+	if err != nil {
+		return fmt.Errorf("atomicfile.Create: %v", err)
+	}
+	if _, err := f.Write(dump); err != nil {
+		f.Abort()
+		return fmt.Errorf("Write(%q): %v", f.Name(), err)
+	}
+	if err := c.crash("before rename"); err != nil {
+		// The temporary file is left as after a crash.
+		f.Close()
+		return err
+	}
+	return f.Commit()
+}
+
+func (c *contract) close() error {
+	return c.data.Close()
+}
+
+func (c *contract) remove() error {
+	base := contractPath(c.dir, c.db.Id)
+	// The files may be left from an earlier failed attempt.
+	for _, suffix := range []string{contractSuffix, dataSuffix} {
+		if err := os.Remove(base + suffix); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *contract) numSectors() int64 {
+	return int64(len(c.db.SectorIds))
+}
+
+// readSector reads part of a sector. Run under c.mu.Lock().
+func (c *contract) readSector(sector int64, offset, size int) ([]byte, error) {
+	buf := make([]byte, size)
+	if sector == c.numSectors() {
+		// The sector to be appended.
+		return buf, nil
+	}
+	start := c.db.Slots[sector]*int64(c.db.SectorSize) + int64(offset)
+	if _, err := c.data.ReadAt(buf, start); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("ReadAt: %v", err)
+	}
+	return buf, nil
+}
+
+// rangeProof returns the proof of range [offset, offset+size) of a sector.
+// Run under c.mu.Lock().
+func (c *contract) rangeProof(sector int64, offset, size int) (*fpb.RangeProof, error) {
+	whole, err := c.readSector(sector, 0, int(c.db.SectorSize))
+	if err != nil {
+		return nil, err
+	}
+	start := offset / merkle.SegmentSize
+	end := merkle.Segments(offset + size)
+	hashes, err := merkle.RangeProof(whole, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("merkle.RangeProof: %v", err)
+	}
+	last := end * merkle.SegmentSize
+	if last > len(whole) {
+		last = len(whole)
+	}
+	return &fpb.RangeProof{
+		Prefix: whole[start*merkle.SegmentSize : offset],
+		Suffix: whole[offset+size : last],
+		Hashes: hashes,
+	}, nil
+}
+
+// state returns the current state of the contract. Run under c.mu.Lock().
+func (c *contract) state() *fpb.ContractState {
+	return &fpb.ContractState{
+		Id:         c.db.Id,
+		Revision:   c.db.Revision,
+		SectorIds:  c.db.SectorIds,
+		SectorSize: c.db.SectorSize,
+		Expires:    c.db.Expires,
+	}
+}
+
+// commit saves the state signed by the client with the given slots.
+// If it fails, the contract is not changed. Run under c.mu.Lock().
+func (c *contract) commit(state *fpb.ContractState, clientSignature []byte, slots []int64) error {
+	db := proto.Clone(c.db).(*hostdb.Contract)
+	db.Revision = state.Revision
+	db.SectorIds = state.SectorIds
+	db.Expires = state.Expires
+	db.ClientSignature = clientSignature
+	db.Slots = slots
+	if err := c.save(db); err != nil {
+		return err
+	}
+	c.db = db
+	c.findFree()
+	return nil
+}
+
+// grow adds free slots to the data file. It preallocates at most
+// spare bytes besides the slot needed now, negative spare means no
+// limit. Run under c.mu.Lock().
+func (c *contract) grow(spare int64) error {
+	sectorSize := int64(c.db.SectorSize)
+	add := c.nslots
+	if add*sectorSize > maxGrowBytes {
+		add = maxGrowBytes / sectorSize
+	}
+	if spare >= 0 && add > 1+spare/sectorSize {
+		add = 1 + spare/sectorSize
+	}
+	if add < 1 {
+		add = 1
+	}
+	if err := preallocate(c.data, c.nslots*sectorSize, add*sectorSize); err != nil {
+		return fmt.Errorf("preallocate: %v", err)
+	}
+	c.nslots += add
+	c.findFree()
+	return nil
+}
+
+// writeSector writes the whole sector to a free slot and commits
+// the new state. If sector is equal to the number of sectors, a new
+// sector is appended. See grow about spare. Run under c.mu.Lock().
+func (c *contract) writeSector(sector int64, whole []byte, state *fpb.ContractState, clientSignature []byte, spare int64) error {
+	if len(c.free) == 0 {
+		if err := c.grow(spare); err != nil {
+			return err
+		}
+	}
+	slot := c.free[len(c.free)-1]
+	if _, err := c.data.WriteAt(whole, slot*int64(c.db.SectorSize)); err != nil {
+		return fmt.Errorf("WriteAt: %v", err)
+	}
+	if err := c.data.Sync(); err != nil {
+		return fmt.Errorf("Sync: %v", err)
+	}
+	if err := c.crash("after data"); err != nil {
+		return err
+	}
+	slots := append([]int64{}, c.db.Slots...)
+	if sector == c.numSectors() {
+		slots = append(slots, slot)
+	} else {
+		slots[sector] = slot
+	}
+	return c.commit(state, clientSignature, slots)
+}
+
+// shrink truncates the contract to n sectors and commits the new state.
+// Run under c.mu.Lock().
+func (c *contract) shrink(n int64, state *fpb.ContractState, clientSignature []byte) error {
+	slots := append([]int64{}, c.db.Slots[:n]...)
+	if err := c.commit(state, clientSignature, slots); err != nil {
+		return err
+	}
+	if err := c.trim(); err != nil {
+		// The state is committed, free slots are reused anyway.
+		log.Printf("Failed to trim data file: %v.", err)
+	}
+	return nil
+}
+
+// trim removes free slots from the end of the data file.
+// Run under c.mu.Lock().
+func (c *contract) trim() error {
+	var last int64 = -1
+	for _, slot := range c.db.Slots {
+		if slot > last {
+			last = slot
+		}
+	}
+	nslots := last + 1
+	if nslots == c.nslots {
+		return nil
+	}
+	if err := c.data.Truncate(nslots * int64(c.db.SectorSize)); err != nil {
+		return fmt.Errorf("Truncate: %v", err)
+	}
+	c.nslots = nslots
+	c.findFree()
+	return nil
+}
+
+// reorder moves sector ordering[i] to position i and commits the new
+// state. ordering must be a permutation of sector indices.
+// Run under c.mu.Lock().
+func (c *contract) reorder(ordering []int64, state *fpb.ContractState, clientSignature []byte) error {
+	slots := make([]int64, len(ordering))
+	for i, j := range ordering {
+		slots[i] = c.db.Slots[j]
+	}
+	return c.commit(state, clientSignature, slots)
+}
+
+// sectorID returns the Merkle root of the sector.
+func sectorID(data []byte) []byte {
+	return merkle.Root(data)
+}
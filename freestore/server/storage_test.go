@@ -0,0 +1,241 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+
+	"github.com/starius/invisiblefs/atomicfile"
+	"github.com/starius/invisiblefs/freestore/hostdb"
+	fpb "github.com/starius/invisiblefs/freestore/proto"
+	"github.com/starius/invisiblefs/freestore/state"
+)
+
+const storageSectorSize = 256
+
+var errCrash = fmt.Errorf("crash")
+
+func storageSector(b byte) []byte {
+	return bytes.Repeat([]byte{b}, storageSectorSize)
+}
+
+func newStorageContract(t *testing.T, dir string) *contract {
+	expires, err := ptypes.TimestampProto(time.Now().Add(day))
+	if err != nil {
+		t.Fatalf("ptypes.TimestampProto: %v", err)
+	}
+	c, err := createContract(dir, &hostdb.Contract{
+		Id:         []byte("contract"),
+		SectorSize: storageSectorSize,
+		Expires:    expires,
+	})
+	if err != nil {
+		t.Fatalf("createContract: %v", err)
+	}
+	return c
+}
+
+// appendSector appends a sector using the storage directly.
+func appendSector(c *contract, data []byte) error {
+	st, err := state.Write(c.state(), c.numSectors(), sectorID(data))
+	if err != nil {
+		return err
+	}
+	return c.writeSector(c.numSectors(), data, st, nil, -1)
+}
+
+// reopen simulates a restart of the host: c is abandoned without
+// any cleanup and the contract is loaded from disk.
+func reopen(t *testing.T, dir string, c *contract) *contract {
+	c.close()
+	contracts, err := loadContracts(dir)
+	if err != nil {
+		t.Fatalf("loadContracts: %v", err)
+	}
+	c1, has := contracts[string(c.db.Id)]
+	if !has || len(contracts) != 1 {
+		t.Fatalf("loadContracts returned %d contracts", len(contracts))
+	}
+	return c1
+}
+
+// checkContract checks that the contract has the state and that
+// the data of each sector matches its root.
+func checkContract(t *testing.T, c *contract, want *fpb.ContractState, sectors ...[]byte) {
+	if got := c.state(); !proto.Equal(got, want) {
+		t.Fatalf("state is %v, want %v", got, want)
+	}
+	if int(c.numSectors()) != len(sectors) {
+		t.Fatalf("%d sectors, want %d", c.numSectors(), len(sectors))
+	}
+	for i, data := range sectors {
+		got, err := c.readSector(int64(i), 0, storageSectorSize)
+		if err != nil {
+			t.Fatalf("readSector(%d): %v", i, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("sector %d has wrong data", i)
+		}
+		if !bytes.Equal(sectorID(got), c.db.SectorIds[i]) {
+			t.Errorf("data of sector %d does not match its root", i)
+		}
+	}
+}
+
+func TestStorageCrashRecovery(t *testing.T) {
+	type operation struct {
+		name  string
+		apply func(c *contract) error
+		after [][]byte
+	}
+	operations := []operation{
+		{
+			name: "overwrite",
+			apply: func(c *contract) error {
+				st, err := state.Write(c.state(), 1, sectorID(storageSector(9)))
+				if err != nil {
+					return err
+				}
+				return c.writeSector(1, storageSector(9), st, nil, -1)
+			},
+			after: [][]byte{storageSector(1), storageSector(9), storageSector(3)},
+		},
+		{
+			name: "append",
+			apply: func(c *contract) error {
+				return appendSector(c, storageSector(4))
+			},
+			after: [][]byte{storageSector(1), storageSector(2), storageSector(3), storageSector(4)},
+		},
+		{
+			name: "shrink",
+			apply: func(c *contract) error {
+				st, err := state.Shrink(c.state(), 1)
+				if err != nil {
+					return err
+				}
+				return c.shrink(1, st, nil)
+			},
+			after: [][]byte{storageSector(1)},
+		},
+		{
+			name: "reorder",
+			apply: func(c *contract) error {
+				ordering := []int64{2, 0, 1}
+				st, err := state.Reorder(c.state(), ordering)
+				if err != nil {
+					return err
+				}
+				return c.reorder(ordering, st, nil)
+			},
+			after: [][]byte{storageSector(3), storageSector(1), storageSector(2)},
+		},
+	}
+	before := [][]byte{storageSector(1), storageSector(2), storageSector(3)}
+	for _, op := range operations {
+		for _, point := range []string{"after data", "before rename"} {
+			dir := tempDir(t)
+			c := newStorageContract(t, dir)
+			for _, data := range before {
+				if err := appendSector(c, data); err != nil {
+					t.Fatalf("appendSector: %v", err)
+				}
+			}
+			old := c.state()
+			crashed := false
+			c.crash = func(p string) error {
+				if p == point {
+					crashed = true
+					return errCrash
+				}
+				return nil
+			}
+			err := op.apply(c)
+			if crashed != (err == errCrash) {
+				t.Fatalf("%s, crash %s: apply returned %v", op.name, point, err)
+			}
+			if crashed {
+				c = reopen(t, dir, c)
+				checkContract(t, c, old, before...)
+				// The operation succeeds after the restart.
+				if err := op.apply(c); err != nil {
+					t.Fatalf("%s after crash %s: %v", op.name, point, err)
+				}
+			}
+			newState := c.state()
+			checkContract(t, c, newState, op.after...)
+			c = reopen(t, dir, c)
+			checkContract(t, c, newState, op.after...)
+			// Free slots are reused and do not corrupt sectors.
+			if err := appendSector(c, storageSector(7)); err != nil {
+				t.Fatalf("appendSector: %v", err)
+			}
+			checkContract(t, c, c.state(), append(op.after, storageSector(7))...)
+			c.close()
+			files, err := ioutil.ReadDir(dir)
+			if err != nil {
+				t.Fatalf("ioutil.ReadDir: %v", err)
+			}
+			for _, file := range files {
+				if atomicfile.IsTemp(file.Name()) {
+					t.Errorf("%s, crash %s: temporary file %s was not removed", op.name, point, file.Name())
+				}
+			}
+			os.RemoveAll(dir)
+		}
+	}
+}
+
+func TestStorageShrinkReclaimsSpace(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	c := newStorageContract(t, dir)
+	defer c.close()
+	for i := 0; i < 10; i++ {
+		if err := appendSector(c, storageSector(byte(i))); err != nil {
+			t.Fatalf("appendSector: %v", err)
+		}
+	}
+	st, err := state.Shrink(c.state(), 2)
+	if err != nil {
+		t.Fatalf("state.Shrink: %v", err)
+	}
+	if err := c.shrink(2, st, nil); err != nil {
+		t.Fatalf("shrink: %v", err)
+	}
+	stat, err := c.data.Stat()
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if stat.Size() != 2*storageSectorSize {
+		t.Errorf("size of data file after shrink is %d, want %d", stat.Size(), 2*storageSectorSize)
+	}
+}
+
+func TestStorageGrowWithinBudget(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	c := newStorageContract(t, dir)
+	defer c.close()
+	for i, spare := range []int64{-1, -1, 0, storageSectorSize, -1, -1} {
+		data := storageSector(byte(i))
+		st, err := state.Write(c.state(), c.numSectors(), sectorID(data))
+		if err != nil {
+			t.Fatalf("state.Write: %v", err)
+		}
+		if err := c.writeSector(c.numSectors(), data, st, nil, spare); err != nil {
+			t.Fatalf("writeSector: %v", err)
+		}
+	}
+	// 1 + 1 + 1 (no spare space) + 2 (one spare slot used by the
+	// next write) + 5.
+	if c.nslots != 10 {
+		t.Errorf("data file has %d slots, want 10", c.nslots)
+	}
+}
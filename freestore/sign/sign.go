@@ -0,0 +1,48 @@
+// Package sign defines the byte strings covered by signatures in
+// freestore requests and responses.
+//
+// Both the client and the host sign the state of a contract after each
+// change (see ContractState). The host also signs the state reported
+// in ContractMetadataResponse together with the nonce from the request.
+package sign
+
+import (
+	"crypto/sha256"
+
+	"github.com/golang/protobuf/proto"
+
+	fpb "github.com/starius/invisiblefs/freestore/proto"
+)
+
+// marshal concatenates the name of the operation and the length-prefixed
+// serializations of the messages.
+func marshal(op string, messages ...proto.Message) []byte {
+	buf := []byte(op + "\x00")
+	for _, m := range messages {
+		data, err := proto.Marshal(m)
+		if err != nil {
+			panic(err)
+		}
+		buf = append(buf, proto.EncodeVarint(uint64(len(data)))...)
+		buf = append(buf, data...)
+	}
+	return buf
+}
+
+// State returns the data signed by both sides when the state of
+// a contract changes.
+func State(state *fpb.ContractState) []byte {
+	return marshal("ContractState", state)
+}
+
+// Metadata returns the data signed by the host in ContractMetadataResponse.
+func Metadata(state *fpb.ContractState, nonce []byte) []byte {
+	return marshal("ContractMetadata", state, &fpb.ContractMetadataRequest{Nonce: nonce})
+}
+
+// Digest returns the nonce to pass to ContractMetadata to get
+// the answer usable as an evidence against the host (see Evidence).
+func Digest(signed *fpb.SignedState) []byte {
+	hash := sha256.Sum256(marshal("SignedState", signed))
+	return hash[:]
+}
@@ -0,0 +1,85 @@
+// Package state implements changes of freestore contract state.
+// The host and the client use it to compute the next state they sign.
+package state
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+
+	fpb "github.com/starius/invisiblefs/freestore/proto"
+)
+
+const Day = 24 * time.Hour
+
+// next returns a copy of st with incremented revision.
+func next(st *fpb.ContractState) *fpb.ContractState {
+	st1 := proto.Clone(st).(*fpb.ContractState)
+	st1.Revision++
+	return st1
+}
+
+// Write sets the root of a sector. If sector is equal to the number
+// of sectors, the sector is appended.
+func Write(st *fpb.ContractState, sector int64, root []byte) (*fpb.ContractState, error) {
+	n := int64(len(st.SectorIds))
+	if sector < 0 || sector > n {
+		return nil, fmt.Errorf("can not write sector %d to contract of %d sectors", sector, n)
+	}
+	st1 := next(st)
+	if sector == n {
+		st1.SectorIds = append(st1.SectorIds, root)
+	} else {
+		st1.SectorIds[sector] = root
+	}
+	return st1, nil
+}
+
+// Shrink truncates the contract to n sectors.
+func Shrink(st *fpb.ContractState, n int64) (*fpb.ContractState, error) {
+	if n < 0 || n > int64(len(st.SectorIds)) {
+		return nil, fmt.Errorf("can not shrink %d sectors to %d", len(st.SectorIds), n)
+	}
+	st1 := next(st)
+	st1.SectorIds = st1.SectorIds[:n]
+	return st1, nil
+}
+
+// Reorder moves sector ordering[i] to position i.
+func Reorder(st *fpb.ContractState, ordering []int64) (*fpb.ContractState, error) {
+	n := int64(len(st.SectorIds))
+	if int64(len(ordering)) != n {
+		return nil, fmt.Errorf("len(ordering) is %d, want %d", len(ordering), n)
+	}
+	seen := make([]bool, n)
+	for _, j := range ordering {
+		if j < 0 || j >= n || seen[j] {
+			return nil, fmt.Errorf("ordering is not a permutation")
+		}
+		seen[j] = true
+	}
+	st1 := next(st)
+	for i, j := range ordering {
+		st1.SectorIds[i] = st.SectorIds[j]
+	}
+	return st1, nil
+}
+
+// Extend moves the expiration time of the contract by days.
+func Extend(st *fpb.ContractState, days int32) (*fpb.ContractState, error) {
+	if days <= 0 {
+		return nil, fmt.Errorf("bad number of days: %d", days)
+	}
+	expires, err := ptypes.Timestamp(st.Expires)
+	if err != nil {
+		return nil, fmt.Errorf("bad expiration time: %v", err)
+	}
+	st1 := next(st)
+	st1.Expires, err = ptypes.TimestampProto(expires.Add(time.Duration(days) * Day))
+	if err != nil {
+		return nil, fmt.Errorf("bad number of days: %v", err)
+	}
+	return st1, nil
+}
@@ -0,0 +1,166 @@
+// Package verifier checks responses of untrusted freestore hosts.
+package verifier
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+
+	fpb "github.com/starius/invisiblefs/freestore/proto"
+	"github.com/starius/invisiblefs/freestore/sign"
+	"github.com/starius/invisiblefs/merkle"
+	"github.com/starius/invisiblefs/pubkey"
+)
+
+// ReadSector checks that res contains the range of the sector requested
+// in req. sectorSize and root are taken from the contract metadata.
+// req.ProofNeeded must be true.
+func ReadSector(req *fpb.ReadSectorRequest, res *fpb.ReadSectorResponse, sectorSize int32, root []byte) error {
+	if req.Offset < 0 || req.Size <= 0 || int64(req.Offset)+int64(req.Size) > int64(sectorSize) {
+		return fmt.Errorf("bad range [%d, %d)", req.Offset, int64(req.Offset)+int64(req.Size))
+	}
+	if len(res.Data) != int(req.Size) {
+		return fmt.Errorf("len(data) is %d, want %d", len(res.Data), req.Size)
+	}
+	proof := &fpb.RangeProof{}
+	if err := proto.Unmarshal(res.Proof, proof); err != nil {
+		return fmt.Errorf("proto.Unmarshal(proof): %v", err)
+	}
+	offset, size := int(req.Offset), int(req.Size)
+	start := offset / merkle.SegmentSize
+	end := merkle.Segments(offset + size)
+	if len(proof.Prefix) != offset-start*merkle.SegmentSize {
+		return fmt.Errorf("len(prefix) is %d, want %d", len(proof.Prefix), offset-start*merkle.SegmentSize)
+	}
+	last := end * merkle.SegmentSize
+	if last > int(sectorSize) {
+		last = int(sectorSize)
+	}
+	if len(proof.Suffix) != last-offset-size {
+		return fmt.Errorf("len(suffix) is %d, want %d", len(proof.Suffix), last-offset-size)
+	}
+	segments := make([]byte, 0, last-start*merkle.SegmentSize)
+	segments = append(segments, proof.Prefix...)
+	segments = append(segments, res.Data...)
+	segments = append(segments, proof.Suffix...)
+	n := merkle.Segments(int(sectorSize))
+	if err := merkle.VerifyRange(segments, proof.Hashes, start, end, n, root); err != nil {
+		return fmt.Errorf("merkle.VerifyRange: %v", err)
+	}
+	return nil
+}
+
+// Challenge checks the response to a proof-of-storage challenge.
+// st is the latest contract state signed by the host.
+func Challenge(req *fpb.ChallengeRequest, res *fpb.ChallengeResponse, st *fpb.ContractState) error {
+	if len(res.Proofs) != len(req.Segments) {
+		return fmt.Errorf("got %d proofs, want %d", len(res.Proofs), len(req.Segments))
+	}
+	sectorSize := int(st.SectorSize)
+	n := merkle.Segments(sectorSize)
+	for i, ref := range req.Segments {
+		if ref.Sector < 0 || ref.Sector >= int64(len(st.SectorIds)) {
+			return fmt.Errorf("no sector %d", ref.Sector)
+		}
+		start := int(ref.Segment)
+		if start < 0 || start >= n {
+			return fmt.Errorf("no segment %d", start)
+		}
+		size := sectorSize - start*merkle.SegmentSize
+		if size > merkle.SegmentSize {
+			size = merkle.SegmentSize
+		}
+		proof := res.Proofs[i]
+		if len(proof.Data) != size {
+			return fmt.Errorf("len(data) of segment %d of sector %d is %d, want %d", start, ref.Sector, len(proof.Data), size)
+		}
+		if err := merkle.VerifyRange(proof.Data, proof.Hashes, start, start+1, n, st.SectorIds[ref.Sector]); err != nil {
+			return fmt.Errorf("segment %d of sector %d: merkle.VerifyRange: %v", start, ref.Sector, err)
+		}
+	}
+	return nil
+}
+
+// CheckState checks the signatures of a contract state. The client
+// signature is not required for revision 0 created by the host.
+func CheckState(hostCert, clientCert []byte, signed *fpb.SignedState) error {
+	if signed.State == nil {
+		return fmt.Errorf("no state")
+	}
+	data := sign.State(signed.State)
+	if err := pubkey.Verify(hostCert, data, signed.HostSignature); err != nil {
+		return fmt.Errorf("bad host signature: %v", err)
+	}
+	if signed.State.Revision == 0 && len(signed.ClientSignature) == 0 {
+		return nil
+	}
+	if err := pubkey.Verify(clientCert, data, signed.ClientSignature); err != nil {
+		return fmt.Errorf("bad client signature: %v", err)
+	}
+	return nil
+}
+
+// CheckMetadata checks ContractMetadataResponse requested with
+// nonce = sign.Digest(latest), where latest is the latest state known
+// to the client. If the host reports an older state or another state
+// of the same revision, CheckMetadata returns the evidence of this
+// (see CheckEvidence) in addition to the error.
+func CheckMetadata(hostCert, clientCert []byte, latest *fpb.SignedState, res *fpb.ContractMetadataResponse) (*fpb.Evidence, error) {
+	if res.State == nil {
+		return nil, fmt.Errorf("no state")
+	}
+	nonce := sign.Digest(latest)
+	if err := pubkey.Verify(hostCert, sign.Metadata(res.State, nonce), res.Signature); err != nil {
+		return nil, fmt.Errorf("bad host signature: %v", err)
+	}
+	reported, want := res.State, latest.State
+	if !bytes.Equal(reported.Id, want.Id) {
+		return nil, fmt.Errorf("reported state of another contract")
+	}
+	if reported.Revision < want.Revision || (reported.Revision == want.Revision && !proto.Equal(reported, want)) {
+		evidence := &fpb.Evidence{
+			Latest:    latest,
+			Reported:  reported,
+			Signature: res.Signature,
+		}
+		return evidence, fmt.Errorf("host reported revision %d, latest is %d", reported.Revision, want.Revision)
+	}
+	if err := pubkey.Verify(clientCert, sign.State(reported), res.ClientSignature); err != nil && reported.Revision != 0 {
+		return nil, fmt.Errorf("reported state is not signed by the client: %v", err)
+	}
+	if len(res.SectorIds) != len(reported.SectorIds) || res.SectorSize != reported.SectorSize {
+		return nil, fmt.Errorf("metadata does not match the reported state")
+	}
+	for i, id := range res.SectorIds {
+		if !bytes.Equal(id, reported.SectorIds[i]) {
+			return nil, fmt.Errorf("metadata does not match the reported state")
+		}
+	}
+	return nil, nil
+}
+
+// CheckEvidence checks that the host signed the latest state and later
+// reported an older state or another state of the same revision.
+// The client signature of the latest state is not checked: the host
+// has signed it anyway.
+func CheckEvidence(hostCert []byte, e *fpb.Evidence) error {
+	if e.Latest == nil || e.Latest.State == nil || e.Reported == nil {
+		return fmt.Errorf("incomplete evidence")
+	}
+	latest := e.Latest.State
+	if err := pubkey.Verify(hostCert, sign.State(latest), e.Latest.HostSignature); err != nil {
+		return fmt.Errorf("latest state is not signed by the host: %v", err)
+	}
+	nonce := sign.Digest(e.Latest)
+	if err := pubkey.Verify(hostCert, sign.Metadata(e.Reported, nonce), e.Signature); err != nil {
+		return fmt.Errorf("reported state is not signed by the host: %v", err)
+	}
+	if !bytes.Equal(e.Reported.Id, latest.Id) {
+		return fmt.Errorf("states of different contracts")
+	}
+	if e.Reported.Revision > latest.Revision || proto.Equal(e.Reported, latest) {
+		return fmt.Errorf("reported state is not older than the latest state")
+	}
+	return nil
+}
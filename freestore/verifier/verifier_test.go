@@ -0,0 +1,69 @@
+package verifier
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	fpb "github.com/starius/invisiblefs/freestore/proto"
+	"github.com/starius/invisiblefs/merkle"
+)
+
+const sectorSize = 1000
+
+func response(t *testing.T, sector []byte, offset, size int) *fpb.ReadSectorResponse {
+	start := offset / merkle.SegmentSize
+	end := merkle.Segments(offset + size)
+	hashes, err := merkle.RangeProof(sector, start, end)
+	if err != nil {
+		t.Fatalf("merkle.RangeProof: %v", err)
+	}
+	last := end * merkle.SegmentSize
+	if last > len(sector) {
+		last = len(sector)
+	}
+	proof, err := proto.Marshal(&fpb.RangeProof{
+		Prefix: sector[start*merkle.SegmentSize : offset],
+		Suffix: sector[offset+size : last],
+		Hashes: hashes,
+	})
+	if err != nil {
+		t.Fatalf("proto.Marshal: %v", err)
+	}
+	return &fpb.ReadSectorResponse{
+		Data:  append([]byte{}, sector[offset:offset+size]...),
+		Proof: proof,
+	}
+}
+
+func TestReadSector(t *testing.T) {
+	sector := make([]byte, sectorSize)
+	rand.Read(sector)
+	root := merkle.Root(sector)
+	for _, r := range []struct{ offset, size int }{
+		{0, sectorSize},
+		{10, 100},
+		{990, 10},
+		{64, 1},
+	} {
+		req := &fpb.ReadSectorRequest{
+			Offset:      int32(r.offset),
+			Size:        int32(r.size),
+			ProofNeeded: true,
+		}
+		res := response(t, sector, r.offset, r.size)
+		if err := ReadSector(req, res, sectorSize, root); err != nil {
+			t.Errorf("ReadSector(%v): %v", r, err)
+		}
+		res.Data[0] ^= 1
+		if err := ReadSector(req, res, sectorSize, root); err == nil {
+			t.Errorf("ReadSector(%v) accepted corrupted data", r)
+		}
+		res.Data[0] ^= 1
+		req.Offset++
+		if err := ReadSector(req, res, sectorSize, root); err == nil {
+			t.Errorf("ReadSector(%v) accepted data from another offset", r)
+		}
+	}
+}
@@ -3,10 +3,18 @@ package kvsia
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/starius/invisiblefs/siaform/files"
+	"github.com/starius/invisiblefs/siaform/manager"
+	"github.com/starius/invisiblefs/zipkvserver/kv"
+	"golang.org/x/net/context"
 )
 
+// Clients are asked to retry after this delay if too much data
+// waits for uploading.
+const retryAfter = 10 * time.Second
+
 type KvSia struct {
 	f *files.Files
 }
@@ -15,14 +23,14 @@ func New(f *files.Files) (*KvSia, error) {
 	return &KvSia{f}, nil
 }
 
-func (k *KvSia) Has(key string) (bool, []byte, error) {
+func (k *KvSia) Has(ctx context.Context, key string) (bool, []byte, error) {
 	has, err := k.f.Has("metadata-" + key)
 	if err != nil {
 		return false, nil, fmt.Errorf("f.Has: %v", err)
 	}
 	var metadata []byte
 	if has {
-		metadata, err = k.f.Get("metadata-" + key)
+		metadata, err = k.f.Get(ctx, "metadata-"+key)
 		if err != nil {
 			return false, nil, fmt.Errorf("Failed to get metadata: %v", err)
 		}
@@ -30,31 +38,31 @@ func (k *KvSia) Has(key string) (bool, []byte, error) {
 	return has, metadata, nil
 }
 
-func (k *KvSia) Get(key string) ([]byte, []byte, error) {
-	metadata, err := k.f.Get("metadata-" + key)
+func (k *KvSia) Get(ctx context.Context, key string) ([]byte, []byte, error) {
+	metadata, err := k.f.Get(ctx, "metadata-"+key)
 	if err != nil {
 		return nil, nil, fmt.Errorf("Failed to get metadata: %v", err)
 	}
-	data, err := k.f.Get("data-" + key)
+	data, err := k.f.Get(ctx, "data-"+key)
 	if err != nil {
 		return nil, nil, fmt.Errorf("Failed to get data: %v", err)
 	}
 	return data, metadata, nil
 }
 
-func (k *KvSia) GetAt(key string, offset, size int) ([]byte, []byte, error) {
-	metadata, err := k.f.Get("metadata-" + key)
+func (k *KvSia) GetAt(ctx context.Context, key string, offset, size int) ([]byte, []byte, error) {
+	metadata, err := k.f.Get(ctx, "metadata-"+key)
 	if err != nil {
 		return nil, nil, fmt.Errorf("Failed to get metadata: %v", err)
 	}
-	data, err := k.f.GetAt("data-"+key, offset, size)
+	data, err := k.f.GetAt(ctx, "data-"+key, offset, size)
 	if err != nil {
 		return nil, nil, fmt.Errorf("Failed to get data: %v", err)
 	}
 	return data, metadata, nil
 }
 
-func (k *KvSia) List() (map[string]int, error) {
+func (k *KvSia) List(ctx context.Context) (map[string]int, error) {
 	l, err := k.f.List()
 	if err != nil {
 		return nil, err
@@ -68,28 +76,52 @@ func (k *KvSia) List() (map[string]int, error) {
 	return m, nil
 }
 
-func (k *KvSia) Put(key string, value, metadata []byte) error {
-	if err := k.f.Put("metadata-"+key, metadata); err != nil {
-		return fmt.Errorf("Failed to put metadata: %v", err)
+func retryLater(err error) error {
+	return &kv.RetryableError{
+		Err:        err,
+		RetryAfter: retryAfter,
 	}
-	if err := k.f.Put("data-"+key, value); err != nil {
-		return fmt.Errorf("Failed to put data: %v", err)
+}
+
+// putMetadata writes the metadata of the key. The data is written
+// before it, so if the metadata can not be written, the key is
+// removed to be not left without metadata.
+func (k *KvSia) putMetadata(ctx context.Context, key string, metadata []byte) error {
+	err := k.f.Put(ctx, "metadata-"+key, metadata)
+	if err == nil {
+		return nil
 	}
-	return nil
+	if err2 := k.f.Delete("data-" + key); err2 != nil {
+		return fmt.Errorf("Failed to put metadata: %v; failed to delete data: %v", err, err2)
+	}
+	if err2 := k.f.Delete("metadata-" + key); err2 != nil {
+		return fmt.Errorf("Failed to put metadata: %v; failed to delete old metadata: %v", err, err2)
+	}
+	if err == manager.ErrOverloaded {
+		return retryLater(err)
+	}
+	return fmt.Errorf("Failed to put metadata: %v", err)
 }
 
-func (k *KvSia) Link(dstKey, srcKey string, metadata []byte) error {
-	if err := k.f.Put("metadata-"+dstKey, metadata); err != nil {
-		return fmt.Errorf("Failed to put metadata: %v", err)
+func (k *KvSia) Put(ctx context.Context, key string, value, metadata []byte) error {
+	if err := k.f.Put(ctx, "data-"+key, value); err != nil {
+		if err == manager.ErrOverloaded {
+			return retryLater(err)
+		}
+		return fmt.Errorf("Failed to put data: %v", err)
 	}
+	return k.putMetadata(ctx, key, metadata)
+}
+
+func (k *KvSia) Link(ctx context.Context, dstKey, srcKey string, metadata []byte) error {
 	if err := k.f.Link("data-"+dstKey, "data-"+srcKey); err != nil {
 		return fmt.Errorf("Failed to link data: %v", err)
 	}
-	return nil
+	return k.putMetadata(ctx, dstKey, metadata)
 }
 
-func (k *KvSia) Delete(key string) (metadata []byte, err error) {
-	metadata, err = k.f.Get("metadata-" + key)
+func (k *KvSia) Delete(ctx context.Context, key string) (metadata []byte, err error) {
+	metadata, err = k.f.Get(ctx, "metadata-"+key)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to get metadata: %v", err)
 	}
@@ -102,7 +134,7 @@ func (k *KvSia) Delete(key string) (metadata []byte, err error) {
 	return metadata, nil
 }
 
-func (k *KvSia) Sync() error {
+func (k *KvSia) Sync(ctx context.Context) error {
 	// TODO upload is_progress, upload pending
 	return nil
 }
@@ -0,0 +1,77 @@
+package kvsia
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/starius/invisiblefs/siaform/files"
+	"github.com/starius/invisiblefs/siaform/manager"
+	"github.com/starius/invisiblefs/zipkvserver/kv"
+	"golang.org/x/net/context"
+)
+
+// newOverloaded returns KvSia over a manager which has no memory
+// for one more sector.
+func newOverloaded(t *testing.T, sectorSize int) (*KvSia, *files.Files) {
+	mn, err := manager.New(2, 1, sectorSize, nil)
+	if err != nil {
+		t.Fatalf("manager.New: %v", err)
+	}
+	if err := mn.SetUploadLimits(2*int64(sectorSize), 0, time.Second); err != nil {
+		t.Fatalf("mn.SetUploadLimits: %v", err)
+	}
+	// The manager is not started, so pending sectors are not drained.
+	for i := 0; i < 2; i++ {
+		if _, err := mn.AddSector(context.Background(), make([]byte, sectorSize)); err != nil {
+			t.Fatalf("mn.AddSector: %v", err)
+		}
+	}
+	f, err := files.New(sectorSize, mn)
+	if err != nil {
+		t.Fatalf("files.New: %v", err)
+	}
+	k, err := New(f)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return k, f
+}
+
+func TestPutOverloaded(t *testing.T) {
+	const sectorSize = 4096
+	ctx := context.Background()
+	// The data fits into the sector in progress, the metadata
+	// fills it and its upload is rejected.
+	value := make([]byte, 3000)
+	metadata := make([]byte, 3000)
+	rand.Read(value)
+	rand.Read(metadata)
+	for _, put := range []func(k *KvSia, f *files.Files) error{
+		func(k *KvSia, f *files.Files) error {
+			return k.Put(ctx, "key", value, metadata)
+		},
+		func(k *KvSia, f *files.Files) error {
+			if err := f.Put(ctx, "data-src", value); err != nil {
+				t.Fatalf("f.Put: %v", err)
+			}
+			return k.Link(ctx, "key", "src", metadata)
+		},
+	} {
+		k, f := newOverloaded(t, sectorSize)
+		err := put(k, f)
+		if _, ok := err.(*kv.RetryableError); !ok {
+			t.Fatalf("got %v, want kv.RetryableError", err)
+		}
+		if has, _, err := k.Has(ctx, "key"); err != nil || has {
+			t.Errorf("Has returned %v, %v after the failed write", has, err)
+		}
+		list, err := k.List(ctx)
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+		if _, has := list["key"]; has {
+			t.Errorf("the key without metadata is listed")
+		}
+	}
+}
@@ -0,0 +1,203 @@
+// Package merkle implements Merkle trees over 64-byte segments compatible
+// with sector roots of Sia: leaves are blake2b-256 of 0x00 and a segment,
+// inner nodes are blake2b-256 of 0x01 and two child hashes. If the number
+// of leaves is not a power of two, the left subtree of a node is
+// the largest complete tree with fewer leaves than the node.
+package merkle
+
+import (
+	"bytes"
+	"fmt"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+const (
+	SegmentSize = 64
+	HashSize    = blake2b.Size256
+)
+
+func leafHash(segment []byte) []byte {
+	h := blake2b.Sum256(append([]byte{0}, segment...))
+	return h[:]
+}
+
+func nodeHash(left, right []byte) []byte {
+	buf := make([]byte, 0, 1+2*HashSize)
+	buf = append(buf, 1)
+	buf = append(buf, left...)
+	buf = append(buf, right...)
+	h := blake2b.Sum256(buf)
+	return h[:]
+}
+
+// Segments returns the number of segments in data of length size.
+func Segments(size int) int {
+	return (size + SegmentSize - 1) / SegmentSize
+}
+
+func leaves(data []byte) [][]byte {
+	var hashes [][]byte
+	for len(data) > 0 {
+		n := SegmentSize
+		if n > len(data) {
+			n = len(data)
+		}
+		hashes = append(hashes, leafHash(data[:n]))
+		data = data[n:]
+	}
+	return hashes
+}
+
+// split returns the number of leaves in the left subtree of a node
+// with n > 1 leaves.
+func split(n int) int {
+	k := 1
+	for k*2 < n {
+		k *= 2
+	}
+	return k
+}
+
+func root(hashes [][]byte) []byte {
+	if len(hashes) == 1 {
+		return hashes[0]
+	}
+	k := split(len(hashes))
+	return nodeHash(root(hashes[:k]), root(hashes[k:]))
+}
+
+// Root returns the Merkle root of data.
+func Root(data []byte) []byte {
+	if len(data) == 0 {
+		return nil
+	}
+	return root(leaves(data))
+}
+
+// RangeProof returns the proof that segments [start, end) belong to data.
+// The proof consists of roots of the subtrees not intersecting the range
+// from left to right.
+func RangeProof(data []byte, start, end int) ([][]byte, error) {
+	return NewTree(data).RangeProof(start, end)
+}
+
+// Tree is the Merkle tree of data with all inner nodes computed once,
+// so proofs of many ranges of the same data are cheap.
+type Tree struct {
+	// levels[h][i] is the root of leaves [i*2^h, (i+1)*2^h),
+	// the last node of a level may have fewer leaves.
+	levels [][][]byte
+}
+
+// NewTree builds the Merkle tree of data.
+func NewTree(data []byte) *Tree {
+	level := leaves(data)
+	t := &Tree{levels: [][][]byte{level}}
+	for len(level) > 1 {
+		var next [][]byte
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				// The left subtree of the node is complete,
+				// so the last node has no pair.
+				next = append(next, level[i])
+			} else {
+				next = append(next, nodeHash(level[i], level[i+1]))
+			}
+		}
+		t.levels = append(t.levels, next)
+		level = next
+	}
+	return t
+}
+
+// node returns the root of the subtree of leaves [lo, hi).
+// lo is aligned to the smallest power of two not less than hi-lo.
+func (t *Tree) node(lo, hi int) []byte {
+	h := uint(0)
+	for 1<<h < hi-lo {
+		h++
+	}
+	return t.levels[h][lo>>h]
+}
+
+// RangeProof returns the proof that segments [start, end) belong
+// to the data of the tree (see function RangeProof).
+func (t *Tree) RangeProof(start, end int) ([][]byte, error) {
+	n := len(t.levels[0])
+	if start < 0 || start >= end || end > n {
+		return nil, fmt.Errorf("bad range [%d, %d) of %d segments", start, end, n)
+	}
+	var proof [][]byte
+	var walk func(lo, hi int)
+	walk = func(lo, hi int) {
+		if hi <= start || lo >= end {
+			proof = append(proof, t.node(lo, hi))
+			return
+		}
+		if start <= lo && hi <= end {
+			return
+		}
+		k := split(hi - lo)
+		walk(lo, lo+k)
+		walk(lo+k, hi)
+	}
+	walk(0, n)
+	return proof, nil
+}
+
+// VerifyRange checks that segments [start, end) of data having n segments
+// and the Merkle root are equal to the given bytes. The last segment
+// of the range may be incomplete only if it is the last segment of data.
+func VerifyRange(segments []byte, proof [][]byte, start, end, n int, wantRoot []byte) error {
+	if start < 0 || start >= end || end > n {
+		return fmt.Errorf("bad range [%d, %d) of %d segments", start, end, n)
+	}
+	hashes := leaves(segments)
+	if len(hashes) != end-start {
+		return fmt.Errorf("got %d segments, want %d", len(hashes), end-start)
+	}
+	if end < n && len(segments) != (end-start)*SegmentSize {
+		return fmt.Errorf("incomplete segment in the middle of data")
+	}
+	for _, h := range proof {
+		if len(h) != HashSize {
+			return fmt.Errorf("bad hash length in proof: %d", len(h))
+		}
+	}
+	var walk func(lo, hi int) ([]byte, error)
+	walk = func(lo, hi int) ([]byte, error) {
+		if hi <= start || lo >= end {
+			if len(proof) == 0 {
+				return nil, fmt.Errorf("the proof is too short")
+			}
+			h := proof[0]
+			proof = proof[1:]
+			return h, nil
+		}
+		if start <= lo && hi <= end {
+			return root(hashes[lo-start : hi-start]), nil
+		}
+		k := split(hi - lo)
+		left, err := walk(lo, lo+k)
+		if err != nil {
+			return nil, err
+		}
+		right, err := walk(lo+k, hi)
+		if err != nil {
+			return nil, err
+		}
+		return nodeHash(left, right), nil
+	}
+	gotRoot, err := walk(0, n)
+	if err != nil {
+		return err
+	}
+	if len(proof) != 0 {
+		return fmt.Errorf("the proof is too long")
+	}
+	if !bytes.Equal(gotRoot, wantRoot) {
+		return fmt.Errorf("Merkle root mismatch")
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package merkle
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math/rand"
+	"testing"
+)
+
+func makeData(size int) []byte {
+	data := make([]byte, size)
+	rand.New(rand.NewSource(int64(size))).Read(data)
+	return data
+}
+
+func TestRoot(t *testing.T) {
+	if root := Root(nil); root != nil {
+		t.Errorf("Root(nil) = %x", root)
+	}
+	segment := makeData(SegmentSize)
+	if root := Root(segment); !bytes.Equal(root, leafHash(segment)) {
+		t.Errorf("root of one segment is not its leaf hash")
+	}
+	data := makeData(3 * SegmentSize)
+	a := leafHash(data[:SegmentSize])
+	b := leafHash(data[SegmentSize : 2*SegmentSize])
+	c := leafHash(data[2*SegmentSize:])
+	if root := Root(data); !bytes.Equal(root, nodeHash(nodeHash(a, b), c)) {
+		t.Errorf("wrong root of three segments")
+	}
+	// Root of 4 MiB of zeros, sector root of an empty Sia sector.
+	want := "50ed59cecd5ed3ca9e65cec0797202091dbba45272dafa3faa4e27064eedd52c"
+	if root := hex.EncodeToString(Root(make([]byte, 1<<22))); root != want {
+		t.Errorf("root of empty sector is %s, want %s", root, want)
+	}
+}
+
+func TestRangeProof(t *testing.T) {
+	for _, size := range []int{SegmentSize, 7 * SegmentSize, 8 * SegmentSize, 10*SegmentSize + 5, 37 * SegmentSize} {
+		data := makeData(size)
+		n := Segments(size)
+		root := Root(data)
+		for start := 0; start < n; start++ {
+			for end := start + 1; end <= n; end++ {
+				proof, err := RangeProof(data, start, end)
+				if err != nil {
+					t.Fatalf("RangeProof(%d, %d, %d): %v", size, start, end, err)
+				}
+				last := end * SegmentSize
+				if last > size {
+					last = size
+				}
+				segments := data[start*SegmentSize : last]
+				if err := VerifyRange(segments, proof, start, end, n, root); err != nil {
+					t.Errorf("VerifyRange(%d, %d, %d): %v", size, start, end, err)
+				}
+				bad := append([]byte{}, segments...)
+				bad[len(bad)-1] ^= 1
+				if err := VerifyRange(bad, proof, start, end, n, root); err == nil {
+					t.Errorf("VerifyRange(%d, %d, %d) accepted corrupted data", size, start, end)
+				}
+				if len(proof) > 0 {
+					if err := VerifyRange(segments, proof[1:], start, end, n, root); err == nil {
+						t.Errorf("VerifyRange(%d, %d, %d) accepted truncated proof", size, start, end)
+					}
+				}
+			}
+		}
+	}
+}
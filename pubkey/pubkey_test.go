@@ -147,3 +147,25 @@ func TestPubkeyReproducibleRandom(t *testing.T) {
 		t.Fatal("certs generated from the same PRNG are different")
 	}
 }
+
+func TestSignVerify(t *testing.T) {
+	priv, err := GeneratePriv(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := Cert(priv, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte("message")
+	signature, err := Sign(priv, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(cert, data, signature); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+	if err := Verify(cert, []byte("other message"), signature); err == nil {
+		t.Errorf("Verify accepted signature of other message")
+	}
+}
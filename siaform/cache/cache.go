@@ -1,10 +1,12 @@
 package cache
 
 import (
+	"fmt"
 	"sync"
 
 	"github.com/starius/invisiblefs/inmem"
 	"github.com/starius/invisiblefs/siaform/manager"
+	"golang.org/x/net/context"
 )
 
 type SiaClient struct {
@@ -31,8 +33,8 @@ func New(size int, backend manager.SiaClient) (*SiaClient, error) {
 	return sc, nil
 }
 
-func (s *SiaClient) Contracts() ([]string, error) {
-	return s.backend.Contracts()
+func (s *SiaClient) Contracts(ctx context.Context) ([]string, error) {
+	return s.backend.Contracts(ctx)
 }
 
 func (s *SiaClient) serialize(sectorRoot string) {
@@ -47,7 +49,14 @@ func (s *SiaClient) serialize(sectorRoot string) {
 	s.inFlight[sectorRoot] = struct{}{}
 }
 
-func (s *SiaClient) Read(contractID, sectorRoot string, sectorID int64) ([]byte, error) {
+func (s *SiaClient) Read(ctx context.Context, contractID, sectorRoot string, sectorID int64) ([]byte, error) {
+	return s.read(sectorRoot, func() ([]byte, error) {
+		return s.backend.Read(ctx, contractID, sectorRoot, sectorID)
+	})
+}
+
+// read returns the sector from the cache or loads it.
+func (s *SiaClient) read(sectorRoot string, load func() ([]byte, error)) ([]byte, error) {
 	s.serialize(sectorRoot)
 	defer func() {
 		s.mu.Lock()
@@ -59,17 +68,97 @@ func (s *SiaClient) Read(contractID, sectorRoot string, sectorID int64) ([]byte,
 	if has {
 		return cached.([]byte), nil
 	}
-	data, err := s.backend.Read(contractID, sectorRoot, sectorID)
+	data, err := load()
 	if err == nil {
 		s.cache.Add(sectorRoot, data)
 	}
 	return data, err
 }
 
-func (s *SiaClient) Write(contractID string, data []byte, sectorID int64) (string, error) {
-	sectorRoot, err := s.backend.Write(contractID, data, sectorID)
+// ReadAt returns the range from the cache if the whole sector is
+// cached. Otherwise it reads the range from backend without caching.
+func (s *SiaClient) ReadAt(ctx context.Context, contractID, sectorRoot string, sectorID int64, offset, length int) ([]byte, error) {
+	return s.readAt(sectorRoot, offset, length, func() ([]byte, error) {
+		return s.backend.ReadAt(ctx, contractID, sectorRoot, sectorID, offset, length)
+	})
+}
+
+func (s *SiaClient) readAt(sectorRoot string, offset, length int, load func() ([]byte, error)) ([]byte, error) {
+	cached, has := s.cache.Get(sectorRoot)
+	if has {
+		data := cached.([]byte)
+		if offset < 0 || length < 0 || offset+length > len(data) {
+			return nil, fmt.Errorf("bad range [%d,%d)", offset, offset+length)
+		}
+		return data[offset : offset+length], nil
+	}
+	return load()
+}
+
+func (s *SiaClient) Write(ctx context.Context, contractID string, data []byte, sectorID int64) (string, error) {
+	sectorRoot, err := s.backend.Write(ctx, contractID, data, sectorID)
 	if err == nil {
 		s.cache.Add(sectorRoot, data)
 	}
 	return sectorRoot, err
 }
+
+func (s *SiaClient) Transform(data []byte, sectorID int64) []byte {
+	if t, ok := s.backend.(manager.Transformer); ok {
+		return t.Transform(data, sectorID)
+	}
+	return data
+}
+
+// WriteSealed, ReadSealed, ReadAtSealed and TransformSealed implement
+// manager.Sealer. If backend is not a Sealer, sectors are written
+// without a header.
+
+func (s *SiaClient) WriteSealed(ctx context.Context, contractID string, data []byte, sectorID int64) (string, []byte, error) {
+	sealer, ok := s.backend.(manager.Sealer)
+	if !ok {
+		sectorRoot, err := s.Write(ctx, contractID, data, sectorID)
+		return sectorRoot, nil, err
+	}
+	sectorRoot, header, err := sealer.WriteSealed(ctx, contractID, data, sectorID)
+	if err == nil {
+		s.cache.Add(sectorRoot, data)
+	}
+	return sectorRoot, header, err
+}
+
+func (s *SiaClient) ReadSealed(ctx context.Context, contractID, sectorRoot string, sectorID int64, header []byte) ([]byte, error) {
+	sealer, ok := s.backend.(manager.Sealer)
+	if !ok {
+		return nil, fmt.Errorf("backend can not read sealed sectors")
+	}
+	return s.read(sectorRoot, func() ([]byte, error) {
+		return sealer.ReadSealed(ctx, contractID, sectorRoot, sectorID, header)
+	})
+}
+
+func (s *SiaClient) ReadAtSealed(ctx context.Context, contractID, sectorRoot string, sectorID int64, header []byte, offset, length int) ([]byte, error) {
+	sealer, ok := s.backend.(manager.Sealer)
+	if !ok {
+		return nil, fmt.Errorf("backend can not read sealed sectors")
+	}
+	return s.readAt(sectorRoot, offset, length, func() ([]byte, error) {
+		return sealer.ReadAtSealed(ctx, contractID, sectorRoot, sectorID, header, offset, length)
+	})
+}
+
+func (s *SiaClient) TransformSealed(data []byte, sectorID int64, header []byte) ([]byte, error) {
+	sealer, ok := s.backend.(manager.Sealer)
+	if !ok {
+		return nil, fmt.Errorf("backend can not transform sealed sectors")
+	}
+	return sealer.TransformSealed(data, sectorID, header)
+}
+
+// Delete forwards the call to the backend.
+func (s *SiaClient) Delete(ctx context.Context, contractID, sectorRoot string) error {
+	if d, ok := s.backend.(manager.Deleter); ok {
+		return d.Delete(ctx, contractID, sectorRoot)
+	}
+	return nil
+}
@@ -1,7 +1,10 @@
 package crypto
 
 import (
+	"fmt"
+
 	"github.com/starius/invisiblefs/siaform/manager"
+	"golang.org/x/net/context"
 )
 
 type SiaClient struct {
@@ -20,12 +23,12 @@ func New(key []byte, backend manager.SiaClient) (*SiaClient, error) {
 	}, err
 }
 
-func (s *SiaClient) Contracts() ([]string, error) {
-	return s.backend.Contracts()
+func (s *SiaClient) Contracts(ctx context.Context) ([]string, error) {
+	return s.backend.Contracts(ctx)
 }
 
-func (s *SiaClient) Read(contractID, sectorRoot string, sectorID int64) ([]byte, error) {
-	data, err := s.backend.Read(contractID, sectorRoot, sectorID)
+func (s *SiaClient) Read(ctx context.Context, contractID, sectorRoot string, sectorID int64) ([]byte, error) {
+	data, err := s.backend.Read(ctx, contractID, sectorRoot, sectorID)
 	if err != nil {
 		return nil, err
 	}
@@ -35,9 +38,97 @@ func (s *SiaClient) Read(contractID, sectorRoot string, sectorID int64) ([]byte,
 	return data1, err
 }
 
-func (s *SiaClient) Write(contractID string, data []byte, sectorID int64) (string, error) {
+func (s *SiaClient) ReadAt(ctx context.Context, contractID, sectorRoot string, sectorID int64, offset, length int) ([]byte, error) {
+	data, err := s.backend.ReadAt(ctx, contractID, sectorRoot, sectorID, offset, length)
+	if err != nil {
+		return nil, err
+	}
+	data1 := make([]byte, len(data))
+	copy(data1, data)
+	s.c.DecryptAt(sectorID, offset, data1)
+	return data1, err
+}
+
+// Write stores the sector encrypted with AES-CTR without a MAC.
+// The manager uses WriteSealed instead.
+func (s *SiaClient) Write(ctx context.Context, contractID string, data []byte, sectorID int64) (string, error) {
+	data1 := make([]byte, len(data))
+	copy(data1, data)
+	s.c.Encrypt(sectorID, data1)
+	return s.backend.Write(ctx, contractID, data1, sectorID)
+}
+
+// WriteSealed stores the sector encrypted with AES-GCM and
+// a random nonce. Implements manager.Sealer.
+func (s *SiaClient) WriteSealed(ctx context.Context, contractID string, data []byte, sectorID int64) (string, []byte, error) {
+	data1 := make([]byte, len(data))
+	copy(data1, data)
+	header, err := s.c.Seal(sectorID, data1)
+	if err != nil {
+		return "", nil, err
+	}
+	sectorRoot, err := s.backend.Write(ctx, contractID, data1, sectorID)
+	if err != nil {
+		return "", nil, err
+	}
+	return sectorRoot, header, nil
+}
+
+// ReadSealed returns ErrAuth if the sector was modified.
+func (s *SiaClient) ReadSealed(ctx context.Context, contractID, sectorRoot string, sectorID int64, header []byte) ([]byte, error) {
+	data, err := s.backend.Read(ctx, contractID, sectorRoot, sectorID)
+	if err != nil {
+		return nil, err
+	}
+	data1 := make([]byte, len(data))
+	copy(data1, data)
+	if err := s.c.Open(sectorID, header, data1); err != nil {
+		return nil, fmt.Errorf("sector %d: %v", sectorID, err)
+	}
+	return data1, nil
+}
+
+func (s *SiaClient) ReadAtSealed(ctx context.Context, contractID, sectorRoot string, sectorID int64, header []byte, offset, length int) ([]byte, error) {
+	data, err := s.backend.ReadAt(ctx, contractID, sectorRoot, sectorID, offset, length)
+	if err != nil {
+		return nil, err
+	}
+	data1 := make([]byte, len(data))
+	copy(data1, data)
+	if err := s.c.OpenAt(header, offset, data1); err != nil {
+		return nil, fmt.Errorf("sector %d: %v", sectorID, err)
+	}
+	return data1, nil
+}
+
+// TransformSealed returns the data sealed as it is stored by backend.
+func (s *SiaClient) TransformSealed(data []byte, sectorID int64, header []byte) ([]byte, error) {
+	data1 := make([]byte, len(data))
+	copy(data1, data)
+	if err := s.c.Reseal(sectorID, header, data1); err != nil {
+		return nil, fmt.Errorf("sector %d: %v", sectorID, err)
+	}
+	if t, ok := s.backend.(manager.Transformer); ok {
+		return t.Transform(data1, sectorID), nil
+	}
+	return data1, nil
+}
+
+// Transform returns the data encrypted as it is stored by backend.
+func (s *SiaClient) Transform(data []byte, sectorID int64) []byte {
 	data1 := make([]byte, len(data))
 	copy(data1, data)
 	s.c.Encrypt(sectorID, data1)
-	return s.backend.Write(contractID, data1, sectorID)
+	if t, ok := s.backend.(manager.Transformer); ok {
+		return t.Transform(data1, sectorID)
+	}
+	return data1
+}
+
+// Delete forwards the call to the backend.
+func (s *SiaClient) Delete(ctx context.Context, contractID, sectorRoot string) error {
+	if d, ok := s.backend.(manager.Deleter); ok {
+		return d.Delete(ctx, contractID, sectorRoot)
+	}
+	return nil
 }
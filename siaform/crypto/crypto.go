@@ -3,13 +3,35 @@ package crypto
 import (
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
 	"crypto/sha256"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
 )
 
+// Sealed sectors are encrypted with AES-GCM. The header of a sealed
+// sector is stored outside of the sector, so its size is not changed:
+// version (1 byte), random nonce (12 bytes), GCM tag (16 bytes).
+// Sectors encrypted with Encrypt (AES-CTR, no MAC) have no header.
+const (
+	versionGCM = 1
+
+	nonceSize  = 12
+	tagSize    = 16
+	headerSize = 1 + nonceSize + tagSize
+)
+
+// ErrAuth is returned if a sealed sector was modified.
+var ErrAuth = errors.New("crypto: message authentication failed")
+
 type Cipher struct {
 	b cipher.Block
+
+	gb   cipher.Block
+	aead cipher.AEAD
 }
 
 func NewCipher(key []byte) (*Cipher, error) {
@@ -18,18 +40,143 @@ func NewCipher(key []byte) (*Cipher, error) {
 	if err != nil {
 		return nil, fmt.Errorf("aes.NewCipher: %v", err)
 	}
+	// A separate key, so AES-CTR and AES-GCM never share keystream.
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("siaform sealed sector"))
+	gb, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, fmt.Errorf("aes.NewCipher: %v", err)
+	}
+	aead, err := cipher.NewGCM(gb)
+	if err != nil {
+		return nil, fmt.Errorf("cipher.NewGCM: %v", err)
+	}
 	return &Cipher{
-		b: b,
+		b:    b,
+		gb:   gb,
+		aead: aead,
 	}, nil
 }
 
 func (c *Cipher) Encrypt(sectorID int64, data []byte) {
+	c.EncryptAt(sectorID, 0, data)
+}
+
+func (c *Cipher) Decrypt(sectorID int64, data []byte) {
+	c.Encrypt(sectorID, data)
+}
+
+// EncryptAt encrypts data located at offset of the sector.
+func (c *Cipher) EncryptAt(sectorID int64, offset int, data []byte) {
 	iv := make([]byte, c.b.BlockSize())
 	binary.LittleEndian.PutUint64(iv[:8], uint64(sectorID))
-	s := cipher.NewCTR(c.b, iv)
+	xorAt(c.b, iv, offset, data)
+}
+
+// DecryptAt decrypts data located at offset of the sector.
+func (c *Cipher) DecryptAt(sectorID int64, offset int, data []byte) {
+	c.EncryptAt(sectorID, offset, data)
+}
+
+// xorAt applies CTR keystream starting from iv to data located
+// at offset of the sector.
+func xorAt(b cipher.Block, iv []byte, offset int, data []byte) {
+	bs := b.BlockSize()
+	iv = append([]byte{}, iv...)
+	// CTR increments IV as a big-endian number for each block.
+	carry := uint64(offset / bs)
+	for i := bs - 1; i >= 0 && carry != 0; i-- {
+		sum := uint64(iv[i]) + carry
+		iv[i] = byte(sum)
+		carry = sum >> 8
+	}
+	s := cipher.NewCTR(b, iv)
+	skip := make([]byte, offset%bs)
+	s.XORKeyStream(skip, skip)
 	s.XORKeyStream(data, data)
 }
 
-func (c *Cipher) Decrypt(sectorID int64, data []byte) {
-	c.Encrypt(sectorID, data)
+// Seal encrypts the sector in place with a random nonce and
+// returns its header.
+func (c *Cipher) Seal(sectorID int64, data []byte) ([]byte, error) {
+	nonce := make([]byte, nonceSize)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("rand.Read: %v", err)
+	}
+	return c.sealWith(sectorID, nonce, data), nil
+}
+
+func (c *Cipher) sealWith(sectorID int64, nonce, data []byte) []byte {
+	sealed := c.aead.Seal(nil, nonce, data, ad(sectorID))
+	copy(data, sealed)
+	header := make([]byte, 0, headerSize)
+	header = append(header, versionGCM)
+	header = append(header, nonce...)
+	header = append(header, sealed[len(data):]...)
+	return header
+}
+
+// Reseal encrypts the sector in place as it was encrypted by Seal
+// which returned the header.
+func (c *Cipher) Reseal(sectorID int64, header, data []byte) error {
+	nonce, _, err := parseHeader(header)
+	if err != nil {
+		return err
+	}
+	c.sealWith(sectorID, nonce, data)
+	return nil
+}
+
+// Open decrypts the sector in place. It returns ErrAuth if
+// the sector or its header was modified or if it belongs
+// to another sector ID.
+func (c *Cipher) Open(sectorID int64, header, data []byte) error {
+	nonce, tag, err := parseHeader(header)
+	if err != nil {
+		return err
+	}
+	sealed := make([]byte, 0, len(data)+tagSize)
+	sealed = append(sealed, data...)
+	sealed = append(sealed, tag...)
+	plain, err := c.aead.Open(sealed[:0], nonce, sealed, ad(sectorID))
+	if err != nil {
+		return ErrAuth
+	}
+	copy(data, plain)
+	return nil
+}
+
+// OpenAt decrypts data located at offset of the sealed sector.
+// The data is not authenticated.
+func (c *Cipher) OpenAt(header []byte, offset int, data []byte) error {
+	nonce, _, err := parseHeader(header)
+	if err != nil {
+		return err
+	}
+	// GCM encrypts the message with CTR starting from nonce||2.
+	iv := make([]byte, c.gb.BlockSize())
+	copy(iv, nonce)
+	binary.BigEndian.PutUint32(iv[nonceSize:], 2)
+	xorAt(c.gb, iv, offset, data)
+	return nil
+}
+
+func parseHeader(header []byte) (nonce, tag []byte, err error) {
+	if len(header) == 0 {
+		return nil, nil, fmt.Errorf("empty header")
+	}
+	if header[0] != versionGCM {
+		return nil, nil, fmt.Errorf("unknown header version %d", header[0])
+	}
+	if len(header) != headerSize {
+		return nil, nil, fmt.Errorf("header size is %d, want %d", len(header), headerSize)
+	}
+	return header[1 : 1+nonceSize], header[1+nonceSize:], nil
+}
+
+// ad binds the sealed sector to its ID.
+func ad(sectorID int64) []byte {
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, uint64(sectorID))
+	return buf
 }
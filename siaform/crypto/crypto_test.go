@@ -0,0 +1,167 @@
+package crypto
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDecryptAt(t *testing.T) {
+	c, err := NewCipher([]byte("key"))
+	if err != nil {
+		t.Fatalf("NewCipher: %v", err)
+	}
+	plain := make([]byte, 4096)
+	for i := range plain {
+		plain[i] = byte(i * 7)
+	}
+	encrypted := append([]byte{}, plain...)
+	c.Encrypt(42, encrypted)
+	for _, r := range [][2]int{{0, 10}, {5, 100}, {16, 16}, {17, 300}, {4000, 96}, {4095, 1}} {
+		offset, length := r[0], r[1]
+		part := append([]byte{}, encrypted[offset:offset+length]...)
+		c.DecryptAt(42, offset, part)
+		if !bytes.Equal(part, plain[offset:offset+length]) {
+			t.Errorf("DecryptAt(%d, %d) returned wrong data", offset, length)
+		}
+	}
+}
+
+func TestSeal(t *testing.T) {
+	c, err := NewCipher([]byte("key"))
+	if err != nil {
+		t.Fatalf("NewCipher: %v", err)
+	}
+	plain := make([]byte, 4096)
+	for i := range plain {
+		plain[i] = byte(i * 7)
+	}
+	sealed := append([]byte{}, plain...)
+	header, err := c.Seal(42, sealed)
+	if err != nil {
+		t.Fatalf("c.Seal: %v", err)
+	}
+	// Nonces are random, so the same sector is sealed differently.
+	sealed2 := append([]byte{}, plain...)
+	if _, err := c.Seal(42, sealed2); err != nil {
+		t.Fatalf("c.Seal: %v", err)
+	}
+	if bytes.Equal(sealed, sealed2) {
+		t.Errorf("two seals of the same sector are equal")
+	}
+	resealed := append([]byte{}, plain...)
+	if err := c.Reseal(42, header, resealed); err != nil {
+		t.Fatalf("c.Reseal: %v", err)
+	}
+	if !bytes.Equal(resealed, sealed) {
+		t.Errorf("c.Reseal returned other data than c.Seal")
+	}
+	opened := append([]byte{}, sealed...)
+	if err := c.Open(42, header, opened); err != nil {
+		t.Fatalf("c.Open: %v", err)
+	}
+	if !bytes.Equal(opened, plain) {
+		t.Errorf("c.Open returned wrong data")
+	}
+	for _, r := range [][2]int{{0, 10}, {5, 100}, {16, 16}, {17, 300}, {4095, 1}} {
+		offset, length := r[0], r[1]
+		part := append([]byte{}, sealed[offset:offset+length]...)
+		if err := c.OpenAt(header, offset, part); err != nil {
+			t.Fatalf("c.OpenAt: %v", err)
+		}
+		if !bytes.Equal(part, plain[offset:offset+length]) {
+			t.Errorf("OpenAt(%d, %d) returned wrong data", offset, length)
+		}
+	}
+	// Tampering.
+	flipped := append([]byte{}, sealed...)
+	flipped[100] ^= 1
+	if err := c.Open(42, header, flipped); err != ErrAuth {
+		t.Errorf("c.Open of modified sector returned %v", err)
+	}
+	if err := c.Open(43, header, append([]byte{}, sealed...)); err != ErrAuth {
+		t.Errorf("c.Open of other sector ID returned %v", err)
+	}
+	badHeader := append([]byte{}, header...)
+	badHeader[len(badHeader)-1] ^= 1
+	if err := c.Open(42, badHeader, append([]byte{}, sealed...)); err != ErrAuth {
+		t.Errorf("c.Open with modified header returned %v", err)
+	}
+	badHeader = append([]byte{}, header...)
+	badHeader[0] = 2
+	if err := c.Open(42, badHeader, append([]byte{}, sealed...)); err == nil {
+		t.Errorf("c.Open accepted unknown header version")
+	}
+}
+
+func TestKeyring(t *testing.T) {
+	scryptN = 1 << 4
+	dir, err := ioutil.TempDir("", "keyring")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	fname := filepath.Join(dir, "keyring")
+	dataKey, err := OpenKeyring(fname, []byte("key1"), false)
+	if err != nil {
+		t.Fatalf("OpenKeyring: %v", err)
+	}
+	if len(dataKey) != dataKeySize {
+		t.Errorf("len(dataKey) = %d, want %d", len(dataKey), dataKeySize)
+	}
+	dataKey2, err := OpenKeyring(fname, []byte("key1"), false)
+	if err != nil {
+		t.Fatalf("OpenKeyring: %v", err)
+	}
+	if !bytes.Equal(dataKey, dataKey2) {
+		t.Errorf("reopened keyring returned other data key")
+	}
+	if _, err := OpenKeyring(fname, []byte("key2"), false); err == nil {
+		t.Errorf("OpenKeyring accepted wrong key")
+	}
+	if err := Rekey(fname, []byte("key2"), []byte("key3")); err == nil {
+		t.Errorf("Rekey accepted wrong key")
+	}
+	if err := Rekey(fname, []byte("key1"), []byte("key2")); err != nil {
+		t.Fatalf("Rekey: %v", err)
+	}
+	if _, err := OpenKeyring(fname, []byte("key1"), false); err == nil {
+		t.Errorf("OpenKeyring accepted old key after Rekey")
+	}
+	dataKey2, err = OpenKeyring(fname, []byte("key2"), false)
+	if err != nil {
+		t.Fatalf("OpenKeyring: %v", err)
+	}
+	if !bytes.Equal(dataKey, dataKey2) {
+		t.Errorf("Rekey changed the data key")
+	}
+	// Malformed keyrings are rejected without panics.
+	k, err := readKeyring(fname)
+	if err != nil {
+		t.Fatalf("readKeyring: %v", err)
+	}
+	for name, edit := range map[string]func(k *keyring){
+		"short nonce": func(k *keyring) { k.Nonce = k.Nonce[:4] },
+		"huge N":      func(k *keyring) { k.N = 1 << 40 },
+		"huge r":      func(k *keyring) { k.R = 1 << 20 },
+		"huge p":      func(k *keyring) { k.P = 1 << 20 },
+		"bad N":       func(k *keyring) { k.N = 1000 },
+	} {
+		k1 := *k
+		edit(&k1)
+		if _, err := k1.unwrap([]byte("key2")); err == nil {
+			t.Errorf("%s: unwrap succeeded", name)
+		}
+	}
+	// Existing data is encrypted with the key file directly.
+	fname = filepath.Join(dir, "legacy")
+	dataKey, err = OpenKeyring(fname, []byte("key1"), true)
+	if err != nil {
+		t.Fatalf("OpenKeyring: %v", err)
+	}
+	if !bytes.Equal(dataKey, []byte("key1")) {
+		t.Errorf("legacy data key is %q, want key1", dataKey)
+	}
+}
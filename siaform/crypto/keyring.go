@@ -0,0 +1,195 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/starius/invisiblefs/atomicfile"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Sectors are encrypted with a data key. The keyring file keeps
+// the data key wrapped with a master key derived from the key file
+// with scrypt, so the key file can be changed without re-uploading
+// sectors.
+
+const (
+	keyringVersion = 1
+	dataKeySize    = 32
+)
+
+// Parameters of scrypt for new keyrings.
+var (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+// Limits of scrypt parameters of existing keyrings, so an edited
+// keyring can not make scrypt use too much memory or time.
+// scrypt uses 128*N*r bytes of memory.
+const (
+	maxScryptMemory = 1 << 28
+	maxScryptP      = 16
+)
+
+type keyring struct {
+	Version int    `json:"version"`
+	N       int    `json:"n"`
+	R       int    `json:"r"`
+	P       int    `json:"p"`
+	Salt    []byte `json:"salt"`
+	Nonce   []byte `json:"nonce"`
+	Wrapped []byte `json:"wrapped"`
+}
+
+func randBytes(n int) ([]byte, error) {
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(rand.Reader, buf); err != nil {
+		return nil, fmt.Errorf("rand.Read: %v", err)
+	}
+	return buf, nil
+}
+
+// check validates scrypt parameters read from the file.
+func (k *keyring) check() error {
+	if k.N <= 1 || k.N&(k.N-1) != 0 {
+		return fmt.Errorf("bad scrypt N: %d", k.N)
+	}
+	if k.R <= 0 || k.N > maxScryptMemory/128/k.R {
+		return fmt.Errorf("scrypt N=%d, r=%d need too much memory", k.N, k.R)
+	}
+	if k.P <= 0 || k.P > maxScryptP {
+		return fmt.Errorf("bad scrypt p: %d", k.P)
+	}
+	return nil
+}
+
+func (k *keyring) aead(key []byte) (cipher.AEAD, error) {
+	master, err := scrypt.Key(key, k.Salt, k.N, k.R, k.P, 32)
+	if err != nil {
+		return nil, fmt.Errorf("scrypt.Key: %v", err)
+	}
+	b, err := aes.NewCipher(master)
+	if err != nil {
+		return nil, fmt.Errorf("aes.NewCipher: %v", err)
+	}
+	return cipher.NewGCM(b)
+}
+
+func wrap(dataKey, key []byte) (*keyring, error) {
+	salt, err := randBytes(32)
+	if err != nil {
+		return nil, err
+	}
+	k := &keyring{
+		Version: keyringVersion,
+		N:       scryptN,
+		R:       scryptR,
+		P:       scryptP,
+		Salt:    salt,
+	}
+	aead, err := k.aead(key)
+	if err != nil {
+		return nil, err
+	}
+	if k.Nonce, err = randBytes(aead.NonceSize()); err != nil {
+		return nil, err
+	}
+	k.Wrapped = aead.Seal(nil, k.Nonce, dataKey, nil)
+	return k, nil
+}
+
+func (k *keyring) unwrap(key []byte) ([]byte, error) {
+	if k.Version != keyringVersion {
+		return nil, fmt.Errorf("unknown keyring version %d", k.Version)
+	}
+	if err := k.check(); err != nil {
+		return nil, err
+	}
+	aead, err := k.aead(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(k.Nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("bad nonce size: %d", len(k.Nonce))
+	}
+	dataKey, err := aead.Open(nil, k.Nonce, k.Wrapped, nil)
+	if err != nil {
+		return nil, fmt.Errorf("wrong key")
+	}
+	return dataKey, nil
+}
+
+func readKeyring(fname string) (*keyring, error) {
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	k := &keyring{}
+	if err := json.Unmarshal(data, k); err != nil {
+		return nil, fmt.Errorf("json.Unmarshal: %v", err)
+	}
+	return k, nil
+}
+
+func writeKeyring(fname string, k *keyring) error {
+	data, err := json.Marshal(k)
+	if err != nil {
+		return fmt.Errorf("json.Marshal: %v", err)
+	}
+	return atomicfile.WriteFile(fname, data)
+}
+
+// OpenKeyring returns the data key from the keyring file unwrapping
+// it with key. If the file does not exist, it is created. The data
+// key of the new keyring is key itself if legacy is true (sectors
+// of existing databases were encrypted with the key directly) and
+// a random key otherwise.
+func OpenKeyring(fname string, key []byte, legacy bool) ([]byte, error) {
+	k, err := readKeyring(fname)
+	if err == nil {
+		return k.unwrap(key)
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("readKeyring(%q): %v", fname, err)
+	}
+	var dataKey []byte
+	if legacy {
+		dataKey = key
+	} else if dataKey, err = randBytes(dataKeySize); err != nil {
+		return nil, err
+	}
+	if k, err = wrap(dataKey, key); err != nil {
+		return nil, err
+	}
+	if err := writeKeyring(fname, k); err != nil {
+		return nil, fmt.Errorf("writeKeyring(%q): %v", fname, err)
+	}
+	return dataKey, nil
+}
+
+// Rekey wraps the data key of the keyring file with newKey.
+// Sectors are not changed.
+func Rekey(fname string, oldKey, newKey []byte) error {
+	k, err := readKeyring(fname)
+	if err != nil {
+		return fmt.Errorf("readKeyring(%q): %v", fname, err)
+	}
+	dataKey, err := k.unwrap(oldKey)
+	if err != nil {
+		return err
+	}
+	if k, err = wrap(dataKey, newKey); err != nil {
+		return err
+	}
+	if err := writeKeyring(fname, k); err != nil {
+		return fmt.Errorf("writeKeyring(%q): %v", fname, err)
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+// Package faulty wraps a SiaClient injecting faults into its contracts.
+// It is used to test how the manager survives bad hosts.
+package faulty
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// Backend is the same as manager.SiaClient. It is not imported
+// so that tests of manager can use this package.
+type Backend interface {
+	Contracts(ctx context.Context) ([]string, error)
+	Read(ctx context.Context, contractID, sectorRoot string, sectorID int64) ([]byte, error)
+	ReadAt(ctx context.Context, contractID, sectorRoot string, sectorID int64, offset, length int) ([]byte, error)
+	Write(ctx context.Context, contractID string, data []byte, sectorID int64) (string, error)
+}
+
+// Faults describes misbehaviour of a contract.
+type Faults struct {
+	// Share of reads and writes which fail.
+	FailureRate float64
+
+	// Added to each read and write.
+	Latency time.Duration
+
+	// Share of reads which return data with a byte changed.
+	CorruptionRate float64
+
+	// The contract and all its data are lost. It is not
+	// returned by Contracts and all operations fail.
+	Lost bool
+}
+
+type SiaClient struct {
+	backend Backend
+
+	faults map[string]Faults
+	rand   *rand.Rand
+	mu     sync.Mutex
+}
+
+// New returns SiaClient without faults. Random decisions
+// are derived from seed.
+func New(backend Backend, seed int64) *SiaClient {
+	return &SiaClient{
+		backend: backend,
+		faults:  make(map[string]Faults),
+		rand:    rand.New(rand.NewSource(seed)),
+	}
+}
+
+// Set sets faults of the contract replacing previous ones.
+func (s *SiaClient) Set(contractID string, f Faults) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults[contractID] = f
+}
+
+// Reset removes faults of the contract.
+func (s *SiaClient) Reset(contractID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.faults, contractID)
+}
+
+func (s *SiaClient) get(contractID string) Faults {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.faults[contractID]
+}
+
+func (s *SiaClient) happens(rate float64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rand.Float64() < rate
+}
+
+// before applies latency and failures common for all operations.
+func (s *SiaClient) before(ctx context.Context, contractID string) (Faults, error) {
+	f := s.get(contractID)
+	select {
+	case <-time.After(f.Latency):
+	case <-ctx.Done():
+		return f, ctx.Err()
+	}
+	if f.Lost {
+		return f, fmt.Errorf("contract %s is lost", contractID)
+	}
+	if s.happens(f.FailureRate) {
+		return f, fmt.Errorf("injected failure of contract %s", contractID)
+	}
+	return f, nil
+}
+
+func (s *SiaClient) corrupt(f Faults, data []byte) []byte {
+	if len(data) == 0 || !s.happens(f.CorruptionRate) {
+		return data
+	}
+	data1 := make([]byte, len(data))
+	copy(data1, data)
+	s.mu.Lock()
+	i := s.rand.Intn(len(data1))
+	s.mu.Unlock()
+	data1[i]++
+	return data1
+}
+
+func (s *SiaClient) Contracts(ctx context.Context) ([]string, error) {
+	contracts, err := s.backend.Contracts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var contracts1 []string
+	for _, contract := range contracts {
+		if !s.get(contract).Lost {
+			contracts1 = append(contracts1, contract)
+		}
+	}
+	return contracts1, nil
+}
+
+func (s *SiaClient) Read(ctx context.Context, contractID, sectorRoot string, sectorID int64) ([]byte, error) {
+	f, err := s.before(ctx, contractID)
+	if err != nil {
+		return nil, err
+	}
+	data, err := s.backend.Read(ctx, contractID, sectorRoot, sectorID)
+	if err != nil {
+		return nil, err
+	}
+	return s.corrupt(f, data), nil
+}
+
+func (s *SiaClient) ReadAt(ctx context.Context, contractID, sectorRoot string, sectorID int64, offset, length int) ([]byte, error) {
+	f, err := s.before(ctx, contractID)
+	if err != nil {
+		return nil, err
+	}
+	data, err := s.backend.ReadAt(ctx, contractID, sectorRoot, sectorID, offset, length)
+	if err != nil {
+		return nil, err
+	}
+	return s.corrupt(f, data), nil
+}
+
+func (s *SiaClient) Write(ctx context.Context, contractID string, data []byte, sectorID int64) (string, error) {
+	if _, err := s.before(ctx, contractID); err != nil {
+		return "", err
+	}
+	return s.backend.Write(ctx, contractID, data, sectorID)
+}
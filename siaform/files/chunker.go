@@ -0,0 +1,89 @@
+package files
+
+import (
+	"io"
+)
+
+// gear is the table of the rolling hash. It is fixed, so that
+// the same data is cut the same way in all runs.
+var gear [256]uint64
+
+func init() {
+	// splitmix64.
+	x := uint64(0)
+	for i := range gear {
+		x += 0x9e3779b97f4a7c15
+		z := x
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		gear[i] = z ^ (z >> 31)
+	}
+}
+
+// chunker cuts a stream into content-defined chunks: a chunk ends
+// where the gear hash of the last 64 bytes has low bits zero. Equal
+// data is cut into equal chunks regardless of its offset in the
+// stream, so it can be deduplicated. Chunks are between sectorSize/16
+// and sectorSize bytes long, about sectorSize/5 on average.
+type chunker struct {
+	r    io.Reader
+	buf  []byte
+	eof  bool
+	min  int
+	max  int
+	mask uint64
+}
+
+func newChunker(r io.Reader, sectorSize int) *chunker {
+	bits := uint(0)
+	for (1 << (bits + 1)) <= sectorSize/8 {
+		bits++
+	}
+	min := sectorSize / 16
+	if min < 1 {
+		min = 1
+	}
+	return &chunker{
+		r:    r,
+		min:  min,
+		max:  sectorSize,
+		mask: 1<<bits - 1,
+	}
+}
+
+func (c *chunker) fill() error {
+	if len(c.buf) >= c.max || c.eof {
+		return nil
+	}
+	buf := make([]byte, c.max)
+	n := copy(buf, c.buf)
+	m, err := io.ReadFull(c.r, buf[n:])
+	c.buf = buf[:n+m]
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		c.eof = true
+		return nil
+	}
+	return err
+}
+
+// next returns the next chunk or io.EOF.
+func (c *chunker) next() ([]byte, error) {
+	if err := c.fill(); err != nil {
+		return nil, err
+	}
+	if len(c.buf) == 0 {
+		return nil, io.EOF
+	}
+	cut := len(c.buf)
+	h := uint64(0)
+	for i, b := range c.buf {
+		h = h<<1 + gear[b]
+		if i+1 >= c.min && h&c.mask == 0 {
+			cut = i + 1
+			break
+		}
+	}
+	chunk := c.buf[:cut]
+	c.buf = c.buf[cut:]
+	return chunk, nil
+}
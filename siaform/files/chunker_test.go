@@ -0,0 +1,56 @@
+package files
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+func chunks(t *testing.T, data []byte, sectorSize int) [][]byte {
+	c := newChunker(bytes.NewReader(data), sectorSize)
+	var result [][]byte
+	for {
+		chunk, err := c.next()
+		if err == io.EOF {
+			return result
+		} else if err != nil {
+			t.Fatalf("c.next: %v", err)
+		}
+		result = append(result, append([]byte{}, chunk...))
+	}
+}
+
+func TestChunker(t *testing.T) {
+	const sectorSize = 4096
+	data := make([]byte, 100*sectorSize)
+	rand.New(rand.NewSource(1)).Read(data)
+	chunks1 := chunks(t, data, sectorSize)
+	if got := bytes.Join(chunks1, nil); !bytes.Equal(got, data) {
+		t.Fatalf("chunks do not add up to the data")
+	}
+	for i, chunk := range chunks1 {
+		if len(chunk) > sectorSize {
+			t.Errorf("len(chunk %d) = %d > %d", i, len(chunk), sectorSize)
+		}
+		if i != len(chunks1)-1 && len(chunk) < sectorSize/16 {
+			t.Errorf("len(chunk %d) = %d < %d", i, len(chunk), sectorSize/16)
+		}
+	}
+	// Inserting a prefix changes only the first chunks.
+	shifted := append([]byte("prefix"), data...)
+	chunks2 := chunks(t, shifted, sectorSize)
+	seen := make(map[string]bool)
+	for _, chunk := range chunks1 {
+		seen[string(chunk)] = true
+	}
+	common := 0
+	for _, chunk := range chunks2 {
+		if seen[string(chunk)] {
+			common++
+		}
+	}
+	if common < len(chunks1)-2 {
+		t.Errorf("only %d of %d chunks survived a shift", common, len(chunks1))
+	}
+}
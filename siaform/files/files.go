@@ -3,6 +3,7 @@ package files
 import (
 	"bytes"
 	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"log"
@@ -11,14 +12,24 @@ import (
 	"github.com/golang/protobuf/proto"
 	"github.com/starius/invisiblefs/gzip"
 	"github.com/starius/invisiblefs/siaform/filesdb"
+	"github.com/starius/invisiblefs/siaform/journal"
 	"github.com/starius/invisiblefs/siaform/manager"
+	"golang.org/x/net/context"
 )
 
 type Files struct {
 	db         *filesdb.Db
 	manager    *manager.Manager
 	sectorSize int
-	mu         sync.Mutex
+	mu         sync.Mutex // db, journal, refs.
+	journal    *journal.Journal
+
+	// Number of pieces of files in each sector.
+	refs map[int64]int64
+
+	// Held for reading while a sector is allocated and referenced
+	// and for writing by Collect.
+	writeMu sync.RWMutex
 }
 
 func New(sectorSize int, manager *manager.Manager) (*Files, error) {
@@ -26,8 +37,10 @@ func New(sectorSize int, manager *manager.Manager) (*Files, error) {
 		db: &filesdb.Db{
 			Files:      make(map[string]*filesdb.File),
 			SectorSize: int32(sectorSize),
+			Chunks:     make(map[string]*filesdb.Piece),
 		},
 		manager: manager,
+		refs:    make(map[int64]int64),
 	}, nil
 }
 
@@ -43,15 +56,43 @@ func Load(zdump []byte, manager *manager.Manager) (*Files, error) {
 	if db.Files == nil {
 		db.Files = make(map[string]*filesdb.File)
 	}
-	return &Files{
+	if db.Chunks == nil {
+		db.Chunks = make(map[string]*filesdb.Piece)
+	}
+	f := &Files{
 		db:      db,
 		manager: manager,
-	}, nil
+	}
+	f.reindex()
+	return f, nil
+}
+
+// reindex counts references to sectors. Run under f.mu.Lock().
+func (f *Files) reindex() {
+	f.refs = make(map[int64]int64)
+	for _, f1 := range f.db.Files {
+		f.ref(f1, 1)
+	}
+}
+
+// ref adds delta to reference counts of sectors of the file.
+// Run under f.mu.Lock().
+func (f *Files) ref(f1 *filesdb.File, delta int64) {
+	for _, piece := range f1.Pieces {
+		f.refs[piece.SectorId] += delta
+		if f.refs[piece.SectorId] == 0 {
+			delete(f.refs, piece.SectorId)
+		}
+	}
 }
 
 func (f *Files) DumpDb() ([]byte, error) {
 	f.mu.Lock()
 	defer f.mu.Unlock()
+	return f.dumpDb()
+}
+
+func (f *Files) dumpDb() ([]byte, error) {
 	dump, err := proto.Marshal(f.db)
 	if err != nil {
 		return nil, fmt.Errorf("proto.Marshal: %v", err)
@@ -63,22 +104,30 @@ func (f *Files) DumpDb() ([]byte, error) {
 	return zdump, nil
 }
 
-func (f *Files) Open(name string) (*File, error) {
+// Open opens the file. Reads and writes of the file are done
+// in context ctx.
+func (f *Files) Open(ctx context.Context, name string) (*File, error) {
 	f.mu.Lock()
 	defer f.mu.Unlock()
 	f1, ok := f.db.Files[name]
 	if !ok {
 		return nil, fmt.Errorf("No file %q", name)
 	}
+	return f.newFile(ctx, name, f1), nil
+}
+
+func (f *Files) newFile(ctx context.Context, name string, f1 *filesdb.File) *File {
 	return &File{
 		offset:           0,
 		File:             f1,
+		name:             name,
 		manager:          f.manager,
 		sectorSize:       int(f.db.SectorSize),
 		lastSectorID:     -1,
 		fs:               f,
 		minSizeForSector: int(f.db.SectorSize) * 95 / 100,
-	}, nil
+		ctx:              ctx,
+	}
 }
 
 func (f *Files) Has(name string) (bool, error) {
@@ -88,7 +137,9 @@ func (f *Files) Has(name string) (bool, error) {
 	return has, nil
 }
 
-func (f *Files) Create(name string) (*File, error) {
+// Create creates the file. Reads and writes of the file are done
+// in context ctx.
+func (f *Files) Create(ctx context.Context, name string) (*File, error) {
 	f.mu.Lock()
 	defer f.mu.Unlock()
 	_, ok := f.db.Files[name]
@@ -96,24 +147,22 @@ func (f *Files) Create(name string) (*File, error) {
 		return nil, fmt.Errorf("File exists: %q", name)
 	}
 	f1 := &filesdb.File{}
+	if err := f.logRecords(&filesdb.Record{
+		Name: name,
+		File: f1,
+	}); err != nil {
+		return nil, fmt.Errorf("f.logRecords: %v", err)
+	}
 	f.db.Files[name] = f1
-	return &File{
-		offset:           0,
-		File:             f1,
-		manager:          f.manager,
-		sectorSize:       int(f.db.SectorSize),
-		lastSectorID:     -1,
-		fs:               f,
-		minSizeForSector: int(f.db.SectorSize) * 95 / 100,
-	}, nil
+	return f.newFile(ctx, name, f1), nil
 }
 
-func (f *Files) OpenOrCreate(name string) (*File, error) {
-	fi, err := f.Open(name)
+func (f *Files) OpenOrCreate(ctx context.Context, name string) (*File, error) {
+	fi, err := f.Open(ctx, name)
 	if err == nil {
 		return fi, nil
 	}
-	return f.Create(name)
+	return f.Create(ctx, name)
 }
 
 func (f *Files) Rename(oldName, newName string) error {
@@ -123,18 +172,59 @@ func (f *Files) Rename(oldName, newName string) error {
 	if !ok {
 		return fmt.Errorf("No such file: %q", oldName)
 	}
+	if err := f.logRecords(&filesdb.Record{
+		Name: newName,
+		File: f1,
+	}, &filesdb.Record{
+		Name:    oldName,
+		Deleted: true,
+	}); err != nil {
+		return fmt.Errorf("f.logRecords: %v", err)
+	}
+	if old, has := f.db.Files[newName]; has && newName != oldName {
+		f.ref(old, -1)
+	}
 	f.db.Files[newName] = f1
 	delete(f.db.Files, oldName)
 	return nil
 }
 
-func (f *Files) UploadSectorInProgress() error {
-	f.mu.Lock()
-	defer f.mu.Unlock()
-	return f.uploadSectorInProgress()
+func (f *Files) UploadSectorInProgress(ctx context.Context) error {
+	if err := f.lockInProgress(ctx, int(f.db.SectorSize)); err != nil {
+		return err
+	}
+	f.mu.Unlock()
+	return nil
+}
+
+// lockInProgress locks f.mu and makes room for l bytes in the
+// in_progress sector uploading it if needed. f.mu is not held while
+// waiting for the manager to accept the sector, so reads are not
+// blocked by overloaded writes. f.mu is locked if it returns nil.
+func (f *Files) lockInProgress(ctx context.Context, l int) error {
+	for {
+		f.mu.Lock()
+		if len(f.db.InProgress)+l <= int(f.db.SectorSize) {
+			return nil
+		}
+		err := f.uploadSectorInProgress(ctx)
+		if err == nil {
+			return nil
+		}
+		f.mu.Unlock()
+		if err != manager.ErrOverloaded {
+			return fmt.Errorf("uploadSectorInProgress: %v", err)
+		}
+		if err := f.manager.WaitForMemory(ctx); err != nil {
+			return err
+		}
+	}
 }
 
-func (f *Files) uploadSectorInProgress() error {
+// uploadSectorInProgress uploads the in_progress sector. It does not
+// wait for memory and returns manager.ErrOverloaded instead.
+// Run under f.mu.Lock().
+func (f *Files) uploadSectorInProgress(ctx context.Context) error {
 	if len(f.db.InProgress) == 0 {
 		return nil
 	}
@@ -142,23 +232,32 @@ func (f *Files) uploadSectorInProgress() error {
 	nz := int(f.db.SectorSize) - len(f.db.InProgress)
 	ip := append(f.db.InProgress, make([]byte, nz)...)
 	ipsid := f.db.InProgressSectorId
-	if err := f.manager.WriteSector(ipsid, ip); err != nil {
+	if err := f.manager.TryWriteSector(ctx, ipsid, ip); err == manager.ErrOverloaded {
+		return err
+	} else if err != nil {
 		return fmt.Errorf("WriteSector: %v", err)
 	}
 	f.db.InProgress = nil
 	f.db.InProgressSectorId = 0
+	if err := f.logRecords(&filesdb.Record{
+		ResetInProgress: true,
+	}); err != nil {
+		return fmt.Errorf("f.logRecords: %v", err)
+	}
 	return nil
 }
 
 type File struct {
 	offset           int64
 	File             *filesdb.File
+	name             string
 	manager          *manager.Manager
 	sectorSize       int
 	minSizeForSector int
 	lastSector       []byte
 	lastSectorID     int64
 	fs               *Files
+	ctx              context.Context
 	mu               sync.Mutex
 }
 
@@ -233,7 +332,7 @@ func (f *File) Read(p []byte) (n int, err error) {
 				if sectorID == f.lastSectorID {
 					sector = f.lastSector
 				} else {
-					sector, err = f.manager.ReadSector(sectorID)
+					sector, err = f.manager.ReadSector(f.ctx, sectorID)
 					if err != nil {
 						return n, err
 					}
@@ -242,13 +341,24 @@ func (f *File) Read(p []byte) (n int, err error) {
 				}
 				part = sector[sbegin:send]
 			} else {
-				part, err = f.manager.InsecureReadSectorAt(sectorID, int(sbegin), int(send-sbegin))
+				part, err = f.manager.InsecureReadSectorAt(f.ctx, sectorID, int(sbegin), int(send-sbegin))
 				if err != nil {
 					return n, err
 				}
 				checksum := sha256.Sum256(part)
 				if !bytes.Equal(checksum[:], piece.Sha256) {
-					return n, fmt.Errorf("Checksum mismatch")
+					// ReadSector checks the whole sector and
+					// recovers it if needed.
+					log.Printf("Checksum mismatch in sector %d - reading whole sector.", sectorID)
+					sector, err := f.manager.ReadSector(f.ctx, sectorID)
+					if err != nil {
+						return n, err
+					}
+					part = sector[sbegin:send]
+					checksum = sha256.Sum256(part)
+					if !bytes.Equal(checksum[:], piece.Sha256) {
+						return n, fmt.Errorf("Checksum mismatch")
+					}
 				}
 			}
 			nn := copy(r, part)
@@ -260,58 +370,300 @@ func (f *File) Read(p []byte) (n int, err error) {
 	return n, nil
 }
 
+// Write writes p at the offset of the file. Data is split across
+// sectors. Writing past the end extends the file with zeros.
 func (f *File) Write(p []byte) (n int, err error) {
 	f.mu.Lock()
 	defer f.mu.Unlock()
 	log.Printf("Writing %d bytes.\n", len(p))
+	n, err = f.writeAt(p, f.offset)
+	f.offset += int64(n)
+	return n, err
+}
+
+// WriteAt writes p at offset off of the file. Overwritten pieces
+// are not changed: new pieces replace them (copy-on-write).
+// The offset of the file is not changed. Implements io.WriterAt.
+func (f *File) WriteAt(p []byte, off int64) (n int, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset")
+	}
+	return f.writeAt(p, off)
+}
+
+// writeAt writes p at offset at in parts of at most a sector.
+// Run under f.mu.Lock().
+func (f *File) writeAt(p []byte, at int64) (n int, err error) {
+	if err := f.extend(at); err != nil {
+		return 0, err
+	}
+	for n < len(p) {
+		l := len(p) - n
+		if l > f.sectorSize {
+			l = f.sectorSize
+		}
+		if err := f.write(p[n:n+l], false, at+int64(n)); err != nil {
+			return n, err
+		}
+		n += l
+	}
+	return n, nil
+}
+
+// Truncate changes the size of the file. The file is extended
+// with zeros. The offset of the file is not changed.
+func (f *File) Truncate(size int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if size < 0 {
+		return fmt.Errorf("negative size")
+	}
+	if size >= f.File.Size {
+		return f.extend(size)
+	}
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	record := f.splice(size, f.File.Size, nil)
+	record.Size = size
+	if err := f.fs.logRecords(record); err != nil {
+		return fmt.Errorf("logRecords: %v", err)
+	}
+	f.apply(record)
+	return nil
+}
+
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+// extend appends zeros to the file up to size. The zeros are
+// deduplicated. Run under f.mu.Lock().
+func (f *File) extend(size int64) error {
+	if size <= f.File.Size {
+		return nil
+	}
+	_, err := f.readFrom(io.LimitReader(zeros{}, size-f.File.Size), f.File.Size)
+	return err
+}
+
+// ReadFrom writes data from r at the offset of the file. The data
+// is cut into content-defined chunks and chunks stored before are
+// reused instead of being uploaded again. Implements io.ReaderFrom,
+// so io.Copy to the file deduplicates data.
+func (f *File) ReadFrom(r io.Reader) (n int64, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.extend(f.offset); err != nil {
+		return 0, err
+	}
+	n, err = f.readFrom(r, f.offset)
+	f.offset += n
+	return n, err
+}
+
+// readFrom writes data from r at offset at deduplicating it.
+// Run under f.mu.Lock().
+func (f *File) readFrom(r io.Reader, at int64) (n int64, err error) {
+	c := newChunker(r, f.sectorSize)
+	for {
+		chunk, err := c.next()
+		if err == io.EOF {
+			return n, nil
+		} else if err != nil {
+			return n, err
+		}
+		if has, err := f.writeStored(chunk, at+n); err != nil {
+			return n, err
+		} else if !has {
+			if err := f.write(chunk, true, at+n); err != nil {
+				return n, err
+			}
+		}
+		n += int64(len(chunk))
+	}
+}
+
+func pieceLength(piece *filesdb.Piece, sectorSize int) int {
+	if piece.Length != 0 {
+		return int(piece.Length)
+	}
+	return sectorSize
+}
+
+// subPiece returns range [off, off+length) of the piece. Its
+// checksum is unknown, so the whole sector is read and checked.
+func subPiece(piece *filesdb.Piece, off, length int64) *filesdb.Piece {
+	return &filesdb.Piece{
+		SectorId: piece.SectorId,
+		Offset:   piece.Offset + int32(off),
+		Length:   int32(length),
+	}
+}
+
+// splice returns the record which replaces range [begin, end) of
+// the file with pieces. If begin is the end of the file, the pieces
+// are appended. Pieces overlapping the range partially are cut.
+// Run under f.mu.Lock().
+func (f *File) splice(begin, end int64, pieces []*filesdb.Piece) *filesdb.Record {
+	record := &filesdb.Record{
+		Name: f.name,
+		Size: max(f.File.Size, end),
+	}
+	if begin == f.File.Size {
+		record.Pieces = pieces
+		return record
+	}
+	from, to := -1, 0
+	var left, right *filesdb.Piece
+	fbegin := int64(0)
+	for j, piece := range f.File.Pieces {
+		if fbegin >= end {
+			break
+		}
+		fend := fbegin + int64(pieceLength(piece, f.sectorSize))
+		if fend > begin {
+			if from == -1 {
+				from = j
+				if fbegin < begin {
+					left = subPiece(piece, 0, begin-fbegin)
+				}
+			}
+			to = j + 1
+			right = nil
+			if fend > end {
+				right = subPiece(piece, end-fbegin, fend-end)
+			}
+		}
+		fbegin = fend
+	}
+	if left != nil {
+		record.Pieces = append(record.Pieces, left)
+	}
+	record.Pieces = append(record.Pieces, pieces...)
+	if right != nil {
+		record.Pieces = append(record.Pieces, right)
+	}
+	record.Splice = true
+	record.SpliceBegin = int64(from)
+	record.SpliceEnd = int64(to)
+	return record
+}
+
+// apply applies the logged record to the file and updates reference
+// counts of sectors. Run under f.mu.Lock() and f.fs.mu.Lock().
+func (f *File) apply(record *filesdb.Record) {
+	removed, err := splicePieces(f.File, record)
+	if err != nil {
+		panic(fmt.Sprintf("splicePieces: %v", err))
+	}
+	f.fs.ref(&filesdb.File{Pieces: record.Pieces}, 1)
+	f.fs.ref(&filesdb.File{Pieces: removed}, -1)
+}
+
+// writeStored writes the chunk at offset at if it is in the index
+// of chunks. Run under f.mu.Lock().
+func (f *File) writeStored(chunk []byte, at int64) (bool, error) {
+	checksum := sha256.Sum256(chunk)
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	piece, has := f.fs.db.Chunks[hex.EncodeToString(checksum[:])]
+	if !has || f.fs.refs[piece.SectorId] == 0 || pieceLength(piece, f.sectorSize) != len(chunk) {
+		// Pieces of unreferenced sectors are removed by Compact.
+		return false, nil
+	}
+	piece = proto.Clone(piece).(*filesdb.Piece)
+	record := f.splice(at, at+int64(len(chunk)), []*filesdb.Piece{piece})
+	if err := f.fs.logRecords(record); err != nil {
+		return false, fmt.Errorf("logRecords: %v", err)
+	}
+	f.apply(record)
+	return true, nil
+}
+
+// write writes p at offset at. If index is true, the piece is added
+// to the index of chunks. Run under f.mu.Lock().
+func (f *File) write(p []byte, index bool, at int64) error {
 	if len(p) > f.sectorSize {
-		return 0, fmt.Errorf("too long write")
+		return fmt.Errorf("too long write")
 	}
+	f.fs.writeMu.RLock()
+	defer f.fs.writeMu.RUnlock()
 	l := len(p)
+	checksum := sha256.Sum256(p)
+	var piece *filesdb.Piece
+	var inProgressSectorID int64
 	if l < f.minSizeForSector {
-		f.fs.mu.Lock()
-		defer f.fs.mu.Unlock()
-		if len(f.fs.db.InProgress)+l > f.sectorSize {
-			// Upload previous in_progress sector.
-			f.fs.uploadSectorInProgress()
+		if err := f.fs.lockInProgress(f.ctx, l); err != nil {
+			return err
 		}
+		defer f.fs.mu.Unlock()
 		if f.fs.db.InProgressSectorId == 0 {
 			sectorID, err := f.manager.AllocateSector()
 			if err != nil {
-				return 0, fmt.Errorf("AllocateSector: %v", err)
+				return fmt.Errorf("AllocateSector: %v", err)
 			}
-			f.fs.db.InProgressSectorId = sectorID
+			inProgressSectorID = sectorID
+		} else {
+			inProgressSectorID = f.fs.db.InProgressSectorId
 		}
-		offset := len(f.fs.db.InProgress)
-		f.fs.db.InProgress = append(f.fs.db.InProgress, p...)
-		checksum := sha256.Sum256(p)
-		f.File.Pieces = append(f.File.Pieces, &filesdb.Piece{
-			SectorId: f.fs.db.InProgressSectorId,
+		piece = &filesdb.Piece{
+			SectorId: inProgressSectorID,
 			Sha256:   checksum[:],
-			Offset:   int32(offset),
+			Offset:   int32(len(f.fs.db.InProgress)),
 			Length:   int32(l),
-		})
+		}
 	} else {
-		p1 := append(p, make([]byte, f.sectorSize-l)...)
-		sectorID, err := f.manager.AddSector(p1)
-		if err != nil {
-			return 0, fmt.Errorf("AddSector: %v", err)
+		p1 := make([]byte, f.sectorSize)
+		copy(p1, p)
+		sectorID, err := f.manager.AddSector(f.ctx, p1)
+		if err == manager.ErrOverloaded {
+			return err
+		} else if err != nil {
+			return fmt.Errorf("AddSector: %v", err)
 		}
-		piece := &filesdb.Piece{
+		piece = &filesdb.Piece{
 			SectorId: sectorID,
 		}
 		if l != f.sectorSize {
 			piece.Length = int32(l)
 		}
-		f.File.Pieces = append(f.File.Pieces, piece)
+		if index {
+			piece.Sha256 = checksum[:]
+		}
+		f.fs.mu.Lock()
+		defer f.fs.mu.Unlock()
+	}
+	record := f.splice(at, at+int64(l), []*filesdb.Piece{piece})
+	if inProgressSectorID != 0 {
+		record.InProgressSectorId = inProgressSectorID
+		record.InProgress = p
+	}
+	if index {
+		record.Chunks = []*filesdb.Piece{piece}
+	}
+	if err := f.fs.logRecords(record); err != nil {
+		return fmt.Errorf("logRecords: %v", err)
 	}
-	f.File.Size += int64(l)
-	f.offset += int64(l)
-	return l, nil
+	if inProgressSectorID != 0 {
+		f.fs.db.InProgressSectorId = inProgressSectorID
+		f.fs.db.InProgress = append(f.fs.db.InProgress, p...)
+	}
+	if index {
+		f.fs.db.Chunks[hex.EncodeToString(checksum[:])] = piece
+	}
+	f.apply(record)
+	return nil
 }
 
-func (f *Files) Get(name string) ([]byte, error) {
-	fi, err := f.Open(name)
+func (f *Files) Get(ctx context.Context, name string) ([]byte, error) {
+	fi, err := f.Open(ctx, name)
 	if err != nil {
 		return nil, err
 	}
@@ -326,8 +678,8 @@ func (f *Files) Get(name string) ([]byte, error) {
 	return p, nil
 }
 
-func (f *Files) GetAt(name string, offset, size int) ([]byte, error) {
-	fi, err := f.Open(name)
+func (f *Files) GetAt(ctx context.Context, name string, offset, size int) ([]byte, error) {
+	fi, err := f.Open(ctx, name)
 	if err != nil {
 		return nil, err
 	}
@@ -348,18 +700,29 @@ func (f *Files) GetAt(name string, offset, size int) ([]byte, error) {
 	return p, nil
 }
 
-func (f *Files) Put(name string, value []byte) error {
-	fi, err := f.OpenOrCreate(name)
-	if err != nil {
+// Put replaces the file with value. The value is deduplicated.
+func (f *Files) Put(ctx context.Context, name string, value []byte) error {
+	// The value is written to a file without a name which replaces
+	// the file in the end, so a failed Put leaves the file intact.
+	fi := f.newFile(ctx, "", &filesdb.File{})
+	if _, err := fi.ReadFrom(bytes.NewReader(value)); err != nil {
+		f.mu.Lock()
+		f.ref(fi.File, -1)
+		f.mu.Unlock()
 		return err
 	}
-	n, err := fi.Write(value)
-	if err != nil {
-		return err
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.logRecords(&filesdb.Record{
+		Name: name,
+		File: fi.File,
+	}); err != nil {
+		return fmt.Errorf("f.logRecords: %v", err)
 	}
-	if n != len(value) {
-		return fmt.Errorf("want to write %d, got %d", len(value), n)
+	if old, has := f.db.Files[name]; has {
+		f.ref(old, -1)
 	}
+	f.db.Files[name] = fi.File
 	return nil
 }
 
@@ -380,13 +743,51 @@ func (f *Files) Link(dstKey, srcKey string) error {
 	if !has {
 		return fmt.Errorf("no such key: %q", srcKey)
 	}
-	f.db.Files[dstKey] = proto.Clone(fi).(*filesdb.File)
+	fi = proto.Clone(fi).(*filesdb.File)
+	if err := f.logRecords(&filesdb.Record{
+		Name: dstKey,
+		File: fi,
+	}); err != nil {
+		return fmt.Errorf("f.logRecords: %v", err)
+	}
+	if old, has := f.db.Files[dstKey]; has {
+		f.ref(old, -1)
+	}
+	f.ref(fi, 1)
+	f.db.Files[dstKey] = fi
 	return nil
 }
 
 func (f *Files) Delete(key string) error {
 	f.mu.Lock()
 	defer f.mu.Unlock()
+	if err := f.logRecords(&filesdb.Record{
+		Name:    key,
+		Deleted: true,
+	}); err != nil {
+		return fmt.Errorf("f.logRecords: %v", err)
+	}
+	if f1, has := f.db.Files[key]; has {
+		f.ref(f1, -1)
+	}
 	delete(f.db.Files, key)
 	return nil
 }
+
+// Collect passes sectors referenced by files to the manager, which
+// marks other sectors as garbage. See manager.Collect.
+func (f *Files) Collect() (int, error) {
+	// Sectors allocated by writes in progress are not referenced yet.
+	f.writeMu.Lock()
+	defer f.writeMu.Unlock()
+	f.mu.Lock()
+	live := make(map[int64]struct{}, len(f.refs)+1)
+	for i := range f.refs {
+		live[i] = struct{}{}
+	}
+	if f.db.InProgressSectorId != 0 {
+		live[f.db.InProgressSectorId] = struct{}{}
+	}
+	f.mu.Unlock()
+	return f.manager.Collect(live)
+}
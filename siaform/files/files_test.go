@@ -0,0 +1,346 @@
+package files
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/starius/invisiblefs/siaform/manager"
+	"golang.org/x/net/context"
+)
+
+// newManager returns a started manager which does not form parity
+// sets, so sectors stay in memory.
+func newManager(t *testing.T, sectorSize int) *manager.Manager {
+	mn, err := manager.New(100, 1, sectorSize, nil)
+	if err != nil {
+		t.Fatalf("manager.New: %v", err)
+	}
+	if err := mn.Start(); err != nil {
+		t.Fatalf("mn.Start: %v", err)
+	}
+	return mn
+}
+
+// reopen closes the journal of fs and loads the files from the
+// snapshot, if it is not empty, and the journal.
+func reopen(t *testing.T, fs *Files, snapshot, fname string) *Files {
+	if err := fs.journal.Close(); err != nil {
+		t.Fatalf("fs.journal.Close: %v", err)
+	}
+	var fs2 *Files
+	var err error
+	if snapshot == "" {
+		fs2, err = New(int(fs.db.SectorSize), fs.manager)
+	} else {
+		zdump, err1 := ioutil.ReadFile(snapshot)
+		if err1 != nil {
+			t.Fatalf("ioutil.ReadFile: %v", err1)
+		}
+		fs2, err = Load(zdump, fs.manager)
+	}
+	if err != nil {
+		t.Fatalf("New or Load: %v", err)
+	}
+	if err := fs2.OpenJournal(fname); err != nil {
+		t.Fatalf("fs2.OpenJournal: %v", err)
+	}
+	return fs2
+}
+
+// sectors returns the sectors referenced by files.
+func sectors(fs *Files) map[int64]struct{} {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	ids := make(map[int64]struct{})
+	for i := range fs.refs {
+		ids[i] = struct{}{}
+	}
+	return ids
+}
+
+func TestWriteAt(t *testing.T) {
+	const sectorSize = 4096
+	dir, err := ioutil.TempDir("", "files")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	mn := newManager(t, sectorSize)
+	defer mn.Stop()
+	fname := filepath.Join(dir, "files.journal")
+	fs, err := New(sectorSize, mn)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := fs.OpenJournal(fname); err != nil {
+		t.Fatalf("fs.OpenJournal: %v", err)
+	}
+	ctx := context.Background()
+	f, err := fs.Create(ctx, "file")
+	if err != nil {
+		t.Fatalf("fs.Create: %v", err)
+	}
+	var want []byte
+	check := func(fs *Files, step string) {
+		got, err := fs.Get(ctx, "file")
+		if err != nil {
+			t.Fatalf("%s: fs.Get: %v", step, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatalf("%s: got %d bytes, want %d bytes", step, len(got), len(want))
+		}
+	}
+	random := func(size int) []byte {
+		p := make([]byte, size)
+		rand.Read(p)
+		return p
+	}
+	writeAt := func(p []byte, off int) {
+		if n, err := f.WriteAt(p, int64(off)); err != nil || n != len(p) {
+			t.Fatalf("f.WriteAt: %d, %v", n, err)
+		}
+		if off+len(p) > len(want) {
+			want = append(want, make([]byte, off+len(p)-len(want))...)
+		}
+		copy(want[off:], p)
+	}
+	want = random(3*sectorSize + 100)
+	if n, err := f.Write(want); err != nil || n != len(want) {
+		t.Fatalf("f.Write: %d, %v", n, err)
+	}
+	check(fs, "write")
+	writeAt(random(1000), sectorSize-500)
+	check(fs, "overwrite across sectors")
+	writeAt(random(10), 2*sectorSize+3)
+	check(fs, "overwrite inside a sector")
+	writeAt(random(2*sectorSize), 5*sectorSize)
+	check(fs, "write past the end")
+	if err := f.Truncate(int64(sectorSize + 7)); err != nil {
+		t.Fatalf("f.Truncate: %v", err)
+	}
+	want = want[:sectorSize+7]
+	check(fs, "shrink")
+	if err := f.Truncate(int64(3 * sectorSize)); err != nil {
+		t.Fatalf("f.Truncate: %v", err)
+	}
+	want = append(want, make([]byte, 2*sectorSize-7)...)
+	check(fs, "grow")
+	if _, err := f.Seek(100, io.SeekStart); err != nil {
+		t.Fatalf("f.Seek: %v", err)
+	}
+	p := random(50)
+	if n, err := f.Write(p); err != nil || n != len(p) {
+		t.Fatalf("f.Write: %d, %v", n, err)
+	}
+	copy(want[100:], p)
+	check(fs, "write after seek")
+	fs2 := reopen(t, fs, "", fname)
+	check(fs2, "replay")
+	f2, err := fs2.Open(ctx, "file")
+	if err != nil {
+		t.Fatalf("fs2.Open: %v", err)
+	}
+	if err := f2.Truncate(0); err != nil {
+		t.Fatalf("f2.Truncate: %v", err)
+	}
+	want = nil
+	check(fs2, "truncate to zero")
+	if len(fs2.refs) != 0 {
+		t.Errorf("sectors are still referenced: %v", fs2.refs)
+	}
+}
+
+func TestOverloadedWriteDoesNotBlockReads(t *testing.T) {
+	const sectorSize = 4096
+	mn, err := manager.New(2, 1, sectorSize, nil)
+	if err != nil {
+		t.Fatalf("manager.New: %v", err)
+	}
+	if err := mn.SetUploadLimits(2*sectorSize, 0, time.Second); err != nil {
+		t.Fatalf("mn.SetUploadLimits: %v", err)
+	}
+	ctx := context.Background()
+	// The manager is not started, so pending sectors are not drained.
+	for k := 0; k < 2; k++ {
+		if _, err := mn.AddSector(ctx, make([]byte, sectorSize)); err != nil {
+			t.Fatalf("mn.AddSector: %v", err)
+		}
+	}
+	fs, err := New(sectorSize, mn)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	f, err := fs.Create(ctx, "file")
+	if err != nil {
+		t.Fatalf("fs.Create: %v", err)
+	}
+	if _, err := f.Write(make([]byte, 3000)); err != nil {
+		t.Fatalf("f.Write: %v", err)
+	}
+	done := make(chan error)
+	go func() {
+		// Uploads the in_progress sector and waits for memory.
+		_, err := f.Write(make([]byte, 3000))
+		done <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+	start := time.Now()
+	if _, err := fs.List(); err != nil {
+		t.Fatalf("fs.List: %v", err)
+	}
+	if _, err := fs.Has("file"); err != nil {
+		t.Fatalf("fs.Has: %v", err)
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("List and Has waited for the overloaded write for %s", d)
+	}
+	if err := <-done; err != manager.ErrOverloaded {
+		t.Errorf("f.Write returned %v, want ErrOverloaded", err)
+	}
+}
+
+func TestDedup(t *testing.T) {
+	const sectorSize = 4096
+	dir, err := ioutil.TempDir("", "files")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	mn := newManager(t, sectorSize)
+	defer mn.Stop()
+	fname := filepath.Join(dir, "files.journal")
+	fs, err := New(sectorSize, mn)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := fs.OpenJournal(fname); err != nil {
+		t.Fatalf("fs.OpenJournal: %v", err)
+	}
+	ctx := context.Background()
+	value := make([]byte, 8*sectorSize)
+	rand.Read(value)
+	put := func(fs *Files, name string, value []byte) {
+		if err := fs.Put(ctx, name, value); err != nil {
+			t.Fatalf("fs.Put(%q): %v", name, err)
+		}
+		got, err := fs.Get(ctx, name)
+		if err != nil {
+			t.Fatalf("fs.Get(%q): %v", name, err)
+		}
+		if !bytes.Equal(got, value) {
+			t.Fatalf("fs.Get(%q) returned other data", name)
+		}
+	}
+	put(fs, "a", value)
+	old := sectors(fs)
+	put(fs, "b", value)
+	if n := len(sectors(fs)); n != len(old) {
+		t.Errorf("the same value uses %d sectors, want %d", n, len(old))
+	}
+	// Chunks after the changed beginning are reused.
+	put(fs, "c", append([]byte("prefix"), value...))
+	if n := len(sectors(fs)); n > len(old)+3 {
+		t.Errorf("overlapping value added %d sectors", n-len(old))
+	}
+	// Chunks survive the replay of the journal.
+	chunks := len(fs.db.Chunks)
+	fs = reopen(t, fs, "", fname)
+	if len(fs.db.Chunks) != chunks {
+		t.Errorf("%d chunks after replay, want %d", len(fs.db.Chunks), chunks)
+	}
+	n := len(sectors(fs))
+	put(fs, "d", value)
+	if len(sectors(fs)) != n {
+		t.Errorf("the value was stored again after replay")
+	}
+	// Chunks of sectors without files are not reused.
+	old = sectors(fs)
+	for _, name := range []string{"a", "b", "c", "d"} {
+		if err := fs.Delete(name); err != nil {
+			t.Fatalf("fs.Delete: %v", err)
+		}
+	}
+	if len(fs.refs) != 0 {
+		t.Errorf("sectors are still referenced: %v", fs.refs)
+	}
+	// New chunks are still appended to the sector in progress.
+	inProgress := fs.db.InProgressSectorId
+	put(fs, "e", value)
+	for i := range sectors(fs) {
+		if _, has := old[i]; has && i != inProgress {
+			t.Errorf("sector %d without files was reused", i)
+		}
+	}
+	// Chunks survive Compact.
+	snapshot := filepath.Join(dir, "files.db")
+	if err := fs.Compact(snapshot); err != nil {
+		t.Fatalf("fs.Compact: %v", err)
+	}
+	for _, piece := range fs.db.Chunks {
+		if _, has := old[piece.SectorId]; has && fs.refs[piece.SectorId] == 0 {
+			t.Errorf("Compact kept chunk of unreferenced sector %d", piece.SectorId)
+		}
+	}
+	e := sectors(fs)
+	fs = reopen(t, fs, snapshot, fname)
+	put(fs, "f", value)
+	if got := sectors(fs); len(got) != len(e) {
+		t.Errorf("the value was stored again after Compact: %d sectors, want %d", len(got), len(e))
+	}
+}
+
+func TestCollect(t *testing.T) {
+	const sectorSize = 4096
+	mn := newManager(t, sectorSize)
+	defer mn.Stop()
+	fs, err := New(sectorSize, mn)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	ctx := context.Background()
+	value := make([]byte, 8*sectorSize)
+	rand.Read(value)
+	if err := fs.Put(ctx, "a", value); err != nil {
+		t.Fatalf("fs.Put: %v", err)
+	}
+	if err := fs.Link("b", "a"); err != nil {
+		t.Fatalf("fs.Link: %v", err)
+	}
+	if err := fs.Delete("a"); err != nil {
+		t.Fatalf("fs.Delete: %v", err)
+	}
+	if n, err := fs.Collect(); err != nil {
+		t.Fatalf("fs.Collect: %v", err)
+	} else if n != 0 {
+		t.Errorf("fs.Collect found %d garbage sectors of a linked file", n)
+	}
+	got, err := fs.Get(ctx, "b")
+	if err != nil {
+		t.Fatalf("fs.Get: %v", err)
+	}
+	if !bytes.Equal(got, value) {
+		t.Errorf("linked file returned other data")
+	}
+	ids := sectors(fs)
+	if err := fs.Delete("b"); err != nil {
+		t.Fatalf("fs.Delete: %v", err)
+	}
+	// The sector in progress is kept for further writes.
+	delete(ids, fs.db.InProgressSectorId)
+	if n, err := fs.Collect(); err != nil {
+		t.Fatalf("fs.Collect: %v", err)
+	} else if n != len(ids) {
+		t.Errorf("fs.Collect found %d garbage sectors, want %d", n, len(ids))
+	}
+	for i := range ids {
+		if _, err := mn.ReadSector(ctx, i); err == nil {
+			t.Errorf("sector %d of deleted files was not removed", i)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package files
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/starius/invisiblefs/atomicfile"
+	"github.com/starius/invisiblefs/siaform/filesdb"
+	"github.com/starius/invisiblefs/siaform/journal"
+)
+
+// OpenJournal applies changes logged to the journal after the
+// snapshot the files were loaded from and logs further changes to it.
+func (f *Files) OpenJournal(fname string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	j, err := journal.Open(fname, f.db.JournalSeq, f.applyRecord)
+	if err != nil {
+		return fmt.Errorf("journal.Open: %v", err)
+	}
+	f.journal = j
+	f.reindex()
+	return nil
+}
+
+// applyRecord applies a record of the journal to the db.
+// Run under f.mu.Lock().
+func (f *Files) applyRecord(data []byte) error {
+	record := &filesdb.Record{}
+	if err := proto.Unmarshal(data, record); err != nil {
+		return fmt.Errorf("proto.Unmarshal: %v", err)
+	}
+	if record.ResetInProgress {
+		f.db.InProgress = nil
+		f.db.InProgressSectorId = 0
+	}
+	if record.InProgressSectorId != 0 {
+		f.db.InProgressSectorId = record.InProgressSectorId
+	}
+	f.db.InProgress = append(f.db.InProgress, record.InProgress...)
+	for _, piece := range record.Chunks {
+		f.db.Chunks[hex.EncodeToString(piece.Sha256)] = piece
+	}
+	if record.Name == "" {
+		return nil
+	}
+	if record.Deleted {
+		delete(f.db.Files, record.Name)
+	} else if record.File != nil {
+		f.db.Files[record.Name] = record.File
+	} else if f1, has := f.db.Files[record.Name]; has {
+		if _, err := splicePieces(f1, record); err != nil {
+			return fmt.Errorf("file %q: %v", record.Name, err)
+		}
+	}
+	return nil
+}
+
+// splicePieces appends pieces of the record to the file or replaces
+// its pieces with them and sets the size of the file. It returns
+// the removed pieces.
+func splicePieces(f1 *filesdb.File, record *filesdb.Record) ([]*filesdb.Piece, error) {
+	if !record.Splice {
+		f1.Pieces = append(f1.Pieces, record.Pieces...)
+		f1.Size = record.Size
+		return nil, nil
+	}
+	begin, end := int(record.SpliceBegin), int(record.SpliceEnd)
+	if begin < 0 || begin > end || end > len(f1.Pieces) {
+		return nil, fmt.Errorf("bad splice [%d,%d) of %d pieces", begin, end, len(f1.Pieces))
+	}
+	removed := f1.Pieces[begin:end]
+	pieces := make([]*filesdb.Piece, 0, len(f1.Pieces)-len(removed)+len(record.Pieces))
+	pieces = append(pieces, f1.Pieces[:begin]...)
+	pieces = append(pieces, record.Pieces...)
+	pieces = append(pieces, f1.Pieces[end:]...)
+	f1.Pieces = pieces
+	f1.Size = record.Size
+	return removed, nil
+}
+
+// logRecords appends the records to the journal if it is open.
+// Run under f.mu.Lock().
+func (f *Files) logRecords(records ...*filesdb.Record) error {
+	if f.journal == nil {
+		return nil
+	}
+	var datas [][]byte
+	for _, record := range records {
+		data, err := proto.Marshal(record)
+		if err != nil {
+			return fmt.Errorf("proto.Marshal: %v", err)
+		}
+		datas = append(datas, data)
+	}
+	if err := f.journal.Append(datas...); err != nil {
+		return fmt.Errorf("journal.Append: %v", err)
+	}
+	return nil
+}
+
+// Compact writes the snapshot of the db to fname and clears the
+// journal. The snapshot is replaced atomically.
+func (f *Files) Compact(fname string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.journal != nil {
+		f.db.JournalSeq = f.journal.Seq()
+	}
+	// Chunks of sectors without files are not reused.
+	for key, piece := range f.db.Chunks {
+		if f.refs[piece.SectorId] == 0 {
+			delete(f.db.Chunks, key)
+		}
+	}
+	zdump, err := f.dumpDb()
+	if err != nil {
+		return fmt.Errorf("f.dumpDb: %v", err)
+	}
+	if err := atomicfile.WriteFile(fname, zdump); err != nil {
+		return fmt.Errorf("atomicfile.WriteFile: %v", err)
+	}
+	if f.journal != nil {
+		if err := f.journal.Reset(); err != nil {
+			return fmt.Errorf("journal.Reset: %v", err)
+		}
+	}
+	return nil
+}
@@ -12,6 +12,7 @@ It has these top-level messages:
 	Db
 	File
 	Piece
+	Record
 */
 package filesdb
 
@@ -35,6 +36,10 @@ type Db struct {
 	SectorSize         int32            `protobuf:"zigzag32,2,opt,name=sector_size,json=sectorSize" json:"sector_size,omitempty"`
 	InProgress         []byte           `protobuf:"bytes,3,opt,name=in_progress,json=inProgress,proto3" json:"in_progress,omitempty"`
 	InProgressSectorId int64            `protobuf:"zigzag64,4,opt,name=in_progress_sector_id,json=inProgressSectorId" json:"in_progress_sector_id,omitempty"`
+	// Sequence number of the last journal record included.
+	JournalSeq uint64 `protobuf:"varint,5,opt,name=journal_seq,json=journalSeq" json:"journal_seq,omitempty"`
+	// Index of deduplicated chunks by hex of sha256.
+	Chunks map[string]*Piece `protobuf:"bytes,6,rep,name=chunks" json:"chunks,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
 }
 
 func (m *Db) Reset()                    { *m = Db{} }
@@ -70,6 +75,20 @@ func (m *Db) GetInProgressSectorId() int64 {
 	return 0
 }
 
+func (m *Db) GetJournalSeq() uint64 {
+	if m != nil {
+		return m.JournalSeq
+	}
+	return 0
+}
+
+func (m *Db) GetChunks() map[string]*Piece {
+	if m != nil {
+		return m.Chunks
+	}
+	return nil
+}
+
 type File struct {
 	Pieces []*Piece `protobuf:"bytes,1,rep,name=pieces" json:"pieces,omitempty"`
 	Size   int64    `protobuf:"zigzag64,2,opt,name=size" json:"size,omitempty"`
@@ -96,7 +115,8 @@ func (m *File) GetSize() int64 {
 
 type Piece struct {
 	SectorId int64 `protobuf:"zigzag64,1,opt,name=sector_id,json=sectorId" json:"sector_id,omitempty"`
-	// Only if not whole sector.
+	// Only if not whole sector or deduplicated. Parts of pieces
+	// cut by overwrites have no checksum: the sector is read whole.
 	Sha256 []byte `protobuf:"bytes,2,opt,name=sha256,proto3" json:"sha256,omitempty"`
 	Offset int32  `protobuf:"zigzag32,3,opt,name=offset" json:"offset,omitempty"`
 	Length int32  `protobuf:"zigzag32,4,opt,name=length" json:"length,omitempty"`
@@ -135,33 +155,160 @@ func (m *Piece) GetLength() int32 {
 	return 0
 }
 
+// Record of the journal. Changes are applied in the order of fields.
+type Record struct {
+	// Clear in_progress.
+	ResetInProgress bool `protobuf:"varint,1,opt,name=reset_in_progress,json=resetInProgress" json:"reset_in_progress,omitempty"`
+	// Set in_progress_sector_id if not 0.
+	InProgressSectorId int64 `protobuf:"zigzag64,2,opt,name=in_progress_sector_id,json=inProgressSectorId" json:"in_progress_sector_id,omitempty"`
+	// Append to in_progress.
+	InProgress []byte `protobuf:"bytes,3,opt,name=in_progress,json=inProgress,proto3" json:"in_progress,omitempty"`
+	Name       string `protobuf:"bytes,4,opt,name=name" json:"name,omitempty"`
+	// Remove the file.
+	Deleted bool `protobuf:"varint,5,opt,name=deleted" json:"deleted,omitempty"`
+	// Replace the file.
+	File *File `protobuf:"bytes,6,opt,name=file" json:"file,omitempty"`
+	// Append pieces to the file and set its size.
+	Pieces []*Piece `protobuf:"bytes,7,rep,name=pieces" json:"pieces,omitempty"`
+	Size   int64    `protobuf:"zigzag64,8,opt,name=size" json:"size,omitempty"`
+	// Add pieces to the index of chunks.
+	Chunks []*Piece `protobuf:"bytes,9,rep,name=chunks" json:"chunks,omitempty"`
+	// Replace pieces [splice_begin, splice_end) of the file with
+	// pieces instead of appending them.
+	Splice      bool  `protobuf:"varint,10,opt,name=splice" json:"splice,omitempty"`
+	SpliceBegin int64 `protobuf:"zigzag64,11,opt,name=splice_begin,json=spliceBegin" json:"splice_begin,omitempty"`
+	SpliceEnd   int64 `protobuf:"zigzag64,12,opt,name=splice_end,json=spliceEnd" json:"splice_end,omitempty"`
+}
+
+func (m *Record) Reset()                    { *m = Record{} }
+func (m *Record) String() string            { return proto.CompactTextString(m) }
+func (*Record) ProtoMessage()               {}
+func (*Record) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{3} }
+
+func (m *Record) GetResetInProgress() bool {
+	if m != nil {
+		return m.ResetInProgress
+	}
+	return false
+}
+
+func (m *Record) GetInProgressSectorId() int64 {
+	if m != nil {
+		return m.InProgressSectorId
+	}
+	return 0
+}
+
+func (m *Record) GetInProgress() []byte {
+	if m != nil {
+		return m.InProgress
+	}
+	return nil
+}
+
+func (m *Record) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *Record) GetDeleted() bool {
+	if m != nil {
+		return m.Deleted
+	}
+	return false
+}
+
+func (m *Record) GetFile() *File {
+	if m != nil {
+		return m.File
+	}
+	return nil
+}
+
+func (m *Record) GetPieces() []*Piece {
+	if m != nil {
+		return m.Pieces
+	}
+	return nil
+}
+
+func (m *Record) GetSize() int64 {
+	if m != nil {
+		return m.Size
+	}
+	return 0
+}
+
+func (m *Record) GetChunks() []*Piece {
+	if m != nil {
+		return m.Chunks
+	}
+	return nil
+}
+
+func (m *Record) GetSplice() bool {
+	if m != nil {
+		return m.Splice
+	}
+	return false
+}
+
+func (m *Record) GetSpliceBegin() int64 {
+	if m != nil {
+		return m.SpliceBegin
+	}
+	return 0
+}
+
+func (m *Record) GetSpliceEnd() int64 {
+	if m != nil {
+		return m.SpliceEnd
+	}
+	return 0
+}
+
 func init() {
 	proto.RegisterType((*Db)(nil), "filesdb.Db")
 	proto.RegisterType((*File)(nil), "filesdb.File")
 	proto.RegisterType((*Piece)(nil), "filesdb.Piece")
+	proto.RegisterType((*Record)(nil), "filesdb.Record")
 }
 
 func init() { proto.RegisterFile("filesdb.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 296 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x4c, 0x91, 0xcf, 0x4a, 0xc3, 0x40,
-	0x10, 0xc6, 0xd9, 0xfc, 0xd3, 0x4e, 0x5a, 0x31, 0x03, 0x96, 0xa0, 0x07, 0x43, 0x04, 0xc9, 0x41,
-	0x02, 0x46, 0x14, 0xf1, 0x28, 0x55, 0xf1, 0x56, 0xb6, 0x0f, 0x10, 0x9a, 0x66, 0xd3, 0x2e, 0x86,
-	0x24, 0x64, 0xa3, 0xd0, 0x3e, 0xb5, 0x8f, 0x20, 0xbb, 0x59, 0x93, 0xde, 0xe6, 0xfb, 0xe6, 0x37,
-	0xcb, 0x37, 0xb3, 0x30, 0x2b, 0x78, 0xc9, 0x44, 0x9e, 0xc5, 0x4d, 0x5b, 0x77, 0x35, 0x9e, 0x68,
-	0x19, 0xfe, 0x12, 0x30, 0x16, 0x19, 0xde, 0x81, 0xad, 0x1c, 0x9f, 0x04, 0x66, 0xe4, 0x26, 0xf3,
-	0xf8, 0x1f, 0x5f, 0x64, 0xf1, 0xbb, 0x2c, 0xdf, 0xaa, 0xae, 0xdd, 0xd3, 0x1e, 0xc2, 0x6b, 0x70,
-	0x05, 0xdb, 0x74, 0x75, 0x9b, 0x0a, 0x7e, 0x60, 0xbe, 0x11, 0x90, 0xc8, 0xa3, 0xd0, 0x5b, 0x2b,
-	0x7e, 0x60, 0x12, 0xe0, 0x55, 0xda, 0xb4, 0xf5, 0xb6, 0x65, 0x42, 0xf8, 0x66, 0x40, 0xa2, 0x29,
-	0x05, 0x5e, 0x2d, 0xb5, 0x83, 0xf7, 0x70, 0x71, 0x04, 0xa4, 0xfa, 0x35, 0x9e, 0xfb, 0x56, 0x40,
-	0x22, 0xa4, 0x38, 0xa2, 0x2b, 0xd5, 0xfa, 0xcc, 0x2f, 0x3f, 0x00, 0xc6, 0x24, 0x78, 0x0e, 0xe6,
-	0x17, 0xdb, 0xfb, 0x24, 0x20, 0xd1, 0x84, 0xca, 0x12, 0x6f, 0xc0, 0xfe, 0x59, 0x97, 0xdf, 0x7d,
-	0x1c, 0x37, 0x99, 0x0d, 0x2b, 0xc8, 0x29, 0xda, 0xf7, 0x5e, 0x8c, 0x67, 0x12, 0xbe, 0x82, 0x25,
-	0x2d, 0xbc, 0x05, 0xa7, 0xe1, 0x6c, 0x33, 0x2c, 0x7d, 0x36, 0x4c, 0x2c, 0xa5, 0x4d, 0x75, 0x17,
-	0x11, 0xac, 0x61, 0x4d, 0xa4, 0xaa, 0x0e, 0x4b, 0xb0, 0x15, 0x84, 0x57, 0x30, 0x19, 0xc3, 0x13,
-	0x45, 0x9c, 0x0a, 0x1d, 0x19, 0xe7, 0xe0, 0x88, 0xdd, 0x3a, 0x79, 0x7c, 0x52, 0xb3, 0x53, 0xaa,
-	0x95, 0xf4, 0xeb, 0xa2, 0x10, 0xac, 0x53, 0x97, 0xf1, 0xa8, 0x56, 0xd2, 0x2f, 0x59, 0xb5, 0xed,
-	0x76, 0xea, 0x0c, 0x1e, 0xd5, 0x2a, 0x73, 0xd4, 0xa7, 0x3d, 0xfc, 0x05, 0x00, 0x00, 0xff, 0xff,
-	0x2d, 0x9e, 0xa0, 0x42, 0xc5, 0x01, 0x00, 0x00,
+	// 481 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0x03, 0x8d, 0x53, 0xc1, 0x6e, 0xd3, 0x40,
+	0x10, 0x95, 0x63, 0xc7, 0x89, 0xc7, 0x29, 0x90, 0x95, 0xda, 0xae, 0x8a, 0x10, 0x25, 0x20, 0x14,
+	0x21, 0x14, 0x44, 0x10, 0xa8, 0xe2, 0x58, 0x5a, 0x50, 0x6e, 0xd5, 0xe6, 0x03, 0xac, 0xd8, 0x9e,
+	0x24, 0x6e, 0xcd, 0x3a, 0xb5, 0x1d, 0xa4, 0xf6, 0x1f, 0x38, 0xf3, 0xbb, 0xec, 0xce, 0x6e, 0x12,
+	0x83, 0xa2, 0xaa, 0xb7, 0x99, 0x37, 0x6f, 0x9e, 0x77, 0xe6, 0x8d, 0xe1, 0x60, 0x9e, 0xe5, 0x58,
+	0xa5, 0xf1, 0x68, 0x55, 0x16, 0x75, 0xc1, 0x3a, 0x36, 0x1d, 0xfc, 0x76, 0xa1, 0x75, 0x11, 0xb3,
+	0xf7, 0xd0, 0x26, 0x84, 0x3b, 0xa7, 0xee, 0x30, 0x1c, 0x1f, 0x8d, 0x36, 0xf4, 0x8b, 0x78, 0xf4,
+	0x5d, 0x87, 0x97, 0xb2, 0x2e, 0xef, 0x84, 0x21, 0xb1, 0x97, 0x10, 0x56, 0x98, 0xd4, 0x45, 0x19,
+	0x55, 0xd9, 0x3d, 0xf2, 0xd6, 0xa9, 0x33, 0xec, 0x0b, 0x30, 0xd0, 0x54, 0x21, 0x9a, 0x90, 0xc9,
+	0x48, 0x7d, 0x6a, 0x51, 0x62, 0x55, 0x71, 0x57, 0x11, 0x7a, 0x02, 0x32, 0x79, 0x65, 0x11, 0xf6,
+	0x11, 0x0e, 0x1b, 0x84, 0xc8, 0xaa, 0x65, 0x29, 0xf7, 0x14, 0x95, 0x09, 0xb6, 0xa3, 0x4e, 0xa9,
+	0x34, 0x49, 0xb5, 0xe6, 0x75, 0xb1, 0x2e, 0xe5, 0x2c, 0x57, 0xf4, 0x5b, 0xde, 0x56, 0x44, 0x4f,
+	0x80, 0x85, 0xa6, 0x78, 0xcb, 0x3e, 0x80, 0x9f, 0x2c, 0xd7, 0xf2, 0xa6, 0xe2, 0x3e, 0x0d, 0x71,
+	0xdc, 0x1c, 0xe2, 0x1b, 0x55, 0xcc, 0x14, 0x96, 0x76, 0xf2, 0x03, 0x60, 0x37, 0x1b, 0x7b, 0x06,
+	0xee, 0x0d, 0xde, 0xa9, 0x05, 0x38, 0xc3, 0x40, 0xe8, 0x90, 0xbd, 0x86, 0xf6, 0xaf, 0x59, 0xbe,
+	0x36, 0x03, 0x86, 0xe3, 0x83, 0xad, 0x9e, 0xee, 0x12, 0xa6, 0xf6, 0xb5, 0x75, 0xe6, 0x9c, 0x4c,
+	0x20, 0x6c, 0xe8, 0xef, 0x51, 0x7a, 0xf3, 0xaf, 0xd2, 0x93, 0xad, 0xd2, 0x55, 0x86, 0x49, 0x53,
+	0x6a, 0x70, 0x0e, 0x9e, 0x56, 0x67, 0x6f, 0xc1, 0x5f, 0xe9, 0xda, 0xc6, 0x91, 0xff, 0x5b, 0x6c,
+	0x95, 0x31, 0xf0, 0xb6, 0x1e, 0x30, 0x41, 0xf1, 0x20, 0x87, 0x36, 0x91, 0xd8, 0x73, 0x08, 0x76,
+	0x9b, 0x75, 0x88, 0xd1, 0xad, 0x36, 0xfb, 0x3c, 0x02, 0xbf, 0x5a, 0xce, 0xc6, 0x9f, 0xbf, 0x50,
+	0x6f, 0x4f, 0xd8, 0x4c, 0xe3, 0xc5, 0x7c, 0x5e, 0x61, 0x4d, 0xb6, 0xf5, 0x85, 0xcd, 0x34, 0x9e,
+	0xa3, 0x5c, 0xd4, 0x4b, 0xf2, 0x48, 0xe1, 0x26, 0x1b, 0xfc, 0x71, 0xc1, 0x17, 0x98, 0x14, 0x65,
+	0xca, 0xde, 0x41, 0x5f, 0x59, 0x86, 0x75, 0xd4, 0x34, 0x5f, 0x7f, 0xb7, 0x2b, 0x9e, 0x52, 0x61,
+	0xf2, 0x88, 0x0b, 0x68, 0x3d, 0x74, 0x01, 0x0f, 0x5f, 0x95, 0x5a, 0x86, 0x9c, 0xfd, 0x44, 0x7a,
+	0x60, 0x20, 0x28, 0x66, 0x1c, 0x3a, 0x29, 0xe6, 0x58, 0x63, 0x4a, 0x27, 0xd3, 0x15, 0x9b, 0x94,
+	0xbd, 0x02, 0x4f, 0xef, 0x54, 0x5d, 0xcb, 0x1e, 0x77, 0xa9, 0xd4, 0x70, 0xa1, 0xf3, 0x28, 0x17,
+	0xba, 0x3b, 0x17, 0x74, 0xaf, 0x3d, 0xc7, 0x60, 0x7f, 0xaf, 0xa9, 0x92, 0x0f, 0xab, 0x3c, 0x4b,
+	0x90, 0x03, 0xbd, 0xcf, 0x66, 0xea, 0x79, 0x3d, 0x13, 0x45, 0x31, 0x2e, 0x32, 0xc9, 0x43, 0xd2,
+	0x0e, 0x0d, 0x76, 0xae, 0x21, 0xf6, 0x02, 0xc0, 0x52, 0x50, 0xa6, 0xbc, 0x47, 0x84, 0xc0, 0x20,
+	0x97, 0x32, 0x8d, 0x7d, 0xfa, 0xd7, 0x3f, 0xfd, 0x05, 0x30, 0xd7, 0x2e, 0x0a, 0xfc, 0x03, 0x00,
+	0x00,
 }
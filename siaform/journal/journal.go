@@ -0,0 +1,190 @@
+// Package journal implements an append-only log of records used
+// to persist mutations of a database between its snapshots.
+//
+// Each record is stored as 4 bytes of length of data, 4 bytes of
+// CRC-32 of the rest, 8 bytes of sequence number and data. All
+// numbers are little-endian. A record torn by a crash is dropped.
+package journal
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sync"
+)
+
+const headerSize = 16
+
+// file is implemented by *os.File. Tests inject failures through it.
+type file interface {
+	io.Writer
+	io.Seeker
+	io.Closer
+	Sync() error
+	Truncate(size int64) error
+}
+
+type Journal struct {
+	f    file
+	seq  uint64
+	size int64 // Size of valid records.
+	err  error // Set if a torn record could not be removed.
+	mu   sync.Mutex
+}
+
+// Open applies records of the journal having sequence numbers
+// greater than seq and opens the journal for appending.
+// The file is created if it does not exist.
+func Open(fname string, seq uint64, apply func(data []byte) error) (*Journal, error) {
+	f, err := os.OpenFile(fname, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("os.OpenFile(%q): %v", fname, err)
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("f.Stat: %v", err)
+	}
+	r := bufio.NewReader(f)
+	valid := int64(0)
+	header := make([]byte, headerSize)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			break
+		}
+		length := binary.LittleEndian.Uint32(header[0:4])
+		checksum := binary.LittleEndian.Uint32(header[4:8])
+		if int64(length) > stat.Size()-valid-headerSize {
+			// The length is not covered by the checksum.
+			break
+		}
+		data := make([]byte, length)
+		if _, err := io.ReadFull(r, data); err != nil {
+			break
+		}
+		h := crc32.NewIEEE()
+		h.Write(header[8:])
+		h.Write(data)
+		if h.Sum32() != checksum {
+			break
+		}
+		recordSeq := binary.LittleEndian.Uint64(header[8:])
+		if recordSeq > seq {
+			if err := apply(data); err != nil {
+				f.Close()
+				return nil, fmt.Errorf("record %d: %v", recordSeq, err)
+			}
+			seq = recordSeq
+		}
+		valid += headerSize + int64(length)
+	}
+	// Drop the torn tail.
+	if err := f.Truncate(valid); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("f.Truncate: %v", err)
+	}
+	if _, err := f.Seek(valid, io.SeekStart); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("f.Seek: %v", err)
+	}
+	return &Journal{
+		f:    f,
+		seq:  seq,
+		size: valid,
+	}, nil
+}
+
+// Append writes records to the journal and waits until they
+// reach the disk. If it fails, the records are removed, so records
+// appended later are not dropped with them on replay. If they can
+// not be removed, all later appends fail.
+func (j *Journal) Append(records ...[]byte) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.err != nil {
+		return j.err
+	}
+	seq := j.seq
+	var buf []byte
+	for _, data := range records {
+		j.seq++
+		header := make([]byte, headerSize)
+		binary.LittleEndian.PutUint32(header[0:4], uint32(len(data)))
+		binary.LittleEndian.PutUint64(header[8:], j.seq)
+		h := crc32.NewIEEE()
+		h.Write(header[8:])
+		h.Write(data)
+		binary.LittleEndian.PutUint32(header[4:8], h.Sum32())
+		buf = append(buf, header...)
+		buf = append(buf, data...)
+	}
+	if err := j.write(buf); err != nil {
+		j.seq = seq
+		if err2 := j.rollback(); err2 != nil {
+			j.err = fmt.Errorf("the journal is broken: %v", err2)
+		}
+		return err
+	}
+	j.size += int64(len(buf))
+	return nil
+}
+
+func (j *Journal) write(buf []byte) error {
+	if _, err := j.f.Write(buf); err != nil {
+		return fmt.Errorf("f.Write: %v", err)
+	}
+	if err := j.f.Sync(); err != nil {
+		return fmt.Errorf("f.Sync: %v", err)
+	}
+	return nil
+}
+
+// rollback removes a partially written record.
+func (j *Journal) rollback() error {
+	if err := j.f.Truncate(j.size); err != nil {
+		return fmt.Errorf("f.Truncate: %v", err)
+	}
+	if _, err := j.f.Seek(j.size, io.SeekStart); err != nil {
+		return fmt.Errorf("f.Seek: %v", err)
+	}
+	if err := j.f.Sync(); err != nil {
+		return fmt.Errorf("f.Sync: %v", err)
+	}
+	return nil
+}
+
+// Seq returns the sequence number of the last record.
+func (j *Journal) Seq() uint64 {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.seq
+}
+
+// Reset removes all records. Call it after the snapshot including
+// them is saved. Sequence numbers of new records continue.
+func (j *Journal) Reset() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err := j.f.Truncate(0); err != nil {
+		return fmt.Errorf("f.Truncate: %v", err)
+	}
+	if _, err := j.f.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("f.Seek: %v", err)
+	}
+	if err := j.f.Sync(); err != nil {
+		return fmt.Errorf("f.Sync: %v", err)
+	}
+	// Torn records are removed too.
+	j.size = 0
+	j.err = nil
+	return nil
+}
+
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.f.Close()
+}
@@ -0,0 +1,190 @@
+package journal
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func replay(t *testing.T, fname string, seq uint64) (*Journal, []string) {
+	var records []string
+	j, err := Open(fname, seq, func(data []byte) error {
+		records = append(records, string(data))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	return j, records
+}
+
+func TestJournal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	fname := filepath.Join(dir, "journal")
+	j, records := replay(t, fname, 0)
+	if len(records) != 0 {
+		t.Errorf("new journal has records %v", records)
+	}
+	for i := 0; i < 3; i++ {
+		if err := j.Append([]byte(fmt.Sprintf("r%d", i))); err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+	}
+	if err := j.Append([]byte("r3"), []byte("r4")); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	if j.Seq() != 5 {
+		t.Errorf("Seq is %d, want 5", j.Seq())
+	}
+	if err := j.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	j, records = replay(t, fname, 2)
+	if want := []string{"r2", "r3", "r4"}; !reflect.DeepEqual(records, want) {
+		t.Errorf("replayed %v, want %v", records, want)
+	}
+	if err := j.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	// Tear the last record.
+	info, err := os.Stat(fname)
+	if err != nil {
+		t.Fatalf("os.Stat: %v", err)
+	}
+	if err := os.Truncate(fname, info.Size()-1); err != nil {
+		t.Fatalf("os.Truncate: %v", err)
+	}
+	j, records = replay(t, fname, 0)
+	if want := []string{"r0", "r1", "r2", "r3"}; !reflect.DeepEqual(records, want) {
+		t.Errorf("replayed %v, want %v", records, want)
+	}
+	if err := j.Append([]byte("r5")); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	if err := j.Reset(); err != nil {
+		t.Fatalf("Reset: %v", err)
+	}
+	if err := j.Append([]byte("r6")); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	if err := j.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	j, records = replay(t, fname, 5)
+	if want := []string{"r6"}; !reflect.DeepEqual(records, want) {
+		t.Errorf("replayed %v, want %v", records, want)
+	}
+	if j.Seq() != 6 {
+		t.Errorf("Seq is %d, want 6", j.Seq())
+	}
+	if err := j.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+}
+
+// shortFile writes only a part of data once.
+type shortFile struct {
+	file
+	short bool
+}
+
+func (f *shortFile) Write(p []byte) (int, error) {
+	if f.short {
+		f.short = false
+		n, _ := f.file.Write(p[:len(p)/2])
+		return n, io.ErrShortWrite
+	}
+	return f.file.Write(p)
+}
+
+func TestShortWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	fname := filepath.Join(dir, "journal")
+	j, _ := replay(t, fname, 0)
+	if err := j.Append([]byte("r0")); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	f := &shortFile{file: j.f, short: true}
+	j.f = f
+	if err := j.Append([]byte("torn")); err == nil {
+		t.Errorf("Append succeeded after a short write")
+	}
+	if j.Seq() != 1 {
+		t.Errorf("Seq is %d, want 1", j.Seq())
+	}
+	if err := j.Append([]byte("r1")); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	if err := j.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	j, records := replay(t, fname, 0)
+	if want := []string{"r0", "r1"}; !reflect.DeepEqual(records, want) {
+		t.Errorf("replayed %v, want %v", records, want)
+	}
+	if j.Seq() != 2 {
+		t.Errorf("Seq is %d, want 2", j.Seq())
+	}
+	if err := j.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+}
+
+func TestOversizedLength(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	fname := filepath.Join(dir, "journal")
+	j, _ := replay(t, fname, 0)
+	if err := j.Append([]byte("r0"), []byte("r1")); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	if err := j.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	// Garbage header of a torn record claiming 4 GiB of data.
+	f, err := os.OpenFile(fname, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatalf("os.OpenFile: %v", err)
+	}
+	header := make([]byte, headerSize)
+	binary.LittleEndian.PutUint32(header[0:4], 0xFFFFFFFF)
+	if _, err := f.Write(header); err != nil {
+		t.Fatalf("f.Write: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("f.Close: %v", err)
+	}
+	j, records := replay(t, fname, 0)
+	if want := []string{"r0", "r1"}; !reflect.DeepEqual(records, want) {
+		t.Errorf("replayed %v, want %v", records, want)
+	}
+	if err := j.Append([]byte("r2")); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	if err := j.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	j, records = replay(t, fname, 0)
+	if want := []string{"r0", "r1", "r2"}; !reflect.DeepEqual(records, want) {
+		t.Errorf("replayed %v, want %v", records, want)
+	}
+	if err := j.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+}
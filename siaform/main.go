@@ -13,6 +13,9 @@ import (
 	"strings"
 	"time"
 
+	"golang.org/x/net/context"
+
+	"github.com/starius/invisiblefs/freestore/client"
 	"github.com/starius/invisiblefs/siaform/crypto"
 	"github.com/starius/invisiblefs/siaform/files"
 	"github.com/starius/invisiblefs/siaform/manager"
@@ -28,6 +31,24 @@ var (
 	dataDir    = flag.String("data-dir", "data-dir", "Directory to store databases")
 	keyFile    = flag.String("key-file", "", "File with key ('disable' to disable encryption")
 
+	repairInterval = flag.Duration("repair-interval", time.Hour, "How often to rebuild sectors of lost contracts (0 to disable)")
+	blacklist      = flag.String("blacklist", "", "Comma separated contracts to stop using")
+	hedgedReads    = flag.Bool("hedged-reads", false, "Recover sectors of slow contracts from parity in parallel")
+
+	compactInterval = flag.Duration("compact-interval", 10*time.Minute, "How often to write databases and clear their journals")
+
+	gcInterval  = flag.Duration("gc-interval", time.Hour, "How often to remove sectors of deleted files (0 to disable)")
+	repackRatio = flag.Float64("repack-ratio", 0.5, "Share of garbage data sectors of a parity set which makes it repacked")
+
+	maxPending  = flag.Int64("max-pending-bytes", 0, "Limit of data waiting for a parity set (0 for no limit)")
+	maxInFlight = flag.Int64("max-inflight-bytes", 1<<30, "Limit of data of parity sets being uploaded (0 for no limit)")
+	uploadWait  = flag.Duration("upload-wait", 10*time.Second, "How long writes wait for uploads when the limits are hit")
+
+	useFreestore   = flag.Bool("freestore", false, "Store sectors on freestore hosts instead of Sia")
+	freestoreSeeds = flag.String("freestore-seeds", "", "Comma separated address=certfile of freestore hosts to find hosts from")
+	freestoreDays  = flag.Int("freestore-days", 30, "Duration of new freestore contracts, in days")
+	freestoreAudit = flag.Duration("freestore-audit-interval", time.Hour, "How often to challenge freestore hosts")
+
 	mn *manager.Manager
 	fi *files.Files
 )
@@ -59,7 +80,7 @@ func h(res http.ResponseWriter, req *http.Request) {
 			return
 		}
 		name := parts[1]
-		f, err := fi.Open(name)
+		f, err := fi.Open(req.Context(), name)
 		if err != nil {
 			log.Printf("fi.Open(%q): %v.", name, err)
 			res.WriteHeader(http.StatusInternalServerError)
@@ -71,7 +92,7 @@ func h(res http.ResponseWriter, req *http.Request) {
 	} else if req.Method == "POST" && req.URL.Path == "/upload" {
 		log.Printf("Started uploading\n")
 		name := fmt.Sprintf("%d", rand.Int())
-		f, err := fi.Create(name)
+		f, err := fi.Create(req.Context(), name)
 		if err != nil {
 			log.Printf("fi.Create(%q): %v.", name, err)
 			res.WriteHeader(http.StatusInternalServerError)
@@ -108,6 +129,11 @@ func h(res http.ResponseWriter, req *http.Request) {
 					}
 					if _, err := f.Write(buf1); err != nil {
 						log.Printf("f.Write: %v.", err)
+						if err == manager.ErrOverloaded {
+							res.Header().Set("Retry-After", "10")
+							res.WriteHeader(http.StatusServiceUnavailable)
+							return
+						}
 						res.WriteHeader(http.StatusInternalServerError)
 						return
 					}
@@ -134,9 +160,31 @@ func main() {
 	fiFile := filepath.Join(*dataDir, "files.db")
 	var err error
 	var sc manager.SiaClient
-	sc, err = siaclient.New(*siaAddr, &http.Client{})
-	if err != nil {
-		log.Fatalf("siaclient.New: %v.", err)
+	var fc *client.Client
+	if *useFreestore {
+		fc, err = client.OpenDir(*dataDir)
+		if err != nil {
+			log.Fatalf("client.OpenDir: %v.", err)
+		}
+		seeds, err := client.ParsePeers(*freestoreSeeds)
+		if err != nil {
+			log.Fatalf("client.ParsePeers: %v.", err)
+		}
+		if err := fc.EnsureContracts(context.Background(), seeds, *ndata+*nparity, int32(*sectorSize), int32(*freestoreDays)); err != nil {
+			log.Fatalf("EnsureContracts: %v.", err)
+		}
+		// Extend contracts when a third of their duration is left.
+		days := int32(*freestoreDays)
+		renewBefore := time.Duration(days) * 24 * time.Hour / 3
+		if err := fc.StartRenewing(time.Hour, renewBefore, days); err != nil {
+			log.Fatalf("StartRenewing: %v.", err)
+		}
+		sc = fc
+	} else {
+		sc, err = siaclient.New(*siaAddr, &http.Client{})
+		if err != nil {
+			log.Fatalf("siaclient.New: %v.", err)
+		}
 	}
 	if *keyFile == "" {
 		log.Fatalf("Specify -key-file")
@@ -145,7 +193,16 @@ func main() {
 		if err != nil {
 			log.Fatalf("ioutil.ReadFile(%q): %v.", *keyFile, err)
 		}
-		sc, err = crypto.New(key, sc)
+		// Sectors of databases created before the keyring
+		// are encrypted with the key file directly.
+		_, err = os.Stat(mnFile)
+		legacy := !os.IsNotExist(err)
+		keyringFile := filepath.Join(*dataDir, "keyring")
+		dataKey, err := crypto.OpenKeyring(keyringFile, key, legacy)
+		if err != nil {
+			log.Fatalf("crypto.OpenKeyring(%q): %v.", keyringFile, err)
+		}
+		sc, err = crypto.New(dataKey, sc)
 		if err != nil {
 			log.Fatalf("crypto.New: %v.", err)
 		}
@@ -180,28 +237,68 @@ func main() {
 			log.Fatalf("files.New: %v.", err)
 		}
 	}
+	if err := mn.OpenJournal(mnFile + ".journal"); err != nil {
+		log.Fatalf("mn.OpenJournal: %v.", err)
+	}
+	// Data of sectors which are not uploaded yet.
+	if err := mn.OpenSpool(filepath.Join(*dataDir, "spool")); err != nil {
+		log.Fatalf("mn.OpenSpool: %v.", err)
+	}
+	if err := fi.OpenJournal(fiFile + ".journal"); err != nil {
+		log.Fatalf("fi.OpenJournal: %v.", err)
+	}
+	if *blacklist != "" {
+		for _, contract := range strings.Split(*blacklist, ",") {
+			if err := mn.Blacklist(contract); err != nil {
+				log.Fatalf("mn.Blacklist: %v.", err)
+			}
+		}
+	}
+	mn.SetRepairInterval(*repairInterval)
+	mn.SetHedgedReads(*hedgedReads)
+	if err := mn.SetUploadLimits(*maxPending, *maxInFlight, *uploadWait); err != nil {
+		log.Fatalf("mn.SetUploadLimits: %v.", err)
+	}
 	if err := mn.Start(); err != nil {
 		log.Fatalf("manager.Start: %v.", err)
 	}
+	if fc != nil {
+		// Failed challenges are recorded in the contracts history.
+		auditor := client.NewAuditor(fc, mn, 16)
+		if err := auditor.Start(*freestoreAudit); err != nil {
+			log.Fatalf("auditor.Start: %v.", err)
+		}
+	}
 	go func() {
 	begin:
-		time.Sleep(10 * time.Second)
-		data, err := mn.DumpDb()
-		if err != nil {
-			log.Fatalf("mn.DumpDb: %v.", err)
+		time.Sleep(*compactInterval)
+		// Changes between compactions are in the journals.
+		if err := mn.Compact(mnFile); err != nil {
+			log.Fatalf("mn.Compact(%q): %v.", mnFile, err)
 		}
-		if err := ioutil.WriteFile(mnFile, data, 0600); err != nil {
-			log.Fatalf("ioutil.WriteFile(%q, ...): %v.", mnFile, err)
-		}
-		data, err = fi.DumpDb()
-		if err != nil {
-			log.Fatalf("fi.DumpDb: %v.", err)
-		}
-		if err := ioutil.WriteFile(fiFile, data, 0600); err != nil {
-			log.Fatalf("ioutil.WriteFile(%q, ...): %v.", fiFile, err)
+		if err := fi.Compact(fiFile); err != nil {
+			log.Fatalf("fi.Compact(%q): %v.", fiFile, err)
 		}
 		goto begin
 	}()
+	if *gcInterval > 0 {
+		go func() {
+			for {
+				time.Sleep(*gcInterval)
+				if _, err := fi.Collect(); err != nil {
+					log.Printf("fi.Collect: %v.", err)
+					continue
+				}
+				ctx := context.Background()
+				if _, err := mn.Repack(ctx, *repackRatio); err != nil {
+					log.Printf("mn.Repack: %v.", err)
+				}
+				if _, err := mn.Release(ctx); err != nil {
+					log.Printf("mn.Release: %v.", err)
+				}
+			}
+		}()
+	}
 	s := &http.Server{
 		Addr:           *httpAddr,
 		ReadTimeout:    1000 * time.Second,
@@ -0,0 +1,370 @@
+package manager
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/starius/invisiblefs/siaform/managerdb"
+	"golang.org/x/net/context"
+)
+
+// Deleter is implemented by SiaClients which can remove sectors
+// from contracts, so hosts can free their space. Deleting a sector
+// which is not in the contract is not an error. SiaClients wrapping
+// other SiaClients implement it by forwarding the call and do nothing
+// if the wrapped one is not a Deleter: the sector is left in the
+// contract until it expires.
+type Deleter interface {
+	Delete(ctx context.Context, contractID, sectorRoot string) error
+}
+
+// sweep accumulates changes of the db made by Collect and Repack.
+type sweep struct {
+	record   managerdb.Record
+	released []*managerdb.Sector
+	spooled  []int64
+}
+
+// Collect marks data sectors which are not in live as garbage.
+// Sectors which are not in parity sets yet are removed at once.
+// Uploaded parity sets of garbage only are removed together with
+// their parity sectors. It returns the number of garbage sectors
+// found. All sectors being allocated or written concurrently
+// must be in live.
+func (m *Manager) Collect(live map[int64]struct{}) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	s := &sweep{}
+	for i := range m.db.Sectors {
+		if _, has := live[i]; has {
+			continue
+		}
+		if _, has := m.sector2set[i]; has {
+			continue
+		}
+		// Allocated or pending.
+		m.removeSector(i, s)
+		n++
+	}
+	var pending []int64
+	for _, i := range m.db.Pending {
+		if _, has := live[i]; has {
+			pending = append(pending, i)
+		}
+	}
+	if len(pending) != len(m.db.Pending) {
+		s.record.HasPending = true
+		s.record.Pending = pending
+		m.db.Pending = pending
+		m.notifyDrained()
+	}
+	for setIndex, set := range m.db.Sets {
+		garbage := 0
+		for _, i := range set.DataIds {
+			sector := m.db.Sectors[i]
+			if !sector.Garbage {
+				if _, has := live[i]; has {
+					continue
+				}
+				sector.Garbage = true
+				s.record.Sectors = append(s.record.Sectors, &managerdb.SectorUpdate{
+					Id:     i,
+					Sector: sector,
+				})
+				n++
+			}
+			garbage++
+		}
+		if garbage != 0 && garbage == len(set.DataIds) && m.settled(setIndex) {
+			for _, ids := range [][]int64{set.DataIds, set.ParityIds} {
+				for _, i := range ids {
+					m.removeSector(i, s)
+				}
+			}
+			m.clearSet(setIndex, s)
+		}
+	}
+	if err := m.commit(s); err != nil {
+		return 0, err
+	}
+	if n != 0 {
+		log.Printf("Found %d garbage sectors.", n)
+	}
+	return n, nil
+}
+
+// settled returns true if all sectors of the set are uploaded and
+// the set is not being uploaded. Run under m.mu.Lock().
+func (m *Manager) settled(setIndex int) bool {
+	set := m.db.Sets[setIndex]
+	for _, ids := range [][]int64{set.DataIds, set.ParityIds} {
+		for _, i := range ids {
+			if len(m.db.Sectors[i].Contract) == 0 {
+				return false
+			}
+		}
+	}
+	m.uploadingSetsMu.Lock()
+	_, uploading := m.uploadingSets[setIndex]
+	m.uploadingSetsMu.Unlock()
+	return !uploading
+}
+
+// removeSector removes the sector from the db. If it was uploaded,
+// it is released. Run under m.mu.Lock().
+func (m *Manager) removeSector(i int64, s *sweep) {
+	sector := m.db.Sectors[i]
+	delete(m.db.Sectors, i)
+	delete(m.sector2set, i)
+	// m.next is not lowered by reindex if i was the last sector.
+	m.db.Next = m.next
+	s.record.Sectors = append(s.record.Sectors, &managerdb.SectorUpdate{
+		Id:      i,
+		Deleted: true,
+	})
+	m.release(sector, s)
+	if sector.DataSha256 != nil {
+		s.spooled = append(s.spooled, i)
+	}
+}
+
+// release adds the uploaded sector to the released sectors.
+func (m *Manager) release(sector *managerdb.Sector, s *sweep) {
+	if len(sector.Contract) == 0 {
+		return
+	}
+	s.released = append(s.released, &managerdb.Sector{
+		Contract:   sector.Contract,
+		MerkleRoot: sector.MerkleRoot,
+	})
+}
+
+// clearSet replaces the set with an empty set. Indices of sets
+// are not changed. Run under m.mu.Lock().
+func (m *Manager) clearSet(setIndex int, s *sweep) {
+	empty := &managerdb.Set{}
+	m.db.Sets[setIndex] = empty
+	s.record.Sets = append(s.record.Sets, &managerdb.SetUpdate{
+		Index: int32(setIndex),
+		Set:   empty,
+	})
+}
+
+// commit logs the changes. Released sectors are removed from
+// contracts by Release only after the changes are logged.
+// Run under m.mu.Lock().
+func (m *Manager) commit(s *sweep) error {
+	r := &s.record
+	if len(r.Sectors) == 0 && len(r.Sets) == 0 && !r.HasPending {
+		return nil
+	}
+	if len(s.released) != 0 {
+		r.HasReleased = true
+		r.Released = append(append([]*managerdb.Sector{}, m.db.Released...), s.released...)
+	}
+	if err := m.logRecord(r); err != nil {
+		return fmt.Errorf("m.logRecord: %v", err)
+	}
+	if r.HasReleased {
+		m.db.Released = r.Released
+	}
+	for _, i := range s.spooled {
+		m.unspoolSector(i)
+	}
+	return nil
+}
+
+// Repack moves live data sectors of parity sets in which at least
+// ratio of data sectors are garbage to new parity sets and removes
+// the old sets, so their sectors can be released. Live sectors are
+// read and uploaded again keeping their IDs. It returns the number
+// of removed sets. The manager must be started.
+func (m *Manager) Repack(ctx context.Context, ratio float64) (int, error) {
+	var sets []int
+	m.mu.Lock()
+	for setIndex := range m.db.Sets {
+		if m.repackable(setIndex, ratio) {
+			sets = append(sets, setIndex)
+		}
+	}
+	m.mu.Unlock()
+	n := 0
+	for _, setIndex := range sets {
+		repacked, err := m.repackSet(ctx, setIndex, ratio)
+		if err != nil {
+			return n, fmt.Errorf("set %d: %v", setIndex, err)
+		}
+		if repacked {
+			n++
+		}
+	}
+	if n != 0 {
+		log.Printf("Repacked %d parity sets.", n)
+	}
+	return n, nil
+}
+
+// repackable returns true if the set is uploaded and at least ratio
+// of its data sectors are garbage. Run under m.mu.Lock().
+func (m *Manager) repackable(setIndex int, ratio float64) bool {
+	set := m.db.Sets[setIndex]
+	if len(set.DataIds) == 0 || !m.settled(setIndex) {
+		return false
+	}
+	garbage := 0
+	for _, i := range set.DataIds {
+		if m.db.Sectors[i].Garbage {
+			garbage++
+		}
+	}
+	return garbage != 0 && float64(garbage) >= ratio*float64(len(set.DataIds))
+}
+
+func (m *Manager) repackSet(ctx context.Context, setIndex int, ratio float64) (bool, error) {
+	m.mu.Lock()
+	if !m.repackable(setIndex, ratio) {
+		m.mu.Unlock()
+		return false, nil
+	}
+	set := m.db.Sets[setIndex]
+	var ids []int64
+	for _, i := range set.DataIds {
+		if !m.db.Sectors[i].Garbage {
+			ids = append(ids, i)
+		}
+	}
+	m.mu.Unlock()
+	moved := make(map[int64][]byte)
+	for _, i := range ids {
+		data, err := m.ReadSector(ctx, i)
+		if err != nil {
+			return false, fmt.Errorf("m.ReadSector(%d): %v", i, err)
+		}
+		moved[i] = data
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.waitForMemory(ctx); err != nil {
+		return false, err
+	}
+	if m.db.Sets[setIndex] != set || !m.repackable(setIndex, ratio) {
+		// Changed while we were reading it, e.g. repaired.
+		return false, nil
+	}
+	s := &sweep{}
+	pending := m.db.Pending
+	for _, ids := range [][]int64{set.DataIds, set.ParityIds} {
+		for _, i := range ids {
+			data, has := moved[i]
+			if !has {
+				m.removeSector(i, s)
+				continue
+			}
+			// The sector looks like written and not uploaded now.
+			sector := m.db.Sectors[i]
+			m.release(sector, s)
+			sector.Contract = nil
+			sector.MerkleRoot = nil
+			sector.Header = nil
+			sector.Data = data
+			if err := m.spoolSector(i, sector); err != nil {
+				// The data stays in the db.
+				log.Printf("Failed to spool repacked sector %d: %v.", i, err)
+			}
+			delete(m.sector2set, i)
+			pending = append(pending, i)
+			s.record.Sectors = append(s.record.Sectors, &managerdb.SectorUpdate{
+				Id:     i,
+				Sector: sector,
+			})
+		}
+	}
+	m.clearSet(setIndex, s)
+	m.db.Pending = pending
+	s.record.HasPending = true
+	s.record.Pending = pending
+	if err := m.commit(s); err != nil {
+		// The set is repacked again after restart.
+		log.Printf("Failed to log repacked set: %v.", err)
+	}
+	// Form new parity sets if needed.
+	select {
+	case m.dataChan <- struct{}{}:
+	default:
+	}
+	return true, nil
+}
+
+// Release removes released sectors from contracts if the SiaClient
+// is a Deleter. Otherwise hosts free the space when the contracts
+// expire. It returns the number of removed sectors.
+func (m *Manager) Release(ctx context.Context) (int, error) {
+	m.releaseMu.Lock()
+	defer m.releaseMu.Unlock()
+	m.mu.Lock()
+	released := m.db.Released
+	// The same data can be uploaded to the same contract again,
+	// e.g. a repacked sector which is not encrypted.
+	used := make(map[string]struct{})
+	if len(released) != 0 {
+		for _, sector := range m.db.Sectors {
+			if len(sector.Contract) != 0 {
+				used[string(sector.Contract)+string(sector.MerkleRoot)] = struct{}{}
+			}
+		}
+	}
+	m.mu.Unlock()
+	if len(released) == 0 {
+		return 0, nil
+	}
+	n := 0
+	var failed []*managerdb.Sector
+	var lastErr error
+	if d, ok := m.siaclient.(Deleter); ok {
+		ctx1, cancel := context.WithTimeout(ctx, contractsTimeout)
+		contracts, err := m.siaclient.Contracts(ctx1)
+		cancel()
+		if err != nil {
+			return 0, fmt.Errorf("siaclient.Contracts: %v", err)
+		}
+		alive := make(map[string]struct{})
+		for _, contract := range contracts {
+			alive[contract] = struct{}{}
+		}
+		for _, sector := range released {
+			contract := bytes2hex(sector.Contract)
+			if _, has := alive[contract]; !has {
+				// The space was freed with the contract.
+				continue
+			}
+			if _, has := used[string(sector.Contract)+string(sector.MerkleRoot)]; has {
+				continue
+			}
+			ctx1, cancel := context.WithTimeout(ctx, writeTimeout)
+			err := d.Delete(ctx1, contract, bytes2hex(sector.MerkleRoot))
+			cancel()
+			if err != nil {
+				lastErr = fmt.Errorf("siaclient.Delete(%q): %v", contract, err)
+				failed = append(failed, sector)
+				continue
+			}
+			n++
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// Sectors released while we were deleting are kept.
+	rest := append(failed, m.db.Released[len(released):]...)
+	if err := m.logRecord(&managerdb.Record{
+		HasReleased: true,
+		Released:    rest,
+	}); err != nil {
+		return n, fmt.Errorf("m.logRecord: %v", err)
+	}
+	m.db.Released = rest
+	if n != 0 {
+		log.Printf("Removed %d released sectors from contracts.", n)
+	}
+	return n, lastErr
+}
@@ -0,0 +1,254 @@
+package manager
+
+import (
+	"encoding/hex"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/starius/invisiblefs/siaform/managerdb"
+)
+
+const (
+	// Number of read latencies kept per contract.
+	recentReads = 100
+
+	// Number of recent results of each kind of operations from
+	// which the success rates are computed.
+	recentResults = 100
+
+	// Reads slower than this halve the score. Latency only orders
+	// contracts, it does not blacklist them.
+	slowRead = time.Second
+
+	// Score of a contract which has just failed is multiplied by
+	// failurePenalty. The penalty fades out during failureWindow.
+	// It is well above minScore, so a single transient failure of a
+	// healthy contract does not blacklist it: the stable score must
+	// be low too.
+	failurePenalty = 0.5
+	failureWindow  = 10 * time.Minute
+
+	// Contracts scoring below are blacklisted automatically.
+	minScore = 0.1
+
+	// An automatically blacklisted contract is tried again if it
+	// has not failed for this time. A new failure blacklists it
+	// for this time again.
+	probationDelay = time.Hour
+)
+
+// history returns the history of the contract creating it if needed.
+// Run under m.contractsHistoryMu.Lock().
+func (m *Manager) history(contract string) *managerdb.ContractHistory {
+	h, has := m.db.ContractsHistory[contract]
+	if !has {
+		h = &managerdb.ContractHistory{}
+		m.db.ContractsHistory[contract] = h
+	}
+	return h
+}
+
+// successRate returns the share of successful recent operations.
+// A contract without history has rate 1.
+func successRate(failures []bool) float64 {
+	ok := 0
+	for _, failed := range failures {
+		if !failed {
+			ok++
+		}
+	}
+	return float64(ok+1) / float64(len(failures)+1)
+}
+
+// addResult appends the result of an operation to the recent results.
+func addResult(failures []bool, failed bool) []bool {
+	failures = append(failures, failed)
+	if len(failures) > recentResults {
+		failures = failures[len(failures)-recentResults:]
+	}
+	return failures
+}
+
+// readLatency returns the q-quantile of recent read latencies.
+func readLatency(h *managerdb.ContractHistory, q float64) time.Duration {
+	if len(h.RecentReadsMs) == 0 {
+		return 0
+	}
+	ms := append([]int64{}, h.RecentReadsMs...)
+	sort.Slice(ms, func(i, j int) bool { return ms[i] < ms[j] })
+	k := int(math.Ceil(q*float64(len(ms)))) - 1
+	if k < 0 {
+		k = 0
+	}
+	return time.Duration(ms[k]) * time.Millisecond
+}
+
+// reliability returns the product of success rates of recent
+// reads, writes and audits, from 0 (worst) to 1 (best).
+func reliability(h *managerdb.ContractHistory) float64 {
+	if h.Blacklisted {
+		return 0
+	}
+	s := successRate(h.RecentReadFailures)
+	s *= successRate(h.RecentWriteFailures)
+	s *= successRate(h.RecentAuditFailures)
+	return s
+}
+
+// stableScore returns health of the contract from 0 (worst) to 1 (best).
+// It combines reliability and 95th percentile of read latency.
+func stableScore(h *managerdb.ContractHistory) float64 {
+	p95 := readLatency(h, 0.95)
+	return reliability(h) / (1 + p95.Seconds()/slowRead.Seconds())
+}
+
+// sinceFailure returns the time passed since the last failure.
+// It returns false if there was no failure or its time is malformed.
+func sinceFailure(h *managerdb.ContractHistory, now time.Time) (time.Duration, bool) {
+	if h.LastFailure == nil {
+		return 0, false
+	}
+	at, err := ptypes.Timestamp(h.LastFailure)
+	if err != nil {
+		return 0, false
+	}
+	return now.Sub(at), true
+}
+
+// penalty returns the factor lowering the score of a contract
+// which has failed recently.
+func penalty(h *managerdb.ContractHistory, now time.Time) float64 {
+	since, has := sinceFailure(h, now)
+	if !has || since >= failureWindow {
+		return 1
+	}
+	fade := float64(since) / float64(failureWindow)
+	return failurePenalty + (1-failurePenalty)*fade
+}
+
+// score is stableScore lowered if the contract has failed recently.
+func score(h *managerdb.ContractHistory, now time.Time) float64 {
+	return stableScore(h) * penalty(h, now)
+}
+
+// Score returns health of the contract from 0 (worst) to 1 (best).
+func (m *Manager) Score(contract string) float64 {
+	m.contractsHistoryMu.Lock()
+	defer m.contractsHistoryMu.Unlock()
+	h, has := m.db.ContractsHistory[contract]
+	if !has {
+		return score(&managerdb.ContractHistory{}, time.Now())
+	}
+	return score(h, time.Now())
+}
+
+// blacklisted returns true if the contract was blacklisted manually
+// or if its reliability lowered by a recent failure is too low and
+// it is not on probation. Run under m.contractsHistoryMu.Lock().
+func (m *Manager) blacklisted(contract string, now time.Time) bool {
+	h, has := m.db.ContractsHistory[contract]
+	if !has {
+		return false
+	}
+	if h.Blacklisted {
+		return true
+	}
+	if reliability(h)*penalty(h, now) >= minScore {
+		return false
+	}
+	// Without a valid time of the last failure, the contract is
+	// tried again at once.
+	since, has := sinceFailure(h, now)
+	return has && since < probationDelay
+}
+
+// failing returns true if the contract is unreliable not only
+// because of a recent failure. Run under m.contractsHistoryMu.Lock().
+func (m *Manager) failing(contract string) bool {
+	h, has := m.db.ContractsHistory[contract]
+	return has && reliability(h) < minScore
+}
+
+// Blacklist excludes the contract from uploads and reads
+// until Unblacklist is called.
+func (m *Manager) Blacklist(contract string) error {
+	if _, err := hex.DecodeString(contract); err != nil {
+		return fmt.Errorf("bad contract %q: %v", contract, err)
+	}
+	m.contractsHistoryMu.Lock()
+	defer m.contractsHistoryMu.Unlock()
+	m.history(contract).Blacklisted = true
+	return nil
+}
+
+// Unblacklist undoes Blacklist. The contract may still be
+// blacklisted automatically because of its score.
+func (m *Manager) Unblacklist(contract string) error {
+	m.contractsHistoryMu.Lock()
+	defer m.contractsHistoryMu.Unlock()
+	h, has := m.db.ContractsHistory[contract]
+	if !has || !h.Blacklisted {
+		return fmt.Errorf("contract %q is not blacklisted", contract)
+	}
+	h.Blacklisted = false
+	return nil
+}
+
+// recordRead stores the result of reading from the contract.
+// Run under m.contractsHistoryMu.Lock().
+func (m *Manager) recordRead(contract string, latency time.Duration, readErr error) {
+	h := m.history(contract)
+	h.ReadsNumber++
+	h.RecentReadFailures = addResult(h.RecentReadFailures, readErr != nil)
+	if readErr != nil {
+		h.ReadsFailures++
+		markFailure(h)
+		return
+	}
+	ms := latency.Nanoseconds() / 1e6
+	h.ReadsTotalMs += ms
+	h.RecentReadsMs = append(h.RecentReadsMs, ms)
+	if len(h.RecentReadsMs) > recentReads {
+		h.RecentReadsMs = h.RecentReadsMs[len(h.RecentReadsMs)-recentReads:]
+	}
+}
+
+// recordRangeRead stores the result of reading a part of a sector.
+// Its latency is not comparable with latencies of full reads.
+// Run under m.contractsHistoryMu.Lock().
+func (m *Manager) recordRangeRead(contract string, readErr error) {
+	h := m.history(contract)
+	h.ReadsNumber++
+	h.RecentReadFailures = addResult(h.RecentReadFailures, readErr != nil)
+	if readErr != nil {
+		h.ReadsFailures++
+		markFailure(h)
+	}
+}
+
+// recordWrite stores the result of writing to the contract.
+// Run under m.contractsHistoryMu.Lock().
+func (m *Manager) recordWrite(contract string, writeErr error) {
+	h := m.history(contract)
+	h.WritesNumber++
+	h.RecentWriteFailures = addResult(h.RecentWriteFailures, writeErr != nil)
+	if writeErr != nil {
+		h.WritesFailures++
+		markFailure(h)
+	}
+}
+
+// markFailure sets the time of the last failure. If the time can not
+// be stored, only the success rates reflect the failure.
+func markFailure(h *managerdb.ContractHistory) {
+	lastFailure, err := ptypes.TimestampProto(time.Now())
+	if err != nil {
+		log.Printf("ptypes.TimestampProto: %v.", err)
+		return
+	}
+	h.LastFailure = lastFailure
+}
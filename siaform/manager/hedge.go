@@ -0,0 +1,104 @@
+package manager
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// SetHedgedReads enables or disables hedged reads. If the contract
+// of a sector is slower than its 95th percentile of read latency,
+// a hedged read also recovers the sector from other sectors of its
+// parity set and returns whichever finishes first. Call it before Start.
+func (m *Manager) SetHedgedReads(enabled bool) {
+	m.hedgedReads = enabled
+}
+
+// hedgeDelay returns the time after which the read from the contract
+// is hedged. It returns false if the contract has no read history.
+func (m *Manager) hedgeDelay(contract string) (time.Duration, bool) {
+	m.contractsHistoryMu.Lock()
+	defer m.contractsHistoryMu.Unlock()
+	h, has := m.db.ContractsHistory[contract]
+	if !has || len(h.RecentReadsMs) == 0 {
+		return 0, false
+	}
+	return readLatency(h, 0.95), true
+}
+
+type readResult struct {
+	data []byte
+	err  error
+}
+
+func (m *Manager) hedgedRead(ctx context.Context, i int64, contract, sectorRoot string, header []byte) ([]byte, error) {
+	// The primary read is canceled if the hedge wins, so the slow
+	// contract is not downloaded from in vain.
+	primaryCtx, cancelPrimary := context.WithCancel(ctx)
+	defer cancelPrimary()
+	t1 := time.Now()
+	primary := make(chan readResult, 1)
+	go func() {
+		data, err := m.load(primaryCtx, i, contract, sectorRoot, header)
+		primary <- readResult{data, err}
+	}()
+	var slow <-chan time.Time
+	if delay, has := m.hedgeDelay(contract); has {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		slow = timer.C
+	}
+	select {
+	case <-m.stopChan:
+		return nil, fmt.Errorf("The manager was stopped")
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case r := <-primary:
+		if r.err == nil {
+			return r.data, nil
+		}
+		log.Printf("Sector %d is broken - recovering", i)
+		return m.recoverData(ctx, i, nil)
+	case <-slow:
+	}
+	log.Printf("Contract of sector %d is slow - recovering in parallel", i)
+	// The recovery is canceled if the primary read wins.
+	hedgeCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	hedge := make(chan readResult, 1)
+	go func() {
+		data, err := m.recoverData(hedgeCtx, i, map[int64]struct{}{i: {}})
+		hedge <- readResult{data, err}
+	}()
+	var errs []error
+	for primary != nil || hedge != nil {
+		select {
+		case <-m.stopChan:
+			return nil, fmt.Errorf("The manager was stopped")
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case r := <-primary:
+			if r.err == nil {
+				return r.data, nil
+			}
+			errs = append(errs, r.err)
+			primary = nil
+		case r := <-hedge:
+			if r.err == nil {
+				if primary != nil {
+					// The canceled read is not recorded by load.
+					// Its latency is at least the time elapsed.
+					m.contractsHistoryMu.Lock()
+					m.recordRead(contract, time.Since(t1), nil)
+					m.contractsHistoryMu.Unlock()
+				}
+				return r.data, nil
+			}
+			errs = append(errs, r.err)
+			hedge = nil
+		}
+	}
+	return nil, fmt.Errorf("failed to read sector %d: %v", i, errs)
+}
@@ -0,0 +1,115 @@
+package manager
+
+import (
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/starius/invisiblefs/atomicfile"
+	"github.com/starius/invisiblefs/siaform/journal"
+	"github.com/starius/invisiblefs/siaform/managerdb"
+)
+
+// OpenJournal applies changes logged to the journal after the
+// snapshot the manager was loaded from and logs further changes of
+// sectors and sets to it. Call it before Start.
+func (m *Manager) OpenJournal(fname string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, err := journal.Open(fname, m.db.JournalSeq, m.applyRecord)
+	if err != nil {
+		return fmt.Errorf("journal.Open: %v", err)
+	}
+	m.journal = j
+	m.reindex()
+	return nil
+}
+
+// applyRecord applies a record of the journal to the db.
+// Run under m.mu.Lock().
+func (m *Manager) applyRecord(data []byte) error {
+	record := &managerdb.Record{}
+	if err := proto.Unmarshal(data, record); err != nil {
+		return fmt.Errorf("proto.Unmarshal: %v", err)
+	}
+	for _, u := range record.Sectors {
+		if u.Deleted {
+			delete(m.db.Sectors, u.Id)
+			if u.Id >= m.db.Next {
+				m.db.Next = u.Id + 1
+			}
+			continue
+		}
+		sector := u.Sector
+		if sector == nil {
+			sector = &managerdb.Sector{}
+		}
+		m.db.Sectors[u.Id] = sector
+	}
+	for _, u := range record.Sets {
+		set := u.Set
+		if set == nil {
+			set = &managerdb.Set{}
+		}
+		index := int(u.Index)
+		if index < len(m.db.Sets) {
+			m.db.Sets[index] = set
+		} else if index == len(m.db.Sets) {
+			m.db.Sets = append(m.db.Sets, set)
+		} else {
+			return fmt.Errorf("set %d added after %d sets", index, len(m.db.Sets))
+		}
+	}
+	if record.HasPending {
+		m.db.Pending = record.Pending
+	}
+	if record.HasReleased {
+		m.db.Released = record.Released
+	}
+	return nil
+}
+
+// logRecord appends the record to the journal if it is open.
+// Run under m.mu.Lock().
+func (m *Manager) logRecord(record *managerdb.Record) error {
+	if m.journal == nil {
+		return nil
+	}
+	for _, u := range record.Sectors {
+		if u.Sector != nil {
+			u.Sector = withoutData(u.Sector)
+		}
+	}
+	data, err := proto.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("proto.Marshal: %v", err)
+	}
+	if err := m.journal.Append(data); err != nil {
+		return fmt.Errorf("journal.Append: %v", err)
+	}
+	return nil
+}
+
+// Compact writes the snapshot of the db to fname and clears the
+// journal. The snapshot is replaced atomically.
+func (m *Manager) Compact(fname string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.contractsHistoryMu.Lock()
+	defer m.contractsHistoryMu.Unlock()
+	if m.journal != nil {
+		m.db.JournalSeq = m.journal.Seq()
+	}
+	zdump, err := m.DumpDb()
+	if err != nil {
+		return fmt.Errorf("m.DumpDb: %v", err)
+	}
+	if err := atomicfile.WriteFile(fname, zdump); err != nil {
+		return fmt.Errorf("atomicfile.WriteFile: %v", err)
+	}
+	if m.journal != nil {
+		if err := m.journal.Reset(); err != nil {
+			return fmt.Errorf("journal.Reset: %v", err)
+		}
+	}
+	return nil
+}
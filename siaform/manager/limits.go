@@ -0,0 +1,88 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// ErrOverloaded is returned by WriteSector and AddSector if too much
+// data waits for uploading. Retry later.
+var ErrOverloaded = errors.New("too much data waits for uploading")
+
+// SetUploadLimits limits data kept in memory until it is uploaded.
+// maxPending limits data sectors not included in parity sets yet,
+// maxInFlight limits sectors of parity sets being uploaded (including
+// parity sectors). It is a soft limit: a parity set is formed even
+// if it exceeds it. WriteSector waits up to wait for the data to
+// drain and returns ErrOverloaded. Zero disables a limit.
+// Call it before Start.
+func (m *Manager) SetUploadLimits(maxPending, maxInFlight int64, wait time.Duration) error {
+	if maxPending != 0 && maxPending < int64(m.ndata*m.sectorSize) {
+		return fmt.Errorf("maxPending (%d) must fit a parity set (%d)", maxPending, m.ndata*m.sectorSize)
+	}
+	m.maxPending = maxPending
+	m.maxInFlight = maxInFlight
+	m.uploadWait = wait
+	return nil
+}
+
+// overloaded returns true if the limits do not allow to add a sector.
+// Run under m.mu.Lock().
+func (m *Manager) overloaded() bool {
+	size := int64(m.sectorSize)
+	pending := int64(len(m.db.Pending)) * size
+	inFlight := m.inFlight * size
+	return (m.maxPending != 0 && pending >= m.maxPending) ||
+		(m.maxInFlight != 0 && inFlight >= m.maxInFlight)
+}
+
+// waitForMemory waits until the limits allow to add a sector.
+// Run under m.mu.Lock(). The mutex is unlocked while waiting.
+func (m *Manager) waitForMemory(ctx context.Context) error {
+	var timeout <-chan time.Time
+	for m.overloaded() {
+		if timeout == nil {
+			if m.uploadWait == 0 {
+				return ErrOverloaded
+			}
+			timer := time.NewTimer(m.uploadWait)
+			defer timer.Stop()
+			timeout = timer.C
+		}
+		drained := m.drained
+		m.mu.Unlock()
+		select {
+		case <-drained:
+		case <-timeout:
+			m.mu.Lock()
+			return ErrOverloaded
+		case <-m.stopChan:
+			m.mu.Lock()
+			return fmt.Errorf("The manager was stopped")
+		case <-ctx.Done():
+			m.mu.Lock()
+			return ctx.Err()
+		}
+		m.mu.Lock()
+	}
+	return nil
+}
+
+// WaitForMemory waits until the limits allow to add a sector or
+// returns ErrOverloaded, like WriteSector does. Use it to wait
+// without holding locks of the caller.
+func (m *Manager) WaitForMemory(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.waitForMemory(ctx)
+}
+
+// notifyDrained wakes up writers waiting in waitForMemory.
+// Run under m.mu.Lock().
+func (m *Manager) notifyDrained() {
+	close(m.drained)
+	m.drained = make(chan struct{})
+}
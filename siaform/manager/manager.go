@@ -11,10 +11,19 @@ import (
 	"time"
 
 	"github.com/golang/protobuf/proto"
-	"github.com/golang/protobuf/ptypes"
 	"github.com/klauspost/reedsolomon"
 	"github.com/starius/invisiblefs/gzip"
+	"github.com/starius/invisiblefs/merkle"
+	"github.com/starius/invisiblefs/siaform/journal"
 	"github.com/starius/invisiblefs/siaform/managerdb"
+	"golang.org/x/net/context"
+)
+
+const (
+	// Deadlines of operations of SiaClient.
+	readTimeout      = time.Minute
+	writeTimeout     = 5 * time.Minute
+	contractsTimeout = time.Minute
 )
 
 func hex2bytes(data string) []byte {
@@ -30,16 +39,27 @@ func bytes2hex(data []byte) string {
 }
 
 type SiaClient interface {
-	Contracts() ([]string, error)
-	Read(contractID, sectorRoot string, sectorID int64) ([]byte, error)
-	Write(contractID string, data []byte, sectorID int64) (string, error)
+	Contracts(ctx context.Context) ([]string, error)
+	Read(ctx context.Context, contractID, sectorRoot string, sectorID int64) ([]byte, error)
+	// ReadAt reads length bytes of the sector starting from offset.
+	ReadAt(ctx context.Context, contractID, sectorRoot string, sectorID int64, offset, length int) ([]byte, error)
+	Write(ctx context.Context, contractID string, data []byte, sectorID int64) (string, error)
+}
+
+// Transformer is implemented by SiaClient wrappers which change data
+// before passing it to their backends, e.g. encrypt it. Transform
+// returns the data as it is stored by hosts.
+type Transformer interface {
+	Transform(data []byte, sectorID int64) []byte
 }
 
 type Manager struct {
 	db         *managerdb.Db
 	next       int64
 	sector2set map[int64]int
-	mu         sync.Mutex // db.Sectors, db.Sets, db.Pending.
+	mu         sync.Mutex // db.Sectors, db.Sets, db.Pending, journal.
+	journal    *journal.Journal
+	spoolDir   string
 
 	siaclient SiaClient
 
@@ -52,11 +72,25 @@ type Manager struct {
 	stopChan chan struct{}
 	finChan  chan struct{}
 
+	// Context of background uploads. It is canceled by Stop.
+	ctx    context.Context
+	cancel context.CancelFunc
+
 	uploadingSectors   map[int64]struct{}
 	uploadingSectorsMu sync.Mutex
 
 	uploadingSets   map[int]struct{}
 	uploadingSetsMu sync.Mutex
+
+	repairInterval time.Duration
+	hedgedReads    bool
+
+	releaseMu sync.Mutex // Serializes Release.
+
+	maxPending, maxInFlight int64
+	uploadWait              time.Duration
+	inFlight                int64         // Sectors of sets not uploaded yet.
+	drained                 chan struct{} // Closed when data is drained.
 }
 
 func New(ndata, nparity, sectorSize int, sc SiaClient) (*Manager, error) {
@@ -67,6 +101,7 @@ func New(ndata, nparity, sectorSize int, sc SiaClient) (*Manager, error) {
 		SectorSize:       int32(sectorSize),
 		ContractsHistory: make(map[string]*managerdb.ContractHistory),
 	}
+	ctx, cancel := context.WithCancel(context.Background())
 	return &Manager{
 		db:               db,
 		next:             1,
@@ -81,6 +116,9 @@ func New(ndata, nparity, sectorSize int, sc SiaClient) (*Manager, error) {
 		finChan:          make(chan struct{}),
 		uploadingSectors: make(map[int64]struct{}),
 		uploadingSets:    make(map[int]struct{}),
+		drained:          make(chan struct{}),
+		ctx:              ctx,
+		cancel:           cancel,
 	}, nil
 }
 
@@ -93,6 +131,7 @@ func Load(zdump []byte, sc SiaClient) (*Manager, error) {
 	if err := proto.Unmarshal(dump, db); err != nil {
 		return nil, fmt.Errorf("proto.Unmarshal(dump, db): %v", err)
 	}
+	ctx, cancel := context.WithCancel(context.Background())
 	m := &Manager{
 		db:               db,
 		siaclient:        sc,
@@ -106,6 +145,9 @@ func Load(zdump []byte, sc SiaClient) (*Manager, error) {
 		sectorSize:       int(db.SectorSize),
 		uploadingSectors: make(map[int64]struct{}),
 		uploadingSets:    make(map[int]struct{}),
+		drained:          make(chan struct{}),
+		ctx:              ctx,
+		cancel:           cancel,
 	}
 	if m.db.Sectors == nil {
 		m.db.Sectors = make(map[int64]*managerdb.Sector)
@@ -113,6 +155,12 @@ func Load(zdump []byte, sc SiaClient) (*Manager, error) {
 	if m.db.ContractsHistory == nil {
 		m.db.ContractsHistory = make(map[string]*managerdb.ContractHistory)
 	}
+	m.reindex()
+	return m, nil
+}
+
+// reindex restores m.next, m.sector2set and m.inFlight from the db.
+func (m *Manager) reindex() {
 	maxI := int64(0)
 	for i := range m.db.Sectors {
 		if i > maxI {
@@ -120,6 +168,11 @@ func Load(zdump []byte, sc SiaClient) (*Manager, error) {
 		}
 	}
 	m.next = maxI + 1
+	if m.db.Next > m.next {
+		// The last sectors were removed.
+		m.next = m.db.Next
+	}
+	m.sector2set = make(map[int64]int)
 	for j, set := range m.db.Sets {
 		for _, i := range set.DataIds {
 			m.sector2set[i] = j
@@ -128,11 +181,22 @@ func Load(zdump []byte, sc SiaClient) (*Manager, error) {
 			m.sector2set[i] = j
 		}
 	}
-	return m, nil
+	m.inFlight = 0
+	for i := range m.sector2set {
+		if len(m.db.Sectors[i].Contract) == 0 {
+			m.inFlight++
+		}
+	}
 }
 
 func (m *Manager) DumpDb() ([]byte, error) {
-	dump, err := proto.Marshal(m.db)
+	db := *m.db
+	db.Next = m.next
+	db.Sectors = make(map[int64]*managerdb.Sector, len(m.db.Sectors))
+	for i, sector := range m.db.Sectors {
+		db.Sectors[i] = withoutData(sector)
+	}
+	dump, err := proto.Marshal(&db)
 	if err != nil {
 		return nil, fmt.Errorf("proto.Marshal: %v", err)
 	}
@@ -143,43 +207,76 @@ func (m *Manager) DumpDb() ([]byte, error) {
 	return zdump, nil
 }
 
-func (m *Manager) getSector(i int64) (string, string, []byte, error) {
+func (m *Manager) getSector(i int64) (string, string, []byte, []byte, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	sector, has := m.db.Sectors[i]
 	if !has {
-		return "", "", nil, fmt.Errorf("No such sector: %d", i)
+		return "", "", nil, nil, fmt.Errorf("No such sector: %d", i)
 	}
-	return bytes2hex(sector.Contract), bytes2hex(sector.MerkleRoot), sector.Data, nil
+	return bytes2hex(sector.Contract), bytes2hex(sector.MerkleRoot), sector.Header, sector.Data, nil
 }
 
-func (m *Manager) load(i int64, contract, sectorRoot string) ([]byte, error) {
+func (m *Manager) load(ctx context.Context, i int64, contract, sectorRoot string, header []byte) ([]byte, error) {
 	log.Printf("Loading data from contract %s", contract)
-	if contract == "84e570089934203463967a7bf8b55b37664f597dc1004cb20f526d87259fecda" {
-		return nil, fmt.Errorf("test error")
-	}
+	ctx1, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
 	t1 := time.Now()
-	data, err := m.siaclient.Read(contract, sectorRoot, i)
+	data, err := m.read(ctx1, contract, sectorRoot, i, header)
 	latency := time.Since(t1)
-	m.contractsHistoryMu.Lock()
-	h, has := m.db.ContractsHistory[contract]
-	if !has {
-		h = &managerdb.ContractHistory{}
-		m.db.ContractsHistory[contract] = h
+	if ctx.Err() != nil {
+		// Not a fault of the contract.
+		return nil, ctx.Err()
+	}
+	if err == nil && len(data) != m.sectorSize {
+		err = fmt.Errorf("Bad data length: %d. Want %d", len(data), m.sectorSize)
 	}
-	h.ReadsTotalMs += latency.Nanoseconds() / 1e6
-	h.ReadsNumber++
+	if err == nil {
+		err = m.checkRoot(i, data, sectorRoot, header)
+	}
+	m.contractsHistoryMu.Lock()
+	m.recordRead(contract, latency, err)
 	m.contractsHistoryMu.Unlock()
-	if len(data) != m.sectorSize {
-		return nil, fmt.Errorf("Bad data length: %d. Want %d", len(data), m.sectorSize)
+	if err != nil {
+		return nil, err
 	}
-	return data, err
+	return data, nil
+}
+
+// checkRoot compares the Merkle root of the sector as it is stored
+// by the host with sectorRoot.
+func (m *Manager) checkRoot(i int64, data []byte, sectorRoot string, header []byte) error {
+	stored, err := m.transform(data, i, header)
+	if err != nil {
+		return fmt.Errorf("sector %d: %v", i, err)
+	}
+	root := bytes2hex(merkle.Root(stored))
+	if root != sectorRoot {
+		return fmt.Errorf("Merkle root of sector %d is %s, want %s", i, root, sectorRoot)
+	}
+	return nil
+}
+
+// ReportAudit records the result of a proof-of-storage challenge
+// of the contract.
+func (m *Manager) ReportAudit(contract string, auditErr error) {
+	m.contractsHistoryMu.Lock()
+	defer m.contractsHistoryMu.Unlock()
+	h := m.history(contract)
+	h.AuditsNumber++
+	h.RecentAuditFailures = addResult(h.RecentAuditFailures, auditErr != nil)
+	if auditErr == nil {
+		return
+	}
+	h.AuditsFailures++
+	markFailure(h)
 }
 
 type sectorData struct {
 	id         int64
 	contract   string
 	merkleRoot string
+	header     []byte
 	data       []byte
 }
 
@@ -188,7 +285,7 @@ type event struct {
 	data []byte
 }
 
-func (m *Manager) recoverData(i int64) ([]byte, error) {
+func (m *Manager) recoverData(ctx context.Context, i int64, skip map[int64]struct{}) ([]byte, error) {
 	m.mu.Lock()
 	_, has := m.db.Sectors[i]
 	if !has {
@@ -200,29 +297,80 @@ func (m *Manager) recoverData(i int64) ([]byte, error) {
 		m.mu.Unlock()
 		return nil, fmt.Errorf("sector %d not in set", i)
 	}
+	m.mu.Unlock()
+	ids, datas, err := m.reconstructSet(ctx, setIndex, skip)
+	if err != nil {
+		return nil, fmt.Errorf("sector %d: %v", i, err)
+	}
+	thisJ := -1
+	for j, id := range ids {
+		if id == i {
+			thisJ = j
+		}
+	}
+	if thisJ == -1 {
+		panic("discrepancy: the sector must be in the set")
+	}
+	log.Printf("Recovered sector %d", i)
+	return datas[thisJ], nil
+}
+
+// reconstructSet loads enough sectors of the parity set and rebuilds
+// the rest with Reed-Solomon. Sectors from skip are not loaded.
+// It returns ids of all sectors of the set and their data.
+func (m *Manager) reconstructSet(ctx context.Context, setIndex int, skip map[int64]struct{}) ([]int64, [][]byte, error) {
+	m.mu.Lock()
 	set := m.db.Sets[setIndex]
 	group := []sectorData{}
-	all := append(set.DataIds, set.ParityIds...)
+	all := append(append([]int64{}, set.DataIds...), set.ParityIds...)
 	for _, si := range all {
 		sector := m.db.Sectors[si]
 		group = append(group, sectorData{
 			id:         si,
 			contract:   bytes2hex(sector.Contract),
 			merkleRoot: bytes2hex(sector.MerkleRoot),
+			header:     sector.Header,
 			data:       sector.Data,
 		})
 	}
 	ndata := len(set.DataIds)
 	nparity := len(set.ParityIds)
 	m.mu.Unlock()
+	// Don't load from blacklisted contracts if possible.
+	var bad []int64
+	now := time.Now()
+	m.contractsHistoryMu.Lock()
+	for _, s := range group {
+		if s.data == nil && m.blacklisted(s.contract, now) {
+			bad = append(bad, s.id)
+		}
+	}
+	m.contractsHistoryMu.Unlock()
+	if len(group)-len(skip)-len(bad) >= ndata {
+		skip0 := skip
+		skip = make(map[int64]struct{})
+		for si := range skip0 {
+			skip[si] = struct{}{}
+		}
+		for _, si := range bad {
+			skip[si] = struct{}{}
+		}
+	}
+	// Loads which are not needed anymore are canceled on return.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 	events := make(chan event, ndata+nparity)
 	for j, s := range group {
 		if s.data != nil {
 			events <- event{j, s.data}
 			continue
 		}
+		if _, has := skip[s.id]; has {
+			events <- event{j, nil}
+			continue
+		}
 		go func(j int, s sectorData) {
-			data, err := m.load(s.id, s.contract, s.merkleRoot)
+			data, err := m.load(ctx, s.id, s.contract, s.merkleRoot, s.header)
 			if err == nil {
 				events <- event{j, data}
 			} else {
@@ -237,7 +385,9 @@ func (m *Manager) recoverData(i int64) ([]byte, error) {
 		var e event
 		select {
 		case <-m.stopChan:
-			return nil, fmt.Errorf("The manager was stopped")
+			return nil, nil, fmt.Errorf("The manager was stopped")
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
 		case e = <-events:
 		}
 		if e.data == nil {
@@ -250,31 +400,21 @@ func (m *Manager) recoverData(i int64) ([]byte, error) {
 		}
 	}
 	if known < ndata {
-		return nil, fmt.Errorf("not enough data to recover sector %d", i)
+		return nil, nil, fmt.Errorf("not enough data to recover set %d", setIndex)
 	}
 	rs, err := reedsolomon.New(ndata, nparity)
 	if err != nil {
-		return nil, fmt.Errorf("reedsolomon.New: %v", err)
+		return nil, nil, fmt.Errorf("reedsolomon.New: %v", err)
 	}
 	if err := rs.Reconstruct(datas); err != nil {
-		return nil, fmt.Errorf("rs.Reconstruct: %v", err)
-	}
-	thisJ := -1
-	for j, s := range group {
-		if s.id == i {
-			thisJ = j
-		}
-	}
-	if thisJ == -1 {
-		panic("discrepancy: the sector must be in the set")
+		return nil, nil, fmt.Errorf("rs.Reconstruct: %v", err)
 	}
-	log.Printf("Recovered sector %d", i)
-	return datas[thisJ], nil
+	return all, datas, nil
 }
 
-func (m *Manager) ReadSector(i int64) ([]byte, error) {
+func (m *Manager) ReadSector(ctx context.Context, i int64) ([]byte, error) {
 	log.Printf("Reading sector %d", i)
-	contract, sectorRoot, data, err := m.getSector(i)
+	contract, sectorRoot, header, data, err := m.getSector(i)
 	if err != nil {
 		return nil, err
 	}
@@ -282,32 +422,79 @@ func (m *Manager) ReadSector(i int64) ([]byte, error) {
 		log.Printf("Sector %d is found in memory", i)
 		return data, nil
 	}
-	data, err = m.load(i, contract, sectorRoot)
+	m.contractsHistoryMu.Lock()
+	bad := m.blacklisted(contract, time.Now())
+	m.contractsHistoryMu.Unlock()
+	if bad {
+		log.Printf("Contract of sector %d is blacklisted - recovering", i)
+		return m.recoverData(ctx, i, nil)
+	}
+	if m.hedgedReads {
+		return m.hedgedRead(ctx, i, contract, sectorRoot, header)
+	}
+	data, err = m.load(ctx, i, contract, sectorRoot, header)
 	if err == nil {
 		return data, nil
+	} else if ctx.Err() != nil {
+		return nil, err
 	}
 	log.Printf("Sector %d is broken - recovering", i)
-	return m.recoverData(i)
+	return m.recoverData(ctx, i, nil)
 }
 
-func (m *Manager) InsecureReadSectorAt(i int64, offset, length int) ([]byte, error) {
+func (m *Manager) InsecureReadSectorAt(ctx context.Context, i int64, offset, length int) ([]byte, error) {
 	if offset < 0 || length < 0 || offset+length > m.sectorSize {
 		return nil, fmt.Errorf("Bad range: [%d,%d)", offset, offset+length)
 	}
-	// TODO: read only needed part.
-	data, err := m.ReadSector(i)
+	contract, sectorRoot, header, data, err := m.getSector(i)
+	if err != nil {
+		return nil, err
+	}
+	if data != nil {
+		return data[offset : offset+length], nil
+	}
+	m.contractsHistoryMu.Lock()
+	bad := m.blacklisted(contract, time.Now())
+	m.contractsHistoryMu.Unlock()
+	if !bad {
+		ctx1, cancel := context.WithTimeout(ctx, readTimeout)
+		part, err := m.readAt(ctx1, contract, sectorRoot, i, header, offset, length)
+		cancel()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err == nil && len(part) != length {
+			err = fmt.Errorf("Bad data length: %d. Want %d", len(part), length)
+		}
+		m.contractsHistoryMu.Lock()
+		m.recordRangeRead(contract, err)
+		m.contractsHistoryMu.Unlock()
+		if err == nil {
+			return part, nil
+		}
+		log.Printf("Failed to read part of sector %d: %v", i, err)
+	}
+	data, err = m.ReadSector(ctx, i)
 	if err != nil {
 		return nil, err
 	}
 	return data[offset : offset+length], nil
 }
 
-func (m *Manager) AddSector(data []byte) (int64, error) {
+func (m *Manager) AddSector(ctx context.Context, data []byte) (int64, error) {
+	// Do not allocate sectors for writes which are rejected.
+	if err := m.WaitForMemory(ctx); err != nil {
+		return 0, err
+	}
 	i, err := m.AllocateSector()
 	if err != nil {
 		return 0, fmt.Errorf("m.AllocateSector: %v", err)
 	}
-	if err := m.WriteSector(i, data); err != nil {
+	if err := m.WriteSector(ctx, i, data); err != nil {
+		m.freeSector(i)
+		if err == ErrOverloaded {
+			return 0, err
+		}
 		return 0, fmt.Errorf("m.WriteSector(%d): %v", i, err)
 	}
 	return i, nil
@@ -317,17 +504,60 @@ func (m *Manager) AllocateSector() (int64, error) {
 	m.mu.Lock()
 	i := m.next
 	m.next++
-	m.db.Sectors[i] = &managerdb.Sector{}
+	sector := &managerdb.Sector{}
+	m.db.Sectors[i] = sector
+	err := m.logRecord(&managerdb.Record{
+		Sectors: []*managerdb.SectorUpdate{{Id: i, Sector: sector}},
+	})
 	m.mu.Unlock()
+	if err != nil {
+		return 0, fmt.Errorf("m.logRecord: %v", err)
+	}
 	log.Printf("Allocated sector %d", i)
 	return i, nil
 }
 
-func (m *Manager) WriteSector(i int64, data []byte) error {
+// freeSector removes the allocated sector which was not written.
+func (m *Manager) freeSector(i int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sector, has := m.db.Sectors[i]
+	if !has || len(sector.Data) != 0 || len(sector.Contract) != 0 {
+		return
+	}
+	delete(m.db.Sectors, i)
+	m.db.Next = m.next
+	if err := m.logRecord(&managerdb.Record{
+		Sectors: []*managerdb.SectorUpdate{{Id: i, Deleted: true}},
+	}); err != nil {
+		// Collect removes it later.
+		log.Printf("Failed to log removal of sector %d: %v.", i, err)
+	}
+}
+
+func (m *Manager) WriteSector(ctx context.Context, i int64, data []byte) error {
+	return m.writeSector(ctx, i, data, true)
+}
+
+// TryWriteSector is like WriteSector but returns ErrOverloaded at
+// once instead of waiting for memory. Use it under locks of the
+// caller and wait with WaitForMemory after releasing them.
+func (m *Manager) TryWriteSector(ctx context.Context, i int64, data []byte) error {
+	return m.writeSector(ctx, i, data, false)
+}
+
+func (m *Manager) writeSector(ctx context.Context, i int64, data []byte, wait bool) error {
 	if len(data) != m.sectorSize {
 		return fmt.Errorf("data length is %d", len(data))
 	}
 	m.mu.Lock()
+	if !wait && m.overloaded() {
+		m.mu.Unlock()
+		return ErrOverloaded
+	} else if err := m.waitForMemory(ctx); err != nil {
+		m.mu.Unlock()
+		return err
+	}
 	sector, has := m.db.Sectors[i]
 	if !has {
 		m.mu.Unlock()
@@ -337,8 +567,24 @@ func (m *Manager) WriteSector(i int64, data []byte) error {
 		m.mu.Unlock()
 		return fmt.Errorf("sector %d is not empty", i)
 	}
+	// The data is durable when WriteSector returns.
+	written := &managerdb.Sector{Data: data}
+	if err := m.spoolSector(i, written); err != nil {
+		m.mu.Unlock()
+		return fmt.Errorf("m.spoolSector: %v", err)
+	}
+	pending := append(m.db.Pending, i)
+	if err := m.logRecord(&managerdb.Record{
+		Sectors:    []*managerdb.SectorUpdate{{Id: i, Sector: written}},
+		HasPending: true,
+		Pending:    pending,
+	}); err != nil {
+		m.mu.Unlock()
+		return fmt.Errorf("m.logRecord: %v", err)
+	}
 	sector.Data = data
-	m.db.Pending = append(m.db.Pending, i)
+	sector.DataSha256 = written.DataSha256
+	m.db.Pending = pending
 	m.mu.Unlock()
 	log.Printf("Filled sector with data: %d", i)
 	m.dataChan <- struct{}{}
@@ -374,6 +620,13 @@ func (m *Manager) Start() error {
 			}
 		}
 	}()
+	if m.repairInterval > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.repairLoop()
+		}()
+	}
 	go func() {
 		wg.Wait()
 		// Ingest all data from channels to unblock goroutines.
@@ -393,6 +646,7 @@ func (m *Manager) Start() error {
 
 func (m *Manager) Stop() error {
 	close(m.stopChan)
+	m.cancel()
 	<-m.finChan
 	return nil
 }
@@ -497,6 +751,28 @@ func (m *Manager) formParitySet() int {
 	for _, si := range set.ParityIds {
 		m.sector2set[si] = setIndex
 	}
+	m.inFlight += int64(len(set.DataIds) + len(set.ParityIds))
+	m.notifyDrained()
+	record := &managerdb.Record{
+		Sets:       []*managerdb.SetUpdate{{Index: int32(setIndex), Set: set}},
+		HasPending: true,
+		Pending:    m.db.Pending,
+	}
+	for _, si := range set.ParityIds {
+		sector := m.db.Sectors[si]
+		if err := m.spoolSector(si, sector); err != nil {
+			// The data stays in the db.
+			log.Printf("Failed to spool parity sector %d: %v.", si, err)
+		}
+		record.Sectors = append(record.Sectors, &managerdb.SectorUpdate{
+			Id:     si,
+			Sector: sector,
+		})
+	}
+	if err := m.logRecord(record); err != nil {
+		// The data sectors are still in the journal.
+		log.Printf("Failed to log parity set: %v.", err)
+	}
 	log.Printf("Formed parity set.")
 	return setIndex
 }
@@ -571,47 +847,36 @@ func (m *Manager) uploadSet(setIndex int) error {
 		}
 		paritySectors = append(paritySectors, is)
 	}
-	contracts, err := m.siaclient.Contracts()
+	ctx, cancel := context.WithTimeout(m.ctx, contractsTimeout)
+	contracts, err := m.siaclient.Contracts(ctx)
+	cancel()
 	if err != nil {
 		return fmt.Errorf("siaclient.Contracts: %v.", err)
 	}
 	var contracts1 []string
+	scores := make(map[string]float64)
+	now := time.Now()
 	m.contractsHistoryMu.Lock()
 	for _, contract := range contracts {
 		if _, has := used[contract]; has {
 			continue
 		}
-		if a, has := m.db.ContractsHistory[contract]; has {
-			at, err := ptypes.Timestamp(a.LastFailure)
-			if err != nil {
-				panic(err)
-			}
-			if time.Since(at) < time.Minute {
-				continue
-			}
+		if m.blacklisted(contract, now) {
+			continue
 		}
+		scores[contract] = score(m.history(contract), now)
 		contracts1 = append(contracts1, contract)
 	}
+	m.contractsHistoryMu.Unlock()
 	if len(contracts1) < n {
-		m.contractsHistoryMu.Unlock()
 		return fmt.Errorf("too few contracts (%d < %d)", len(contracts1), n)
 	}
 	sort.Slice(contracts1, func(i, j int) bool {
-		var iavg, javg int64
-		il, has := m.db.ContractsHistory[contracts1[i]]
-		if has {
-			iavg = il.ReadsTotalMs / il.ReadsNumber
-		}
-		jl, has := m.db.ContractsHistory[contracts1[j]]
-		if has {
-			javg = jl.ReadsTotalMs / jl.ReadsNumber
-		}
-		return iavg < javg
+		return scores[contracts1[i]] > scores[contracts1[j]]
 	})
-	m.contractsHistoryMu.Unlock()
 	var wg sync.WaitGroup
 	errors := make(chan error, len(dataSectors)+len(paritySectors))
-	// Upload data sectors to fastest contracts.
+	// Upload data sectors to healthiest contracts.
 	for j, i := range rand.Perm(len(dataSectors)) {
 		contract := contracts1[i]
 		is := dataSectors[j]
@@ -708,25 +973,35 @@ func (m *Manager) uploadSector(sector *managerdb.Sector, id int64, contract stri
 	if len(sector.Data) != m.sectorSize {
 		return fmt.Errorf("uploadSector: len(sector.Data) is %d, want %d; sector %d", len(sector.Data), m.sectorSize, id)
 	}
-	sectorRoot, err := m.siaclient.Write(contract, sector.Data, id)
+	ctx, cancel := context.WithTimeout(m.ctx, writeTimeout)
+	sectorRoot, header, err := m.write(ctx, contract, sector.Data, id)
+	cancel()
+	if m.ctx.Err() != nil {
+		return m.ctx.Err()
+	}
+	m.contractsHistoryMu.Lock()
+	m.recordWrite(contract, err)
+	m.contractsHistoryMu.Unlock()
 	if err != nil {
-		m.contractsHistoryMu.Lock()
-		h, has := m.db.ContractsHistory[contract]
-		if !has {
-			h = &managerdb.ContractHistory{}
-			m.db.ContractsHistory[contract] = h
-		}
-		h.LastFailure, err = ptypes.TimestampProto(time.Now())
-		if err != nil {
-			panic(err)
-		}
-		m.contractsHistoryMu.Unlock()
 		return fmt.Errorf("siaclient.Write(%q): %v.", contract, err)
 	}
 	m.mu.Lock()
 	sector.Contract = hex2bytes(contract)
 	sector.MerkleRoot = hex2bytes(sectorRoot)
+	sector.Header = header
 	sector.Data = nil
+	m.inFlight--
+	m.notifyDrained()
+	spooled := sector.DataSha256 != nil
+	sector.DataSha256 = nil
+	if err := m.logRecord(&managerdb.Record{
+		Sectors: []*managerdb.SectorUpdate{{Id: id, Sector: sector}},
+	}); err != nil {
+		// The sector will be uploaded again after restart.
+		log.Printf("Failed to log uploaded sector %d: %v.", id, err)
+	} else if spooled {
+		m.unspoolSector(id)
+	}
 	m.mu.Unlock()
 	return nil
 }
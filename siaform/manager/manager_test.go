@@ -5,9 +5,17 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"io/ioutil"
 	"math/rand"
+	"os"
+	"path/filepath"
 	"sync"
 	"testing"
+	"time"
+
+	"github.com/starius/invisiblefs/merkle"
+	"github.com/starius/invisiblefs/siaform/faulty"
+	"golang.org/x/net/context"
 )
 
 const (
@@ -60,7 +68,7 @@ func (m *MockSiaClient) disable(contractID string) {
 	m.working[contractID] = false
 }
 
-func (m *MockSiaClient) Contracts() ([]string, error) {
+func (m *MockSiaClient) Contracts(ctx context.Context) ([]string, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	var contracts []string
@@ -70,7 +78,7 @@ func (m *MockSiaClient) Contracts() ([]string, error) {
 	return contracts, nil
 }
 
-func (m *MockSiaClient) Read(contractID, sectorRoot string, sectorID int64) ([]byte, error) {
+func (m *MockSiaClient) Read(ctx context.Context, contractID, sectorRoot string, sectorID int64) ([]byte, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	if working, has := m.working[contractID]; !has {
@@ -85,7 +93,18 @@ func (m *MockSiaClient) Read(contractID, sectorRoot string, sectorID int64) ([]b
 	}
 }
 
-func (m *MockSiaClient) Write(contractID string, data []byte, sectorID int64) (string, error) {
+func (m *MockSiaClient) ReadAt(ctx context.Context, contractID, sectorRoot string, sectorID int64, offset, length int) ([]byte, error) {
+	data, err := m.Read(ctx, contractID, sectorRoot, sectorID)
+	if err != nil {
+		return nil, err
+	}
+	if offset < 0 || length < 0 || offset+length > len(data) {
+		return nil, fmt.Errorf("bad range [%d,%d)", offset, offset+length)
+	}
+	return data[offset : offset+length], nil
+}
+
+func (m *MockSiaClient) Write(ctx context.Context, contractID string, data []byte, sectorID int64) (string, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	if working, has := m.working[contractID]; !has {
@@ -96,12 +115,18 @@ func (m *MockSiaClient) Write(contractID string, data []byte, sectorID int64) (s
 	if len(data) != m.sectorSize {
 		return "", fmt.Errorf("len(data) is %d, want %d", len(data), m.sectorSize)
 	}
-	checksum := sha256.Sum256(data)
-	sectorRoot := hex.EncodeToString(checksum[:])
+	sectorRoot := hex.EncodeToString(merkle.Root(data))
 	m.data[contractID+"-"+sectorRoot] = data
 	return sectorRoot, nil
 }
 
+func (m *MockSiaClient) Delete(ctx context.Context, contractID, sectorRoot string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.data, contractID+"-"+sectorRoot)
+	return nil
+}
+
 func makeData(i, sectorSize int) []byte {
 	source := rand.NewSource(int64(i))
 	r := rand.New(source)
@@ -130,11 +155,11 @@ func TestUploadAndDownloadOneSector(t *testing.T) {
 	}()
 	//
 	data0 := makeData(1, testSectorSize)
-	i, err := mn.AddSector(data0)
+	i, err := mn.AddSector(context.Background(), data0)
 	if err != nil {
 		t.Fatalf("mn.AddSector: %v", err)
 	}
-	data, err := mn.ReadSector(i)
+	data, err := mn.ReadSector(context.Background(), i)
 	if err != nil {
 		t.Fatalf("mn.ReadSector: %v", err)
 	}
@@ -161,7 +186,7 @@ func TestUploadAndDownloadManySectors(t *testing.T) {
 	var ids []int64
 	for k := 0; k < 100; k++ {
 		data0 := makeData(k, testSectorSize)
-		i, err := mn.AddSector(data0)
+		i, err := mn.AddSector(context.Background(), data0)
 		if err != nil {
 			t.Fatalf("mn.AddSector: %v", err)
 		}
@@ -169,7 +194,7 @@ func TestUploadAndDownloadManySectors(t *testing.T) {
 	}
 	for k := 0; k < 100; k++ {
 		data0 := makeData(k, testSectorSize)
-		data, err := mn.ReadSector(ids[k])
+		data, err := mn.ReadSector(context.Background(), ids[k])
 		if err != nil {
 			t.Fatalf("mn.ReadSector: %v", err)
 		}
@@ -191,7 +216,7 @@ func TestUploadAndDownloadOneSectorWithContract(t *testing.T) {
 	}
 	//
 	data0 := makeData(1, testSectorSize)
-	i, err := mn.AddSector(data0)
+	i, err := mn.AddSector(context.Background(), data0)
 	if err != nil {
 		t.Fatalf("mn.AddSector: %v", err)
 	}
@@ -215,7 +240,7 @@ func TestUploadAndDownloadOneSectorWithContract(t *testing.T) {
 		t.Fatalf("mn1.Start: %v", err)
 	}
 	//
-	data, err := mn1.ReadSector(i)
+	data, err := mn1.ReadSector(context.Background(), i)
 	if err != nil {
 		t.Fatalf("mn1.ReadSector: %v", err)
 	}
@@ -242,7 +267,7 @@ func TestUploadAndDownloadManySectorsWithContract(t *testing.T) {
 	var ids []int64
 	for k := 0; k < 100; k++ {
 		data0 := makeData(k, testSectorSize)
-		i, err := mn.AddSector(data0)
+		i, err := mn.AddSector(context.Background(), data0)
 		if err != nil {
 			t.Fatalf("mn.AddSector: %v", err)
 		}
@@ -270,7 +295,7 @@ func TestUploadAndDownloadManySectorsWithContract(t *testing.T) {
 	//
 	for k := 0; k < 100; k++ {
 		data0 := makeData(k, testSectorSize)
-		data, err := mn.ReadSector(ids[k])
+		data, err := mn.ReadSector(context.Background(), ids[k])
 		if err != nil {
 			t.Fatalf("mn.ReadSector: %v", err)
 		}
@@ -304,10 +329,10 @@ func TestAllocate(t *testing.T) {
 		t.Fatalf("mn.AllocateSector: %v", err)
 	}
 	data0 := makeData(1, testSectorSize)
-	if err := mn.WriteSector(i, data0); err != nil {
+	if err := mn.WriteSector(context.Background(), i, data0); err != nil {
 		t.Fatalf("mn.WriteSector: %v", err)
 	}
-	data, err := mn.ReadSector(i)
+	data, err := mn.ReadSector(context.Background(), i)
 	if err != nil {
 		t.Fatalf("mn.ReadSector: %v", err)
 	}
@@ -331,7 +356,7 @@ func TestAllocateAcrossDump(t *testing.T) {
 		t.Fatalf("mn.AllocateSector: %v", err)
 	}
 	data0 := makeData(1, testSectorSize)
-	if err := mn.WriteSector(i, data0); err != nil {
+	if err := mn.WriteSector(context.Background(), i, data0); err != nil {
 		t.Fatalf("mn.WriteSector: %v", err)
 	}
 	//
@@ -350,7 +375,7 @@ func TestAllocateAcrossDump(t *testing.T) {
 		t.Fatalf("mn1.Start: %v", err)
 	}
 	//
-	data, err := mn1.ReadSector(i)
+	data, err := mn1.ReadSector(context.Background(), i)
 	if err != nil {
 		t.Fatalf("mn1.ReadSector: %v", err)
 	}
@@ -379,7 +404,7 @@ func TestUploadAllPending(t *testing.T) {
 	var ids []int64
 	for k := 0; k < 100; k++ {
 		data0 := makeData(k, testSectorSize)
-		i, err := mn.AddSector(data0)
+		i, err := mn.AddSector(context.Background(), data0)
 		if err != nil {
 			t.Fatalf("mn.AddSector: %v", err)
 		}
@@ -409,7 +434,7 @@ func TestUploadAllPending(t *testing.T) {
 	//
 	for k := 0; k < 100; k++ {
 		data0 := makeData(k, testSectorSize)
-		data, err := mn.ReadSector(ids[k])
+		data, err := mn.ReadSector(context.Background(), ids[k])
 		if err != nil {
 			t.Fatalf("mn.ReadSector: %v", err)
 		}
@@ -493,7 +518,7 @@ func TestRecover(t *testing.T) {
 	var ids []int64
 	for k := 0; k < 100; k++ {
 		data0 := makeData(k, testSectorSize)
-		i, err := mn.AddSector(data0)
+		i, err := mn.AddSector(context.Background(), data0)
 		if err != nil {
 			t.Fatalf("mn.AddSector: %v", err)
 		}
@@ -508,7 +533,96 @@ func TestRecover(t *testing.T) {
 	//
 	for k := 0; k < 100; k++ {
 		data0 := makeData(k, testSectorSize)
-		data, err := mn.ReadSector(ids[k])
+		data, err := mn.ReadSector(context.Background(), ids[k])
+		if err != nil {
+			t.Fatalf("mn.ReadSector: %v", err)
+		}
+		if !bytes.Equal(data0, data) {
+			t.Errorf("data != data0")
+		}
+	}
+	//
+	if err := mn.Stop(); err != nil {
+		t.Fatalf("mn.Stop: %v", err)
+	}
+}
+
+func TestReportAudit(t *testing.T) {
+	sc := NewMSC(testSectorSize)
+	mn, err := New(1, 0, testSectorSize, sc)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	mn.ReportAudit("01", nil)
+	mn.ReportAudit("01", fmt.Errorf("bad proof"))
+	mn.ReportAudit("02", nil)
+	dump, err := mn.DumpDb()
+	if err != nil {
+		t.Fatalf("mn.DumpDb: %v", err)
+	}
+	mn1, err := Load(dump, sc)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	h1 := mn1.db.ContractsHistory["01"]
+	if h1.AuditsNumber != 2 || h1.AuditsFailures != 1 || h1.LastFailure == nil {
+		t.Errorf("history of 01 is %v", h1)
+	}
+	h2 := mn1.db.ContractsHistory["02"]
+	if h2.AuditsNumber != 1 || h2.AuditsFailures != 0 || h2.LastFailure != nil {
+		t.Errorf("history of 02 is %v", h2)
+	}
+}
+
+func TestRepair(t *testing.T) {
+	msc := NewMSC(testSectorSize)
+	for c := 1; c <= 9; c++ {
+		msc.addContract(fmt.Sprintf("0%d", c), true)
+	}
+	sc := faulty.New(msc, 1)
+	mn, err := New(3, 4, testSectorSize, sc)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := mn.Start(); err != nil {
+		t.Fatalf("mn.Start: %v", err)
+	}
+	//
+	var ids []int64
+	for k := 0; k < 30; k++ {
+		data0 := makeData(k, testSectorSize)
+		i, err := mn.AddSector(context.Background(), data0)
+		if err != nil {
+			t.Fatalf("mn.AddSector: %v", err)
+		}
+		ids = append(ids, i)
+	}
+	mn.WaitForUploading()
+	// Contract 01 is lost, contract 02 is blacklisted.
+	sc.Set("01", faulty.Faults{Lost: true})
+	if err := mn.Blacklist("02"); err != nil {
+		t.Fatalf("mn.Blacklist: %v", err)
+	}
+	if _, err := mn.Repair(context.Background()); err != nil {
+		t.Fatalf("mn.Repair: %v", err)
+	}
+	mn.WaitForUploading()
+	mn.mu.Lock()
+	for i, sector := range mn.db.Sectors {
+		contract := bytes2hex(sector.Contract)
+		if contract == "01" || contract == "02" {
+			t.Errorf("sector %d is still in contract %s", i, contract)
+		}
+	}
+	mn.mu.Unlock()
+	// Each set has 7 sectors in 7 remaining contracts.
+	// Any 4 of them can be lost.
+	for _, contract := range []string{"03", "05", "07", "09"} {
+		sc.Set(contract, faulty.Faults{FailureRate: 1})
+	}
+	for k := 0; k < 30; k++ {
+		data0 := makeData(k, testSectorSize)
+		data, err := mn.ReadSector(context.Background(), ids[k])
 		if err != nil {
 			t.Fatalf("mn.ReadSector: %v", err)
 		}
@@ -521,3 +635,887 @@ func TestRecover(t *testing.T) {
 		t.Fatalf("mn.Stop: %v", err)
 	}
 }
+
+func TestScore(t *testing.T) {
+	sc := NewMSC(testSectorSize)
+	mn, err := New(1, 0, testSectorSize, sc)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if s := mn.Score("01"); s != 1 {
+		t.Errorf("score of unknown contract is %f, want 1", s)
+	}
+	mn.contractsHistoryMu.Lock()
+	for k := 0; k < 10; k++ {
+		mn.recordRead("01", 10*time.Millisecond, nil)
+		mn.recordRead("02", 2*time.Second, nil)
+	}
+	mn.recordRead("03", 10*time.Millisecond, fmt.Errorf("down"))
+	mn.contractsHistoryMu.Unlock()
+	s1, s2, s3 := mn.Score("01"), mn.Score("02"), mn.Score("03")
+	if !(s1 > s2 && s2 > s3) {
+		t.Errorf("scores are %f, %f, %f; want decreasing", s1, s2, s3)
+	}
+	mn.contractsHistoryMu.Lock()
+	// One failure does not blacklist a contract.
+	for k := 0; k < 10; k++ {
+		mn.recordRead("02", 2*time.Second, nil)
+	}
+	mn.recordRead("02", 2*time.Second, fmt.Errorf("timeout"))
+	if mn.blacklisted("02", time.Now()) {
+		t.Errorf("02 has failed once, want not blacklisted")
+	}
+	if mn.blacklisted("03", time.Now()) {
+		t.Errorf("03 has failed once, want not blacklisted")
+	}
+	// A contract failing most of the time is blacklisted while
+	// the penalty of the last failure lasts.
+	for k := 0; k < 4; k++ {
+		mn.recordRead("03", 10*time.Millisecond, fmt.Errorf("down"))
+	}
+	if !mn.blacklisted("03", time.Now()) {
+		t.Errorf("03 has just failed again, want blacklisted")
+	}
+	if mn.blacklisted("03", time.Now().Add(failureWindow)) {
+		t.Errorf("03 failed long ago, want not blacklisted")
+	}
+	// A malformed timestamp is ignored.
+	mn.history("03").LastFailure.Nanos = -1
+	if mn.blacklisted("03", time.Now()) {
+		t.Errorf("03 has malformed last failure, want not blacklisted")
+	}
+	// Slow reads lower the score, but do not blacklist a contract.
+	for k := 0; k < 10; k++ {
+		mn.recordRead("04", 20*time.Second, nil)
+	}
+	mn.recordRead("04", 20*time.Second, fmt.Errorf("timeout"))
+	if s4, s2 := score(mn.history("04"), time.Now()), score(mn.history("02"), time.Now()); s4 >= s2 {
+		t.Errorf("slow 04 scores %f, not less than %f of 02", s4, s2)
+	}
+	if mn.blacklisted("04", time.Now()) || mn.failing("04") {
+		t.Errorf("04 is slow, want not blacklisted")
+	}
+	// Old failures are forgotten.
+	for k := 0; k < 10; k++ {
+		mn.recordRead("05", 10*time.Millisecond, fmt.Errorf("down"))
+	}
+	if !mn.failing("05") || !mn.blacklisted("05", time.Now()) {
+		t.Errorf("05 is down, want blacklisted")
+	}
+	// A blacklisted contract is tried again after a while and
+	// is blacklisted again if it fails.
+	if mn.blacklisted("05", time.Now().Add(probationDelay)) {
+		t.Errorf("05 has not failed for a long time, want on probation")
+	}
+	mn.recordRead("05", 10*time.Millisecond, fmt.Errorf("down"))
+	if !mn.blacklisted("05", time.Now()) {
+		t.Errorf("05 has failed on probation, want blacklisted")
+	}
+	for k := 0; k < recentResults; k++ {
+		mn.recordRead("05", 10*time.Millisecond, nil)
+	}
+	if mn.failing("05") || mn.blacklisted("05", time.Now()) {
+		t.Errorf("05 has recovered, want not blacklisted")
+	}
+	mn.contractsHistoryMu.Unlock()
+	if err := mn.Blacklist("xyz"); err == nil {
+		t.Errorf("Blacklist accepted bad contract")
+	}
+	if err := mn.Blacklist("01"); err != nil {
+		t.Fatalf("mn.Blacklist: %v", err)
+	}
+	if s := mn.Score("01"); s != 0 {
+		t.Errorf("score of blacklisted contract is %f, want 0", s)
+	}
+	if err := mn.Unblacklist("01"); err != nil {
+		t.Fatalf("mn.Unblacklist: %v", err)
+	}
+	if s := mn.Score("01"); s != s1 {
+		t.Errorf("score after Unblacklist is %f, want %f", s, s1)
+	}
+	if err := mn.Unblacklist("01"); err == nil {
+		t.Errorf("Unblacklist succeeded twice")
+	}
+}
+
+func TestUploadSkipsBlacklisted(t *testing.T) {
+	sc := NewMSC(testSectorSize)
+	for c := 1; c <= 8; c++ {
+		sc.addContract(fmt.Sprintf("0%d", c), true)
+	}
+	mn, err := New(3, 4, testSectorSize, sc)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := mn.Blacklist("01"); err != nil {
+		t.Fatalf("mn.Blacklist: %v", err)
+	}
+	if err := mn.Start(); err != nil {
+		t.Fatalf("mn.Start: %v", err)
+	}
+	for k := 0; k < 30; k++ {
+		if _, err := mn.AddSector(context.Background(), makeData(k, testSectorSize)); err != nil {
+			t.Fatalf("mn.AddSector: %v", err)
+		}
+	}
+	mn.WaitForUploading()
+	if err := mn.Stop(); err != nil {
+		t.Fatalf("mn.Stop: %v", err)
+	}
+	for i, sector := range mn.db.Sectors {
+		if bytes2hex(sector.Contract) == "01" {
+			t.Errorf("sector %d was uploaded to blacklisted contract", i)
+		}
+	}
+}
+
+func TestHedgedRead(t *testing.T) {
+	msc := NewMSC(testSectorSize)
+	for c := 1; c <= 7; c++ {
+		msc.addContract(fmt.Sprintf("0%d", c), true)
+	}
+	sc := faulty.New(msc, 1)
+	mn, err := New(3, 4, testSectorSize, sc)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	mn.SetHedgedReads(true)
+	if err := mn.Start(); err != nil {
+		t.Fatalf("mn.Start: %v", err)
+	}
+	//
+	var ids []int64
+	for k := 0; k < 3; k++ {
+		i, err := mn.AddSector(context.Background(), makeData(k, testSectorSize))
+		if err != nil {
+			t.Fatalf("mn.AddSector: %v", err)
+		}
+		ids = append(ids, i)
+	}
+	mn.WaitForUploading()
+	// Collect read history of all contracts.
+	for _, i := range ids {
+		if _, err := mn.ReadSector(context.Background(), i); err != nil {
+			t.Fatalf("mn.ReadSector: %v", err)
+		}
+	}
+	mn.mu.Lock()
+	slow := bytes2hex(mn.db.Sectors[ids[0]].Contract)
+	mn.mu.Unlock()
+	sc.Set(slow, faulty.Faults{Latency: 5 * time.Second})
+	mn.contractsHistoryMu.Lock()
+	reads := mn.db.ContractsHistory[slow].ReadsNumber
+	mn.contractsHistoryMu.Unlock()
+	t1 := time.Now()
+	data, err := mn.ReadSector(context.Background(), ids[0])
+	if err != nil {
+		t.Fatalf("mn.ReadSector: %v", err)
+	}
+	if !bytes.Equal(makeData(0, testSectorSize), data) {
+		t.Errorf("data != data0")
+	}
+	if latency := time.Since(t1); latency > time.Second {
+		t.Errorf("hedged read took %s", latency)
+	}
+	// The slow read is canceled and recorded once with the time
+	// it took before the hedge won.
+	time.Sleep(100 * time.Millisecond)
+	mn.contractsHistoryMu.Lock()
+	h := mn.db.ContractsHistory[slow]
+	if h.ReadsNumber != reads+1 {
+		t.Errorf("%d reads of %s recorded, want 1", h.ReadsNumber-reads, slow)
+	}
+	if last := h.RecentReadsMs[len(h.RecentReadsMs)-1]; last >= 1000 {
+		t.Errorf("recorded latency of the canceled read is %d ms", last)
+	}
+	mn.contractsHistoryMu.Unlock()
+	//
+	if err := mn.Stop(); err != nil {
+		t.Fatalf("mn.Stop: %v", err)
+	}
+}
+
+func TestReadSectorCanceled(t *testing.T) {
+	msc := NewMSC(testSectorSize)
+	for c := 1; c <= 2; c++ {
+		msc.addContract(fmt.Sprintf("0%d", c), true)
+	}
+	sc := faulty.New(msc, 1)
+	mn, err := New(1, 1, testSectorSize, sc)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := mn.Start(); err != nil {
+		t.Fatalf("mn.Start: %v", err)
+	}
+	//
+	i, err := mn.AddSector(context.Background(), makeData(1, testSectorSize))
+	if err != nil {
+		t.Fatalf("mn.AddSector: %v", err)
+	}
+	mn.WaitForUploading()
+	mn.mu.Lock()
+	contract := bytes2hex(mn.db.Sectors[i].Contract)
+	mn.mu.Unlock()
+	sc.Set(contract, faulty.Faults{Latency: 5 * time.Second})
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	t1 := time.Now()
+	if _, err := mn.ReadSector(ctx, i); err == nil {
+		t.Errorf("mn.ReadSector succeeded with canceled context")
+	}
+	if latency := time.Since(t1); latency > time.Second {
+		t.Errorf("canceled read took %s", latency)
+	}
+	// The contract is not blamed for the cancellation.
+	if s := mn.Score(contract); s < 0.5 {
+		t.Errorf("score of %s is %f after canceled read", contract, s)
+	}
+	//
+	if err := mn.Stop(); err != nil {
+		t.Fatalf("mn.Stop: %v", err)
+	}
+}
+
+func TestInsecureReadSectorAt(t *testing.T) {
+	sc := NewMSC(testSectorSize)
+	for c := 1; c <= 2; c++ {
+		sc.addContract(fmt.Sprintf("0%d", c), true)
+	}
+	mn, err := New(1, 1, testSectorSize, sc)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := mn.Start(); err != nil {
+		t.Fatalf("mn.Start: %v", err)
+	}
+	//
+	data0 := makeData(1, testSectorSize)
+	i, err := mn.AddSector(context.Background(), data0)
+	if err != nil {
+		t.Fatalf("mn.AddSector: %v", err)
+	}
+	mn.WaitForUploading()
+	part, err := mn.InsecureReadSectorAt(context.Background(), i, 100, 200)
+	if err != nil {
+		t.Fatalf("mn.InsecureReadSectorAt: %v", err)
+	}
+	if !bytes.Equal(part, data0[100:300]) {
+		t.Errorf("part != data0[100:300]")
+	}
+	// Falls back to recovery if the contract is down.
+	mn.mu.Lock()
+	contract := bytes2hex(mn.db.Sectors[i].Contract)
+	mn.mu.Unlock()
+	sc.disable(contract)
+	part, err = mn.InsecureReadSectorAt(context.Background(), i, 1000, 10)
+	if err != nil {
+		t.Fatalf("mn.InsecureReadSectorAt: %v", err)
+	}
+	if !bytes.Equal(part, data0[1000:1010]) {
+		t.Errorf("part != data0[1000:1010]")
+	}
+	if _, err := mn.InsecureReadSectorAt(context.Background(), i, testSectorSize-1, 2); err == nil {
+		t.Errorf("mn.InsecureReadSectorAt accepted bad range")
+	}
+	//
+	if err := mn.Stop(); err != nil {
+		t.Fatalf("mn.Stop: %v", err)
+	}
+}
+
+func TestRecoverFromFaults(t *testing.T) {
+	msc := NewMSC(testSectorSize)
+	for c := 1; c <= 7; c++ {
+		msc.addContract(fmt.Sprintf("0%d", c), true)
+	}
+	sc := faulty.New(msc, 1)
+	mn, err := New(3, 4, testSectorSize, sc)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := mn.Start(); err != nil {
+		t.Fatalf("mn.Start: %v", err)
+	}
+	//
+	var ids []int64
+	for k := 0; k < 30; k++ {
+		i, err := mn.AddSector(context.Background(), makeData(k, testSectorSize))
+		if err != nil {
+			t.Fatalf("mn.AddSector: %v", err)
+		}
+		ids = append(ids, i)
+	}
+	mn.WaitForUploading()
+	sc.Set("01", faulty.Faults{Lost: true})
+	sc.Set("02", faulty.Faults{FailureRate: 1})
+	sc.Set("03", faulty.Faults{FailureRate: 0.5})
+	sc.Set("04", faulty.Faults{Latency: 10 * time.Millisecond})
+	for k := 0; k < 30; k++ {
+		data, err := mn.ReadSector(context.Background(), ids[k])
+		if err != nil {
+			t.Fatalf("mn.ReadSector: %v", err)
+		}
+		if !bytes.Equal(makeData(k, testSectorSize), data) {
+			t.Errorf("data != data0")
+		}
+	}
+	//
+	if err := mn.Stop(); err != nil {
+		t.Fatalf("mn.Stop: %v", err)
+	}
+}
+
+func TestPlacementAvoidsFailingContracts(t *testing.T) {
+	msc := NewMSC(testSectorSize)
+	for c := 1; c <= 8; c++ {
+		msc.addContract(fmt.Sprintf("0%d", c), true)
+	}
+	sc := faulty.New(msc, 1)
+	sc.Set("01", faulty.Faults{FailureRate: 1})
+	mn, err := New(3, 4, testSectorSize, sc)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := mn.Start(); err != nil {
+		t.Fatalf("mn.Start: %v", err)
+	}
+	for k := 0; k < 30; k++ {
+		if _, err := mn.AddSector(context.Background(), makeData(k, testSectorSize)); err != nil {
+			t.Fatalf("mn.AddSector: %v", err)
+		}
+	}
+	mn.WaitForUploading()
+	if err := mn.Stop(); err != nil {
+		t.Fatalf("mn.Stop: %v", err)
+	}
+	for i, sector := range mn.db.Sectors {
+		if bytes2hex(sector.Contract) == "01" {
+			t.Errorf("sector %d was uploaded to failing contract", i)
+		}
+	}
+	if s := mn.Score("01"); s >= minScore {
+		t.Errorf("score of failing contract is %f", s)
+	}
+}
+
+func TestCorruptedSector(t *testing.T) {
+	msc := NewMSC(testSectorSize)
+	for c := 1; c <= 2; c++ {
+		msc.addContract(fmt.Sprintf("0%d", c), true)
+	}
+	sc := faulty.New(msc, 1)
+	mn, err := New(1, 1, testSectorSize, sc)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := mn.Start(); err != nil {
+		t.Fatalf("mn.Start: %v", err)
+	}
+	//
+	data0 := makeData(1, testSectorSize)
+	i, err := mn.AddSector(context.Background(), data0)
+	if err != nil {
+		t.Fatalf("mn.AddSector: %v", err)
+	}
+	mn.WaitForUploading()
+	mn.mu.Lock()
+	contract := bytes2hex(mn.db.Sectors[i].Contract)
+	mn.mu.Unlock()
+	sc.Set(contract, faulty.Faults{CorruptionRate: 1})
+	data, err := mn.ReadSector(context.Background(), i)
+	if err != nil {
+		t.Fatalf("mn.ReadSector: %v", err)
+	}
+	if !bytes.Equal(data0, data) {
+		t.Errorf("data != data0")
+	}
+	mn.contractsHistoryMu.Lock()
+	h := mn.db.ContractsHistory[contract]
+	if h.ReadsFailures != 1 || h.LastFailure == nil {
+		t.Errorf("corrupted read was not recorded: %v", h)
+	}
+	mn.contractsHistoryMu.Unlock()
+	//
+	if err := mn.Stop(); err != nil {
+		t.Fatalf("mn.Stop: %v", err)
+	}
+}
+
+// sealingSiaClient stores sha256 of each sector as its header.
+type sealingSiaClient struct {
+	*faulty.SiaClient
+	sealedReads int
+	mu          sync.Mutex
+}
+
+func (s *sealingSiaClient) WriteSealed(ctx context.Context, contractID string, data []byte, sectorID int64) (string, []byte, error) {
+	sectorRoot, err := s.Write(ctx, contractID, data, sectorID)
+	if err != nil {
+		return "", nil, err
+	}
+	header := sha256.Sum256(data)
+	return sectorRoot, header[:], nil
+}
+
+func (s *sealingSiaClient) ReadSealed(ctx context.Context, contractID, sectorRoot string, sectorID int64, header []byte) ([]byte, error) {
+	s.mu.Lock()
+	s.sealedReads++
+	s.mu.Unlock()
+	data, err := s.Read(ctx, contractID, sectorRoot, sectorID)
+	if err != nil {
+		return nil, err
+	}
+	if sum := sha256.Sum256(data); !bytes.Equal(sum[:], header) {
+		return nil, fmt.Errorf("sector %d was modified", sectorID)
+	}
+	return data, nil
+}
+
+func (s *sealingSiaClient) ReadAtSealed(ctx context.Context, contractID, sectorRoot string, sectorID int64, header []byte, offset, length int) ([]byte, error) {
+	s.mu.Lock()
+	s.sealedReads++
+	s.mu.Unlock()
+	return s.ReadAt(ctx, contractID, sectorRoot, sectorID, offset, length)
+}
+
+func (s *sealingSiaClient) TransformSealed(data []byte, sectorID int64, header []byte) ([]byte, error) {
+	return data, nil
+}
+
+func TestSealer(t *testing.T) {
+	msc := NewMSC(testSectorSize)
+	for c := 1; c <= 7; c++ {
+		msc.addContract(fmt.Sprintf("0%d", c), true)
+	}
+	fsc := faulty.New(msc, 1)
+	sc := &sealingSiaClient{SiaClient: fsc}
+	mn, err := New(3, 4, testSectorSize, sc)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := mn.Start(); err != nil {
+		t.Fatalf("mn.Start: %v", err)
+	}
+	//
+	var ids []int64
+	for k := 0; k < 3; k++ {
+		i, err := mn.AddSector(context.Background(), makeData(k, testSectorSize))
+		if err != nil {
+			t.Fatalf("mn.AddSector: %v", err)
+		}
+		ids = append(ids, i)
+	}
+	mn.WaitForUploading()
+	mn.mu.Lock()
+	for i, sector := range mn.db.Sectors {
+		if len(sector.Header) == 0 {
+			t.Errorf("sector %d has no header", i)
+		}
+	}
+	contract := bytes2hex(mn.db.Sectors[ids[0]].Contract)
+	mn.mu.Unlock()
+	if _, err := mn.InsecureReadSectorAt(context.Background(), ids[0], 10, 20); err != nil {
+		t.Fatalf("mn.InsecureReadSectorAt: %v", err)
+	}
+	// A modified sector is detected and recovered.
+	fsc.Set(contract, faulty.Faults{CorruptionRate: 1})
+	data, err := mn.ReadSector(context.Background(), ids[0])
+	if err != nil {
+		t.Fatalf("mn.ReadSector: %v", err)
+	}
+	if !bytes.Equal(makeData(0, testSectorSize), data) {
+		t.Errorf("data != data0")
+	}
+	if s := mn.Score(contract); s >= 0.5 {
+		t.Errorf("score of %s is %f after modified sector", contract, s)
+	}
+	sc.mu.Lock()
+	if sc.sealedReads < 2 {
+		t.Errorf("sealed reads: %d, want at least 2", sc.sealedReads)
+	}
+	sc.mu.Unlock()
+	//
+	if err := mn.Stop(); err != nil {
+		t.Fatalf("mn.Stop: %v", err)
+	}
+}
+
+func TestJournal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "manager")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	dbFile := filepath.Join(dir, "manager.db")
+	journalFile := filepath.Join(dir, "manager.db.journal")
+	sc := NewMSC(testSectorSize)
+	for c := 1; c <= 5; c++ {
+		sc.addContract(fmt.Sprintf("0%d", c), true)
+	}
+	mn, err := New(3, 2, testSectorSize, sc)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := mn.OpenJournal(journalFile); err != nil {
+		t.Fatalf("mn.OpenJournal: %v", err)
+	}
+	if err := mn.Start(); err != nil {
+		t.Fatalf("mn.Start: %v", err)
+	}
+	//
+	var ids []int64
+	for k := 0; k < 10; k++ {
+		if k == 5 {
+			if err := mn.Compact(dbFile); err != nil {
+				t.Fatalf("mn.Compact: %v", err)
+			}
+		}
+		data0 := makeData(k, testSectorSize)
+		i, err := mn.AddSector(context.Background(), data0)
+		if err != nil {
+			t.Fatalf("mn.AddSector: %v", err)
+		}
+		ids = append(ids, i)
+	}
+	mn.WaitForUploading()
+	// Crash: the changes after the compaction are only in the journal.
+	if err := mn.Stop(); err != nil {
+		t.Fatalf("mn.Stop: %v", err)
+	}
+	if err := mn.journal.Close(); err != nil {
+		t.Fatalf("journal.Close: %v", err)
+	}
+	zdump, err := ioutil.ReadFile(dbFile)
+	if err != nil {
+		t.Fatalf("ioutil.ReadFile: %v", err)
+	}
+	mn1, err := Load(zdump, sc)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if err := mn1.OpenJournal(journalFile); err != nil {
+		t.Fatalf("mn1.OpenJournal: %v", err)
+	}
+	if err := mn1.Start(); err != nil {
+		t.Fatalf("mn1.Start: %v", err)
+	}
+	for k, i := range ids {
+		data, err := mn1.ReadSector(context.Background(), i)
+		if err != nil {
+			t.Fatalf("mn1.ReadSector(%d): %v", i, err)
+		}
+		if !bytes.Equal(data, makeData(k, testSectorSize)) {
+			t.Errorf("sector %d: data != data0", i)
+		}
+	}
+	i, err := mn1.AllocateSector()
+	if err != nil {
+		t.Fatalf("mn1.AllocateSector: %v", err)
+	}
+	for _, old := range ids {
+		if i == old {
+			t.Errorf("AllocateSector returned used sector %d", i)
+		}
+	}
+	if err := mn1.Stop(); err != nil {
+		t.Fatalf("mn1.Stop: %v", err)
+	}
+}
+
+func TestCollect(t *testing.T) {
+	dir, err := ioutil.TempDir("", "manager")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	journalFile := filepath.Join(dir, "manager.db.journal")
+	sc := NewMSC(testSectorSize)
+	for c := 1; c <= 5; c++ {
+		sc.addContract(fmt.Sprintf("0%d", c), true)
+	}
+	mn, err := New(3, 2, testSectorSize, sc)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := mn.OpenJournal(journalFile); err != nil {
+		t.Fatalf("mn.OpenJournal: %v", err)
+	}
+	if err := mn.Start(); err != nil {
+		t.Fatalf("mn.Start: %v", err)
+	}
+	ctx := context.Background()
+	var ids []int64
+	for k := 0; k < 9; k++ {
+		i, err := mn.AddSector(ctx, makeData(k, testSectorSize))
+		if err != nil {
+			t.Fatalf("mn.AddSector: %v", err)
+		}
+		ids = append(ids, i)
+	}
+	mn.WaitForUploading()
+	allocated, err := mn.AllocateSector()
+	if err != nil {
+		t.Fatalf("mn.AllocateSector: %v", err)
+	}
+	// The first set is garbage, the second one is mostly garbage.
+	live := make(map[int64]struct{})
+	for _, i := range ids[5:] {
+		live[i] = struct{}{}
+	}
+	if n, err := mn.Collect(live); err != nil {
+		t.Fatalf("mn.Collect: %v", err)
+	} else if n != 6 {
+		t.Errorf("mn.Collect found %d garbage sectors, want 6", n)
+	}
+	for _, i := range []int64{ids[0], allocated} {
+		if _, _, _, _, err := mn.getSector(i); err == nil {
+			t.Errorf("sector %d was not removed", i)
+		}
+	}
+	if _, _, _, _, err := mn.getSector(ids[3]); err != nil {
+		t.Errorf("garbage sector %d of a live set was removed", ids[3])
+	}
+	if n, err := mn.Repack(ctx, 0.5); err != nil {
+		t.Fatalf("mn.Repack: %v", err)
+	} else if n != 1 {
+		t.Errorf("mn.Repack repacked %d sets, want 1", n)
+	}
+	mn.UploadAllPending()
+	mn.WaitForUploading()
+	if _, _, _, _, err := mn.getSector(ids[3]); err == nil {
+		t.Errorf("sector %d of repacked set was not removed", ids[3])
+	}
+	for k, i := range ids[5:] {
+		data, err := mn.ReadSector(ctx, i)
+		if err != nil {
+			t.Fatalf("mn.ReadSector(%d): %v", i, err)
+		}
+		if !bytes.Equal(data, makeData(k+5, testSectorSize)) {
+			t.Errorf("sector %d: data != data0", i)
+		}
+	}
+	if _, err := mn.Release(ctx); err != nil {
+		t.Fatalf("mn.Release: %v", err)
+	}
+	// 5 sectors of the last set and 3 sectors of the new set.
+	// The repacked sector may be stored in its old contract again.
+	sc.mu.Lock()
+	stored := len(sc.data)
+	sc.mu.Unlock()
+	if stored != 8 {
+		t.Errorf("contracts store %d sectors, want 8", stored)
+	}
+	// The last sector is removed, but its ID is not reused.
+	last, err := mn.AllocateSector()
+	if err != nil {
+		t.Fatalf("mn.AllocateSector: %v", err)
+	}
+	if _, err := mn.Collect(live); err != nil {
+		t.Fatalf("mn.Collect: %v", err)
+	}
+	if err := mn.Stop(); err != nil {
+		t.Fatalf("mn.Stop: %v", err)
+	}
+	if err := mn.journal.Close(); err != nil {
+		t.Fatalf("journal.Close: %v", err)
+	}
+	mn1, err := New(3, 2, testSectorSize, sc)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := mn1.OpenJournal(journalFile); err != nil {
+		t.Fatalf("mn1.OpenJournal: %v", err)
+	}
+	if len(mn1.db.Sectors) != len(mn.db.Sectors) {
+		t.Errorf("the journal has %d sectors, want %d", len(mn1.db.Sectors), len(mn.db.Sectors))
+	}
+	if len(mn1.db.Released) != 0 {
+		t.Errorf("the journal has %d released sectors, want 0", len(mn1.db.Released))
+	}
+	i, err := mn1.AllocateSector()
+	if err != nil {
+		t.Fatalf("mn1.AllocateSector: %v", err)
+	}
+	if i <= last {
+		t.Errorf("AllocateSector returned %d after removed sector %d", i, last)
+	}
+}
+
+func TestSpool(t *testing.T) {
+	dir, err := ioutil.TempDir("", "manager")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	dbFile := filepath.Join(dir, "manager.db")
+	journalFile := filepath.Join(dir, "manager.db.journal")
+	spoolDir := filepath.Join(dir, "spool")
+	sc := NewMSC(testSectorSize)
+	mn, err := New(3, 2, testSectorSize, sc)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := mn.OpenJournal(journalFile); err != nil {
+		t.Fatalf("mn.OpenJournal: %v", err)
+	}
+	if err := mn.OpenSpool(spoolDir); err != nil {
+		t.Fatalf("mn.OpenSpool: %v", err)
+	}
+	// No contracts: nothing is uploaded.
+	var ids []int64
+	for k := 0; k < 4; k++ {
+		i, err := mn.AddSector(context.Background(), makeData(k, testSectorSize))
+		if err != nil {
+			t.Fatalf("mn.AddSector: %v", err)
+		}
+		ids = append(ids, i)
+	}
+	mn.UploadAllPending()
+	if err := mn.Compact(dbFile); err != nil {
+		t.Fatalf("mn.Compact: %v", err)
+	}
+	zdump, err := ioutil.ReadFile(dbFile)
+	if err != nil {
+		t.Fatalf("ioutil.ReadFile: %v", err)
+	}
+	if len(zdump) > testSectorSize {
+		t.Errorf("Dump is too large: %d", len(zdump))
+	}
+	infos, err := ioutil.ReadDir(spoolDir)
+	if err != nil {
+		t.Fatalf("ioutil.ReadDir: %v", err)
+	}
+	// 4 data sectors and 2 parity sectors per each of 2 sets.
+	if len(infos) != 8 {
+		t.Errorf("spool has %d files, want 8", len(infos))
+	}
+	if err := mn.journal.Close(); err != nil {
+		t.Fatalf("journal.Close: %v", err)
+	}
+	//
+	for c := 1; c <= 5; c++ {
+		sc.addContract(fmt.Sprintf("0%d", c), true)
+	}
+	mn1, err := Load(zdump, sc)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if err := mn1.OpenJournal(journalFile); err != nil {
+		t.Fatalf("mn1.OpenJournal: %v", err)
+	}
+	if err := mn1.OpenSpool(spoolDir); err != nil {
+		t.Fatalf("mn1.OpenSpool: %v", err)
+	}
+	if err := mn1.Start(); err != nil {
+		t.Fatalf("mn1.Start: %v", err)
+	}
+	mn1.WaitForUploading()
+	for k, i := range ids {
+		data, err := mn1.ReadSector(context.Background(), i)
+		if err != nil {
+			t.Fatalf("mn1.ReadSector(%d): %v", i, err)
+		}
+		if !bytes.Equal(data, makeData(k, testSectorSize)) {
+			t.Errorf("sector %d: data != data0", i)
+		}
+	}
+	if err := mn1.Stop(); err != nil {
+		t.Fatalf("mn1.Stop: %v", err)
+	}
+	infos, err = ioutil.ReadDir(spoolDir)
+	if err != nil {
+		t.Fatalf("ioutil.ReadDir: %v", err)
+	}
+	if len(infos) != 0 {
+		t.Errorf("spool has %d files after uploading", len(infos))
+	}
+}
+
+func TestSpoolChecksum(t *testing.T) {
+	dir, err := ioutil.TempDir("", "manager")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	spoolDir := filepath.Join(dir, "spool")
+	sc := NewMSC(testSectorSize)
+	mn, err := New(3, 2, testSectorSize, sc)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := mn.OpenSpool(spoolDir); err != nil {
+		t.Fatalf("mn.OpenSpool: %v", err)
+	}
+	i, err := mn.AddSector(context.Background(), makeData(1, testSectorSize))
+	if err != nil {
+		t.Fatalf("mn.AddSector: %v", err)
+	}
+	dump, err := mn.DumpDb()
+	if err != nil {
+		t.Fatalf("mn.DumpDb: %v", err)
+	}
+	fname := filepath.Join(spoolDir, fmt.Sprintf("%d", i))
+	if err := ioutil.WriteFile(fname, makeData(2, testSectorSize), 0600); err != nil {
+		t.Fatalf("ioutil.WriteFile: %v", err)
+	}
+	mn1, err := Load(dump, sc)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if err := mn1.OpenSpool(spoolDir); err == nil {
+		t.Errorf("OpenSpool accepted corrupted sector")
+	}
+}
+
+func TestUploadLimits(t *testing.T) {
+	sc := NewMSC(testSectorSize)
+	mn, err := New(2, 1, testSectorSize, sc)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := mn.SetUploadLimits(testSectorSize, 0, 0); err == nil {
+		t.Errorf("SetUploadLimits accepted maxPending smaller than a set")
+	}
+	if err := mn.SetUploadLimits(2*testSectorSize, 3*testSectorSize, 100*time.Millisecond); err != nil {
+		t.Fatalf("mn.SetUploadLimits: %v", err)
+	}
+	if err := mn.Start(); err != nil {
+		t.Fatalf("mn.Start: %v", err)
+	}
+	// No contracts: the first set is not uploaded.
+	for k := 0; k < 2; k++ {
+		if _, err := mn.AddSector(context.Background(), makeData(k, testSectorSize)); err != nil {
+			t.Fatalf("mn.AddSector: %v", err)
+		}
+	}
+	// Wait for the parity set, adding the parity sector.
+	mn.mu.Lock()
+	for len(mn.db.Sets) == 0 {
+		mn.mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mn.mu.Lock()
+	}
+	sectors := len(mn.db.Sectors)
+	mn.mu.Unlock()
+	for k := 0; k < 3; k++ {
+		if _, err := mn.AddSector(context.Background(), makeData(2, testSectorSize)); err != ErrOverloaded {
+			t.Errorf("mn.AddSector returned %v, want ErrOverloaded", err)
+		}
+	}
+	mn.mu.Lock()
+	if len(mn.db.Sectors) != sectors {
+		t.Errorf("rejected writes added %d sectors", len(mn.db.Sectors)-sectors)
+	}
+	mn.mu.Unlock()
+	for c := 1; c <= 3; c++ {
+		sc.addContract(fmt.Sprintf("0%d", c), true)
+	}
+	mn.WaitForUploading()
+	if _, err := mn.AddSector(context.Background(), makeData(3, testSectorSize)); err != nil {
+		t.Errorf("mn.AddSector after uploading: %v", err)
+	}
+	if err := mn.Stop(); err != nil {
+		t.Fatalf("mn.Stop: %v", err)
+	}
+}
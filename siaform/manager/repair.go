@@ -0,0 +1,159 @@
+package manager
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/starius/invisiblefs/siaform/managerdb"
+	"golang.org/x/net/context"
+)
+
+// SetRepairInterval makes the manager run Repair every interval
+// in background. Call it before Start. Zero disables repairing.
+func (m *Manager) SetRepairInterval(interval time.Duration) {
+	m.repairInterval = interval
+}
+
+func (m *Manager) repairLoop() {
+	ticker := time.NewTicker(m.repairInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.stopChan:
+			return
+		case <-ticker.C:
+			if _, err := m.Repair(m.ctx); err != nil {
+				log.Printf("m.Repair: %v.", err)
+			}
+		}
+	}
+}
+
+// Repair finds sectors stored in contracts which are gone, expired
+// or failing, rebuilds them from other sectors of their parity sets
+// and schedules them for uploading to other contracts. It returns
+// the number of rebuilt sectors. The manager must be started.
+func (m *Manager) Repair(ctx context.Context) (int, error) {
+	ctx1, cancel := context.WithTimeout(ctx, contractsTimeout)
+	contracts, err := m.siaclient.Contracts(ctx1)
+	cancel()
+	if err != nil {
+		return 0, fmt.Errorf("siaclient.Contracts: %v", err)
+	}
+	alive := make(map[string]struct{})
+	m.contractsHistoryMu.Lock()
+	for _, contract := range contracts {
+		if m.failing(contract) {
+			continue
+		}
+		alive[contract] = struct{}{}
+	}
+	m.contractsHistoryMu.Unlock()
+	m.mu.Lock()
+	nsets := len(m.db.Sets)
+	m.mu.Unlock()
+	total := 0
+	var lastErr error
+	for setIndex := 0; setIndex < nsets; setIndex++ {
+		n, err := m.repairSet(ctx, setIndex, alive)
+		if err != nil {
+			lastErr = fmt.Errorf("set %d: %v", setIndex, err)
+			log.Printf("Failed to repair parity set: %v.", lastErr)
+			continue
+		}
+		if n == 0 {
+			continue
+		}
+		total += n
+		select {
+		case <-m.stopChan:
+			return total, fmt.Errorf("The manager was stopped")
+		case m.setChan <- setIndex:
+		}
+	}
+	if total != 0 {
+		log.Printf("Rebuilt %d sectors.", total)
+	}
+	return total, lastErr
+}
+
+// repairSet rebuilds sectors of the set stored outside of alive
+// contracts and puts their data back to the sectors. It returns
+// the number of rebuilt sectors.
+func (m *Manager) repairSet(ctx context.Context, setIndex int, alive map[string]struct{}) (int, error) {
+	m.uploadingSetsMu.Lock()
+	_, uploading := m.uploadingSets[setIndex]
+	m.uploadingSetsMu.Unlock()
+	if uploading {
+		return 0, nil
+	}
+	lost := make(map[int64]string)
+	m.mu.Lock()
+	set := m.db.Sets[setIndex]
+	for _, ids := range [][]int64{set.DataIds, set.ParityIds} {
+		for _, si := range ids {
+			sector := m.db.Sectors[si]
+			if len(sector.Contract) == 0 {
+				// Not uploaded yet. The upload of the set will
+				// pick up this set again.
+				m.mu.Unlock()
+				return 0, nil
+			}
+			contract := bytes2hex(sector.Contract)
+			if _, has := alive[contract]; !has {
+				lost[si] = contract
+			}
+		}
+	}
+	m.mu.Unlock()
+	if len(lost) == 0 {
+		return 0, nil
+	}
+	skip := make(map[int64]struct{})
+	for si := range lost {
+		skip[si] = struct{}{}
+	}
+	ids, datas, err := m.reconstructSet(ctx, setIndex, skip)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	record := &managerdb.Record{}
+	m.mu.Lock()
+	for j, si := range ids {
+		contract, has := lost[si]
+		if !has {
+			continue
+		}
+		sector, has := m.db.Sectors[si]
+		if !has || bytes2hex(sector.Contract) != contract {
+			// Changed or removed while we were rebuilding it.
+			continue
+		}
+		// The sector looks like not uploaded now, so the upload
+		// is continued after restart as well.
+		sector.Contract = nil
+		sector.MerkleRoot = nil
+		sector.Header = nil
+		sector.Data = datas[j]
+		if err := m.spoolSector(si, sector); err != nil {
+			// The data stays in the db.
+			log.Printf("Failed to spool rebuilt sector %d: %v.", si, err)
+		}
+		m.inFlight++
+		record.Sectors = append(record.Sectors, &managerdb.SectorUpdate{
+			Id:     si,
+			Sector: sector,
+		})
+		n++
+	}
+	if n != 0 {
+		if err := m.logRecord(record); err != nil {
+			// The sectors will be rebuilt again after restart.
+			log.Printf("Failed to log rebuilt sectors: %v.", err)
+		}
+	}
+	m.mu.Unlock()
+	return n, nil
+}
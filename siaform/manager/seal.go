@@ -0,0 +1,55 @@
+package manager
+
+import (
+	"golang.org/x/net/context"
+)
+
+// Sealer is implemented by SiaClient wrappers which keep a header
+// of each sector outside of the sector, e.g. a random nonce and a MAC
+// of encrypted data. The header returned by WriteSealed is stored
+// in the database and passed back to the other methods. Sectors
+// without a header are accessed with methods of SiaClient.
+type Sealer interface {
+	WriteSealed(ctx context.Context, contractID string, data []byte, sectorID int64) (sectorRoot string, header []byte, err error)
+	// ReadSealed fails if the data does not match the header.
+	ReadSealed(ctx context.Context, contractID, sectorRoot string, sectorID int64, header []byte) ([]byte, error)
+	// ReadAtSealed can not check the data, since the header covers
+	// the whole sector.
+	ReadAtSealed(ctx context.Context, contractID, sectorRoot string, sectorID int64, header []byte, offset, length int) ([]byte, error)
+	// TransformSealed returns the data as it is stored by hosts.
+	TransformSealed(data []byte, sectorID int64, header []byte) ([]byte, error)
+}
+
+func (m *Manager) read(ctx context.Context, contract, sectorRoot string, i int64, header []byte) ([]byte, error) {
+	if s, ok := m.siaclient.(Sealer); ok && len(header) != 0 {
+		return s.ReadSealed(ctx, contract, sectorRoot, i, header)
+	}
+	return m.siaclient.Read(ctx, contract, sectorRoot, i)
+}
+
+func (m *Manager) readAt(ctx context.Context, contract, sectorRoot string, i int64, header []byte, offset, length int) ([]byte, error) {
+	if s, ok := m.siaclient.(Sealer); ok && len(header) != 0 {
+		return s.ReadAtSealed(ctx, contract, sectorRoot, i, header, offset, length)
+	}
+	return m.siaclient.ReadAt(ctx, contract, sectorRoot, i, offset, length)
+}
+
+// write seals the sector if the siaclient is a Sealer.
+func (m *Manager) write(ctx context.Context, contract string, data []byte, i int64) (string, []byte, error) {
+	if s, ok := m.siaclient.(Sealer); ok {
+		return s.WriteSealed(ctx, contract, data, i)
+	}
+	sectorRoot, err := m.siaclient.Write(ctx, contract, data, i)
+	return sectorRoot, nil, err
+}
+
+// transform returns the data as it is stored by hosts.
+func (m *Manager) transform(data []byte, i int64, header []byte) ([]byte, error) {
+	if s, ok := m.siaclient.(Sealer); ok && len(header) != 0 {
+		return s.TransformSealed(data, i, header)
+	}
+	if t, ok := m.siaclient.(Transformer); ok {
+		return t.Transform(data, i), nil
+	}
+	return data, nil
+}
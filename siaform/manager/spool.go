@@ -0,0 +1,109 @@
+package manager
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/starius/invisiblefs/atomicfile"
+	"github.com/starius/invisiblefs/siaform/managerdb"
+)
+
+// OpenSpool makes the manager keep data of sectors which are not
+// uploaded yet in files of dir instead of the db. It reads back
+// data of such sectors, so call it after OpenJournal and before Start.
+func (m *Manager) OpenSpool(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("os.MkdirAll(%q): %v", dir, err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.spoolDir = dir
+	for i, sector := range m.db.Sectors {
+		if len(sector.Contract) != 0 {
+			continue
+		}
+		if sector.Data != nil {
+			if sector.DataSha256 == nil {
+				// The data is in the db. Move it to the spool.
+				if err := m.spoolSector(i, sector); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if sector.DataSha256 == nil {
+			// Allocated but not written yet.
+			continue
+		}
+		data, err := ioutil.ReadFile(m.spoolFile(i))
+		if err != nil {
+			return fmt.Errorf("ioutil.ReadFile: %v", err)
+		}
+		checksum := sha256.Sum256(data)
+		if !bytes.Equal(checksum[:], sector.DataSha256) {
+			return fmt.Errorf("checksum mismatch in spooled sector %d", i)
+		}
+		sector.Data = data
+	}
+	// Remove files of uploaded sectors left after a crash.
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("ioutil.ReadDir(%q): %v", dir, err)
+	}
+	for _, info := range infos {
+		i, err := strconv.ParseInt(info.Name(), 10, 64)
+		if err == nil {
+			sector, has := m.db.Sectors[i]
+			if has && sector.DataSha256 != nil {
+				continue
+			}
+		}
+		if err := os.Remove(filepath.Join(dir, info.Name())); err != nil {
+			return fmt.Errorf("os.Remove: %v", err)
+		}
+	}
+	return nil
+}
+
+func (m *Manager) spoolFile(i int64) string {
+	return filepath.Join(m.spoolDir, strconv.FormatInt(i, 10))
+}
+
+// spoolSector writes data of the sector to the spool if it is open.
+// Run under m.mu.Lock().
+func (m *Manager) spoolSector(i int64, sector *managerdb.Sector) error {
+	if m.spoolDir == "" {
+		return nil
+	}
+	if err := atomicfile.WriteFile(m.spoolFile(i), sector.Data); err != nil {
+		return fmt.Errorf("atomicfile.WriteFile: %v", err)
+	}
+	checksum := sha256.Sum256(sector.Data)
+	sector.DataSha256 = checksum[:]
+	return nil
+}
+
+// unspoolSector removes data of the uploaded sector from the spool.
+// Run under m.mu.Lock().
+func (m *Manager) unspoolSector(i int64) {
+	if err := os.Remove(m.spoolFile(i)); err != nil {
+		log.Printf("Failed to remove spooled sector %d: %v.", i, err)
+	}
+}
+
+// withoutData returns the sector as it is stored in the db and
+// the journal. Data of spooled sectors is not included.
+func withoutData(sector *managerdb.Sector) *managerdb.Sector {
+	if sector.DataSha256 == nil || sector.Data == nil {
+		return sector
+	}
+	s := *sector
+	s.Data = nil
+	return &s
+}
@@ -13,6 +13,9 @@ It has these top-level messages:
 	Sector
 	Set
 	ContractHistory
+	Record
+	SectorUpdate
+	SetUpdate
 */
 package managerdb
 
@@ -40,6 +43,14 @@ type Db struct {
 	SectorSize       int32                       `protobuf:"zigzag32,5,opt,name=sector_size,json=sectorSize" json:"sector_size,omitempty"`
 	ContractsHistory map[string]*ContractHistory `protobuf:"bytes,6,rep,name=contracts_history,json=contractsHistory" json:"contracts_history,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
 	Pending          []int64                     `protobuf:"zigzag64,7,rep,packed,name=pending" json:"pending,omitempty"`
+	// Sequence number of the last journal record included.
+	JournalSeq uint64 `protobuf:"varint,8,opt,name=journal_seq,json=journalSeq" json:"journal_seq,omitempty"`
+	// ID of the next allocated sector. IDs of removed sectors
+	// are not reused.
+	Next int64 `protobuf:"zigzag64,9,opt,name=next" json:"next,omitempty"`
+	// Uploaded sectors which were removed, but still take space
+	// in contracts. Only contract and merkle_root are set.
+	Released []*Sector `protobuf:"bytes,10,rep,name=released" json:"released,omitempty"`
 }
 
 func (m *Db) Reset()                    { *m = Db{} }
@@ -96,12 +107,41 @@ func (m *Db) GetPending() []int64 {
 	return nil
 }
 
+func (m *Db) GetJournalSeq() uint64 {
+	if m != nil {
+		return m.JournalSeq
+	}
+	return 0
+}
+
+func (m *Db) GetNext() int64 {
+	if m != nil {
+		return m.Next
+	}
+	return 0
+}
+
+func (m *Db) GetReleased() []*Sector {
+	if m != nil {
+		return m.Released
+	}
+	return nil
+}
+
 type Sector struct {
 	// If uploaded.
 	Contract   []byte `protobuf:"bytes,1,opt,name=contract,proto3" json:"contract,omitempty"`
 	MerkleRoot []byte `protobuf:"bytes,2,opt,name=merkle_root,json=merkleRoot,proto3" json:"merkle_root,omitempty"`
 	// If not uploaded.
 	Data []byte `protobuf:"bytes,3,opt,name=data,proto3" json:"data,omitempty"`
+	// If data is kept in the spool directory instead of the db.
+	DataSha256 []byte `protobuf:"bytes,4,opt,name=data_sha256,json=dataSha256,proto3" json:"data_sha256,omitempty"`
+	// If uploaded by a Sealer: header of the sealed sector,
+	// e.g. a nonce and a MAC.
+	Header []byte `protobuf:"bytes,5,opt,name=header,proto3" json:"header,omitempty"`
+	// Data sector not referenced anymore. It is kept until its
+	// parity set is repacked or removed.
+	Garbage bool `protobuf:"varint,6,opt,name=garbage" json:"garbage,omitempty"`
 }
 
 func (m *Sector) Reset()                    { *m = Sector{} }
@@ -130,6 +170,27 @@ func (m *Sector) GetData() []byte {
 	return nil
 }
 
+func (m *Sector) GetDataSha256() []byte {
+	if m != nil {
+		return m.DataSha256
+	}
+	return nil
+}
+
+func (m *Sector) GetHeader() []byte {
+	if m != nil {
+		return m.Header
+	}
+	return nil
+}
+
+func (m *Sector) GetGarbage() bool {
+	if m != nil {
+		return m.Garbage
+	}
+	return false
+}
+
 type Set struct {
 	DataIds   []int64 `protobuf:"zigzag64,1,rep,packed,name=data_ids,json=dataIds" json:"data_ids,omitempty"`
 	ParityIds []int64 `protobuf:"zigzag64,2,rep,packed,name=parity_ids,json=parityIds" json:"parity_ids,omitempty"`
@@ -161,6 +222,17 @@ type ContractHistory struct {
 	WritesNumber   int64                      `protobuf:"zigzag64,4,opt,name=writes_number,json=writesNumber" json:"writes_number,omitempty"`
 	WritesFailures int64                      `protobuf:"zigzag64,5,opt,name=writes_failures,json=writesFailures" json:"writes_failures,omitempty"`
 	LastFailure    *google_protobuf.Timestamp `protobuf:"bytes,6,opt,name=last_failure,json=lastFailure" json:"last_failure,omitempty"`
+	// Proof-of-storage challenges.
+	AuditsNumber   int64 `protobuf:"zigzag64,7,opt,name=audits_number,json=auditsNumber" json:"audits_number,omitempty"`
+	AuditsFailures int64 `protobuf:"zigzag64,8,opt,name=audits_failures,json=auditsFailures" json:"audits_failures,omitempty"`
+	// Latencies of the last successful reads.
+	RecentReadsMs []int64 `protobuf:"zigzag64,9,rep,packed,name=recent_reads_ms,json=recentReadsMs" json:"recent_reads_ms,omitempty"`
+	// Set manually.
+	Blacklisted bool `protobuf:"varint,10,opt,name=blacklisted" json:"blacklisted,omitempty"`
+	// Results of the last reads, writes and audits, true for failures.
+	RecentReadFailures  []bool `protobuf:"varint,11,rep,packed,name=recent_read_failures,json=recentReadFailures" json:"recent_read_failures,omitempty"`
+	RecentWriteFailures []bool `protobuf:"varint,12,rep,packed,name=recent_write_failures,json=recentWriteFailures" json:"recent_write_failures,omitempty"`
+	RecentAuditFailures []bool `protobuf:"varint,13,rep,packed,name=recent_audit_failures,json=recentAuditFailures" json:"recent_audit_failures,omitempty"`
 }
 
 func (m *ContractHistory) Reset()                    { *m = ContractHistory{} }
@@ -210,48 +282,235 @@ func (m *ContractHistory) GetLastFailure() *google_protobuf.Timestamp {
 	return nil
 }
 
+func (m *ContractHistory) GetAuditsNumber() int64 {
+	if m != nil {
+		return m.AuditsNumber
+	}
+	return 0
+}
+
+func (m *ContractHistory) GetAuditsFailures() int64 {
+	if m != nil {
+		return m.AuditsFailures
+	}
+	return 0
+}
+
+func (m *ContractHistory) GetRecentReadsMs() []int64 {
+	if m != nil {
+		return m.RecentReadsMs
+	}
+	return nil
+}
+
+func (m *ContractHistory) GetBlacklisted() bool {
+	if m != nil {
+		return m.Blacklisted
+	}
+	return false
+}
+
+func (m *ContractHistory) GetRecentReadFailures() []bool {
+	if m != nil {
+		return m.RecentReadFailures
+	}
+	return nil
+}
+
+func (m *ContractHistory) GetRecentWriteFailures() []bool {
+	if m != nil {
+		return m.RecentWriteFailures
+	}
+	return nil
+}
+
+func (m *ContractHistory) GetRecentAuditFailures() []bool {
+	if m != nil {
+		return m.RecentAuditFailures
+	}
+	return nil
+}
+
+// Record of the journal. It contains new values of changed
+// sectors, sets and the lists of pending and released sectors.
+type Record struct {
+	Sectors     []*SectorUpdate `protobuf:"bytes,1,rep,name=sectors" json:"sectors,omitempty"`
+	Sets        []*SetUpdate    `protobuf:"bytes,2,rep,name=sets" json:"sets,omitempty"`
+	HasPending  bool            `protobuf:"varint,3,opt,name=has_pending,json=hasPending" json:"has_pending,omitempty"`
+	Pending     []int64         `protobuf:"zigzag64,4,rep,packed,name=pending" json:"pending,omitempty"`
+	HasReleased bool            `protobuf:"varint,5,opt,name=has_released,json=hasReleased" json:"has_released,omitempty"`
+	Released    []*Sector       `protobuf:"bytes,6,rep,name=released" json:"released,omitempty"`
+}
+
+func (m *Record) Reset()                    { *m = Record{} }
+func (m *Record) String() string            { return proto.CompactTextString(m) }
+func (*Record) ProtoMessage()               {}
+func (*Record) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{4} }
+
+func (m *Record) GetSectors() []*SectorUpdate {
+	if m != nil {
+		return m.Sectors
+	}
+	return nil
+}
+
+func (m *Record) GetSets() []*SetUpdate {
+	if m != nil {
+		return m.Sets
+	}
+	return nil
+}
+
+func (m *Record) GetHasPending() bool {
+	if m != nil {
+		return m.HasPending
+	}
+	return false
+}
+
+func (m *Record) GetPending() []int64 {
+	if m != nil {
+		return m.Pending
+	}
+	return nil
+}
+
+func (m *Record) GetHasReleased() bool {
+	if m != nil {
+		return m.HasReleased
+	}
+	return false
+}
+
+func (m *Record) GetReleased() []*Sector {
+	if m != nil {
+		return m.Released
+	}
+	return nil
+}
+
+type SectorUpdate struct {
+	Id     int64   `protobuf:"zigzag64,1,opt,name=id" json:"id,omitempty"`
+	Sector *Sector `protobuf:"bytes,2,opt,name=sector" json:"sector,omitempty"`
+	// Remove the sector.
+	Deleted bool `protobuf:"varint,3,opt,name=deleted" json:"deleted,omitempty"`
+}
+
+func (m *SectorUpdate) Reset()                    { *m = SectorUpdate{} }
+func (m *SectorUpdate) String() string            { return proto.CompactTextString(m) }
+func (*SectorUpdate) ProtoMessage()               {}
+func (*SectorUpdate) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{5} }
+
+func (m *SectorUpdate) GetId() int64 {
+	if m != nil {
+		return m.Id
+	}
+	return 0
+}
+
+func (m *SectorUpdate) GetSector() *Sector {
+	if m != nil {
+		return m.Sector
+	}
+	return nil
+}
+
+func (m *SectorUpdate) GetDeleted() bool {
+	if m != nil {
+		return m.Deleted
+	}
+	return false
+}
+
+type SetUpdate struct {
+	Index int32 `protobuf:"zigzag32,1,opt,name=index" json:"index,omitempty"`
+	Set   *Set  `protobuf:"bytes,2,opt,name=set" json:"set,omitempty"`
+}
+
+func (m *SetUpdate) Reset()                    { *m = SetUpdate{} }
+func (m *SetUpdate) String() string            { return proto.CompactTextString(m) }
+func (*SetUpdate) ProtoMessage()               {}
+func (*SetUpdate) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{6} }
+
+func (m *SetUpdate) GetIndex() int32 {
+	if m != nil {
+		return m.Index
+	}
+	return 0
+}
+
+func (m *SetUpdate) GetSet() *Set {
+	if m != nil {
+		return m.Set
+	}
+	return nil
+}
+
 func init() {
 	proto.RegisterType((*Db)(nil), "managerdb.Db")
 	proto.RegisterType((*Sector)(nil), "managerdb.Sector")
 	proto.RegisterType((*Set)(nil), "managerdb.Set")
 	proto.RegisterType((*ContractHistory)(nil), "managerdb.ContractHistory")
+	proto.RegisterType((*Record)(nil), "managerdb.Record")
+	proto.RegisterType((*SectorUpdate)(nil), "managerdb.SectorUpdate")
+	proto.RegisterType((*SetUpdate)(nil), "managerdb.SetUpdate")
 }
 
 func init() { proto.RegisterFile("managerdb.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 513 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x6c, 0x53, 0x5f, 0x6f, 0xd3, 0x3e,
-	0x14, 0x55, 0x92, 0xfe, 0x59, 0x6f, 0xb3, 0x76, 0xbd, 0xfa, 0xfd, 0x24, 0x53, 0x09, 0xad, 0x74,
-	0xa0, 0xe5, 0x29, 0x43, 0x83, 0x07, 0x84, 0x84, 0x78, 0x60, 0x20, 0xf6, 0x30, 0x84, 0xdc, 0xbd,
-	0xf0, 0x14, 0x39, 0x8d, 0x57, 0xa2, 0x25, 0x71, 0x65, 0xbb, 0xa0, 0xee, 0x43, 0xf0, 0xc5, 0xf8,
-	0x52, 0x28, 0x76, 0x1c, 0xd2, 0x89, 0xb7, 0xdc, 0x73, 0xce, 0x3d, 0xf7, 0xd8, 0x37, 0x86, 0x69,
-	0xc9, 0x2a, 0xb6, 0xe1, 0x32, 0x4b, 0xe3, 0xad, 0x14, 0x5a, 0xe0, 0xa8, 0x05, 0xe6, 0xa7, 0x1b,
-	0x21, 0x36, 0x05, 0xbf, 0x30, 0x44, 0xba, 0xbb, 0xbb, 0xd0, 0x79, 0xc9, 0x95, 0x66, 0xe5, 0xd6,
-	0x6a, 0x97, 0xbf, 0x03, 0xf0, 0xaf, 0x52, 0x7c, 0x0d, 0x43, 0xc5, 0xd7, 0x5a, 0x48, 0x45, 0xbc,
-	0x45, 0x10, 0x8d, 0x2f, 0xe7, 0xf1, 0x5f, 0xd7, 0xab, 0x34, 0x5e, 0x59, 0xf2, 0x63, 0xa5, 0xe5,
-	0x9e, 0x3a, 0x29, 0x2e, 0xa1, 0xa7, 0xb8, 0x56, 0xc4, 0x37, 0x2d, 0x93, 0x4e, 0xcb, 0x8a, 0x6b,
-	0x6a, 0x38, 0xfc, 0x0f, 0xfa, 0x55, 0xc6, 0x34, 0x23, 0xc1, 0xc2, 0x8b, 0x66, 0xd4, 0x16, 0x48,
-	0x60, 0x58, 0x6d, 0x99, 0xcc, 0xf5, 0x9e, 0xf4, 0x0c, 0xee, 0x4a, 0x3c, 0x85, 0xb1, 0xb5, 0x4f,
-	0x54, 0xfe, 0xc0, 0x49, 0xdf, 0xb0, 0x60, 0xa1, 0x55, 0xfe, 0xc0, 0xf1, 0x2b, 0xcc, 0xd6, 0xa2,
-	0xd2, 0x92, 0xad, 0xb5, 0x4a, 0xbe, 0xe7, 0x4a, 0x0b, 0xb9, 0x27, 0x03, 0x93, 0xe0, 0xec, 0x30,
-	0xf4, 0x07, 0x27, 0xfb, 0x6c, 0x55, 0x36, 0xfd, 0xc9, 0xfa, 0x11, 0x5c, 0x87, 0xd9, 0xf2, 0x2a,
-	0xcb, 0xab, 0x0d, 0x19, 0x2e, 0x82, 0x08, 0xa9, 0x2b, 0xe7, 0x37, 0x10, 0x76, 0x4f, 0x8e, 0x27,
-	0x10, 0xdc, 0xf3, 0x3d, 0xf1, 0x16, 0x5e, 0x84, 0xb4, 0xfe, 0xc4, 0x73, 0xe8, 0xff, 0x60, 0xc5,
-	0x8e, 0x13, 0x7f, 0xe1, 0x45, 0xe3, 0xcb, 0xd9, 0xc1, 0x1d, 0xd4, 0x9d, 0xd4, 0xf2, 0x6f, 0xfd,
-	0x37, 0xde, 0x3c, 0x81, 0xff, 0xff, 0x99, 0xa9, 0xeb, 0x3b, 0xb2, 0xbe, 0x2f, 0x0f, 0x7d, 0xbb,
-	0xeb, 0x70, 0x16, 0x8d, 0x43, 0x67, 0xc0, 0xf2, 0x1b, 0x0c, 0xec, 0x54, 0x9c, 0xc3, 0x91, 0x3b,
-	0xa7, 0xb1, 0x0d, 0x69, 0x5b, 0xd7, 0x57, 0x5c, 0x72, 0x79, 0x5f, 0xf0, 0x44, 0x0a, 0xa1, 0xcd,
-	0x84, 0x90, 0x82, 0x85, 0xa8, 0x10, 0x1a, 0x11, 0x7a, 0xed, 0xca, 0x42, 0x6a, 0xbe, 0x97, 0xef,
-	0x21, 0x58, 0x71, 0x8d, 0x4f, 0xe0, 0xa8, 0x2e, 0x93, 0x3c, 0xb3, 0x7f, 0x0a, 0xd2, 0x61, 0x5d,
-	0x5f, 0x67, 0x0a, 0x9f, 0x02, 0xd8, 0x1d, 0x1a, 0xd2, 0x37, 0xe4, 0xc8, 0x22, 0xd7, 0x99, 0x5a,
-	0xfe, 0xf2, 0x61, 0xfa, 0x28, 0x3a, 0x3e, 0x87, 0x89, 0xe4, 0x2c, 0x53, 0x89, 0x16, 0x9a, 0x15,
-	0x49, 0xa9, 0x9a, 0xab, 0x0d, 0x0d, 0x7a, 0x5b, 0x83, 0x37, 0x0a, 0x9f, 0x81, 0xad, 0x93, 0x6a,
-	0x57, 0xa6, 0x5c, 0x9a, 0xc0, 0x48, 0xc7, 0x06, 0xfb, 0x62, 0x20, 0x7c, 0xe1, 0x8c, 0xee, 0x58,
-	0x5e, 0xec, 0x24, 0x57, 0x26, 0x3b, 0xd2, 0x63, 0x83, 0x7e, 0x6a, 0x40, 0x3c, 0x83, 0xe3, 0x9f,
-	0x32, 0xd7, 0xbc, 0xb5, 0xea, 0xd9, 0x71, 0x16, 0x6c, 0xbc, 0xce, 0x61, 0xda, 0x88, 0x5a, 0xb3,
-	0xbe, 0x91, 0x4d, 0x2c, 0xdc, 0xba, 0xbd, 0x83, 0xb0, 0x60, 0x4a, 0x3b, 0x19, 0x19, 0x34, 0xab,
-	0xb2, 0x6f, 0x2e, 0x76, 0x6f, 0x2e, 0xbe, 0x75, 0x6f, 0x8e, 0x8e, 0x6b, 0x7d, 0xd3, 0x9f, 0x0e,
-	0x8c, 0xe0, 0xd5, 0x9f, 0x00, 0x00, 0x00, 0xff, 0xff, 0x9c, 0x9b, 0x2a, 0x99, 0xc0, 0x03, 0x00,
-	0x00,
+	// 841 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0x03, 0x85, 0x55, 0xdb, 0x6e, 0xd3, 0x40,
+	0x10, 0x55, 0xae, 0x4d, 0x26, 0xe9, 0x6d, 0x69, 0xc1, 0x44, 0x42, 0x2d, 0x29, 0xd0, 0xf0, 0x40,
+	0x0a, 0xe5, 0x22, 0x84, 0x84, 0x10, 0x6a, 0x41, 0xf0, 0x50, 0x84, 0x36, 0x45, 0x3c, 0x5a, 0x9b,
+	0x78, 0x9b, 0x98, 0x3a, 0x76, 0xea, 0xdd, 0x40, 0xc3, 0x37, 0x21, 0xf1, 0x0b, 0x7c, 0x13, 0x5f,
+	0xc0, 0xec, 0xac, 0xed, 0x38, 0xa1, 0x88, 0xa7, 0x78, 0xce, 0xcc, 0x9c, 0x3d, 0x3b, 0x33, 0x3b,
+	0x81, 0xf5, 0xb1, 0x08, 0xc5, 0x50, 0xc6, 0x5e, 0xbf, 0x3b, 0x89, 0x23, 0x1d, 0xb1, 0x7a, 0x06,
+	0xb4, 0x76, 0x86, 0x51, 0x34, 0x0c, 0xe4, 0x01, 0x39, 0xfa, 0xd3, 0xb3, 0x03, 0xed, 0x8f, 0xa5,
+	0xd2, 0x62, 0x3c, 0xb1, 0xb1, 0xed, 0x9f, 0x65, 0x28, 0x1e, 0xf7, 0xd9, 0x13, 0x58, 0x51, 0x72,
+	0xa0, 0xa3, 0x58, 0x39, 0x85, 0xdd, 0x52, 0xa7, 0x71, 0xd8, 0xea, 0xce, 0x59, 0x8f, 0xfb, 0xdd,
+	0x9e, 0x75, 0xbe, 0x09, 0x75, 0x3c, 0xe3, 0x69, 0x28, 0x6b, 0x43, 0x59, 0x49, 0xad, 0x9c, 0x22,
+	0xa5, 0xac, 0xe5, 0x52, 0x7a, 0x52, 0x73, 0xf2, 0xb1, 0x2d, 0xa8, 0x84, 0x9e, 0xd0, 0xc2, 0x29,
+	0xed, 0x16, 0x3a, 0x9b, 0xdc, 0x1a, 0xcc, 0x81, 0x95, 0x70, 0x22, 0x62, 0x5f, 0xcf, 0x9c, 0x32,
+	0xe1, 0xa9, 0xc9, 0x76, 0xa0, 0x61, 0xe9, 0x5d, 0xe5, 0x7f, 0x97, 0x4e, 0x85, 0xbc, 0x60, 0xa1,
+	0x1e, 0x22, 0xec, 0x23, 0x6c, 0x0e, 0x22, 0xd4, 0x21, 0x06, 0x5a, 0xb9, 0x23, 0x5f, 0x21, 0x3e,
+	0x73, 0xaa, 0xa4, 0x60, 0x6f, 0x51, 0xf4, 0x51, 0x1a, 0xf6, 0xce, 0x46, 0x59, 0xf5, 0x1b, 0x83,
+	0x25, 0xd8, 0x88, 0x99, 0xc8, 0xd0, 0xf3, 0xc3, 0xa1, 0xb3, 0x82, 0x3c, 0x8c, 0xa7, 0xa6, 0x11,
+	0xf3, 0x25, 0x9a, 0xc6, 0xa1, 0x08, 0x5c, 0x25, 0x2f, 0x9c, 0x1a, 0x8a, 0x29, 0x73, 0x48, 0xa0,
+	0x9e, 0xbc, 0x60, 0x0c, 0xca, 0xa1, 0xbc, 0xd4, 0x4e, 0x1d, 0x3d, 0x8c, 0xd3, 0x37, 0x7b, 0x00,
+	0xb5, 0x58, 0x06, 0x52, 0x28, 0xe9, 0x39, 0x40, 0xba, 0x36, 0x17, 0x2a, 0x63, 0x6e, 0xc2, 0xb3,
+	0x90, 0xd6, 0x09, 0x34, 0xf3, 0xd5, 0x65, 0x1b, 0x50, 0x3a, 0x97, 0x33, 0x6c, 0x83, 0x61, 0x34,
+	0x9f, 0x6c, 0x1f, 0x2a, 0x5f, 0x45, 0x30, 0x95, 0x58, 0xe7, 0xc2, 0xd5, 0x6c, 0xd6, 0xff, 0xa2,
+	0xf8, 0xbc, 0xd0, 0x72, 0x61, 0xfb, 0xca, 0x7b, 0xe7, 0x79, 0xeb, 0x96, 0xf7, 0xe1, 0x22, 0x6f,
+	0xbe, 0xe5, 0x29, 0x45, 0xc2, 0x90, 0x3b, 0xa0, 0xfd, 0xa3, 0x00, 0x55, 0x7b, 0x2c, 0x6b, 0x41,
+	0x2d, 0x2d, 0x26, 0xf1, 0x36, 0x79, 0x66, 0x9b, 0xd2, 0x8d, 0x65, 0x7c, 0x1e, 0x48, 0x37, 0x8e,
+	0x22, 0x4d, 0x47, 0x34, 0x39, 0x58, 0x88, 0x23, 0x62, 0x4a, 0x97, 0xcd, 0x45, 0x93, 0xd3, 0xb7,
+	0x49, 0x32, 0xbf, 0xae, 0x1a, 0x89, 0xc3, 0xa7, 0xcf, 0x68, 0x34, 0x30, 0xc9, 0x40, 0x3d, 0x42,
+	0xd8, 0x75, 0xa8, 0x8e, 0xa4, 0xf0, 0x64, 0x4c, 0x83, 0xd1, 0xe4, 0x89, 0x65, 0x5a, 0x38, 0x14,
+	0x71, 0x1f, 0xd5, 0xe3, 0x28, 0x14, 0x3a, 0x35, 0x9e, 0x9a, 0xed, 0x57, 0x50, 0xc2, 0x61, 0x64,
+	0x37, 0xa1, 0x46, 0xcc, 0xbe, 0x67, 0x27, 0x1c, 0x9b, 0x6c, 0xec, 0xf7, 0x9e, 0x62, 0xb7, 0x00,
+	0xec, 0xec, 0x91, 0xb3, 0x48, 0xce, 0xba, 0x45, 0xd0, 0xdd, 0xfe, 0x55, 0x86, 0xf5, 0xa5, 0x72,
+	0xb0, 0x3b, 0xb0, 0x16, 0xe3, 0xc1, 0xca, 0xd5, 0x91, 0xc6, 0xd9, 0x18, 0xab, 0xa4, 0x5d, 0x4d,
+	0x42, 0x4f, 0x0d, 0x78, 0xa2, 0xd8, 0x6d, 0xb0, 0xb6, 0x1b, 0x4e, 0xc7, 0x7d, 0x94, 0x5c, 0xa4,
+	0x98, 0x06, 0x61, 0x1f, 0x08, 0x62, 0x77, 0x53, 0xa2, 0x33, 0xe1, 0x07, 0xd3, 0x58, 0x2a, 0x2a,
+	0x07, 0xe3, 0xab, 0x84, 0xbe, 0x4d, 0x40, 0xb6, 0x07, 0xab, 0xdf, 0x50, 0x8f, 0xcc, 0xa8, 0xca,
+	0xf6, 0x38, 0x0b, 0x26, 0x5c, 0xfb, 0xb0, 0x9e, 0x04, 0x65, 0x64, 0x15, 0x0a, 0x5b, 0xb3, 0x70,
+	0xc6, 0xf6, 0x12, 0x9a, 0x81, 0x50, 0x3a, 0x0d, 0xa3, 0x8a, 0x99, 0xf6, 0xdb, 0x5d, 0xd1, 0x4d,
+	0x77, 0x45, 0xf7, 0x34, 0xdd, 0x15, 0xbc, 0x61, 0xe2, 0x93, 0x7c, 0x23, 0x46, 0x4c, 0x3d, 0x5f,
+	0x67, 0x62, 0x56, 0xac, 0x18, 0x0b, 0xce, 0xc5, 0x24, 0x41, 0x99, 0x98, 0x9a, 0x15, 0x63, 0xe1,
+	0x4c, 0xcc, 0x3d, 0x58, 0x8f, 0xe5, 0x40, 0x86, 0xda, 0xb5, 0x85, 0xc0, 0x5a, 0xd6, 0xa9, 0x05,
+	0xab, 0x16, 0xe6, 0x06, 0xc5, 0x62, 0xee, 0x42, 0xa3, 0x1f, 0x88, 0xc1, 0x79, 0x80, 0x2d, 0xa0,
+	0x87, 0x65, 0xba, 0x9c, 0x87, 0x70, 0x9c, 0xb7, 0x72, 0x4c, 0xf3, 0x73, 0x1b, 0x48, 0x57, 0xe3,
+	0x6c, 0x4e, 0x97, 0x9d, 0x7d, 0x08, 0xdb, 0x49, 0x06, 0x55, 0x68, 0x9e, 0xd2, 0xa4, 0x94, 0x6b,
+	0xd6, 0xf9, 0xd9, 0xf8, 0xae, 0xc8, 0xa1, 0x8b, 0xcc, 0x73, 0x56, 0xf3, 0x39, 0xaf, 0x8d, 0x2f,
+	0xcd, 0x69, 0xff, 0xc6, 0x27, 0xc3, 0xe5, 0x20, 0x8a, 0x3d, 0xf6, 0x68, 0x79, 0xd1, 0xde, 0xf8,
+	0xeb, 0x35, 0x7f, 0x9a, 0xe0, 0x64, 0xca, 0xf9, 0x96, 0xed, 0x2c, 0x6c, 0xd9, 0xad, 0xc5, 0x2d,
+	0x9b, 0x04, 0xdb, 0x5d, 0x8b, 0xcf, 0x67, 0x24, 0x94, 0x9b, 0x2e, 0xb3, 0x12, 0xd5, 0x08, 0x10,
+	0xfa, 0x98, 0xec, 0xb3, 0xdc, 0xa6, 0x2b, 0x2f, 0x6e, 0x3a, 0x9c, 0x55, 0x93, 0x9a, 0x2d, 0xae,
+	0x8a, 0xad, 0x2f, 0x62, 0x3c, 0x81, 0x16, 0xf6, 0x5a, 0xf5, 0xbf, 0x7b, 0xad, 0x3d, 0x48, 0xf7,
+	0x9a, 0x95, 0xc8, 0xd6, 0xa0, 0xe8, 0x7b, 0xc9, 0x3b, 0xc1, 0x2f, 0x76, 0x1f, 0xaa, 0xf6, 0x86,
+	0xff, 0x5e, 0x6b, 0x49, 0x80, 0x91, 0xed, 0x21, 0xad, 0xe9, 0xbb, 0xbd, 0x53, 0x6a, 0xb6, 0x8f,
+	0xa0, 0x9e, 0x15, 0xc1, 0xfc, 0xd5, 0xf8, 0xa1, 0x27, 0x2f, 0xe9, 0x10, 0xfc, 0xab, 0x21, 0x03,
+	0x07, 0xa7, 0x84, 0xc5, 0x49, 0x0e, 0x59, 0xfe, 0x8f, 0x32, 0xae, 0x7e, 0x95, 0x26, 0xfe, 0xf1,
+	0x1f, 0xd2, 0x87, 0x8e, 0x61, 0x49, 0x07, 0x00, 0x00,
 }
@@ -9,6 +9,8 @@ import (
 	"mime/multipart"
 	"net/http"
 	"net/url"
+
+	"golang.org/x/net/context"
 )
 
 type SiaClient struct {
@@ -31,7 +33,7 @@ type contractsJson struct {
 	Message string
 }
 
-func (s *SiaClient) Contracts() ([]string, error) {
+func (s *SiaClient) Contracts(ctx context.Context) ([]string, error) {
 	req := &http.Request{
 		Method: "GET",
 		URL: &url.URL{
@@ -43,7 +45,7 @@ func (s *SiaClient) Contracts() ([]string, error) {
 			"User-Agent": {"Sia-Agent"},
 		},
 	}
-	resp, err := s.client.Do(req)
+	resp, err := s.client.Do(req.WithContext(ctx))
 	if err != nil {
 		return nil, fmt.Errorf("client.Do: %v", err)
 	}
@@ -70,7 +72,30 @@ type readJson struct {
 	Message string
 }
 
-func (s *SiaClient) Read(contractID, sectorRoot string, i int64) ([]byte, error) {
+func (s *SiaClient) Read(ctx context.Context, contractID, sectorRoot string, i int64) ([]byte, error) {
+	return s.read(ctx, contractID, sectorRoot, "")
+}
+
+func (s *SiaClient) ReadAt(ctx context.Context, contractID, sectorRoot string, i int64, offset, length int) ([]byte, error) {
+	if length == 0 {
+		return []byte{}, nil
+	}
+	rng := fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)
+	body, err := s.read(ctx, contractID, sectorRoot, rng)
+	if err != nil {
+		return nil, err
+	}
+	if len(body) == length {
+		return body, nil
+	}
+	// Range is not supported, the whole sector was returned.
+	if offset+length > len(body) {
+		return nil, fmt.Errorf("len(body) is %d, range is [%d,%d).", len(body), offset, offset+length)
+	}
+	return body[offset : offset+length], nil
+}
+
+func (s *SiaClient) read(ctx context.Context, contractID, sectorRoot, rng string) ([]byte, error) {
 	path2 := "/renter/read/" + contractID + "/" + sectorRoot
 	req := &http.Request{
 		Method: "GET",
@@ -83,7 +108,10 @@ func (s *SiaClient) Read(contractID, sectorRoot string, i int64) ([]byte, error)
 			"User-Agent": {"Sia-Agent"},
 		},
 	}
-	resp, err := s.client.Do(req)
+	if rng != "" {
+		req.Header.Set("Range", rng)
+	}
+	resp, err := s.client.Do(req.WithContext(ctx))
 	if err != nil {
 		return nil, fmt.Errorf("client.Do: %v.", err)
 	}
@@ -92,7 +120,7 @@ func (s *SiaClient) Read(contractID, sectorRoot string, i int64) ([]byte, error)
 	if err != nil {
 		return nil, fmt.Errorf("ioutil.ReadAll(resp.Body): %v.", err)
 	}
-	if resp.StatusCode != http.StatusOK {
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
 		var rr readJson
 		if err := json.Unmarshal(body, &rr); err != nil {
 			return nil, fmt.Errorf("HTTP status: %s; json.Unmarshal(body): %v.", resp.Status, err)
@@ -107,7 +135,7 @@ type writeJson struct {
 	Message    string
 }
 
-func (s *SiaClient) Write(contractID string, data []byte, i int64) (string, error) {
+func (s *SiaClient) Write(ctx context.Context, contractID string, data []byte, i int64) (string, error) {
 	log.Printf("SiaClient.Write(%q) start\n", contractID)
 	defer log.Printf("SiaClient.Write(%q) stop\n", contractID)
 	body := &bytes.Buffer{}
@@ -129,7 +157,7 @@ func (s *SiaClient) Write(contractID string, data []byte, i int64) (string, erro
 	}
 	req.Header.Set("User-Agent", "Sia-Agent")
 	req.Header.Set("Content-Type", writer.FormDataContentType())
-	resp, err := s.client.Do(req)
+	resp, err := s.client.Do(req.WithContext(ctx))
 	if err != nil {
 		return "", fmt.Errorf("client.Do: %v.", err)
 	}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+
+	"github.com/starius/invisiblefs/siaform/crypto"
+)
+
+var (
+	dataDir    = flag.String("data-dir", "data-dir", "Directory to store databases")
+	keyFile    = flag.String("key-file", "", "File with current key")
+	newKeyFile = flag.String("new-key-file", "", "File with new key")
+)
+
+func main() {
+	flag.Parse()
+	if *keyFile == "" || *newKeyFile == "" {
+		flag.PrintDefaults()
+		log.Fatal("Provide -key-file and -new-key-file.")
+	}
+	key, err := ioutil.ReadFile(*keyFile)
+	if err != nil {
+		log.Fatalf("ioutil.ReadFile(%q): %v.", *keyFile, err)
+	}
+	newKey, err := ioutil.ReadFile(*newKeyFile)
+	if err != nil {
+		log.Fatalf("ioutil.ReadFile(%q): %v.", *newKeyFile, err)
+	}
+	keyringFile := filepath.Join(*dataDir, "keyring")
+	if err := crypto.Rekey(keyringFile, key, newKey); err != nil {
+		log.Fatalf("crypto.Rekey(%q): %v.", keyringFile, err)
+	}
+	log.Printf("The data key is wrapped with the new key.")
+}
@@ -5,6 +5,8 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+
+	"golang.org/x/net/context"
 )
 
 type FsKV struct {
@@ -17,7 +19,7 @@ func New(root string) (*FsKV, error) {
 	}, nil
 }
 
-func (f *FsKV) Has(key string) (bool, []byte, error) {
+func (f *FsKV) Has(ctx context.Context, key string) (bool, []byte, error) {
 	path := filepath.Join(f.root, key)
 	_, err := os.Stat(path)
 	if err == nil {
@@ -29,13 +31,13 @@ func (f *FsKV) Has(key string) (bool, []byte, error) {
 	}
 }
 
-func (f *FsKV) Get(key string) ([]byte, []byte, error) {
+func (f *FsKV) Get(ctx context.Context, key string) ([]byte, []byte, error) {
 	path := filepath.Join(f.root, key)
 	data, err := ioutil.ReadFile(path)
 	return data, nil, err
 }
 
-func (f *FsKV) GetAt(key string, offset, size int) ([]byte, []byte, error) {
+func (f *FsKV) GetAt(ctx context.Context, key string, offset, size int) ([]byte, []byte, error) {
 	path := filepath.Join(f.root, key)
 	bf, err := os.Open(path)
 	if err != nil {
@@ -52,11 +54,11 @@ func (f *FsKV) GetAt(key string, offset, size int) ([]byte, []byte, error) {
 	return buf, nil, nil
 }
 
-func (f *FsKV) List() (map[string]int, error) {
+func (f *FsKV) List(ctx context.Context) (map[string]int, error) {
 	return nil, fmt.Errorf("fskv doesn't support List")
 }
 
-func (f *FsKV) Put(key string, value, metadata []byte) error {
+func (f *FsKV) Put(ctx context.Context, key string, value, metadata []byte) error {
 	if len(metadata) > 0 {
 		return fmt.Errorf("fskv doesn't support metadata")
 	}
@@ -64,15 +66,15 @@ func (f *FsKV) Put(key string, value, metadata []byte) error {
 	return ioutil.WriteFile(path, value, 0600)
 }
 
-func (f *FsKV) Link(dstKey, srcKey string, metadata []byte) error {
+func (f *FsKV) Link(ctx context.Context, dstKey, srcKey string, metadata []byte) error {
 	return fmt.Errorf("fskv doesn't support Link")
 }
 
-func (f *FsKV) Delete(key string) ([]byte, error) {
+func (f *FsKV) Delete(ctx context.Context, key string) ([]byte, error) {
 	path := filepath.Join(f.root, key)
 	return nil, os.Remove(path)
 }
 
-func (f *FsKV) Sync() error {
+func (f *FsKV) Sync(ctx context.Context) error {
 	return nil
 }
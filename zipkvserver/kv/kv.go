@@ -1,12 +1,29 @@
 package kv
 
+import (
+	"time"
+
+	"golang.org/x/net/context"
+)
+
 type KV interface {
-	Has(key string) (bool, []byte, error)
-	Get(key string) ([]byte, []byte, error)
-	GetAt(key string, offset, size int) ([]byte, []byte, error)
-	List() (map[string]int, error)
-	Put(key string, value, metadata []byte) error
-	Link(dstKey, srcKey string, metadata []byte) error
-	Delete(key string) (metadata []byte, err error)
-	Sync() error
+	Has(ctx context.Context, key string) (bool, []byte, error)
+	Get(ctx context.Context, key string) ([]byte, []byte, error)
+	GetAt(ctx context.Context, key string, offset, size int) ([]byte, []byte, error)
+	List(ctx context.Context) (map[string]int, error)
+	Put(ctx context.Context, key string, value, metadata []byte) error
+	Link(ctx context.Context, dstKey, srcKey string, metadata []byte) error
+	Delete(ctx context.Context, key string) (metadata []byte, err error)
+	Sync(ctx context.Context) error
+}
+
+// RetryableError is returned by KV methods which failed temporarily,
+// e.g. because the backend is overloaded. Retry after RetryAfter.
+type RetryableError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *RetryableError) Error() string {
+	return e.Err.Error()
 }
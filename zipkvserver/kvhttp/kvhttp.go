@@ -7,7 +7,9 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/NebulousLabs/fastrand"
 	"github.com/golang/protobuf/proto"
@@ -25,6 +27,14 @@ const (
   <Message>The resource you requested does not exist</Message>
   <Resource>%s</Resource>
   <RequestId>%s</RequestId>
+</Error>
+	`
+	xml503 = `<?xml version="1.0" encoding="UTF-8"?>
+<Error>
+  <Code>SlowDown</Code>
+  <Message>Please reduce your request rate</Message>
+  <Resource>%s</Resource>
+  <RequestId>%s</RequestId>
 </Error>
 	`
 	xmlCopy = `<?xml version="1.0" encoding="UTF-8"?>
@@ -83,6 +93,23 @@ func writeMetadata(w http.ResponseWriter, metadata []byte) error {
 	return nil
 }
 
+// writeRetry reports a temporary failure if err is kv.RetryableError.
+func writeRetry(w http.ResponseWriter, key string, err error) bool {
+	re, ok := err.(*kv.RetryableError)
+	if !ok {
+		return false
+	}
+	seconds := int((re.RetryAfter + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	w.Write([]byte(fmt.Sprintf(xml503, key, genRequestId())))
+	return true
+}
+
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	key := r.URL.Path
 	log.Printf("%s %s?%s", r.Method, key, r.URL.RawQuery)
@@ -91,9 +118,11 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	key = strings.TrimPrefix(key, h.baseURL)
+	// Canceled if the client goes away.
+	ctx := r.Context()
 	if r.Method == "GET" && key == "" {
 		prefix := r.URL.Query().Get("prefix")
-		list, err := h.kv.List()
+		list, err := h.kv.List(ctx)
 		if err != nil {
 			log.Printf("List(): %s", err)
 			w.WriteHeader(http.StatusInternalServerError)
@@ -125,7 +154,7 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	} else if r.Method == "GET" || r.Method == "HEAD" {
 		// TODO Range: bytes.
-		value, metadata, err := h.kv.Get(key)
+		value, metadata, err := h.kv.Get(ctx, key)
 		if err != nil {
 			log.Printf("Get(%q): %s", key, err)
 			w.Header().Set("Content-Type", "application/xml")
@@ -172,7 +201,7 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			// http://docs.aws.amazon.com/AmazonS3/latest/API/RESTObjectCOPY.html
 			copySource := strings.TrimPrefix(copySource, h.baseURL)
 			log.Printf("x-amz-copy-source: %s", copySource)
-			has, srcMd, err := h.kv.Has(copySource)
+			has, srcMd, err := h.kv.Has(ctx, copySource)
 			if err != nil {
 				log.Printf("h.kv.Has(%q): %s", copySource, err)
 				w.WriteHeader(http.StatusInternalServerError)
@@ -194,8 +223,11 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 				w.WriteHeader(http.StatusBadRequest)
 				return
 			}
-			if err := h.kv.Link(key, copySource, metadata); err != nil {
+			if err := h.kv.Link(ctx, key, copySource, metadata); err != nil {
 				log.Printf("h.kv.Has(%q): %s", copySource, err)
+				if writeRetry(w, key, err) {
+					return
+				}
 				w.WriteHeader(http.StatusInternalServerError)
 				return
 			}
@@ -214,8 +246,11 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
-		if err := h.kv.Put(key, value, metadata); err != nil {
+		if err := h.kv.Put(ctx, key, value, metadata); err != nil {
 			log.Printf("Put(%q): %s", key, err)
+			if writeRetry(w, key, err) {
+				return
+			}
 			w.WriteHeader(http.StatusBadGateway)
 			return
 		}
@@ -224,7 +259,7 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		return
 	} else if r.Method == "DELETE" {
-		if _, err := h.kv.Delete(key); err != nil {
+		if _, err := h.kv.Delete(ctx, key); err != nil {
 			log.Printf("Delete(%q): %s", key, err)
 			w.WriteHeader(http.StatusNotFound)
 			return
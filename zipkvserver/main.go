@@ -14,6 +14,7 @@ import (
 	"github.com/starius/invisiblefs/zipkvserver/fskv"
 	"github.com/starius/invisiblefs/zipkvserver/kvhttp"
 	"github.com/starius/invisiblefs/zipkvserver/zipkv"
+	"golang.org/x/net/context"
 )
 
 var (
@@ -55,7 +56,7 @@ func main() {
 		for signal := range c {
 			fmt.Printf("Caught %s.\n", signal)
 			fmt.Printf("Writting the remaining files to %s.\n", *dir)
-			if err := fe.Sync(); err != nil {
+			if err := fe.Sync(context.Background()); err != nil {
 				fmt.Printf("Failed to write: %s.\n", err)
 				continue
 			}
@@ -3,6 +3,8 @@ package mem
 import (
 	"fmt"
 	"sync"
+
+	"golang.org/x/net/context"
 )
 
 type file struct {
@@ -20,7 +22,7 @@ func New() (*Mem, error) {
 	}, nil
 }
 
-func (m *Mem) Has(key string) (bool, []byte, error) {
+func (m *Mem) Has(ctx context.Context, key string) (bool, []byte, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 	if f, has := m.files[key]; has {
@@ -30,7 +32,7 @@ func (m *Mem) Has(key string) (bool, []byte, error) {
 	}
 }
 
-func (m *Mem) Get(key string) ([]byte, []byte, error) {
+func (m *Mem) Get(ctx context.Context, key string) ([]byte, []byte, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 	if f, has := m.files[key]; has {
@@ -40,7 +42,7 @@ func (m *Mem) Get(key string) ([]byte, []byte, error) {
 	}
 }
 
-func (m *Mem) GetAt(key string, offset, size int) ([]byte, []byte, error) {
+func (m *Mem) GetAt(ctx context.Context, key string, offset, size int) ([]byte, []byte, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 	if offset < 0 {
@@ -62,7 +64,7 @@ func (m *Mem) GetAt(key string, offset, size int) ([]byte, []byte, error) {
 	}
 }
 
-func (m *Mem) List() (map[string]int, error) {
+func (m *Mem) List(ctx context.Context) (map[string]int, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 	result := make(map[string]int)
@@ -72,7 +74,7 @@ func (m *Mem) List() (map[string]int, error) {
 	return result, nil
 }
 
-func (m *Mem) Put(key string, value, metadata []byte) error {
+func (m *Mem) Put(ctx context.Context, key string, value, metadata []byte) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	value1 := make([]byte, len(value))
@@ -84,7 +86,7 @@ func (m *Mem) Put(key string, value, metadata []byte) error {
 	return nil
 }
 
-func (m *Mem) Link(dstKey, srcKey string, metadata []byte) error {
+func (m *Mem) Link(ctx context.Context, dstKey, srcKey string, metadata []byte) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	f, has := m.files[srcKey]
@@ -98,7 +100,7 @@ func (m *Mem) Link(dstKey, srcKey string, metadata []byte) error {
 	return nil
 }
 
-func (m *Mem) Delete(key string) ([]byte, error) {
+func (m *Mem) Delete(ctx context.Context, key string) ([]byte, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	f, has := m.files[key]
@@ -109,6 +111,6 @@ func (m *Mem) Delete(key string) ([]byte, error) {
 	return f.metadata, nil
 }
 
-func (m *Mem) Sync() error {
+func (m *Mem) Sync(ctx context.Context) error {
 	return nil
 }
@@ -6,38 +6,39 @@ import (
 	"testing"
 
 	"github.com/starius/invisiblefs/zipkvserver/kv"
+	"golang.org/x/net/context"
 )
 
 func TestEmpty(t *testing.T, k kv.KV) {
-	if has, _, err := k.Has("file"); err != nil {
+	if has, _, err := k.Has(context.Background(), "file"); err != nil {
 		t.Errorf("k.Has: %s.", err)
 	} else if has != false {
 		t.Errorf("k.Has returned %#v, want false.", has)
 	}
-	if _, _, err := k.Get("file"); err == nil {
+	if _, _, err := k.Get(context.Background(), "file"); err == nil {
 		t.Errorf("k.Get returned no error for absent file.")
 	}
-	if _, _, err := k.GetAt("file", 1, 2); err == nil {
+	if _, _, err := k.GetAt(context.Background(), "file", 1, 2); err == nil {
 		t.Errorf("k.GetAt returned no error for absent file.")
 	}
 }
 
 func TestPut(t *testing.T, k kv.KV) {
 	data0 := []byte{1, 2, 3, 4, 5, 6, 7, 8, 9}
-	if err := k.Put("file", data0, nil); err != nil {
+	if err := k.Put(context.Background(), "file", data0, nil); err != nil {
 		t.Fatalf("k.Put: %s.", err)
 	}
-	if has, _, err := k.Has("file"); err != nil {
+	if has, _, err := k.Has(context.Background(), "file"); err != nil {
 		t.Errorf("k.Has: %s.", err)
 	} else if has != true {
 		t.Errorf("k.Has returned %#v, want true.", has)
 	}
-	if data, _, err := k.Get("file"); err != nil {
+	if data, _, err := k.Get(context.Background(), "file"); err != nil {
 		t.Errorf("k.Get: %s.", err)
 	} else if !bytes.Equal(data, data0) {
 		t.Errorf("k.Get returned %#v, want %#v.", data, data0)
 	}
-	if data, _, err := k.GetAt("file", 1, 2); err != nil {
+	if data, _, err := k.GetAt(context.Background(), "file", 1, 2); err != nil {
 		t.Errorf("k.GetAt: %s.", err)
 	} else if !bytes.Equal(data, data0[1:1+2]) {
 		t.Errorf("k.GetAt returned %#v, want %#v.", data, data0[1:2])
@@ -52,21 +53,21 @@ func TestPutLarge(t *testing.T, k kv.KV) {
 		data0[i] = byte(a)
 		a, b = b, (a+b)%256
 	}
-	if err := k.Put("file", data0, nil); err != nil {
+	if err := k.Put(context.Background(), "file", data0, nil); err != nil {
 		t.Fatalf("k.Put: %s.", err)
 	}
-	if has, _, err := k.Has("file"); err != nil {
+	if has, _, err := k.Has(context.Background(), "file"); err != nil {
 		t.Errorf("k.Has: %s.", err)
 	} else if has != true {
 		t.Errorf("k.Has returned %#v, want true.", has)
 	}
-	if data, _, err := k.Get("file"); err != nil {
+	if data, _, err := k.Get(context.Background(), "file"); err != nil {
 		t.Errorf("k.Get: %s.", err)
 	} else if !bytes.Equal(data, data0) {
 		t.Errorf("k.Get returned %#v, want %#v.", data, data0)
 	}
 	data0s := data0[10000 : 10000+20000]
-	if data, _, err := k.GetAt("file", 10000, 20000); err != nil {
+	if data, _, err := k.GetAt(context.Background(), "file", 10000, 20000); err != nil {
 		t.Errorf("k.GetAt: %s.", err)
 	} else if !bytes.Equal(data, data0s) {
 		t.Errorf("k.GetAt returned %#v, want %#v.", data, data0s)
@@ -81,8 +82,8 @@ func TestPutMany1(t *testing.T, k kv.KV, n int) {
 		for j := 0; j < len(data0); j++ {
 			data0[j] = byte((i + j) % 256)
 		}
-		if err := k.Put(key, data0, nil); err != nil {
-			t.Fatalf("k.Put(%q): %s.", key, err)
+		if err := k.Put(context.Background(), key, data0, nil); err != nil {
+			t.Fatalf("k.Put(context.Background(), %q): %s.", key, err)
 		}
 	}
 }
@@ -95,18 +96,18 @@ func TestPutMany2(t *testing.T, k kv.KV, n int) {
 		for j := 0; j < len(data0); j++ {
 			data0[j] = byte((i + j) % 256)
 		}
-		if has, _, err := k.Has(key); err != nil {
+		if has, _, err := k.Has(context.Background(), key); err != nil {
 			t.Errorf("k.Has: %s.", err)
 		} else if has != true {
 			t.Errorf("k.Has returned %#v, want true.", has)
 		}
-		if data, _, err := k.Get(key); err != nil {
+		if data, _, err := k.Get(context.Background(), key); err != nil {
 			t.Errorf("k.Get: %s.", err)
 		} else if !bytes.Equal(data, data0) {
 			t.Errorf("k.Get returned %#v, want %#v.", data, data0)
 		}
 		data0s := data0[100 : 100+200]
-		if data, _, err := k.GetAt(key, 100, 200); err != nil {
+		if data, _, err := k.GetAt(context.Background(), key, 100, 200); err != nil {
 			t.Errorf("k.GetAt: %s.", err)
 		} else if !bytes.Equal(data, data0s) {
 			t.Errorf("k.GetAt returned %#v, want %#v.", data, data0s)
@@ -122,21 +123,21 @@ func TestPutMany(t *testing.T, k kv.KV) {
 
 func TestDelete(t *testing.T, k kv.KV) {
 	data0 := []byte{1, 2, 3, 4, 5, 6, 7, 8, 9}
-	if err := k.Put("file", data0, nil); err != nil {
+	if err := k.Put(context.Background(), "file", data0, nil); err != nil {
 		t.Fatalf("k.Put: %s.", err)
 	}
-	if _, err := k.Delete("file"); err != nil {
+	if _, err := k.Delete(context.Background(), "file"); err != nil {
 		t.Fatalf("k.Delete: %s.", err)
 	}
-	if has, _, err := k.Has("file"); err != nil {
+	if has, _, err := k.Has(context.Background(), "file"); err != nil {
 		t.Errorf("k.Has: %s.", err)
 	} else if has != false {
 		t.Errorf("k.Has returned %#v, want false.", has)
 	}
-	if _, _, err := k.Get("file"); err == nil {
+	if _, _, err := k.Get(context.Background(), "file"); err == nil {
 		t.Errorf("k.Get returned no error for absent file.")
 	}
-	if _, _, err := k.GetAt("file", 1, 2); err == nil {
+	if _, _, err := k.GetAt(context.Background(), "file", 1, 2); err == nil {
 		t.Errorf("k.GetAt returned no error for absent file.")
 	}
 }
@@ -7,6 +7,7 @@ import (
 	"github.com/golang/protobuf/proto"
 	"github.com/starius/invisiblefs/gzip"
 	"github.com/starius/invisiblefs/zipkvserver/kv"
+	"golang.org/x/net/context"
 )
 
 //go:generate protoc --proto_path=. --go_out=. db.proto
@@ -21,7 +22,7 @@ func Zip(backend kv.KV, maxValueSize int, rev int) (*Frontend, error) {
 		be:  backend,
 		max: maxValueSize,
 	}
-	if err := fe.setupDb(rev); err != nil {
+	if err := fe.setupDb(context.Background(), rev); err != nil {
 		return nil, err
 	}
 	return fe, nil
@@ -45,10 +46,10 @@ func (f *Frontend) blockName(i int32) string {
 	return fmt.Sprintf("block%010d", i)
 }
 
-func (f *Frontend) findDb() (int, error) {
+func (f *Frontend) findDb(ctx context.Context) (int, error) {
 	for i := 0; i <= maxDbName; i++ {
 		dbname := f.dbName(i)
-		if has, _, err := f.be.Has(dbname); err != nil {
+		if has, _, err := f.be.Has(ctx, dbname); err != nil {
 			return 0, fmt.Errorf("f.be.Has(%q): %s", dbname, err)
 		} else if has {
 			return i, nil
@@ -57,15 +58,15 @@ func (f *Frontend) findDb() (int, error) {
 	return -1, nil
 }
 
-func (f *Frontend) setupDb(rev int) error {
+func (f *Frontend) setupDb(ctx context.Context, rev int) error {
 	f.files = make(map[string]*Location)
-	i, err := f.findDb()
+	i, err := f.findDb(ctx)
 	if err != nil {
 		return err
 	}
 	if i != -1 {
 		dbname := f.dbName(i)
-		zdata, _, err := f.be.Get(dbname)
+		zdata, _, err := f.be.Get(ctx, dbname)
 		if err != nil {
 			return fmt.Errorf("f.be.Get(%q): %s", dbname, err)
 		}
@@ -104,7 +105,7 @@ func (f *Frontend) setupDb(rev int) error {
 	return nil
 }
 
-func (f *Frontend) Has(key string) (bool, []byte, error) {
+func (f *Frontend) Has(ctx context.Context, key string) (bool, []byte, error) {
 	f.m.RLock()
 	defer f.m.RUnlock()
 	loc, has := f.files[key]
@@ -115,7 +116,7 @@ func (f *Frontend) Has(key string) (bool, []byte, error) {
 	}
 }
 
-func (f *Frontend) Get(key string) ([]byte, []byte, error) {
+func (f *Frontend) Get(ctx context.Context, key string) ([]byte, []byte, error) {
 	f.m.RLock()
 	loc, has := f.files[key]
 	if !has {
@@ -129,11 +130,11 @@ func (f *Frontend) Get(key string) ([]byte, []byte, error) {
 	}
 	f.m.RUnlock()
 	blockname := f.blockName(loc.BackendFile)
-	data, _, err := f.be.GetAt(blockname, int(loc.Offset), int(loc.Size))
+	data, _, err := f.be.GetAt(ctx, blockname, int(loc.Offset), int(loc.Size))
 	return data, loc.Metadata, err
 }
 
-func (f *Frontend) GetAt(key string, offset, size int) ([]byte, []byte, error) {
+func (f *Frontend) GetAt(ctx context.Context, key string, offset, size int) ([]byte, []byte, error) {
 	f.m.RLock()
 	loc, has := f.files[key]
 	if !has {
@@ -156,11 +157,11 @@ func (f *Frontend) GetAt(key string, offset, size int) ([]byte, []byte, error) {
 	}
 	f.m.RUnlock()
 	blockname := f.blockName(loc.BackendFile)
-	data, _, err := f.be.GetAt(blockname, offset2, size)
+	data, _, err := f.be.GetAt(ctx, blockname, offset2, size)
 	return data, loc.Metadata, err
 }
 
-func (f *Frontend) List() (map[string]int, error) {
+func (f *Frontend) List(ctx context.Context) (map[string]int, error) {
 	sizes := make(map[string]int)
 	for key, loc := range f.files {
 		sizes[key] = int(loc.Size)
@@ -168,7 +169,7 @@ func (f *Frontend) List() (map[string]int, error) {
 	return sizes, nil
 }
 
-func (f *Frontend) writeDb() error {
+func (f *Frontend) writeDb(ctx context.Context) error {
 	// Call this function under f.m.Lock().
 	data, err := proto.Marshal(f.db)
 	if err != nil {
@@ -180,12 +181,12 @@ func (f *Frontend) writeDb() error {
 	}
 	nextDb := (f.currDb + 1) % (maxDbName + 1)
 	dbname := f.dbName(nextDb)
-	if err := f.be.Put(dbname, zdata, nil); err != nil {
+	if err := f.be.Put(ctx, dbname, zdata, nil); err != nil {
 		return fmt.Errorf("f.be.Put(%q, ...): %s", dbname, err)
 	}
 	if f.currDb != -1 {
 		prevname := f.dbName(f.currDb)
-		if _, err := f.be.Delete(prevname); err != nil {
+		if _, err := f.be.Delete(ctx, prevname); err != nil {
 			return fmt.Errorf("f.be.Delete(%q): %s", prevname, err)
 		}
 	}
@@ -193,28 +194,28 @@ func (f *Frontend) writeDb() error {
 	return nil
 }
 
-func (f *Frontend) writeNext() error {
+func (f *Frontend) writeNext(ctx context.Context) error {
 	// Call this function under f.m.Lock().
 	blockname := f.blockName(f.db.NextBackendFile)
-	if err := f.be.Put(blockname, f.next, nil); err != nil {
+	if err := f.be.Put(ctx, blockname, f.next, nil); err != nil {
 		return fmt.Errorf("f.be.Put(%q, ...): %s", blockname, err)
 	}
 	f.db.NextBackendFile++
-	if err := f.writeDb(); err != nil {
+	if err := f.writeDb(ctx); err != nil {
 		return fmt.Errorf("f.writeDb(): %s", err)
 	}
 	f.next = f.next[:0]
 	return nil
 }
 
-func (f *Frontend) Put(key string, value, metadata []byte) error {
+func (f *Frontend) Put(ctx context.Context, key string, value, metadata []byte) error {
 	if len(value) > f.max {
 		return fmt.Errorf("%d > %d", len(value), f.max)
 	}
 	f.m.Lock()
 	defer f.m.Unlock()
 	if len(f.next)+len(value) > f.max {
-		if err := f.writeNext(); err != nil {
+		if err := f.writeNext(ctx); err != nil {
 			return fmt.Errorf("f.writeNext(): %s", err)
 		}
 	}
@@ -237,7 +238,7 @@ func (f *Frontend) Put(key string, value, metadata []byte) error {
 	return nil
 }
 
-func (f *Frontend) Link(dstKey, srcKey string, metadata []byte) error {
+func (f *Frontend) Link(ctx context.Context, dstKey, srcKey string, metadata []byte) error {
 	f.m.Lock()
 	defer f.m.Unlock()
 	loc, has := f.files[srcKey]
@@ -259,7 +260,7 @@ func (f *Frontend) Link(dstKey, srcKey string, metadata []byte) error {
 	return nil
 }
 
-func (f *Frontend) Delete(key string) (metadata []byte, err error) {
+func (f *Frontend) Delete(ctx context.Context, key string) (metadata []byte, err error) {
 	f.m.Lock()
 	defer f.m.Unlock()
 	loc, has := f.files[key]
@@ -277,11 +278,11 @@ func (f *Frontend) Delete(key string) (metadata []byte, err error) {
 	return loc.Metadata, nil
 }
 
-func (f *Frontend) Sync() error {
+func (f *Frontend) Sync(ctx context.Context) error {
 	f.m.Lock()
 	defer f.m.Unlock()
 	if len(f.next) > 0 {
-		if err := f.writeNext(); err != nil {
+		if err := f.writeNext(ctx); err != nil {
 			return fmt.Errorf("f.writeNext(): %s", err)
 		}
 	}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/starius/invisiblefs/zipkvserver/mem"
 	"github.com/starius/invisiblefs/zipkvserver/tests"
+	"golang.org/x/net/context"
 )
 
 func instance(size int) (*Frontend, error) {
@@ -66,7 +67,7 @@ func TestReload(t *testing.T) {
 		t.Fatalf("Failed to create Frontend: %s.", err)
 	}
 	tests.TestPutMany1(t, kv1, 10*1000)
-	if err := kv1.Sync(); err != nil {
+	if err := kv1.Sync(context.Background()); err != nil {
 		t.Fatalf("Failed to sync: %s.", err)
 	}
 	kv2, err := Zip(m, 2*1000*1000, -1)
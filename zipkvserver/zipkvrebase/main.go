@@ -6,6 +6,7 @@ import (
 
 	"github.com/starius/invisiblefs/zipkvserver/fskv"
 	"github.com/starius/invisiblefs/zipkvserver/zipkv"
+	"golang.org/x/net/context"
 )
 
 var (
@@ -41,20 +42,21 @@ func main() {
 	if len(toFe.History()) > 0 {
 		log.Fatalf("Destination is not empty.")
 	}
-	list, err := fromFe.List()
+	ctx := context.Background()
+	list, err := fromFe.List(ctx)
 	if err != nil {
 		log.Fatalf("Failed to get list of files: %s.", err)
 	}
 	for key, _ := range list {
-		data, metadata, err := fromFe.Get(key)
+		data, metadata, err := fromFe.Get(ctx, key)
 		if err != nil {
 			log.Fatalf("Get(%q): %s.", key, err)
 		}
-		if err := toFe.Put(key, data, metadata); err != nil {
+		if err := toFe.Put(ctx, key, data, metadata); err != nil {
 			log.Fatalf("Put(%q): %s.", key, err)
 		}
 	}
-	if err := toFe.Sync(); err != nil {
+	if err := toFe.Sync(ctx); err != nil {
 		log.Fatalf("Failed to sync: %s.", err)
 	}
 }